@@ -0,0 +1,291 @@
+package business
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	m "library/internal/app/models"
+
+	"gopkg.in/yaml.v2"
+)
+
+//Content types of the inventory formats
+var inventoryContentTypes = map[string]string{
+	"json": "application/json",
+	"yaml": "application/x-yaml",
+	"csv":  "text/csv",
+}
+
+//Fixed CSV columns; every other column holds the value of a field, named fields.{key}
+var inventoryCSVColumns = []string{"name", "description", "template", "projects", "active"}
+
+// InventoryFormat picks the inventory format from the format query parameter, falling back on the content type of the request
+// Args:	format query parameter, content type
+// Rets:	format, error
+func InventoryFormat(format string, contentType string) (string, error) {
+	var err error
+
+	if format == "" {
+		format = "json"
+
+		for f, ctype := range inventoryContentTypes {
+			if strings.HasPrefix(contentType, ctype) || (f == "yaml" && strings.Contains(contentType, "yaml")) {
+				format = f
+			}
+		}
+	}
+
+	if _, ok := inventoryContentTypes[format]; !ok {
+		err = fmt.Errorf("error: unknown inventory format %s", format)
+	}
+
+	return format, err
+}
+
+// InventoryContentType returns the content type of an inventory format
+func InventoryContentType(format string) string {
+	return inventoryContentTypes[format]
+}
+
+// encodeInventory encodes an inventory. CSV holds resources only, one per row
+// Args:	inventory, format
+// Rets:	encoded inventory, error
+func encodeInventory(inventory *m.Inventory, format string) ([]byte, error) {
+	var err error
+	var data []byte
+
+	switch format {
+	case "json":
+		data, err = json.MarshalIndent(inventory, "", "  ")
+	case "yaml":
+		data, err = yaml.Marshal(inventory)
+	case "csv":
+		data, err = encodeInventoryCSV(inventory.Resources)
+	default:
+		err = fmt.Errorf("error: unknown inventory format %s", format)
+	}
+
+	return data, err
+}
+
+// decodeInventory decodes an inventory. CSV holds resources only, one per row
+// Args:	encoded inventory, format
+// Rets:	inventory, error
+func decodeInventory(data []byte, format string) (*m.Inventory, error) {
+	var err error
+	inventory := &m.Inventory{}
+
+	switch format {
+	case "json":
+		err = json.Unmarshal(data, inventory)
+	case "yaml":
+		inventory, err = decodeYAMLInventory(data)
+	case "csv":
+		inventory.Resources, err = decodeInventoryCSV(data)
+	default:
+		err = fmt.Errorf("error: unknown inventory format %s", format)
+	}
+
+	return inventory, err
+}
+
+// decodeYAMLInventory decodes a stream of YAML documents, such as a directory of manifests joined with document separators, into a single inventory
+// Args:	YAML stream
+// Rets:	inventory, error
+func decodeYAMLInventory(data []byte) (*m.Inventory, error) {
+	var err error
+	inventory := &m.Inventory{}
+	decoder := yaml.NewDecoder(bytes.NewReader(data))
+
+	for err == nil {
+		document := &m.Inventory{}
+
+		if err = decoder.Decode(document); err == nil {
+			inventory.Templates = append(inventory.Templates, document.Templates...)
+			inventory.Projects = append(inventory.Projects, document.Projects...)
+			inventory.Resources = append(inventory.Resources, document.Resources...)
+		}
+	}
+
+	//The stream ends with EOF
+	if err == io.EOF {
+		err = nil
+		normalizeYAMLInventory(inventory)
+	}
+
+	return inventory, err
+}
+
+// normalizeYAMLInventory converts maps decoded from YAML into maps with string keys, as decoded from JSON, so that values can be stored and compared the same way
+func normalizeYAMLInventory(inventory *m.Inventory) {
+	for i := range inventory.Templates {
+		for j := range inventory.Templates[i].Fields {
+			inventory.Templates[i].Fields[j].Value = normalizeYAMLValue(inventory.Templates[i].Fields[j].Value)
+		}
+	}
+
+	for i := range inventory.Projects {
+		for j := range inventory.Projects[i].Settings {
+			inventory.Projects[i].Settings[j].Value = normalizeYAMLValue(inventory.Projects[i].Settings[j].Value)
+		}
+	}
+
+	for i := range inventory.Resources {
+		for j := range inventory.Resources[i].Fields {
+			inventory.Resources[i].Fields[j].Value = normalizeYAMLValue(inventory.Resources[i].Fields[j].Value)
+		}
+	}
+}
+
+// normalizeYAMLValue converts a value decoded from YAML recursively
+func normalizeYAMLValue(value interface{}) interface{} {
+	switch t := value.(type) {
+	case map[interface{}]interface{}:
+		converted := map[string]interface{}{}
+		for k, v := range t {
+			converted[fmt.Sprintf("%v", k)] = normalizeYAMLValue(v)
+		}
+		value = converted
+	case []interface{}:
+		for i := range t {
+			t[i] = normalizeYAMLValue(t[i])
+		}
+	}
+
+	return value
+}
+
+// encodeInventoryCSV writes resources as CSV rows. Projects are separated by semicolons; string field values are written as they are and other values as JSON
+// Args:	resources
+// Rets:	CSV, error
+func encodeInventoryCSV(resources []m.InventoryResource) ([]byte, error) {
+	var err error
+	var keys []string
+	buf := &bytes.Buffer{}
+	w := csv.NewWriter(buf)
+	columns := map[string]int{}
+
+	//Field columns are ordered by first appearance
+	for _, r := range resources {
+		for _, f := range r.Fields {
+			if _, ok := columns[f.Key]; !ok {
+				columns[f.Key] = len(keys)
+				keys = append(keys, f.Key)
+			}
+		}
+	}
+
+	header := append([]string{}, inventoryCSVColumns...)
+	for _, key := range keys {
+		header = append(header, "fields."+key)
+	}
+
+	err = w.Write(header)
+
+	for i := 0; err == nil && i < len(resources); i++ {
+		r := resources[i]
+		row := make([]string, len(header))
+		row[0], row[1], row[2], row[3] = r.Name, r.Description, r.Template, strings.Join(r.Projects, ";")
+
+		if r.Active != nil {
+			row[4] = strconv.FormatBool(*r.Active)
+		}
+
+		for _, f := range r.Fields {
+			cell := len(inventoryCSVColumns) + columns[f.Key]
+
+			if s, ok := f.Value.(string); ok {
+				row[cell] = s
+			} else if f.Value != nil {
+				var encoded []byte
+
+				if encoded, err = json.Marshal(f.Value); err != nil {
+					break
+				}
+				row[cell] = string(encoded)
+			}
+		}
+
+		if err == nil {
+			err = w.Write(row)
+		}
+	}
+
+	if err == nil {
+		w.Flush()
+		err = w.Error()
+	}
+
+	return buf.Bytes(), err
+}
+
+// decodeInventoryCSV reads resources from CSV rows. Empty field cells leave the field out; values which parse as JSON numbers, booleans, objects or lists are imported as such, anything else as a string
+// Args:	CSV
+// Rets:	resources, error
+func decodeInventoryCSV(data []byte) ([]m.InventoryResource, error) {
+	var err error
+	var rows [][]string
+	resources := []m.InventoryResource{}
+	columns := map[string]int{}
+
+	if rows, err = csv.NewReader(bytes.NewReader(data)).ReadAll(); err == nil && len(rows) > 0 {
+		for i, column := range rows[0] {
+			columns[strings.TrimSpace(column)] = i
+		}
+
+		for _, required := range []string{"name", "template", "projects"} {
+			if _, ok := columns[required]; !ok {
+				err = fmt.Errorf("error: missing %s column", required)
+			}
+		}
+
+		for i := 1; err == nil && i < len(rows); i++ {
+			r := m.InventoryResource{Fields: []m.Field{}}
+			cell := func(column string) string {
+				var value string
+				if j, ok := columns[column]; ok {
+					value = rows[i][j]
+				}
+				return value
+			}
+
+			r.Name, r.Description, r.Template = cell("name"), cell("description"), cell("template")
+
+			for _, name := range strings.Split(cell("projects"), ";") {
+				if name = strings.TrimSpace(name); name != "" {
+					r.Projects = append(r.Projects, name)
+				}
+			}
+
+			if active := cell("active"); active != "" {
+				var flag bool
+
+				if flag, err = strconv.ParseBool(active); err != nil {
+					err = fmt.Errorf("error: row %d: active is not true or false", i+1)
+					break
+				}
+				r.Active = &flag
+			}
+
+			for j, column := range rows[0] {
+				if key := strings.TrimPrefix(column, "fields."); key != column && rows[i][j] != "" {
+					var value interface{}
+
+					if json.Unmarshal([]byte(rows[i][j]), &value) != nil {
+						value = rows[i][j]
+					}
+					r.Fields = append(r.Fields, m.Field{Key: key, Value: value})
+				}
+			}
+
+			resources = append(resources, r)
+		}
+	}
+
+	return resources, err
+}
@@ -2,9 +2,11 @@ package business
 
 // Config structure
 type Config struct {
-	Port    int
-	Runmode string
-	SessExt int
-	DBName  string
-	Logfile string
+	Port       int
+	Runmode    string
+	SessExt    int
+	DBName     string
+	Logfile    string
+	MongoURI   string //Overrides the MongoDB connection string of the run mode
+	Replicated bool   //Whether several replicas share the database; locks are then taken in the database
 }
@@ -0,0 +1,24 @@
+package business
+
+import (
+	"strings"
+
+	m "library/internal/app/models"
+)
+
+// etagMatches evaluates an If-Match precondition against a stored document. An empty header is no precondition and * matches any existing document; weak tags never match, as If-Match uses strong comparison
+// Args:	If-Match header value, revision of the document
+// Rets:	bool
+func etagMatches(ifMatch string, revision int64) bool {
+	matches := strings.TrimSpace(ifMatch) == ""
+	etag := m.ETag(revision)
+
+	for _, tag := range strings.Split(ifMatch, ",") {
+		if tag = strings.TrimSpace(tag); tag == "*" || tag == etag {
+			matches = true
+			break
+		}
+	}
+
+	return matches
+}
@@ -0,0 +1,47 @@
+package business
+
+import (
+	"testing"
+
+	m "library/internal/app/models"
+)
+
+func TestEtagMatches(t *testing.T) {
+	tests := []struct {
+		ifMatch  string
+		revision int64
+		matches  bool
+	}{
+		{"", 4, true},
+		{"*", 4, true},
+		{`"4"`, 4, true},
+		{`"a"`, 10, true},
+		{`"3"`, 4, false},
+		{`"3", "4"`, 4, true},
+		{`W/"4"`, 4, false},
+		{"4", 4, false},
+	}
+
+	for _, test := range tests {
+		if matches := etagMatches(test.ifMatch, test.revision); matches != test.matches {
+			t.Errorf("etagMatches(%q, %d) = %v, want %v", test.ifMatch, test.revision, matches, test.matches)
+		}
+	}
+}
+
+func TestSavingChangesETag(t *testing.T) {
+	resource := &m.Resource{Name: "phone"}
+
+	//Creating and every update go through the saving hook
+	created := resource.Saving()
+	etag := m.ETag(resource.Revision)
+	updated := resource.Saving()
+
+	if created != nil || updated != nil || resource.Revision != 2 || m.ETag(resource.Revision) == etag {
+		t.Errorf("revision = %d, etag %s after %s; want 2 and a new etag", resource.Revision, m.ETag(resource.Revision), etag)
+	}
+
+	if resource.UpdatedAt.IsZero() {
+		t.Error("saving didn't set updated_at")
+	}
+}
@@ -0,0 +1,253 @@
+package business
+
+import (
+	"fmt"
+
+	m "library/internal/app/models"
+	db "library/internal/pkg/dbutil"
+
+	"github.com/Kamva/mgm"
+)
+
+// validateResourceFields verifies resource fields against the fields of the base template. Subresource values are cast to integers in place
+// Args:	template fields, resource fields
+// Rets:	error response, error
+func validateResourceFields(templateFields []m.Field, fields []m.Field) (interface{}, error) {
+	var err error
+	var response interface{}
+
+	if len(templateFields) != len(fields) {
+		//Catching a general template mismatch
+		response, err = m.ResourceTemplateMismatch, fmt.Errorf("")
+	} else {
+		for i := 0; i < len(fields); i++ {
+			//Ensuring that fields in template and resource have the same key names, required flags, type and order
+			if (templateFields[i].Key != fields[i].Key) || (templateFields[i].Required != fields[i].Required) || (templateFields[i].Type != fields[i].Type) {
+				err = fmt.Errorf("")
+				break
+			}
+
+			//Reference constraints are defined by the template
+			fields[i].Target, fields[i].Checkout = templateFields[i].Target, templateFields[i].Checkout
+
+			//Ensuring that the subresource value is an integer
+			if fields[i].Type == "subresource" {
+				if fields[i].Value, err = subresourceValue(fields[i].Value); err != nil {
+					break
+				}
+			}
+
+			//Ensuring that the reference value is empty or an ObjectID
+			if fields[i].Type == "reference" {
+				if id, ok := fields[i].Value.(string); (!ok && fields[i].Value != nil) || (id != "" && !db.VerifyObjectIDString(id)) {
+					err = fmt.Errorf("")
+					break
+				}
+			}
+
+			//Ensuring that required fields are not empty
+			if templateFields[i].Required && isEmptyFieldValue(fields[i].Value) {
+				err = fmt.Errorf("")
+				break
+			}
+		}
+
+		//Catching a template mismatch where required fields are empty
+		if err != nil {
+			response = m.ResourceTemplateMismatchRequired
+		}
+	}
+
+	return response, err
+}
+
+// subresourceValue casts a subresource field value to an integer
+// Args:	field value
+// Rets:	integer value, error
+func subresourceValue(value interface{}) (interface{}, error) {
+	var err error
+
+	switch t := value.(type) {
+	//Values decoded from a request body
+	case float64:
+		value = int(t)
+	//Values read back from the database
+	case int, int32, int64:
+	default:
+		err = fmt.Errorf("error: subresource value is not an integer")
+	}
+
+	return value, err
+}
+
+// isEmptyFieldValue reports whether a field value would fail a required check
+func isEmptyFieldValue(value interface{}) bool {
+	var empty bool
+
+	switch t := value.(type) {
+	case string:
+		empty = t == ""
+	//Case when value is []
+	case []interface{}:
+		empty = len(t) == 0
+	//Case when value is {}
+	case map[string]interface{}:
+		empty = len(t) == 0
+	default:
+		empty = t == nil
+	}
+
+	return empty
+}
+
+// fieldsStructureChanged reports whether two field lists differ in key names, required flags, type, reference target or order
+func fieldsStructureChanged(oldFields []m.Field, newFields []m.Field) bool {
+	changed := len(oldFields) != len(newFields)
+
+	for i := 0; !changed && i < len(oldFields); i++ {
+		if oldFields[i].Key != newFields[i].Key || oldFields[i].Required != newFields[i].Required || oldFields[i].Type != newFields[i].Type || oldFields[i].Target != newFields[i].Target {
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// migrateResourceFields rebuilds resource fields to match the structure of the template. Values are carried over by key (following renames) when the field type and reference target are unchanged, otherwise the migration default or template value is used
+// Args:	template fields, resource fields, renames, defaults
+// Rets:	migrated fields, keys of required fields left without a usable value
+func migrateResourceFields(templateFields []m.Field, fields []m.Field, renames []m.FieldRename, defaults []m.FieldDefault) ([]m.Field, []string) {
+	var missing []string
+	migrated := make([]m.Field, len(templateFields))
+	oldFields := map[string]m.Field{}
+	defaultValues := map[string]interface{}{}
+
+	//Indexing old fields under the keys they have in the current template version
+	for _, f := range fields {
+		oldFields[f.Key] = f
+	}
+
+	for _, r := range renames {
+		if f, ok := oldFields[r.From]; ok {
+			delete(oldFields, r.From)
+			oldFields[r.To] = f
+		}
+	}
+
+	for _, d := range defaults {
+		defaultValues[d.Key] = d.Value
+	}
+
+	for i, tf := range templateFields {
+		migrated[i] = m.Field{
+			Type:     tf.Type,
+			Required: tf.Required,
+			Key:      tf.Key,
+			Value:    tf.Value,
+			Target:   tf.Target,
+			Checkout: tf.Checkout,
+		}
+
+		if old, ok := oldFields[tf.Key]; ok && old.Type == tf.Type && old.Target == tf.Target {
+			migrated[i].Value = old.Value
+		} else if value, ok := defaultValues[tf.Key]; ok {
+			migrated[i].Value = value
+		}
+
+		valid := !(tf.Required && isEmptyFieldValue(migrated[i].Value))
+
+		if tf.Type == "subresource" {
+			var err error
+
+			if migrated[i].Value, err = subresourceValue(migrated[i].Value); err != nil {
+				valid = false
+			}
+		}
+
+		if !valid {
+			missing = append(missing, tf.Key)
+		}
+	}
+
+	return migrated, missing
+}
+
+// validateResourceReferences verifies that reference-type fields point at existing resources built from their target template
+// Args:	resource fields
+// Rets:	error response, error
+func validateResourceReferences(fields []m.Field) (interface{}, error) {
+	var err error
+	var response interface{}
+
+	for _, f := range fields {
+		if id, ok := f.Value.(string); f.Type == "reference" && ok && id != "" {
+			referenced := &m.Resource{}
+
+			if err = mgm.Coll(referenced).FindByID(id, referenced); err != nil || !templateExtends(referenced.TemplateID, f.Target, map[string]bool{}, findTemplate) {
+				response, err = m.ResourceReferenceInvalid, fmt.Errorf("")
+				break
+			}
+		}
+	}
+
+	return response, err
+}
+
+// validateTemplateReferences verifies that reference-type template fields target an existing template
+// Args:	template fields
+// Rets:	error response, error
+func validateTemplateReferences(fields []m.Field) (interface{}, error) {
+	var err error
+	var response interface{}
+
+	for _, f := range fields {
+		if f.Type == "reference" {
+			if !db.VerifyObjectIDString(f.Target) || mgm.Coll(&m.Template{}).FindByID(f.Target, &m.Template{}) != nil {
+				response, err = m.TemplateReferenceInvalid, fmt.Errorf("")
+				break
+			}
+		}
+	}
+
+	return response, err
+}
+
+// templateExtends reports whether a template is the target template or extends it, directly or through its base templates
+// Args:	template id, target template id, ids of templates already visited, template lookup
+// Rets:	bool
+func templateExtends(templateID string, targetID string, visited map[string]bool, lookup templateLookup) bool {
+	extends := templateID == targetID
+
+	if !extends && !visited[templateID] {
+		visited[templateID] = true
+
+		if template, err := lookup(templateID); err == nil {
+			for _, baseID := range template.Extends {
+				if extends = templateExtends(baseID, targetID, visited, lookup); extends {
+					break
+				}
+			}
+		}
+	}
+
+	return extends
+}
+
+// expandResourceReferences replaces the values of listed reference-type fields with the referenced resources. Values of references which cannot be found are left as they are
+// Args:	resource, keys of the fields to expand
+func expandResourceReferences(resource *m.Resource, keys []string) {
+	for i := range resource.Fields {
+		f := &resource.Fields[i]
+
+		for _, key := range keys {
+			if id, ok := f.Value.(string); f.Type == "reference" && f.Key == key && ok && id != "" {
+				referenced := &m.Resource{}
+
+				if err := mgm.Coll(referenced).FindByID(id, referenced); err == nil {
+					f.Value = referenced
+				}
+				break
+			}
+		}
+	}
+}
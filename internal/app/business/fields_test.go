@@ -0,0 +1,91 @@
+package business
+
+import (
+	"reflect"
+	"testing"
+
+	m "library/internal/app/models"
+)
+
+func TestMigrateResourceFields(t *testing.T) {
+	tests := []struct {
+		name           string
+		templateFields []m.Field
+		fields         []m.Field
+		renames        []m.FieldRename
+		defaults       []m.FieldDefault
+		want           []m.Field
+		missing        []string
+	}{
+		{
+			name:           "unchanged fields keep their values",
+			templateFields: []m.Field{{Type: "string", Key: "os", Value: "linux"}},
+			fields:         []m.Field{{Type: "string", Key: "os", Value: "android"}},
+			want:           []m.Field{{Type: "string", Key: "os", Value: "android"}},
+		},
+		{
+			name:           "rename chain across template versions",
+			templateFields: []m.Field{{Type: "string", Key: "system", Required: true}},
+			fields:         []m.Field{{Type: "string", Key: "os", Value: "android"}},
+			renames:        []m.FieldRename{{From: "os", To: "platform"}, {From: "platform", To: "system"}},
+			want:           []m.Field{{Type: "string", Key: "system", Required: true, Value: "android"}},
+		},
+		{
+			name:           "rename of a key the resource doesn't have",
+			templateFields: []m.Field{{Type: "string", Key: "system", Value: "linux"}},
+			fields:         []m.Field{{Type: "string", Key: "vendor", Value: "acme"}},
+			renames:        []m.FieldRename{{From: "os", To: "system"}},
+			want:           []m.Field{{Type: "string", Key: "system", Value: "linux"}},
+		},
+		{
+			name:           "changed type falls back to the migration default",
+			templateFields: []m.Field{{Type: "number", Key: "ram", Value: float64(4)}},
+			fields:         []m.Field{{Type: "string", Key: "ram", Value: "8GB"}},
+			defaults:       []m.FieldDefault{{Key: "ram", Value: float64(8)}},
+			want:           []m.Field{{Type: "number", Key: "ram", Value: float64(8)}},
+		},
+		{
+			name:           "changed type without a default uses the template value",
+			templateFields: []m.Field{{Type: "number", Key: "ram", Value: float64(4)}},
+			fields:         []m.Field{{Type: "string", Key: "ram", Value: "8GB"}},
+			want:           []m.Field{{Type: "number", Key: "ram", Value: float64(4)}},
+		},
+		{
+			name:           "changed reference target falls back to the template value",
+			templateFields: []m.Field{{Type: "reference", Key: "hub", Target: "5f19a22e5b40abf84d198e54"}},
+			fields:         []m.Field{{Type: "reference", Key: "hub", Target: "5f19a22e5b40abf84d198e53", Value: "5f19a22e5b40abf84d198e55"}},
+			want:           []m.Field{{Type: "reference", Key: "hub", Target: "5f19a22e5b40abf84d198e54"}},
+		},
+		{
+			name:           "required subresource without a value",
+			templateFields: []m.Field{{Type: "subresource", Key: "sims", Required: true}, {Type: "string", Key: "os", Required: true}},
+			fields:         []m.Field{{Type: "string", Key: "os", Value: "android"}},
+			want:           []m.Field{{Type: "subresource", Key: "sims", Required: true}, {Type: "string", Key: "os", Required: true, Value: "android"}},
+			missing:        []string{"sims"},
+		},
+		{
+			name:           "subresource default from the request body",
+			templateFields: []m.Field{{Type: "subresource", Key: "sims", Required: true}},
+			defaults:       []m.FieldDefault{{Key: "sims", Value: float64(2)}},
+			want:           []m.Field{{Type: "subresource", Key: "sims", Required: true, Value: 2}},
+		},
+		{
+			name:           "removed fields are dropped",
+			templateFields: []m.Field{},
+			fields:         []m.Field{{Type: "string", Key: "os", Value: "android"}},
+			want:           []m.Field{},
+		},
+	}
+
+	for _, test := range tests {
+		fields, missing := migrateResourceFields(test.templateFields, test.fields, test.renames, test.defaults)
+
+		if !reflect.DeepEqual(fields, test.want) {
+			t.Errorf("%s: fields = %+v, want %+v", test.name, fields, test.want)
+		}
+
+		if !reflect.DeepEqual(missing, test.missing) {
+			t.Errorf("%s: missing = %v, want %v", test.name, missing, test.missing)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package business
+
+import (
+	"context"
+
+	m "library/internal/app/models"
+
+	"github.com/Kamva/mgm"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// EnsureIndexesBusiness creates the indexes list filters and reports rely on, if missing. Meant to be executed at startup
+// Args:	none
+// Rets:	error
+func EnsureIndexesBusiness() error {
+	var err error
+	indexes := []struct {
+		model mgm.Model
+		keys  bson.D
+	}{
+		//Label selectors match label entries by key and value
+		{&m.Resource{}, bson.D{{Key: "labels.key", Value: 1}, {Key: "labels.value", Value: 1}}},
+		{&m.Session{}, bson.D{{Key: "metadata.labels.key", Value: 1}, {Key: "metadata.labels.value", Value: 1}}},
+		{&m.Session{}, bson.D{{Key: "metadata.owner", Value: 1}}},
+		//The worker looks up sessions which ran out
+		{&m.Session{}, bson.D{{Key: "expires", Value: 1}}},
+		{&m.ClosedSession{}, bson.D{{Key: "sessionid", Value: 1}}},
+		{&m.ClosedSession{}, bson.D{{Key: "closed", Value: 1}}},
+		{&m.Usage{}, bson.D{{Key: "resourceid", Value: 1}, {Key: "checkedout", Value: 1}}},
+	}
+
+	for _, index := range indexes {
+		if _, err = mgm.Coll(index.model).Indexes().CreateOne(context.Background(), mongo.IndexModel{Keys: index.keys}); err != nil {
+			break
+		}
+	}
+
+	return err
+}
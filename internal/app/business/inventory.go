@@ -0,0 +1,883 @@
+package business
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+
+	m "library/internal/app/models"
+	db "library/internal/pkg/dbutil"
+	"library/internal/pkg/lockutil"
+
+	"github.com/Kamva/mgm"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// inventoryCatalog holds the documents an import is planned against: working copies of the stored documents, overlaid with the changes of the batch
+type inventoryCatalog struct {
+	templates map[string]*m.Template //Working copies by id
+	projects  map[string]*m.Project  //Working copies by id
+	resources map[string]*m.Resource //Working copies by id
+	stored    map[string]mgm.Model   //Documents as stored before the import by id; created documents are missing
+	names     map[string]string      //Ids by kind and name, e.g. template/android
+	fields    map[string][]m.Field   //Effective fields of templates by id
+	batch     map[string]bool        //Ids of documents listed in the batch
+	sync      bool                   //Documents left out of the batch are deleted
+	force     bool                   //Checked out resources can be updated and deleted
+	report    *m.InventoryReport
+}
+
+// loadInventoryCatalog reads every template, project and resource into a catalog. Documents are read twice so that working copies don't share lists with the stored ones
+// Rets:	catalog, error
+func loadInventoryCatalog() (*inventoryCatalog, error) {
+	var err error
+	var templates, storedTemplates []m.Template
+	var projects, storedProjects []m.Project
+	var resources, storedResources []m.Resource
+
+	cat := &inventoryCatalog{
+		templates: map[string]*m.Template{},
+		projects:  map[string]*m.Project{},
+		resources: map[string]*m.Resource{},
+		stored:    map[string]mgm.Model{},
+		names:     map[string]string{},
+		fields:    map[string][]m.Field{},
+		batch:     map[string]bool{},
+		report:    &m.InventoryReport{Changes: []m.InventoryChange{}, Errors: []m.InventoryError{}},
+	}
+
+	for _, find := range []struct {
+		model   mgm.Model
+		results interface{}
+	}{
+		{&m.Template{}, &templates}, {&m.Template{}, &storedTemplates},
+		{&m.Project{}, &projects}, {&m.Project{}, &storedProjects},
+		{&m.Resource{}, &resources}, {&m.Resource{}, &storedResources},
+	} {
+		if err = mgm.Coll(find.model).SimpleFind(find.results, bson.M{}); err != nil {
+			break
+		}
+	}
+
+	if err == nil {
+		for i := range templates {
+			cat.addTemplate(&templates[i])
+			cat.stored[templates[i].ID.Hex()] = &storedTemplates[i]
+		}
+
+		for i := range projects {
+			cat.addProject(&projects[i])
+			cat.stored[projects[i].ID.Hex()] = &storedProjects[i]
+		}
+
+		for i := range resources {
+			cat.addResource(&resources[i])
+			cat.stored[resources[i].ID.Hex()] = &storedResources[i]
+		}
+	}
+
+	return cat, err
+}
+
+// addTemplate, addProject and addResource index a working copy by id and name
+func (cat *inventoryCatalog) addTemplate(template *m.Template) {
+	cat.templates[template.ID.Hex()] = template
+	cat.names["template/"+template.Name] = template.ID.Hex()
+}
+
+func (cat *inventoryCatalog) addProject(project *m.Project) {
+	cat.projects[project.ID.Hex()] = project
+	cat.names["project/"+project.Name] = project.ID.Hex()
+}
+
+func (cat *inventoryCatalog) addResource(resource *m.Resource) {
+	cat.resources[resource.ID.Hex()] = resource
+	cat.names["resource/"+resource.Name] = resource.ID.Hex()
+}
+
+// template looks up a working copy of a template, following the templateLookup signature
+func (cat *inventoryCatalog) template(id string) (*m.Template, error) {
+	var err error
+
+	template, ok := cat.templates[id]
+	if !ok {
+		err = fmt.Errorf("error: template %s not found", id)
+	}
+
+	return template, err
+}
+
+// storedTemplate looks up a template as stored before the import, following the templateLookup signature
+func (cat *inventoryCatalog) storedTemplate(id string) (*m.Template, error) {
+	var err error
+
+	template, ok := cat.stored[id].(*m.Template)
+	if !ok {
+		err = fmt.Errorf("error: template %s not found", id)
+	}
+
+	return template, err
+}
+
+// fail records a planning error
+func (cat *inventoryCatalog) fail(kind string, name string, format string, args ...interface{}) {
+	cat.report.Errors = append(cat.report.Errors, m.InventoryError{Kind: kind, Name: name, Message: fmt.Sprintf(format, args...)})
+}
+
+// ExportInventoryBusiness godoc
+func ExportInventoryBusiness(requestData *m.InventoryExportRequest) (int, interface{}) {
+	var err error
+	var code int
+	var response interface{}
+	var filter bson.M
+	var resourcesFound []m.Resource
+	var cat *inventoryCatalog
+
+	if filter, err = listFilter(&requestData.ListRequest, "name", "template", "projects", "active", "checkedout", "field", "health", "labels"); err != nil {
+		code, response = http.StatusBadRequest, m.ListRequestInvalid
+	} else if _, err = InventoryFormat(requestData.Format, ""); err != nil {
+		code, response = http.StatusBadRequest, m.InventoryFormatInvalid
+	} else if cat, err = loadInventoryCatalog(); err != nil {
+		code, response = http.StatusInternalServerError, m.InternalError
+	} else if err = mgm.Coll(&m.Resource{}).SimpleFind(&resourcesFound, filter); err != nil {
+		code, response = http.StatusInternalServerError, m.InternalError
+	} else {
+		var data []byte
+		inventory := &m.Inventory{
+			Templates: []m.InventoryTemplate{},
+			Projects:  []m.InventoryProject{},
+			Resources: []m.InventoryResource{},
+		}
+		templateIDs := map[string]bool{}
+		projectIDs := map[string]bool{}
+
+		//A filtered subset carries the templates and projects it depends on, so it can be imported on its own
+		for id := range cat.templates {
+			templateIDs[id] = len(filter) == 0
+		}
+
+		for id := range cat.projects {
+			projectIDs[id] = len(filter) == 0
+		}
+
+		for _, resource := range resourcesFound {
+			cat.templateDependencies(resource.TemplateID, templateIDs)
+
+			for _, projID := range resource.Projects {
+				projectIDs[projID] = true
+			}
+
+			inventory.Resources = append(inventory.Resources, cat.exportResource(&resource))
+		}
+
+		for id, include := range templateIDs {
+			if template, ok := cat.templates[id]; ok && include {
+				inventory.Templates = append(inventory.Templates, cat.exportTemplate(template))
+			}
+		}
+
+		for id, include := range projectIDs {
+			if project, ok := cat.projects[id]; ok && include {
+				inventory.Projects = append(inventory.Projects, m.InventoryProject{Name: project.Name, Settings: project.Settings})
+			}
+		}
+
+		sort.Slice(inventory.Templates, func(i, j int) bool { return inventory.Templates[i].Name < inventory.Templates[j].Name })
+		sort.Slice(inventory.Projects, func(i, j int) bool { return inventory.Projects[i].Name < inventory.Projects[j].Name })
+		sort.Slice(inventory.Resources, func(i, j int) bool { return inventory.Resources[i].Name < inventory.Resources[j].Name })
+
+		format, _ := InventoryFormat(requestData.Format, "")
+
+		if data, err = encodeInventory(inventory, format); err != nil {
+			code, response = http.StatusInternalServerError, m.InternalError
+		} else {
+			code, response = http.StatusOK, data
+		}
+	}
+
+	return code, response
+}
+
+// templateDependencies marks a template along with its base templates and the targets of its reference fields, recursively
+func (cat *inventoryCatalog) templateDependencies(id string, included map[string]bool) {
+	if template, ok := cat.templates[id]; ok && !included[id] {
+		included[id] = true
+
+		for _, baseID := range template.Extends {
+			cat.templateDependencies(baseID, included)
+		}
+
+		for _, f := range template.Fields {
+			if f.Type == "reference" {
+				cat.templateDependencies(f.Target, included)
+			}
+		}
+	}
+}
+
+// exportTemplate converts a template into its portable form, replacing ids with names
+func (cat *inventoryCatalog) exportTemplate(template *m.Template) m.InventoryTemplate {
+	exported := m.InventoryTemplate{
+		Name:        template.Name,
+		Description: template.Description,
+		Extends:     []string{},
+		Fields:      append([]m.Field{}, template.Fields...),
+	}
+
+	for _, baseID := range template.Extends {
+		if base, ok := cat.templates[baseID]; ok {
+			exported.Extends = append(exported.Extends, base.Name)
+		}
+	}
+
+	for i, f := range exported.Fields {
+		if target, ok := cat.templates[f.Target]; ok && f.Type == "reference" {
+			exported.Fields[i].Target = target.Name
+		}
+	}
+
+	return exported
+}
+
+// exportResource converts a resource into its portable form, replacing ids with names
+func (cat *inventoryCatalog) exportResource(resource *m.Resource) m.InventoryResource {
+	active := resource.Active
+	exported := m.InventoryResource{
+		Name:        resource.Name,
+		Description: resource.Description,
+		Projects:    []string{},
+		Fields:      append([]m.Field{}, resource.Fields...),
+		Active:      &active,
+		Labels:      resource.Labels,
+	}
+
+	if template, ok := cat.templates[resource.TemplateID]; ok {
+		exported.Template = template.Name
+	}
+
+	for _, projID := range resource.Projects {
+		if project, ok := cat.projects[projID]; ok {
+			exported.Projects = append(exported.Projects, project.Name)
+		}
+	}
+
+	for i, f := range exported.Fields {
+		if f.Type == "reference" {
+			if target, ok := cat.templates[f.Target]; ok {
+				exported.Fields[i].Target = target.Name
+			}
+
+			if id, ok := f.Value.(string); ok {
+				if referenced, ok := cat.resources[id]; ok {
+					exported.Fields[i].Value = referenced.Name
+				}
+			}
+		}
+	}
+
+	return exported
+}
+
+// ImportInventoryBusiness godoc
+func ImportInventoryBusiness(data []byte, format string, dryRun bool, mux *lockutil.Locks) (int, interface{}) {
+	return runInventory(data, format, dryRun, false, false, mux)
+}
+
+// SyncInventoryBusiness godoc
+func SyncInventoryBusiness(data []byte, format string, dryRun bool, force bool, mux *lockutil.Locks) (int, interface{}) {
+	return runInventory(data, format, dryRun, true, force, mux)
+}
+
+// runInventory plans a batch against the database and applies it unless the plan has errors or it's a dry run
+// Args:	encoded batch, format, dry run flag, sync flag, force flag, locks
+// Rets:	http code, report or error message
+func runInventory(data []byte, format string, dryRun bool, sync bool, force bool, mux *lockutil.Locks) (int, interface{}) {
+	var err error
+	var code int
+	var response interface{}
+	var inventory *m.Inventory
+	var cat *inventoryCatalog
+
+	unlock := mux.Lock("Sessions", "Resources", "Templates", "Projects", "Pools", "Reservations")
+
+	if inventory, err = decodeInventory(data, format); err != nil {
+		code, response = http.StatusBadRequest, m.InventoryFormatInvalid
+	} else if cat, err = loadInventoryCatalog(); err != nil {
+		code, response = http.StatusInternalServerError, m.InternalError
+	} else {
+		cat.report.DryRun, cat.sync, cat.force = dryRun, sync, force
+		saves, deletes := planInventory(cat, inventory)
+
+		if len(cat.report.Errors) > 0 {
+			code, response = http.StatusBadRequest, cat.report
+		} else if dryRun {
+			code, response = http.StatusOK, cat.report
+		} else if err = applyInventory(cat, saves, deletes); err != nil {
+			code, response = http.StatusInternalServerError, m.InternalError
+		} else {
+			cat.report.Applied = true
+			code, response = http.StatusOK, cat.report
+		}
+	}
+
+	unlock()
+
+	return code, response
+}
+
+// planInventory applies a batch to the working copies of the catalog, recording errors and changes in the report of the catalog. Templates, projects and resources are matched by name: missing ones are created, existing ones updated. When syncing, documents left out of the batch are deleted
+// Args:	catalog, batch
+// Rets:	documents which have to be saved, documents which have to be deleted
+func planInventory(cat *inventoryCatalog, inventory *m.Inventory) ([]mgm.Model, []mgm.Model) {
+	var changes []m.InventoryChange
+	var saves, deletes []mgm.Model
+
+	//Documents are created or located first, so that the batch can refer to documents in any order
+	projects := make([]*m.Project, len(inventory.Projects))
+	for i, p := range inventory.Projects {
+		if id, ok := cat.names["project/"+p.Name]; ok && !cat.batch[id] {
+			projects[i] = cat.projects[id]
+		} else if p.Name == "" || ok {
+			cat.fail("project", p.Name, "name is blank or listed more than once")
+		} else {
+			projects[i] = &m.Project{Name: p.Name, Resources: []string{}}
+			projects[i].ID = primitive.NewObjectID()
+			projects[i].UpdateAPIKey()
+			cat.addProject(projects[i])
+		}
+
+		if projects[i] != nil {
+			projects[i].Settings = p.Settings
+			cat.batch[projects[i].ID.Hex()] = true
+		}
+	}
+
+	templates := make([]*m.Template, len(inventory.Templates))
+	for i, t := range inventory.Templates {
+		if id, ok := cat.names["template/"+t.Name]; ok && !cat.batch[id] {
+			templates[i] = cat.templates[id]
+		} else if t.Name == "" || ok {
+			cat.fail("template", t.Name, "name is blank or listed more than once")
+		} else {
+			templates[i] = &m.Template{Name: t.Name, Version: 1}
+			templates[i].ID = primitive.NewObjectID()
+			cat.addTemplate(templates[i])
+		}
+
+		if templates[i] != nil {
+			cat.batch[templates[i].ID.Hex()] = true
+		}
+	}
+
+	resources := make([]*m.Resource, len(inventory.Resources))
+	for i, r := range inventory.Resources {
+		if id, ok := cat.names["resource/"+r.Name]; ok && !cat.batch[id] {
+			resources[i] = cat.resources[id]
+		} else if r.Name == "" || ok {
+			cat.fail("resource", r.Name, "name is blank or listed more than once")
+		} else {
+			resources[i] = &m.Resource{Name: r.Name, Active: true, Health: m.HealthHealthy, Projects: []string{}}
+			resources[i].ID = primitive.NewObjectID()
+			cat.addResource(resources[i])
+		}
+
+		if resources[i] != nil {
+			cat.batch[resources[i].ID.Hex()] = true
+		}
+	}
+
+	//A synced batch can only refer to documents within it, since everything else is deleted
+	if cat.sync {
+		for key, id := range cat.names {
+			if !cat.batch[id] {
+				delete(cat.names, key)
+			}
+		}
+	}
+
+	for i, t := range inventory.Templates {
+		if templates[i] != nil {
+			cat.planTemplate(templates[i], &t)
+		}
+	}
+
+	cat.planTemplateFields()
+
+	for i, r := range inventory.Resources {
+		if resources[i] != nil {
+			cat.planResource(resources[i], &r)
+		}
+	}
+
+	//Deleted resources are dropped from the resource lists of the projects which are kept
+	if cat.sync {
+		for _, p := range projects {
+			if p != nil {
+				kept := []string{}
+
+				for _, resID := range p.Resources {
+					if cat.batch[resID] {
+						kept = append(kept, resID)
+					}
+				}
+				p.Resources = kept
+			}
+		}
+	}
+
+	//Listing the batch in order, followed by documents changed as a side effect, such as project resource lists and versions of derived templates
+	for _, p := range projects {
+		if p != nil {
+			changes = append(changes, cat.change("project", p.Name, p))
+		}
+	}
+
+	for _, t := range templates {
+		if t != nil {
+			changes = append(changes, cat.change("template", t.Name, t))
+		}
+	}
+
+	for _, r := range resources {
+		if r != nil {
+			change := cat.change("resource", r.Name, r)
+
+			//Checked out resources cannot be updated, same as through the API, unless forced
+			if change.Action == "update" && r.CheckedOut > 0 && !cat.force {
+				cat.fail("resource", r.Name, "resource is checked out; cannot update a checked out resource unless forced")
+			}
+
+			changes = append(changes, change)
+		}
+	}
+
+	for _, id := range cat.sortedIDs() {
+		if !cat.batch[id] {
+			var change m.InventoryChange
+			var doc mgm.Model
+
+			if t, ok := cat.templates[id]; ok {
+				change, doc = cat.change("template", t.Name, t), t
+			} else if p, ok := cat.projects[id]; ok {
+				change, doc = cat.change("project", p.Name, p), p
+			} else if r, ok := cat.resources[id]; ok {
+				change, doc = cat.change("resource", r.Name, r), r
+
+				if cat.sync && r.CheckedOut > 0 && !cat.force {
+					cat.fail("resource", r.Name, "resource is checked out; cannot delete a checked out resource unless forced")
+				}
+			}
+
+			if cat.sync {
+				change.Action, change.Diff = "delete", nil
+				deletes = append(deletes, doc)
+			} else if change.Action != "unchanged" {
+				saves = append(saves, doc)
+			}
+
+			if change.Action != "unchanged" {
+				cat.report.Changes = append(cat.report.Changes, change)
+			}
+		}
+	}
+
+	for _, change := range changes {
+		if change.Action != "unchanged" {
+			saves = append(saves, cat.document(change.Kind, change.Name))
+		}
+	}
+
+	cat.report.Changes = append(changes, cat.report.Changes...)
+
+	return saves, deletes
+}
+
+// planTemplate applies a template of the batch to its working copy, resolving base and reference target templates by name
+func (cat *inventoryCatalog) planTemplate(template *m.Template, t *m.InventoryTemplate) {
+	template.Description = t.Description
+	template.Extends = []string{}
+	template.Fields = []m.Field{}
+
+	for _, name := range t.Extends {
+		if id, ok := cat.names["template/"+name]; !ok {
+			cat.fail("template", t.Name, "base template %s not found", name)
+		} else {
+			template.Extends = append(template.Extends, id)
+		}
+	}
+
+	for i, f := range t.Fields {
+		if f.Type == "" {
+			cat.fail("template", t.Name, "field %s has no type", f.Key)
+		}
+
+		for _, other := range t.Fields[i+1:] {
+			if f.Key == other.Key {
+				cat.fail("template", t.Name, "field key %s is not unique", f.Key)
+			}
+		}
+
+		if f.Type == "reference" {
+			if id, ok := cat.names["template/"+f.Target]; !ok {
+				cat.fail("template", t.Name, "target template %s of field %s not found", f.Target, f.Key)
+			} else {
+				f.Target = id
+			}
+		} else {
+			f.Target, f.Checkout = "", false
+		}
+
+		template.Fields = append(template.Fields, f)
+	}
+}
+
+// planTemplateFields resolves the effective fields of every template which is kept. Templates whose structure changes, directly or through their base templates, get a new version, as on update. Errors are only reported for templates which resolved before the import
+func (cat *inventoryCatalog) planTemplateFields() {
+	for _, id := range cat.sortedIDs() {
+		if template, ok := cat.templates[id]; ok && (cat.batch[id] || !cat.sync) {
+			var oldFields, newFields []m.Field
+			var oldErr, err error
+			var response interface{}
+			stored, existed := cat.stored[id].(*m.Template)
+
+			if existed {
+				oldFields, _, _, oldErr = resolveInheritedFields(stored, map[string]bool{}, cat.storedTemplate)
+			}
+
+			if newFields, _, response, err = resolveInheritedFields(template, map[string]bool{}, cat.template); err == nil {
+				for _, f := range newFields {
+					if _, ok := cat.templates[f.Target]; f.Type == "reference" && !ok {
+						response, err = m.TemplateReferenceInvalid, fmt.Errorf("")
+					}
+				}
+			}
+
+			if err != nil {
+				if cat.batch[id] || (existed && oldErr == nil) {
+					cat.fail("template", template.Name, "%v", response.(m.Msg)["message"])
+				}
+			} else {
+				cat.fields[id] = newFields
+
+				if existed && oldErr == nil && fieldsStructureChanged(oldFields, newFields) {
+					template.Version = stored.Version + 1
+				}
+			}
+		}
+	}
+}
+
+// planResource applies a resource of the batch to its working copy. Fields are matched by key: fields left out keep their current value, or the template value for new resources
+func (cat *inventoryCatalog) planResource(resource *m.Resource, r *m.InventoryResource) {
+	var fields []m.Field
+	var projects []string
+	templateID, found := cat.names["template/"+r.Template]
+	templateFields, resolved := cat.fields[templateID]
+	_, existed := cat.stored[resource.ID.Hex()]
+
+	if !found {
+		cat.fail("resource", r.Name, "template %s not found", r.Template)
+	} else if !resolved {
+		cat.fail("resource", r.Name, "fields of template %s cannot be resolved", r.Template)
+	} else if existed && resource.TemplateID != templateID {
+		cat.fail("resource", r.Name, "template of an existing resource cannot be changed; delete its template with cascade=reassign instead")
+	} else {
+		fields, _ = migrateResourceFields(templateFields, resource.Fields, nil, nil)
+
+		for _, f := range r.Fields {
+			index := -1
+
+			for i := range fields {
+				if fields[i].Key == f.Key {
+					index = i
+				}
+			}
+
+			if index < 0 {
+				cat.fail("resource", r.Name, "template %s has no field %s", r.Template, f.Key)
+			} else {
+				fields[index].Value = f.Value
+
+				//References are given by resource name
+				if name, ok := f.Value.(string); ok && name != "" && fields[index].Type == "reference" {
+					if id, ok := cat.names["resource/"+name]; ok {
+						fields[index].Value = id
+					} else if _, ok := cat.resources[name]; !ok || (cat.sync && !cat.batch[name]) {
+						cat.fail("resource", r.Name, "referenced resource %s not found", name)
+					}
+				}
+			}
+		}
+
+		if response, err := validateResourceFields(templateFields, fields); err != nil {
+			cat.fail("resource", r.Name, "%v", response.(m.Msg)["message"])
+		}
+
+		for _, f := range fields {
+			if id, ok := f.Value.(string); f.Type == "reference" && ok && id != "" {
+				if referenced, ok := cat.resources[id]; ok && !templateExtends(referenced.TemplateID, f.Target, map[string]bool{}, cat.template) {
+					cat.fail("resource", r.Name, "%v", m.ResourceReferenceInvalid["message"])
+				}
+			}
+		}
+
+		resource.TemplateID = templateID
+		resource.TemplateVersion = cat.templates[templateID].Version
+		resource.Fields = fields
+	}
+
+	if len(r.Projects) == 0 {
+		cat.fail("resource", r.Name, "resource has to be associated with at least one project")
+	}
+
+	for i, name := range r.Projects {
+		if id, ok := cat.names["project/"+name]; !ok {
+			cat.fail("resource", r.Name, "project %s not found", name)
+		} else {
+			for _, other := range r.Projects[i+1:] {
+				if name == other {
+					cat.fail("resource", r.Name, "%v", m.ResourceProjectIDDuplicate["message"])
+				}
+			}
+
+			projects = append(projects, id)
+		}
+	}
+
+	//Moving the resource between project resource lists, leaving projects it stays in untouched
+	for _, project := range cat.projects {
+		listed, member := false, false
+
+		for _, resID := range project.Resources {
+			listed = listed || resID == resource.ID.Hex()
+		}
+
+		for _, projID := range projects {
+			member = member || projID == project.ID.Hex()
+		}
+
+		if listed && !member {
+			project.DeleteResource(resource.ID.Hex())
+		} else if member && !listed {
+			project.Resources = append(project.Resources, resource.ID.Hex())
+		}
+	}
+
+	resource.Description = r.Description
+	resource.Projects = projects
+
+	if r.Active != nil {
+		resource.Active = *r.Active
+	}
+
+	if r.Labels != nil {
+		if err := validateLabels(r.Labels); err != nil {
+			cat.fail("resource", r.Name, "labels need unique keys of letters, digits and ._/- and values of letters, digits and ._-, up to 63 characters")
+		}
+
+		resource.Labels = r.Labels
+	}
+}
+
+// change compares a working copy with the stored document
+// Args:	kind, name, working copy
+// Rets:	change
+func (cat *inventoryCatalog) change(kind string, name string, doc mgm.Model) m.InventoryChange {
+	change := m.InventoryChange{Kind: kind, Name: name, Action: "create"}
+
+	if stored, ok := cat.stored[documentID(doc)]; ok {
+		change.Action = "unchanged"
+
+		if change.Diff = documentDiff(stored, doc); len(change.Diff) > 0 {
+			change.Action = "update"
+		}
+	}
+
+	return change
+}
+
+// documentID returns the id of a document as a hexadecimal string
+func documentID(doc mgm.Model) string {
+	return doc.GetID().(primitive.ObjectID).Hex()
+}
+
+// document looks up a working copy by kind and name
+func (cat *inventoryCatalog) document(kind string, name string) mgm.Model {
+	var doc mgm.Model
+	id := cat.names[kind+"/"+name]
+
+	switch kind {
+	case "template":
+		doc = cat.templates[id]
+	case "project":
+		doc = cat.projects[id]
+	case "resource":
+		doc = cat.resources[id]
+	}
+
+	return doc
+}
+
+// sortedIDs lists the ids of all documents in the catalog, ordered so that reports come out the same for the same batch
+func (cat *inventoryCatalog) sortedIDs() []string {
+	var ids []string
+
+	for id := range cat.templates {
+		ids = append(ids, id)
+	}
+
+	for id := range cat.projects {
+		ids = append(ids, id)
+	}
+
+	for id := range cat.resources {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+
+	return ids
+}
+
+// documentDiff lists the keys which differ between two versions of a document. Fields and settings are compared per key; ids, timestamps and API keys are left out
+// Args:	old document, new document
+// Rets:	differences
+func documentDiff(oldDoc interface{}, newDoc interface{}) []m.InventoryDiff {
+	var diff []m.InventoryDiff
+	var keys []string
+	oldMap, newMap := map[string]interface{}{}, map[string]interface{}{}
+
+	//Have to marshal into json and unmarshal into a map
+	for _, pair := range [][2]interface{}{{oldDoc, &oldMap}, {newDoc, &newMap}} {
+		marsh, _ := json.Marshal(pair[0])
+		json.Unmarshal(marsh, pair[1])
+	}
+
+	for _, flat := range []map[string]interface{}{oldMap, newMap} {
+		for _, list := range []string{"fields", "settings"} {
+			if elements, ok := flat[list].([]interface{}); ok {
+				for _, e := range elements {
+					if element, ok := e.(map[string]interface{}); ok {
+						flat[fmt.Sprintf("%s.%v", list, element["key"])] = element
+					}
+				}
+			}
+			delete(flat, list)
+		}
+	}
+
+	for key := range oldMap {
+		keys = append(keys, key)
+	}
+
+	for key := range newMap {
+		if _, ok := oldMap[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if key != "_id" && key != "created_at" && key != "updated_at" && key != "apikey" {
+			oldValue, _ := json.Marshal(oldMap[key])
+			newValue, _ := json.Marshal(newMap[key])
+
+			if string(oldValue) != string(newValue) {
+				diff = append(diff, m.InventoryDiff{Key: key, Old: oldMap[key], New: newMap[key]})
+			}
+		}
+	}
+
+	return diff
+}
+
+// applyInventory saves and deletes planned documents in a single transaction so that the batch is applied all-or-nothing. Without transaction support, documents written so far are restored to their stored state if a write fails, though references dropped by deletes are not
+// Args:	catalog, documents to save, documents to delete
+// Rets:	error
+func applyInventory(cat *inventoryCatalog, saves []mgm.Model, deletes []mgm.Model) error {
+	var applied, deleted []mgm.Model
+
+	//Resources are deleted first, while the projects they are dropped from still exist
+	sort.SliceStable(deletes, func(i, j int) bool { return deleteRank(deletes[i]) < deleteRank(deletes[j]) })
+
+	err := db.Transaction(func(ctx context.Context) error {
+		var err error
+
+		//A run retried after a transient error starts over, having written nothing
+		applied, deleted = nil, nil
+
+		for _, doc := range saves {
+			//Created documents already carry their id, so they have to be inserted explicitly
+			if _, ok := cat.stored[documentID(doc)]; ok {
+				err = mgm.Coll(doc).UpdateWithCtx(ctx, doc)
+			} else {
+				err = mgm.Coll(doc).CreateWithCtx(ctx, doc)
+			}
+
+			if err != nil {
+				break
+			}
+			applied = append(applied, doc)
+		}
+
+		for i := 0; err == nil && i < len(deletes); i++ {
+			if err = deleteInventoryDocument(ctx, deletes[i]); err == nil {
+				deleted = append(deleted, deletes[i])
+			}
+		}
+
+		return err
+	})
+
+	if err != nil && !db.TransactionsSupported() {
+		for _, doc := range deleted {
+			_ = mgm.Coll(doc).Create(cat.stored[documentID(doc)])
+		}
+
+		for _, doc := range applied {
+			if stored, ok := cat.stored[documentID(doc)]; ok {
+				_ = mgm.Coll(stored).Update(stored)
+			} else {
+				_ = mgm.Coll(doc).Delete(doc)
+			}
+		}
+	}
+
+	return err
+}
+
+// deleteInventoryDocument deletes a document left out of a synced batch the way the API deletes it, dropping references to resources and projects from projects, pools and sessions along with their reservations. Caller is responsible for locking Sessions, Resources, Templates, Projects, Pools and Reservations
+// Args:	transaction context, document
+// Rets:	error
+func deleteInventoryDocument(ctx context.Context, doc mgm.Model) error {
+	var err error
+
+	switch d := doc.(type) {
+	case *m.Resource:
+		err = deleteResource(ctx, d)
+	case *m.Project:
+		err = deleteProject(ctx, d)
+	default:
+		err = mgm.Coll(doc).DeleteWithCtx(ctx, doc)
+	}
+
+	return err
+}
+
+// deleteRank orders deletes: resources, then projects, then templates
+func deleteRank(doc mgm.Model) int {
+	rank := 2
+
+	switch doc.(type) {
+	case *m.Resource:
+		rank = 0
+	case *m.Project:
+		rank = 1
+	}
+
+	return rank
+}
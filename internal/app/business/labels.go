@@ -0,0 +1,222 @@
+package business
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	m "library/internal/app/models"
+	"library/internal/pkg/lockutil"
+
+	"github.com/Kamva/mgm"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+//Label keys may hold a prefix such as lab.example.com/shelf; values are kept free of the characters of the selector syntax
+var labelKeyPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._/-]{0,62}$`)
+var labelValuePattern = regexp.MustCompile(`^[A-Za-z0-9._-]{0,63}$`)
+
+//Label selector requirements with a set of values, e.g. region in (eu-west,eu-north)
+var labelSetPattern = regexp.MustCompile(`^(\S+)\s+(in|notin)\s*\((.*)\)$`)
+
+// LabelResourceBusiness godoc
+func LabelResourceBusiness(resID string, patch m.MergePatch, ifMatch string, mux *lockutil.Locks) (int, interface{}) {
+	var code int
+	var response interface{}
+	resource := &m.Resource{}
+
+	unlock := mux.Lock(lockutil.Document("Resources", resID))
+
+	//Labels are edited whether or not the resource is checked out
+	if err := mgm.Coll(resource).FindByID(resID, resource); err != nil {
+		code, response = http.StatusNotFound, m.ResourceNotFound
+	} else if !etagMatches(ifMatch, resource.Revision) {
+		code, response = http.StatusPreconditionFailed, m.PreconditionFailed
+	} else if resource.Labels, err = patchLabels(resource.Labels, patch); err != nil {
+		code, response = http.StatusBadRequest, m.LabelsValidateFailed
+	} else if err = mgm.Coll(resource).Update(resource); err != nil {
+		code, response = http.StatusInternalServerError, m.InternalError
+	} else {
+		code, response = http.StatusOK, resource
+	}
+	unlock()
+
+	return code, response
+}
+
+// patchLabels applies a merge patch of label keys to values, where null removes a label, and validates the result. Labels are kept sorted by key
+// Args:	labels, patch
+// Rets:	patched labels, error
+func patchLabels(labels []m.Label, patch m.MergePatch) ([]m.Label, error) {
+	var err error
+	values := map[string]string{}
+	patched := []m.Label{}
+
+	for _, l := range labels {
+		values[l.Key] = l.Value
+	}
+
+	for key, value := range patch {
+		if value == nil {
+			delete(values, key)
+		} else if s, ok := value.(string); ok {
+			values[key] = s
+		} else {
+			err = fmt.Errorf("error: value of label %s is not a string", key)
+		}
+	}
+
+	for key, value := range values {
+		patched = append(patched, m.Label{Key: key, Value: value})
+	}
+
+	sort.Slice(patched, func(i, j int) bool { return patched[i].Key < patched[j].Key })
+
+	if err == nil {
+		err = validateLabels(patched)
+	}
+
+	return patched, err
+}
+
+// validateLabels checks label keys and values against the label syntax, and that keys are unique
+// Args:	labels
+// Rets:	error
+func validateLabels(labels []m.Label) error {
+	var err error
+	keys := map[string]bool{}
+
+	for _, l := range labels {
+		if !labelKeyPattern.MatchString(l.Key) || !labelValuePattern.MatchString(l.Value) {
+			err = fmt.Errorf("error: invalid label %s=%s", l.Key, l.Value)
+		} else if keys[l.Key] {
+			err = fmt.Errorf("error: duplicate label %s", l.Key)
+		}
+
+		keys[l.Key] = true
+	}
+
+	return err
+}
+
+//labelRequirement is a single requirement of a label selector. Without values it requires the label to exist, or to be missing when negated
+type labelRequirement struct {
+	key     string
+	values  []string
+	negated bool
+}
+
+// parseLabelSelector parses a label selector of comma-separated requirements: key, !key, key=value, key==value, key!=value, key in (value,...) and key notin (value,...)
+// Args:	selector
+// Rets:	requirements, error
+func parseLabelSelector(selector string) ([]labelRequirement, error) {
+	var err error
+	requirements := []labelRequirement{}
+
+	for _, term := range splitLabelSelector(selector) {
+		req := labelRequirement{}
+
+		if set := labelSetPattern.FindStringSubmatch(term); set != nil {
+			for _, v := range strings.Split(set[3], ",") {
+				req.values = append(req.values, strings.TrimSpace(v))
+			}
+
+			req.key, req.negated = set[1], set[2] == "notin"
+		} else if i := strings.Index(term, "!="); i > 0 {
+			req.key, req.values, req.negated = term[:i], []string{strings.TrimSpace(term[i+2:])}, true
+		} else if i := strings.Index(term, "="); i > 0 {
+			req.key, req.values = term[:i], []string{strings.TrimSpace(strings.TrimPrefix(term[i+1:], "="))}
+		} else if strings.HasPrefix(term, "!") {
+			req.key, req.negated = term[1:], true
+		} else {
+			req.key = term
+		}
+
+		if req.key = strings.TrimSpace(req.key); !labelKeyPattern.MatchString(req.key) {
+			err = fmt.Errorf("error: invalid label selector requirement %s", term)
+			break
+		}
+
+		requirements = append(requirements, req)
+	}
+
+	if err == nil && len(requirements) == 0 {
+		err = fmt.Errorf("error: empty label selector")
+	}
+
+	return requirements, err
+}
+
+// labelSelectorFilter builds a database filter from a label selector. Negated requirements also match documents without the label. Requirements are matched against label entries so that the labels index applies
+// Args:	key of the label list, selector
+// Rets:	filter, error
+func labelSelectorFilter(key string, selector string) (bson.M, error) {
+	requirements, err := parseLabelSelector(selector)
+	filters := []bson.M{}
+
+	for _, req := range requirements {
+		match := bson.M{"key": req.key}
+
+		if req.values != nil {
+			match["value"] = bson.M{"$in": req.values}
+		}
+
+		if req.negated {
+			filters = append(filters, bson.M{key: bson.M{"$not": bson.M{"$elemMatch": match}}})
+		} else {
+			filters = append(filters, bson.M{key: bson.M{"$elemMatch": match}})
+		}
+	}
+
+	return bson.M{"$and": filters}, err
+}
+
+// labelSelectorMatches reports whether labels satisfy every requirement of a parsed label selector, the way the database filter of the selector would
+// Args:	requirements, labels
+// Rets:	match
+func labelSelectorMatches(requirements []labelRequirement, labels []m.Label) bool {
+	matches := true
+
+	for _, req := range requirements {
+		found := false
+
+		for _, l := range labels {
+			if l.Key == req.key {
+				found = req.values == nil
+
+				for _, v := range req.values {
+					found = found || v == l.Value
+				}
+			}
+		}
+
+		matches = matches && found != req.negated
+	}
+
+	return matches
+}
+
+// splitLabelSelector splits a label selector into its requirements at commas outside of value sets
+// Args:	selector
+// Rets:	trimmed requirements
+func splitLabelSelector(selector string) []string {
+	terms := []string{}
+	depth, start := 0, 0
+
+	for i, r := range selector + "," {
+		if r == '(' {
+			depth++
+		} else if r == ')' {
+			depth--
+		} else if r == ',' && depth == 0 {
+			if term := strings.TrimSpace(selector[start:i]); term != "" {
+				terms = append(terms, term)
+			}
+			start = i + 1
+		}
+	}
+
+	return terms
+}
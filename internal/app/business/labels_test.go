@@ -0,0 +1,126 @@
+package business
+
+import (
+	"reflect"
+	"testing"
+
+	m "library/internal/app/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestParseLabelSelector(t *testing.T) {
+	tests := []struct {
+		selector     string
+		requirements []labelRequirement
+		wantErr      bool
+	}{
+		{"region", []labelRequirement{{key: "region"}}, false},
+		{"!region", []labelRequirement{{key: "region", negated: true}}, false},
+		{"region=eu", []labelRequirement{{key: "region", values: []string{"eu"}}}, false},
+		{"region==eu", []labelRequirement{{key: "region", values: []string{"eu"}}}, false},
+		{"region!=eu", []labelRequirement{{key: "region", values: []string{"eu"}, negated: true}}, false},
+		{"region=", []labelRequirement{{key: "region", values: []string{""}}}, false},
+		{"region in (eu, us)", []labelRequirement{{key: "region", values: []string{"eu", "us"}}}, false},
+		{"region notin (eu,us)", []labelRequirement{{key: "region", values: []string{"eu", "us"}, negated: true}}, false},
+		{
+			"region in (eu,us), tier!=gold, !retired, team",
+			[]labelRequirement{
+				{key: "region", values: []string{"eu", "us"}},
+				{key: "tier", values: []string{"gold"}, negated: true},
+				{key: "retired", negated: true},
+				{key: "team"},
+			},
+			false,
+		},
+		{" region = eu ,, ", []labelRequirement{{key: "region", values: []string{"eu"}}}, false},
+		{"", nil, true},
+		{" , ", nil, true},
+		{"=eu", nil, true},
+		{"!", nil, true},
+		{"region eu", nil, true},
+		{"region in eu", nil, true},
+		{"_region=eu", nil, true},
+	}
+
+	for _, test := range tests {
+		requirements, err := parseLabelSelector(test.selector)
+
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseLabelSelector(%q) err = %v, wantErr %v", test.selector, err, test.wantErr)
+		} else if !test.wantErr && !reflect.DeepEqual(requirements, test.requirements) {
+			t.Errorf("parseLabelSelector(%q) = %+v, want %+v", test.selector, requirements, test.requirements)
+		}
+	}
+}
+
+func TestLabelSelectorFilter(t *testing.T) {
+	tests := []struct {
+		selector string
+		filter   bson.M
+		wantErr  bool
+	}{
+		{
+			selector: "region in (eu,us),!retired",
+			filter: bson.M{"$and": []bson.M{
+				{"labels": bson.M{"$elemMatch": bson.M{"key": "region", "value": bson.M{"$in": []string{"eu", "us"}}}}},
+				{"labels": bson.M{"$not": bson.M{"$elemMatch": bson.M{"key": "retired"}}}},
+			}},
+		},
+		{
+			selector: "tier!=gold",
+			filter: bson.M{"$and": []bson.M{
+				{"labels": bson.M{"$not": bson.M{"$elemMatch": bson.M{"key": "tier", "value": bson.M{"$in": []string{"gold"}}}}}},
+			}},
+		},
+		{selector: "", wantErr: true},
+		{selector: "region in (eu", wantErr: true},
+	}
+
+	for _, test := range tests {
+		filter, err := labelSelectorFilter("labels", test.selector)
+
+		if (err != nil) != test.wantErr {
+			t.Errorf("labelSelectorFilter(%q) err = %v, wantErr %v", test.selector, err, test.wantErr)
+		} else if !test.wantErr && !reflect.DeepEqual(filter, test.filter) {
+			t.Errorf("labelSelectorFilter(%q) = %v, want %v", test.selector, filter, test.filter)
+		}
+	}
+}
+
+func TestLabelSelectorMatches(t *testing.T) {
+	labels := []m.Label{{Key: "region", Value: "eu"}, {Key: "tier", Value: "gold"}, {Key: "spare", Value: ""}}
+
+	tests := []struct {
+		selector string
+		matches  bool
+	}{
+		{"region", true},
+		{"zone", false},
+		{"!zone", true},
+		{"!region", false},
+		{"region=eu", true},
+		{"region==us", false},
+		{"region!=us", true},
+		{"region!=eu", false},
+		{"zone!=eu", true},
+		{"spare=", true},
+		{"region in (us,eu)", true},
+		{"region in (us,asia)", false},
+		{"region notin (us,asia)", true},
+		{"region notin (us,eu)", false},
+		{"zone notin (eu)", true},
+		{"region in (eu,us),tier=gold", true},
+		{"region in (eu,us),tier=silver", false},
+	}
+
+	for _, test := range tests {
+		requirements, err := parseLabelSelector(test.selector)
+
+		if err != nil {
+			t.Errorf("parseLabelSelector(%q) err = %v", test.selector, err)
+		} else if matches := labelSelectorMatches(requirements, labels); matches != test.matches {
+			t.Errorf("labelSelectorMatches(%q) = %v, want %v", test.selector, matches, test.matches)
+		}
+	}
+}
@@ -0,0 +1,393 @@
+package business
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	m "library/internal/app/models"
+	db "library/internal/pkg/dbutil"
+
+	"github.com/Kamva/mgm"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const defaultListLimit = 100
+const maxListLimit = 1000
+
+// listCursor structure, encoded into the opaque next cursor of a page
+type listCursor struct {
+	Value interface{}        `bson:"v,omitempty"` //Sort key value of the last document on the page
+	Null  bool               `bson:"n,omitempty"` //Whether the last document on the page has no value for the sort key, or a null one
+	ID    primitive.ObjectID `bson:"id"`          //ID of the last document on the page, breaks ties between equal sort key values
+}
+
+// listDocuments runs a paginated query against a collection. Pages are keyset-based: the cursor holds the sort key and ID of the last document returned, so documents inserted or deleted between requests don't shift pages. Documents missing the sort key, or with a null value, sort before all others as in the database
+// Args:	collection model, pointer to an empty slice of models, filter, list request, sortable keys
+// Rets:	http code, list response or error message
+func listDocuments(model mgm.Model, results interface{}, filter bson.M, requestData *m.ListRequest, sortKeys []string) (int, interface{}) {
+	var err error
+	var code int
+	var response interface{}
+	var total int64
+	var next string
+
+	limit := requestData.Limit
+	sortKey := strings.TrimPrefix(requestData.Sort, "-")
+	order := 1
+
+	if limit == 0 {
+		limit = defaultListLimit
+	}
+
+	if strings.HasPrefix(requestData.Sort, "-") {
+		order = -1
+	}
+
+	if sortKey == "" || sortKey == "id" {
+		sortKey = "_id"
+	}
+
+	//Verifying paging parameters
+	if limit < 1 || maxListLimit < limit || !listSortable(sortKey, sortKeys) {
+		code, response = http.StatusBadRequest, m.ListRequestInvalid
+	} else if total, err = mgm.Coll(model).CountDocuments(context.Background(), filter); err != nil {
+		code, response = http.StatusInternalServerError, m.InternalError
+	} else {
+		pageFilter := filter
+
+		//Continuing after the last document of the previous page
+		if requestData.Cursor != "" {
+			var after bson.M
+
+			if after, err = listCursorFilter(requestData.Cursor, sortKey, order); err != nil {
+				code, response = http.StatusBadRequest, m.ListRequestInvalid
+			} else {
+				pageFilter = bson.M{"$and": []bson.M{filter, after}}
+			}
+		}
+
+		if err == nil {
+			sort := bson.D{{Key: sortKey, Value: order}}
+			if sortKey != "_id" {
+				sort = append(sort, bson.E{Key: "_id", Value: order})
+			}
+
+			//Fetching one extra document to find out whether there is a next page
+			if err = mgm.Coll(model).SimpleFind(results, pageFilter, options.Find().SetSort(sort).SetLimit(int64(limit+1))); err != nil {
+				code, response = http.StatusInternalServerError, m.InternalError
+			} else {
+				items := reflect.ValueOf(results).Elem()
+
+				if items.Len() > limit {
+					items.Set(items.Slice(0, limit))
+
+					if next, err = encodeListCursor(items.Index(limit-1).Addr().Interface(), sortKey); err != nil {
+						code, response = http.StatusInternalServerError, m.InternalError
+					}
+				}
+
+				//Empty pages are returned as an empty list rather than null
+				if items.Len() == 0 {
+					items.Set(reflect.MakeSlice(items.Type(), 0, 0))
+				}
+			}
+		}
+
+		if err == nil {
+			code, response = http.StatusOK, &m.ListResponse{
+				Items: projectListItems(results, requestData.Fields),
+				Total: total,
+				Next:  next,
+			}
+		}
+	}
+
+	return code, response
+}
+
+// listSortable reports whether a collection can be sorted by a key
+func listSortable(sortKey string, sortKeys []string) bool {
+	sortable := sortKey == "_id" || sortKey == "created_at" || sortKey == "updated_at"
+
+	for i := 0; !sortable && i < len(sortKeys); i++ {
+		sortable = sortKeys[i] == sortKey
+	}
+
+	return sortable
+}
+
+// encodeListCursor builds the next cursor from the last document of a page
+// Args:	document, sort key
+// Rets:	cursor, error
+func encodeListCursor(doc interface{}, sortKey string) (string, error) {
+	var err error
+	var cursor string
+	var raw bson.Raw
+	var encoded []byte
+
+	if raw, err = bson.Marshal(doc); err == nil {
+		last := listCursor{ID: raw.Lookup("_id").ObjectID()}
+
+		//Sort keys of embedded documents are dotted paths. A missing key looks up as an empty value, which can't be encoded
+		if value, lookupErr := raw.LookupErr(strings.Split(sortKey, ".")...); lookupErr != nil || value.Type == bsontype.Null || value.Type == bsontype.Undefined {
+			last.Null = true
+		} else {
+			last.Value = value
+		}
+
+		if encoded, err = bson.Marshal(last); err == nil {
+			cursor = base64.RawURLEncoding.EncodeToString(encoded)
+		}
+	}
+
+	return cursor, err
+}
+
+// listCursorFilter decodes a cursor into a filter matching documents after it in sort order
+// Args:	cursor, sort key, sort order
+// Rets:	filter, error
+func listCursorFilter(cursor string, sortKey string, order int) (bson.M, error) {
+	var err error
+	var filter bson.M
+	var raw []byte
+	last := listCursor{}
+	op := "$gt"
+
+	if order < 0 {
+		op = "$lt"
+	}
+
+	if raw, err = base64.RawURLEncoding.DecodeString(cursor); err == nil {
+		if err = bson.Unmarshal(raw, &last); err == nil {
+			//Null matches documents missing the key as well as those with a null value, which sort before any other value
+			if sortKey == "_id" {
+				filter = bson.M{"_id": bson.M{op: last.ID}}
+			} else if last.Null && order > 0 {
+				filter = bson.M{"$or": []bson.M{
+					{sortKey: bson.M{"$ne": nil}},
+					{sortKey: nil, "_id": bson.M{op: last.ID}},
+				}}
+			} else if last.Null {
+				filter = bson.M{sortKey: nil, "_id": bson.M{op: last.ID}}
+			} else if order > 0 {
+				filter = bson.M{"$or": []bson.M{
+					{sortKey: bson.M{op: last.Value}},
+					{sortKey: last.Value, "_id": bson.M{op: last.ID}},
+				}}
+			} else {
+				filter = bson.M{"$or": []bson.M{
+					{sortKey: bson.M{op: last.Value}},
+					{sortKey: last.Value, "_id": bson.M{op: last.ID}},
+					{sortKey: nil},
+				}}
+			}
+		}
+	}
+
+	return filter, err
+}
+
+// projectListItems reduces documents to the requested keys. Documents are returned unchanged when no keys are requested
+// Args:	pointer to a slice of models, comma-separated keys
+// Rets:	documents
+func projectListItems(results interface{}, fields string) interface{} {
+	var items interface{} = reflect.ValueOf(results).Elem().Interface()
+
+	if fields != "" {
+		var dataMap []map[string]interface{}
+		keep := map[string]bool{"_id": true}
+
+		for _, key := range strings.Split(fields, ",") {
+			keep[strings.TrimSpace(key)] = true
+		}
+
+		//Have to marshal into json and unmarshal into a map
+		marsh, _ := json.Marshal(items)
+		json.Unmarshal(marsh, &dataMap)
+
+		for _, doc := range dataMap {
+			for key := range doc {
+				if !keep[key] {
+					delete(doc, key)
+				}
+			}
+		}
+
+		items = dataMap
+	}
+
+	return items
+}
+
+// listFilter builds a database filter from the filters of a list request. Filters which don't apply to the collection have to be left out of the allowed list and are ignored
+// Args:	list request, allowed filters
+// Rets:	filter, error
+func listFilter(requestData *m.ListRequest, allowed ...string) (bson.M, error) {
+	var err error
+	filter := bson.M{}
+
+	for _, name := range allowed {
+		switch name {
+		case "name":
+			if requestData.Name != "" {
+				filter["name"] = bson.M{"$regex": "^" + regexp.QuoteMeta(requestData.Name)}
+			}
+
+		case "template":
+			if requestData.Template != "" {
+				if !db.VerifyObjectIDString(requestData.Template) {
+					err = fmt.Errorf("error: invalid template id")
+				}
+				filter["templateid"] = requestData.Template
+			}
+
+		//Resources keep a list of projects, sessions a single project
+		case "projects", "project":
+			if requestData.Project != "" {
+				if !db.VerifyObjectIDString(requestData.Project) {
+					err = fmt.Errorf("error: invalid project id")
+				}
+				filter[name] = requestData.Project
+			}
+
+		case "active":
+			if requestData.Active != "" {
+				var active bool
+
+				if active, err = strconv.ParseBool(requestData.Active); err == nil {
+					filter["active"] = active
+				}
+			}
+
+		case "checkedout":
+			if requestData.CheckedOut != "" {
+				var checkedOut bool
+
+				if checkedOut, err = strconv.ParseBool(requestData.CheckedOut); err == nil {
+					if checkedOut {
+						filter["checkedout"] = bson.M{"$gt": 0}
+					} else {
+						filter["checkedout"] = bson.M{"$lte": 0}
+					}
+				}
+			}
+
+		case "field":
+			if requestData.Field != "" {
+				filter["fields"] = fieldFilter(requestData.Field)
+			}
+
+		//Resources are labelled themselves, sessions through their metadata
+		case "labels", "metadata.labels":
+			if requestData.Labels != "" {
+				var selector bson.M
+
+				if selector, err = labelSelectorFilter(name, requestData.Labels); err == nil {
+					filter["$and"] = selector["$and"]
+				}
+			}
+
+		case "owner", "runner":
+			value := map[string]string{"owner": requestData.Owner, "runner": requestData.Runner}[name]
+
+			if value != "" {
+				filter["metadata."+name] = value
+			}
+
+		case "commit":
+			if requestData.Commit != "" {
+				filter["metadata.commit"] = bson.M{"$regex": "^" + regexp.QuoteMeta(requestData.Commit)}
+			}
+
+		case "job":
+			if requestData.Job != "" {
+				filter["metadata.joburl"] = bson.M{"$regex": "^" + regexp.QuoteMeta(requestData.Job)}
+			}
+
+		case "reason":
+			if requestData.Reason != "" {
+				if requestData.Reason != m.CloseExplicit && requestData.Reason != m.CloseExpired && requestData.Reason != m.CloseAdmin && requestData.Reason != m.CloseLeaseLost {
+					err = fmt.Errorf("error: invalid close reason")
+				}
+				filter["reason"] = requestData.Reason
+			}
+
+		case "resources":
+			if requestData.Resource != "" {
+				if !db.VerifyObjectIDString(requestData.Resource) {
+					err = fmt.Errorf("error: invalid resource id")
+				}
+				filter["resources"] = requestData.Resource
+			}
+
+		//Closed sessions are listed by the time they were closed
+		case "closed":
+			bounds := bson.M{}
+
+			for op, value := range map[string]string{"$gte": requestData.From, "$lt": requestData.To} {
+				if value != "" && err == nil {
+					var t time.Time
+
+					if t, err = time.Parse(time.RFC3339, value); err == nil {
+						bounds[op] = t
+					}
+				}
+			}
+
+			if len(bounds) > 0 {
+				filter["closed"] = bounds
+			}
+
+		//Resources created before health states existed have none and are healthy
+		case "health":
+			if requestData.Health == m.HealthQuarantined {
+				filter["health"] = m.HealthQuarantined
+			} else if requestData.Health == m.HealthHealthy {
+				filter["health"] = bson.M{"$ne": m.HealthQuarantined}
+			} else if requestData.Health != "" {
+				err = fmt.Errorf("error: invalid health state")
+			}
+		}
+
+		if err != nil {
+			break
+		}
+	}
+
+	return filter, err
+}
+
+// fieldFilter matches resources with a field of the given key, and value if passed as key:value. Values are matched as strings, and as numbers or booleans where they parse as such
+// Args:	key or key:value
+// Rets:	filter
+func fieldFilter(field string) bson.M {
+	parts := strings.SplitN(field, ":", 2)
+	match := bson.M{"key": parts[0]}
+
+	if len(parts) == 2 {
+		values := []interface{}{parts[1]}
+
+		if number, err := strconv.ParseFloat(parts[1], 64); err == nil {
+			values = append(values, number)
+		}
+
+		if boolean, err := strconv.ParseBool(parts[1]); err == nil {
+			values = append(values, boolean)
+		}
+
+		match["value"] = bson.M{"$in": values}
+	}
+
+	return bson.M{"$elemMatch": match}
+}
@@ -0,0 +1,72 @@
+package business
+
+import (
+	"reflect"
+	"testing"
+
+	m "library/internal/app/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestListCursorMissingSortKey(t *testing.T) {
+	id := primitive.NewObjectID()
+
+	//Sessions started before metadata existed have no owner, others may have a null one
+	for _, doc := range []bson.M{{"_id": id}, {"_id": id, "metadata": bson.M{}}, {"_id": id, "metadata": bson.M{"owner": nil}}} {
+		cursor, err := encodeListCursor(doc, "metadata.owner")
+		if err != nil {
+			t.Fatalf("encoding the cursor of %v: %v", doc, err)
+		}
+
+		asc, err := listCursorFilter(cursor, "metadata.owner", 1)
+		if err != nil {
+			t.Fatalf("decoding the cursor of %v: %v", doc, err)
+		}
+
+		want := bson.M{"$or": []bson.M{
+			{"metadata.owner": bson.M{"$ne": nil}},
+			{"metadata.owner": nil, "_id": bson.M{"$gt": id}},
+		}}
+		if !reflect.DeepEqual(asc, want) {
+			t.Errorf("ascending filter after %v = %v, want %v", doc, asc, want)
+		}
+
+		desc, _ := listCursorFilter(cursor, "metadata.owner", -1)
+		if want := (bson.M{"metadata.owner": nil, "_id": bson.M{"$lt": id}}); !reflect.DeepEqual(desc, want) {
+			t.Errorf("descending filter after %v = %v, want %v", doc, desc, want)
+		}
+	}
+}
+
+func TestListCursorSortKeyValue(t *testing.T) {
+	resource := &m.Resource{CheckedOut: 0}
+	resource.ID = primitive.NewObjectID()
+
+	cursor, err := encodeListCursor(resource, "checkedout")
+	if err != nil {
+		t.Fatal("encoding the cursor:", err)
+	}
+
+	//A zero value is a value, not a missing one
+	asc, _ := listCursorFilter(cursor, "checkedout", 1)
+	want := bson.M{"$or": []bson.M{
+		{"checkedout": bson.M{"$gt": int32(0)}},
+		{"checkedout": int32(0), "_id": bson.M{"$gt": resource.ID}},
+	}}
+	if !reflect.DeepEqual(asc, want) {
+		t.Errorf("ascending filter = %v, want %v", asc, want)
+	}
+
+	//Documents without a value come last in descending order
+	desc, _ := listCursorFilter(cursor, "checkedout", -1)
+	want = bson.M{"$or": []bson.M{
+		{"checkedout": bson.M{"$lt": int32(0)}},
+		{"checkedout": int32(0), "_id": bson.M{"$lt": resource.ID}},
+		{"checkedout": nil},
+	}}
+	if !reflect.DeepEqual(desc, want) {
+		t.Errorf("descending filter = %v, want %v", desc, want)
+	}
+}
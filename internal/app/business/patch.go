@@ -0,0 +1,153 @@
+package business
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+
+	m "library/internal/app/models"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/bsontype"
+)
+
+//Registry decoding embedded documents held by values of any type as maps rather than primitive.D, which json marshals into lists of keys and values
+var plainRegistry = bson.NewRegistryBuilder().RegisterTypeMapEntry(bsontype.EmbeddedDocument, reflect.TypeOf(map[string]interface{}{})).Build()
+
+// mergePatch applies an RFC 7396 merge patch to a decoded JSON value. Objects are merged recursively, null removes a key and any other value replaces the target
+// Args:	target, patch
+// Rets:	patched value
+func mergePatch(target interface{}, patch interface{}) interface{} {
+	patched := patch
+
+	if patchMap, ok := patch.(map[string]interface{}); ok {
+		targetMap, ok := target.(map[string]interface{})
+		if !ok {
+			targetMap = map[string]interface{}{}
+		}
+
+		for key, value := range patchMap {
+			if value == nil {
+				delete(targetMap, key)
+			} else {
+				targetMap[key] = mergePatch(targetMap[key], value)
+			}
+		}
+
+		patched = targetMap
+	}
+
+	return patched
+}
+
+// mergeKeyedListPatch applies a patch of a list of objects with unique keys, such as fields or project settings. A list replaces the whole list, as in RFC 7396. An object keyed by key merges each value into the list element with that key: null removes the element and keys not present yet are appended in key order, keeping the order of the remaining elements
+// Args:	current list, patch
+// Rets:	patched list, error
+func mergeKeyedListPatch(list interface{}, patch interface{}) (interface{}, error) {
+	var err error
+	var patched interface{} = patch
+
+	if patchMap, ok := patch.(map[string]interface{}); ok {
+		merged := []interface{}{}
+		current, _ := list.([]interface{})
+		seen := map[string]bool{}
+
+		//Each element patch has to be an object merged into the element
+		for _, value := range patchMap {
+			if _, ok = value.(map[string]interface{}); !ok && value != nil {
+				err = fmt.Errorf("error: list element patch is not an object")
+			}
+		}
+
+		for _, f := range current {
+			field, _ := f.(map[string]interface{})
+			key, _ := field["key"].(string)
+			seen[key] = true
+
+			if value, ok := patchMap[key]; !ok {
+				merged = append(merged, field)
+			} else if value != nil {
+				merged = append(merged, mergePatch(field, value))
+			}
+		}
+
+		//JSON objects carry no key order, so new elements are appended sorted by key
+		added := []string{}
+
+		for key, value := range patchMap {
+			if !seen[key] && value != nil {
+				added = append(added, key)
+			}
+		}
+
+		sort.Strings(added)
+
+		for _, key := range added {
+			field := mergePatch(map[string]interface{}{}, patchMap[key]).(map[string]interface{})
+			field["key"] = key
+			merged = append(merged, field)
+		}
+
+		patched = merged
+	}
+
+	return patched, err
+}
+
+// applyMergePatch patches a stored document into an update request. Only keys the update request accepts can be patched, so read-only keys such as ids, counters and timestamps are rejected rather than silently dropped
+// Args:	pointer to the stored document, merge patch, pointer to the update request, patchable keys
+// Rets:	error
+func applyMergePatch(doc interface{}, patch m.MergePatch, requestData interface{}, keys ...string) error {
+	var err error
+	var marsh []byte
+	var current map[string]interface{}
+	allowed := map[string]bool{}
+
+	for _, key := range keys {
+		allowed[key] = true
+	}
+
+	for key := range patch {
+		if !allowed[key] {
+			err = fmt.Errorf("error: %s cannot be patched", key)
+		}
+	}
+
+	//Stored object values are decoded as primitive.D; decoding the document again turns them into maps, so that values the patch leaves alone keep their shape
+	plain := reflect.New(reflect.TypeOf(doc).Elem()).Interface()
+	if err == nil {
+		if marsh, err = bson.Marshal(doc); err == nil {
+			err = bson.UnmarshalWithRegistry(plainRegistry, marsh, plain)
+		}
+	}
+
+	//Have to marshal into json and unmarshal into a map
+	if err == nil {
+		if marsh, err = json.Marshal(plain); err == nil {
+			err = json.Unmarshal(marsh, &current)
+		}
+	}
+
+	if err == nil {
+		for key, value := range patch {
+			if (key == "fields" || key == "settings") && value != nil {
+				if current[key], err = mergeKeyedListPatch(current[key], value); err != nil {
+					break
+				}
+			} else if value == nil {
+				delete(current, key)
+			} else {
+				current[key] = mergePatch(current[key], value)
+			}
+		}
+	}
+
+	if err == nil {
+		if marsh, err = json.Marshal(current); err == nil {
+			err = json.Unmarshal(marsh, requestData)
+		}
+	}
+
+	return err
+}
@@ -0,0 +1,173 @@
+package business
+
+import (
+	"reflect"
+	"testing"
+
+	m "library/internal/app/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestApplyMergePatchKeepsObjectValues(t *testing.T) {
+	//Object values read back from the database are decoded as primitive.D
+	resource := &m.Resource{
+		Name: "phone",
+		Fields: []m.Field{
+			{Type: "object", Key: "location", Value: primitive.D{{Key: "rack", Value: "r1"}, {Key: "slot", Value: int32(3)}}},
+			{Type: "list", Key: "ports", Value: primitive.A{primitive.D{{Key: "port", Value: int32(22)}}, "usb"}},
+		},
+	}
+	requestData := &m.ResourceUpdateRequest{}
+
+	if err := applyMergePatch(resource, m.MergePatch{"name": "tablet"}, requestData, "name", "fields"); err != nil {
+		t.Fatalf("patch failed: %v", err)
+	}
+
+	if requestData.Name != "tablet" {
+		t.Errorf("name = %q, want tablet", requestData.Name)
+	}
+
+	location := map[string]interface{}{"rack": "r1", "slot": float64(3)}
+	if len(requestData.Fields) != 2 || !reflect.DeepEqual(requestData.Fields[0].Value, location) {
+		t.Errorf("location = %#v, want %#v", requestData.Fields, location)
+	}
+
+	ports := []interface{}{map[string]interface{}{"port": float64(22)}, "usb"}
+	if len(requestData.Fields) != 2 || !reflect.DeepEqual(requestData.Fields[1].Value, ports) {
+		t.Errorf("ports = %#v, want %#v", requestData.Fields, ports)
+	}
+}
+
+func TestApplyMergePatchMergesObjectValues(t *testing.T) {
+	resource := &m.Resource{
+		Name:   "phone",
+		Fields: []m.Field{{Type: "object", Key: "location", Value: primitive.D{{Key: "rack", Value: "r1"}, {Key: "slot", Value: int32(3)}}}},
+	}
+	requestData := &m.ResourceUpdateRequest{}
+	patch := m.MergePatch{"fields": map[string]interface{}{"location": map[string]interface{}{"value": map[string]interface{}{"slot": nil, "shelf": "top"}}}}
+
+	if err := applyMergePatch(resource, patch, requestData, "name", "fields"); err != nil {
+		t.Fatalf("patch failed: %v", err)
+	}
+
+	location := map[string]interface{}{"rack": "r1", "shelf": "top"}
+	if len(requestData.Fields) != 1 || !reflect.DeepEqual(requestData.Fields[0].Value, location) {
+		t.Errorf("location = %#v, want %#v", requestData.Fields, location)
+	}
+}
+
+func TestApplyMergePatchRejectsReadOnlyKeys(t *testing.T) {
+	if err := applyMergePatch(&m.Resource{}, m.MergePatch{"checkedout": 0}, &m.ResourceUpdateRequest{}, "name"); err == nil {
+		t.Error("patching checkedout succeeded")
+	}
+}
+
+func TestMergeKeyedListPatch(t *testing.T) {
+	list := []interface{}{
+		map[string]interface{}{"key": "os", "type": "string", "value": "android"},
+		map[string]interface{}{"key": "sims", "type": "subresource", "value": float64(2)},
+		map[string]interface{}{"key": "ram", "type": "number", "value": float64(4)},
+	}
+
+	tests := []struct {
+		name    string
+		patch   interface{}
+		want    interface{}
+		wantErr bool
+	}{
+		{
+			name:  "value of an entry keeps the key order",
+			patch: map[string]interface{}{"sims": map[string]interface{}{"value": float64(1)}},
+			want: []interface{}{
+				map[string]interface{}{"key": "os", "type": "string", "value": "android"},
+				map[string]interface{}{"key": "sims", "type": "subresource", "value": float64(1)},
+				map[string]interface{}{"key": "ram", "type": "number", "value": float64(4)},
+			},
+		},
+		{
+			name:  "null removes an entry",
+			patch: map[string]interface{}{"sims": nil},
+			want: []interface{}{
+				map[string]interface{}{"key": "os", "type": "string", "value": "android"},
+				map[string]interface{}{"key": "ram", "type": "number", "value": float64(4)},
+			},
+		},
+		{
+			name:  "null of an unknown key",
+			patch: map[string]interface{}{"vendor": nil},
+			want:  list,
+		},
+		{
+			name: "unknown keys are appended in key order",
+			patch: map[string]interface{}{
+				"vendor": map[string]interface{}{"type": "string", "value": "acme"},
+				"color":  map[string]interface{}{"type": "string", "value": "black"},
+				"os":     map[string]interface{}{"value": "ios"},
+			},
+			want: []interface{}{
+				map[string]interface{}{"key": "os", "type": "string", "value": "ios"},
+				map[string]interface{}{"key": "sims", "type": "subresource", "value": float64(2)},
+				map[string]interface{}{"key": "ram", "type": "number", "value": float64(4)},
+				map[string]interface{}{"key": "color", "type": "string", "value": "black"},
+				map[string]interface{}{"key": "vendor", "type": "string", "value": "acme"},
+			},
+		},
+		{
+			name:  "list replaces the whole list",
+			patch: []interface{}{map[string]interface{}{"key": "ram", "type": "number", "value": float64(8)}},
+			want:  []interface{}{map[string]interface{}{"key": "ram", "type": "number", "value": float64(8)}},
+		},
+		{
+			name:    "entry patch which is not an object",
+			patch:   map[string]interface{}{"os": "ios"},
+			wantErr: true,
+		},
+	}
+
+	for _, test := range tests {
+		//Patches merge into the entries, so each case gets its own copy of the list
+		current := []interface{}{}
+		for _, f := range list {
+			field := map[string]interface{}{}
+			for k, v := range f.(map[string]interface{}) {
+				field[k] = v
+			}
+			current = append(current, field)
+		}
+
+		patched, err := mergeKeyedListPatch(current, test.patch)
+
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", test.name, err, test.wantErr)
+		} else if !test.wantErr && !reflect.DeepEqual(patched, test.want) {
+			t.Errorf("%s: got = %v, want %v", test.name, patched, test.want)
+		}
+	}
+}
+
+func TestApplyMergePatchRemovesSettings(t *testing.T) {
+	project := &m.Project{
+		Name: "lab",
+		Settings: []m.ProjectSetting{
+			{Key: "timeout", Value: "10m"},
+			{Key: "region", Value: "eu"},
+			{Key: "owner", Value: "qa"},
+		},
+	}
+	requestData := &m.ProjectRequest{}
+	patch := m.MergePatch{"settings": map[string]interface{}{"region": nil, "tier": map[string]interface{}{"value": "gold"}}}
+
+	if err := applyMergePatch(project, patch, requestData, "name", "settings"); err != nil {
+		t.Fatalf("patch failed: %v", err)
+	}
+
+	keys := []string{}
+	for _, s := range requestData.Settings {
+		keys = append(keys, s.Key)
+	}
+
+	if want := []string{"timeout", "owner", "tier"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("settings = %v, want %v", keys, want)
+	}
+}
@@ -0,0 +1,431 @@
+package business
+
+import (
+	"context"
+	"math/rand"
+	"net/http"
+	"sort"
+	"time"
+
+	m "library/internal/app/models"
+	db "library/internal/pkg/dbutil"
+	"library/internal/pkg/lockutil"
+
+	"github.com/Kamva/mgm"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+//Source of the random selection strategy; used under the lock of Sessions only
+var poolRandom = rand.New(rand.NewSource(time.Now().UnixNano()))
+
+// CreatePoolBusiness godoc
+func CreatePoolBusiness(requestData *m.PoolRequest, mux *lockutil.Locks) (int, interface{}) {
+	var code int
+	var response interface{}
+	pool := &m.Pool{}
+
+	unlock := mux.Lock("Pools")
+
+	//Verifying that the pool name is unique
+	if err := mgm.Coll(pool).First(bson.M{"name": requestData.Name}, &m.Pool{}); err == nil {
+		code, response = http.StatusConflict, m.PoolExists
+	} else if code, response = validatePool(requestData); response == nil {
+		setPool(pool, requestData)
+
+		if err = mgm.Coll(pool).Create(pool); err != nil {
+			code, response = http.StatusInternalServerError, m.InternalError
+		} else {
+			code, response = http.StatusCreated, pool
+		}
+	}
+
+	unlock()
+
+	return code, response
+}
+
+// ShowAllPoolsBusiness godoc
+func ShowAllPoolsBusiness(requestData *m.ListRequest) (int, interface{}) {
+	var err error
+	var code int
+	var response interface{}
+	var filter bson.M
+	poolsFound := []m.Pool{}
+
+	if filter, err = listFilter(requestData, "name", "projects"); err != nil {
+		code, response = http.StatusBadRequest, m.ListRequestInvalid
+	} else {
+		code, response = listDocuments(&m.Pool{}, &poolsFound, filter, requestData, []string{"name"})
+	}
+
+	return code, response
+}
+
+// ShowPoolBusiness godoc
+func ShowPoolBusiness(id string) (int, interface{}) {
+	var code int
+	var response interface{}
+	pool := &m.Pool{}
+
+	if err := mgm.Coll(pool).FindByID(id, pool); err != nil {
+		code, response = http.StatusNotFound, m.PoolNotFound
+	} else {
+		code, response = http.StatusOK, pool
+	}
+
+	return code, response
+}
+
+// ShowPoolResourcesBusiness godoc
+func ShowPoolResourcesBusiness(id string, requestData *m.ListRequest, expand []string) (int, interface{}) {
+	var err error
+	var code int
+	var response interface{}
+	var filter bson.M
+	pool := &m.Pool{}
+	resourcesFound := []m.Resource{}
+
+	if err = mgm.Coll(pool).FindByID(id, pool); err != nil {
+		code, response = http.StatusNotFound, m.PoolNotFound
+	} else if filter, err = listFilter(requestData, "name", "template", "projects", "active", "checkedout", "field", "health", "labels"); err != nil {
+		code, response = http.StatusBadRequest, m.ListRequestInvalid
+	} else if code, response = listDocuments(&m.Resource{}, &resourcesFound, bson.M{"$and": []bson.M{poolMembers(pool), filter}}, requestData, []string{"name", "checkedout"}); code == http.StatusOK && len(expand) > 0 {
+		//References are expanded on the documents already listed; projection has to be applied again
+		for i := range resourcesFound {
+			expandResourceReferences(&resourcesFound[i], expand)
+		}
+
+		response.(*m.ListResponse).Items = projectListItems(&resourcesFound, requestData.Fields)
+	}
+
+	return code, response
+}
+
+// UpdatePoolBusiness godoc
+func UpdatePoolBusiness(id string, requestData *m.PoolRequest, ifMatch string, mux *lockutil.Locks) (int, interface{}) {
+	var code int
+	var response interface{}
+	pool := &m.Pool{}
+
+	unlock := mux.Lock("Pools")
+
+	if err := mgm.Coll(pool).FindByID(id, pool); err != nil {
+		code, response = http.StatusNotFound, m.PoolNotFound
+	} else if !etagMatches(ifMatch, pool.Revision) {
+		code, response = http.StatusPreconditionFailed, m.PreconditionFailed
+	} else if err = mgm.Coll(pool).First(bson.M{"name": requestData.Name, "_id": bson.M{"$ne": pool.ID}}, &m.Pool{}); err == nil {
+		code, response = http.StatusConflict, m.PoolExists
+	} else if code, response = validatePool(requestData); response == nil {
+		//Sessions keep resources they no longer have access to until they check them in
+		setPool(pool, requestData)
+
+		if err = mgm.Coll(pool).Update(pool); err != nil {
+			code, response = http.StatusInternalServerError, m.InternalError
+		} else {
+			code, response = http.StatusOK, pool
+		}
+	}
+
+	unlock()
+
+	return code, response
+}
+
+// DeletePoolBusiness godoc
+func DeletePoolBusiness(id string, ifMatch string, mux *lockutil.Locks) (int, interface{}) {
+	var code int
+	var response interface{}
+	pool := &m.Pool{}
+
+	unlock := mux.Lock("Pools")
+
+	if err := mgm.Coll(pool).FindByID(id, pool); err != nil {
+		code, response = http.StatusNotFound, m.PoolNotFound
+	} else if !etagMatches(ifMatch, pool.Revision) {
+		code, response = http.StatusPreconditionFailed, m.PreconditionFailed
+	} else if err = mgm.Coll(pool).Delete(pool); err != nil {
+		code, response = http.StatusInternalServerError, m.InternalError
+	} else {
+		code, response = http.StatusOK, m.PoolDeleteSuccess
+	}
+
+	unlock()
+
+	return code, response
+}
+
+// PoolCheckoutBusiness godoc
+func PoolCheckoutBusiness(sessID string, poolID string, labels string, mode string, expand []string, mux *lockutil.Locks) (int, interface{}) {
+	var err error
+	var code int
+	var response interface{}
+	var filter bson.M
+	session := &m.Session{}
+	pool := &m.Pool{}
+	candidates := []m.Resource{}
+
+	unlock := mux.Lock("Sessions", "Resources", "Pools", "Reservations")
+
+	if labels != "" {
+		filter, err = labelSelectorFilter("labels", labels)
+	}
+
+	if err != nil || (mode != "" && mode != m.ModeShared && mode != m.ModeExclusive) {
+		code, response = http.StatusBadRequest, m.PoolCheckoutInvalid
+	} else if err = mgm.Coll(session).FindByID(sessID, session); err != nil {
+		code, response = http.StatusNotFound, m.SessionNotFound
+	} else if err = mgm.Coll(pool).FindByID(poolID, pool); err != nil {
+		code, response = http.StatusNotFound, m.PoolNotFound
+	} else if !resourceInList(pool.Projects, session.Project) {
+		code, response = http.StatusForbidden, m.PoolProjectMismatch
+	} else if code, response = poolShareExceeded(pool, session.Project); response == nil {
+		if mode == "" {
+			mode = pool.Policy.Mode
+		}
+
+		//Members which may be checked out in the requested mode, leaving those the session holds
+		available := []bson.M{poolMembers(pool), {
+			"_id":       bson.M{"$nin": objectIDs(session.Resources)},
+			"active":    true,
+			"health":    bson.M{"$ne": m.HealthQuarantined},
+			"exclusive": bson.M{"$ne": true},
+		}}
+
+		if mode == m.ModeExclusive {
+			available = append(available, bson.M{"checkedout": bson.M{"$lte": 0}})
+		}
+
+		if filter != nil {
+			available = append(available, filter)
+		}
+
+		if err = mgm.Coll(&m.Resource{}).SimpleFind(&candidates, bson.M{"$and": available}, options.Find().SetSort(bson.M{"name": 1})); err != nil {
+			code, response = http.StatusInternalServerError, m.InternalError
+		} else {
+			orderPoolCandidates(candidates, pool.Policy.Strategy)
+			code, response = http.StatusConflict, m.PoolExhausted
+
+			//Candidates refused on checkout, e.g. reserved for another project, are passed over
+			for i := 0; code == http.StatusConflict && i < len(candidates); i++ {
+				code, response = checkoutForSession(session, &candidates[i], mode == m.ModeExclusive, expand)
+			}
+
+			if code == http.StatusConflict {
+				response = m.PoolExhausted
+			}
+		}
+	}
+
+	unlock()
+
+	return code, response
+}
+
+// validatePool checks a pool request: ids of resources and projects have to be valid, unique and exist, the selector has to parse, shares have to belong to projects of the pool, and the policy has to name a known mode and strategy
+// Args:	pool request
+// Rets:	http code and error message, or nil message when the request is valid
+func validatePool(requestData *m.PoolRequest) (int, interface{}) {
+	var code int
+	var response interface{}
+	var resources, projects int64
+	var err error
+	shares := map[string]bool{}
+	policy := requestData.Policy
+	valid := requestData.Name != "" && db.VerifyObjectIDString(requestData.Resources) && db.VerifyObjectIDString(requestData.Projects) &&
+		uniqueIDs(requestData.Resources) && uniqueIDs(requestData.Projects) &&
+		(policy.Mode == "" || policy.Mode == m.ModeShared || policy.Mode == m.ModeExclusive) &&
+		(policy.Strategy == "" || policy.Strategy == m.StrategyFirst || policy.Strategy == m.StrategyRandom || policy.Strategy == m.StrategyLeastUsed)
+
+	if requestData.Selector != "" {
+		_, err = parseLabelSelector(requestData.Selector)
+		valid = valid && err == nil
+	}
+
+	for _, s := range policy.Shares {
+		valid = valid && !shares[s.Project] && resourceInList(requestData.Projects, s.Project) && s.Share >= 1 && s.Share <= 100
+		shares[s.Project] = true
+	}
+
+	if valid {
+		resources, err = mgm.Coll(&m.Resource{}).CountDocuments(context.Background(), bson.M{"_id": bson.M{"$in": objectIDs(requestData.Resources)}})
+
+		if err == nil {
+			projects, err = mgm.Coll(&m.Project{}).CountDocuments(context.Background(), bson.M{"_id": bson.M{"$in": objectIDs(requestData.Projects)}})
+		}
+	}
+
+	if !valid {
+		code, response = http.StatusBadRequest, m.PoolValidateFailed
+	} else if err != nil {
+		code, response = http.StatusInternalServerError, m.InternalError
+	} else if int(resources) != len(requestData.Resources) {
+		code, response = http.StatusNotFound, m.ResourceNotFound
+	} else if int(projects) != len(requestData.Projects) {
+		code, response = http.StatusNotFound, m.ProjectNotFound
+	}
+
+	return code, response
+}
+
+// setPool transfers a validated pool request into the pool, filling in the default mode and strategy
+// Args:	pool, pool request
+func setPool(pool *m.Pool, requestData *m.PoolRequest) {
+	pool.Name = requestData.Name
+	pool.Description = requestData.Description
+	pool.Resources = append([]string{}, requestData.Resources...)
+	pool.Selector = requestData.Selector
+	pool.Projects = append([]string{}, requestData.Projects...)
+	pool.Policy = requestData.Policy
+
+	if pool.Policy.Shares == nil {
+		pool.Policy.Shares = []m.PoolShare{}
+	}
+
+	if pool.Policy.Mode == "" {
+		pool.Policy.Mode = m.ModeShared
+	}
+
+	if pool.Policy.Strategy == "" {
+		pool.Policy.Strategy = m.StrategyFirst
+	}
+}
+
+// poolMembers builds the database filter matching the members of a pool, its static resources and the resources matching its selector
+// Args:	pool
+// Rets:	filter
+func poolMembers(pool *m.Pool) bson.M {
+	members := []bson.M{{"_id": bson.M{"$in": objectIDs(pool.Resources)}}}
+
+	//Selectors are validated when the pool is saved
+	if selector, err := labelSelectorFilter("labels", pool.Selector); err == nil {
+		members = append(members, selector)
+	}
+
+	return bson.M{"$or": members}
+}
+
+// poolGrants reports whether a resource is a member of a pool open to a project
+// Args:	project id, resource
+// Rets:	whether a pool grants the project access to the resource
+func poolGrants(projID string, resource *m.Resource) bool {
+	granted := false
+	poolsFound := []m.Pool{}
+
+	_ = mgm.Coll(&m.Pool{}).SimpleFind(&poolsFound, bson.M{"projects": projID})
+
+	for _, pool := range poolsFound {
+		granted = granted || resourceInList(pool.Resources, resource.ID.Hex())
+
+		if requirements, err := parseLabelSelector(pool.Selector); err == nil {
+			granted = granted || labelSelectorMatches(requirements, resource.Labels)
+		}
+	}
+
+	return granted
+}
+
+// poolShareExceeded checks whether the sessions of a project hold as many members of a pool as its share allows. A share allows at least one resource
+// Args:	pool, project id
+// Rets:	http code and error message, or nil message when the project may check out another member
+func poolShareExceeded(pool *m.Pool, projID string) (int, interface{}) {
+	var err error
+	var code int
+	var response interface{}
+	var size, held int64
+	sessionsFound := []m.Session{}
+	holding := []string{}
+	share := pool.Share(projID)
+
+	if share < 100 {
+		if err = mgm.Coll(&m.Session{}).SimpleFind(&sessionsFound, bson.M{"project": projID}); err == nil {
+			for _, s := range sessionsFound {
+				holding = append(holding, s.Resources...)
+			}
+
+			if size, err = mgm.Coll(&m.Resource{}).CountDocuments(context.Background(), poolMembers(pool)); err == nil {
+				held, err = mgm.Coll(&m.Resource{}).CountDocuments(context.Background(), bson.M{"$and": []bson.M{poolMembers(pool), {"_id": bson.M{"$in": objectIDs(holding)}}}})
+			}
+		}
+
+		if err != nil {
+			code, response = http.StatusInternalServerError, m.InternalError
+		} else if limit := (size*int64(share) + 99) / 100; held >= limit && held > 0 {
+			code, response = http.StatusConflict, m.PoolShareExceeded
+		}
+	}
+
+	return code, response
+}
+
+// orderPoolCandidates orders the candidates of a pool checkout, sorted by name, by the selection strategy of the pool
+// Args:	candidates, strategy
+func orderPoolCandidates(candidates []m.Resource, strategy string) {
+	if strategy == m.StrategyRandom {
+		poolRandom.Shuffle(len(candidates), func(i, j int) { candidates[i], candidates[j] = candidates[j], candidates[i] })
+	} else if strategy == m.StrategyLeastUsed {
+		sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].CheckedOut < candidates[j].CheckedOut })
+	}
+}
+
+// removePoolReferences removes a deleted resource from the static members of pools, or a deleted project from their projects and shares
+// Args:	transaction context, resource id or empty string, project id or empty string
+// Rets:	error
+func removePoolReferences(ctx context.Context, resID string, projID string) error {
+	pull := bson.M{}
+	referencing := []bson.M{}
+
+	if resID != "" {
+		pull["resources"] = resID
+		referencing = append(referencing, bson.M{"resources": resID})
+	}
+
+	if projID != "" {
+		pull["projects"], pull["policy.shares"] = projID, bson.M{"project": projID}
+		referencing = append(referencing, bson.M{"projects": projID}, bson.M{"policy.shares.project": projID})
+	}
+
+	//Only pools which change get a new revision
+	_, err := mgm.Coll(&m.Pool{}).UpdateMany(ctx, bson.M{"$or": referencing}, bson.M{"$pull": pull, "$inc": bson.M{"revision": 1}})
+
+	return err
+}
+
+// resourceInList reports whether an id is listed
+func resourceInList(list []string, id string) bool {
+	found := false
+
+	for _, item := range list {
+		found = found || item == id
+	}
+
+	return found
+}
+
+// uniqueIDs reports whether every id is listed once
+func uniqueIDs(ids []string) bool {
+	seen := map[string]bool{}
+
+	unique := true
+
+	for _, id := range ids {
+		unique = unique && !seen[id]
+		seen[id] = true
+	}
+
+	return unique
+}
+
+// objectIDs converts hex ids into ObjectIDs, leaving out invalid ones
+func objectIDs(ids []string) []primitive.ObjectID {
+	converted := []primitive.ObjectID{}
+
+	for _, id := range ids {
+		if oid, err := primitive.ObjectIDFromHex(id); err == nil {
+			converted = append(converted, oid)
+		}
+	}
+
+	return converted
+}
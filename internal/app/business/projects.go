@@ -1,17 +1,19 @@
 package business
 
 import (
+	"context"
 	"fmt"
 	m "library/internal/app/models"
+	db "library/internal/pkg/dbutil"
+	"library/internal/pkg/lockutil"
 	"net/http"
-	"sync"
 
 	"github.com/Kamva/mgm"
 	"go.mongodb.org/mongo-driver/bson"
 )
 
 // CreateProjectBusiness godoc
-func CreateProjectBusiness(requestData *m.ProjectRequest, mux map[string]*sync.Mutex) (int, interface{}) {
+func CreateProjectBusiness(requestData *m.ProjectRequest, mux *lockutil.Locks) (int, interface{}) {
 	var err error
 	var code int
 	var response interface{}
@@ -22,7 +24,7 @@ func CreateProjectBusiness(requestData *m.ProjectRequest, mux map[string]*sync.M
 		Settings: requestData.Settings,
 	}
 
-	mux["Projects"].Lock()
+	unlock := mux.Lock("Projects")
 
 	//Generating an API key for the new project
 	newProject.UpdateAPIKey()
@@ -41,42 +43,63 @@ func CreateProjectBusiness(requestData *m.ProjectRequest, mux map[string]*sync.M
 		}
 	}
 
-	mux["Projects"].Unlock()
+	unlock()
 
 	return code, response
 }
 
 // ShowAllProjectsBusiness godoc
-func ShowAllProjectsBusiness() (int, interface{}) {
+func ShowAllProjectsBusiness(requestData *m.ListRequest) (int, interface{}) {
+	var err error
 	var code int
 	var response interface{}
+	var filter bson.M
 	projectsFound := []m.Project{}
 
-	//Searching for projects
-	_ = mgm.Coll(&m.Project{}).SimpleFind(&projectsFound, bson.M{})
+	if filter, err = listFilter(requestData, "name"); err != nil {
+		code, response = http.StatusBadRequest, m.ListRequestInvalid
+	} else {
+		code, response = listDocuments(&m.Project{}, &projectsFound, filter, requestData, []string{"name"})
+	}
+
+	return code, response
+}
+
+// ShowProjectBusiness godoc
+func ShowProjectBusiness(id string) (int, interface{}) {
+	var code int
+	var response interface{}
+	project := &m.Project{}
 
-	//Verifying whether we found any projects
-	if len(projectsFound) == 0 {
+	//Looking up a project under passed id
+	if err := mgm.Coll(project).FindByID(id, project); err != nil {
 		code, response = http.StatusNotFound, m.ProjectNotFound
 	} else {
-		code, response = http.StatusOK, projectsFound
+		code, response = http.StatusOK, project
 	}
 
 	return code, response
 }
 
+// ProjectExistsBusiness reports whether a project exists under passed id
+func ProjectExistsBusiness(id string) bool {
+	return mgm.Coll(&m.Project{}).FindByID(id, &m.Project{}) == nil
+}
+
 // UpdateAPIKeyBusiness godoc
-func UpdateAPIKeyBusiness(id string, mux map[string]*sync.Mutex) (int, interface{}) {
+func UpdateAPIKeyBusiness(id string, ifMatch string, mux *lockutil.Locks) (int, interface{}) {
 	var err error
 	var code int
 	var response interface{}
 	project := &m.Project{}
 
-	mux["Projects"].Lock()
+	unlock := mux.Lock("Projects")
 
 	//Looking up a project under passed id
 	if err = mgm.Coll(project).FindByID(id, project); err != nil {
 		code, response = http.StatusNotFound, m.ProjectNotFound
+	} else if !etagMatches(ifMatch, project.Revision) {
+		code, response = http.StatusPreconditionFailed, m.PreconditionFailed
 	} else {
 		project.UpdateAPIKey()
 
@@ -88,107 +111,164 @@ func UpdateAPIKeyBusiness(id string, mux map[string]*sync.Mutex) (int, interface
 		}
 	}
 
-	mux["Projects"].Unlock()
+	unlock()
 
 	return code, response
 }
 
 // UpdateProjectBusiness godoc
-func UpdateProjectBusiness(id string, requestData *m.ProjectRequest, mux map[string]*sync.Mutex) (int, interface{}) {
-	var err error
+func UpdateProjectBusiness(id string, requestData *m.ProjectRequest, ifMatch string, mux *lockutil.Locks) (int, interface{}) {
 	var code int
 	var response interface{}
 	project := &m.Project{}
 
-	mux["Projects"].Lock()
+	unlock := mux.Lock("Projects")
 
 	//Looking up a project under passed id
-	if err = mgm.Coll(project).FindByID(id, project); err != nil {
+	if err := mgm.Coll(project).FindByID(id, project); err != nil {
 		code, response = http.StatusNotFound, m.ProjectNotFound
+	} else if !etagMatches(ifMatch, project.Revision) {
+		code, response = http.StatusPreconditionFailed, m.PreconditionFailed
 	} else {
-		//Checking whether the updated project name matches its old name
-		if project.Name != requestData.Name {
-			//Names don't match, make sure the name isn't taken by another project
-			if err = mgm.Coll(project).First(bson.M{"name": requestData.Name}, &m.Project{}); err == nil {
-				//Name taken by another project
-				code, response = http.StatusConflict, m.ProjectExists
-				err = fmt.Errorf("") //Standin non-empty error to fail next logic check
-			} else {
-				err = nil
-			}
-		}
+		code, response = updateProject(project, requestData)
+	}
 
-		//No name conflicts detected, ready to update
-		if err == nil {
-			//Assigning respective data to a copy of the project
-			project.Name = requestData.Name
-			project.Settings = requestData.Settings
+	unlock()
 
-			//Updating the project in the database
-			if err = mgm.Coll(project).Update(project); err != nil {
-				code, response = http.StatusInternalServerError, m.InternalError
-			} else {
-				code, response = http.StatusOK, project
-			}
+	return code, response
+}
+
+// PatchProjectBusiness godoc
+func PatchProjectBusiness(id string, patch m.MergePatch, ifMatch string, mux *lockutil.Locks) (int, interface{}) {
+	var code int
+	var response interface{}
+	project := &m.Project{}
+	requestData := &m.ProjectRequest{}
+
+	unlock := mux.Lock("Projects")
+
+	//Looking up a project under passed id
+	if err := mgm.Coll(project).FindByID(id, project); err != nil {
+		code, response = http.StatusNotFound, m.ProjectNotFound
+	} else if !etagMatches(ifMatch, project.Revision) {
+		code, response = http.StatusPreconditionFailed, m.PreconditionFailed
+	} else if err = applyMergePatch(project, patch, requestData, "name", "settings"); err != nil {
+		code, response = http.StatusBadRequest, m.PatchInvalid
+	} else {
+		code, response = updateProject(project, requestData)
+	}
+
+	unlock()
+
+	return code, response
+}
+
+// updateProject replaces the contents of a project. Projects have to be locked by the caller
+// Args:	project, update request
+// Rets:	http code, updated project or error message
+func updateProject(project *m.Project, requestData *m.ProjectRequest) (int, interface{}) {
+	var err error
+	var code int
+	var response interface{}
+
+	//Checking whether the updated project name matches its old name
+	if project.Name != requestData.Name {
+		//Names don't match, make sure the name isn't taken by another project
+		if err = mgm.Coll(project).First(bson.M{"name": requestData.Name}, &m.Project{}); err == nil {
+			//Name taken by another project
+			code, response = http.StatusConflict, m.ProjectExists
+			err = fmt.Errorf("") //Standin non-empty error to fail next logic check
+		} else {
+			err = nil
 		}
 	}
 
-	mux["Projects"].Unlock()
+	//No name conflicts detected, ready to update
+	if err == nil {
+		//Assigning respective data to a copy of the project
+		project.Name = requestData.Name
+		project.Settings = requestData.Settings
+
+		//Updating the project in the database
+		if err = mgm.Coll(project).Update(project); err != nil {
+			code, response = http.StatusInternalServerError, m.InternalError
+		} else {
+			code, response = http.StatusOK, project
+		}
+	}
 
 	return code, response
 }
 
 // DeleteProjectBusiness godoc
-func DeleteProjectBusiness(id string, mux map[string]*sync.Mutex) (int, interface{}) {
+func DeleteProjectBusiness(id string, ifMatch string, mux *lockutil.Locks) (int, interface{}) {
 	var err error
 	var code int
 	var response interface{}
 	project := &m.Project{}
 
-	mux["Projects"].Lock()
+	unlock := mux.Lock("Sessions", "Resources", "Projects", "Pools", "Reservations")
 
 	//Locate the project
 	if err = mgm.Coll(project).FindByID(id, project); err != nil {
 		code, response = http.StatusNotFound, m.ProjectNotFound
+	} else if !etagMatches(ifMatch, project.Revision) {
+		code, response = http.StatusPreconditionFailed, m.PreconditionFailed
 	} else {
-		resource := &m.Resource{}
+		//The resources of the project, the pools and the project are updated in a single transaction, so a failed write leaves the project as it was
+		err = db.Transaction(func(ctx context.Context) error { return deleteProject(ctx, project) })
 
-		mux["Resources"].Lock()
-
-		for _, resID := range project.Resources {
-			//Note: not breaking if a resounce is not found -- this edge case would indicate an internal server error, but catching and handling it would be useless as opposed to going through with project deletion
-			if err = mgm.Coll(resource).FindByID(resID, resource); err == nil {
-				//Deleting project id from a list within an associated resource
-				resource.DeleteProject(id)
-
-				//Delete resource if there are no more project associations for it
-				if len(resource.Projects) == 0 {
-					if err = mgm.Coll(resource).Delete(resource); err != nil {
-						code, response = http.StatusInternalServerError, m.InternalError
-						break
-					}
-				} else {
-					//Update resource if it's not deleted
-					if err = mgm.Coll(resource).Update(resource); err != nil {
-						code, response = http.StatusInternalServerError, m.InternalError
-						break
-					}
-				}
-			}
+		if err != nil {
+			code, response = http.StatusInternalServerError, m.InternalError
+		} else {
+			code, response = http.StatusOK, m.ProjectDeleteSuccess
 		}
+	}
+
+	unlock()
+
+	return code, response
+}
+
+// deleteProject deletes a project along with its reservations and references to it from associated resources and pools. Resources left without a project are deleted. Caller is responsible for locking Sessions, Resources, Projects, Pools and Reservations
+// Args:	transaction context, project
+// Rets:	error
+func deleteProject(ctx context.Context, project *m.Project) error {
+	var err error
+	id := project.ID.Hex()
+
+	for _, resID := range project.Resources {
+		resource := &m.Resource{}
 
-		mux["Resources"].Unlock()
+		//Note: not breaking if a resounce is not found -- this edge case would indicate an internal server error, but catching and handling it would be useless as opposed to going through with project deletion
+		if mgm.Coll(resource).FindByIDWithCtx(ctx, resID, resource) == nil {
+			//Deleting project id from a list within an associated resource
+			resource.DeleteProject(id)
 
-		if err == nil {
-			if err = mgm.Coll(project).Delete(project); err != nil {
-				code, response = http.StatusInternalServerError, m.InternalError
+			//Delete resource if there are no more project associations for it, update it otherwise
+			if len(resource.Projects) == 0 {
+				err = deleteResource(ctx, resource)
 			} else {
-				code, response = http.StatusOK, m.ProjectDeleteSuccess
+				err = mgm.Coll(resource).UpdateWithCtx(ctx, resource)
+			}
+
+			if err != nil {
+				break
 			}
 		}
 	}
 
-	mux["Projects"].Unlock()
+	if err == nil {
+		err = removePoolReferences(ctx, "", id)
+	}
 
-	return code, response
+	if err == nil {
+		_, err = mgm.Coll(&m.Reservation{}).DeleteMany(ctx, bson.M{"project": id})
+	}
+
+	if err == nil {
+		err = mgm.Coll(project).DeleteWithCtx(ctx, project)
+	}
+
+	return err
 }
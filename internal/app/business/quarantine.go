@@ -0,0 +1,102 @@
+package business
+
+import (
+	"net/http"
+	"time"
+
+	m "library/internal/app/models"
+	"library/internal/pkg/lockutil"
+
+	"github.com/Kamva/mgm"
+)
+
+// ReportResourceBusiness godoc
+func ReportResourceBusiness(sessID string, resID string, requestData *m.QuarantineRequest, mux *lockutil.Locks) (int, interface{}) {
+	var code int
+	var response interface{}
+	session := &m.Session{}
+
+	unlock := mux.Lock(lockutil.Document("Sessions", sessID), lockutil.Document("Resources", resID))
+
+	//Look up the session in the db
+	if err := mgm.Coll(session).FindByID(sessID, session); err != nil {
+		code, response = http.StatusNotFound, m.SessionNotFound
+	} else if !sessionHasResource(session, resID) {
+		//Sessions can only report resources they have checked out
+		code, response = http.StatusBadRequest, m.SessionResNotCheckedOut
+	} else {
+		code, response = quarantineEvent(resID, m.QuarantineReported, requestData.Note, session)
+	}
+	unlock()
+
+	return code, response
+}
+
+// QuarantineResourceBusiness godoc
+func QuarantineResourceBusiness(resID string, requestData *m.QuarantineRequest, mux *lockutil.Locks) (int, interface{}) {
+	unlock := mux.Lock(lockutil.Document("Resources", resID))
+	code, response := quarantineEvent(resID, m.QuarantineQuarantined, requestData.Note, nil)
+	unlock()
+
+	return code, response
+}
+
+// AnnotateResourceBusiness godoc
+func AnnotateResourceBusiness(resID string, requestData *m.QuarantineRequest, mux *lockutil.Locks) (int, interface{}) {
+	unlock := mux.Lock(lockutil.Document("Resources", resID))
+	code, response := quarantineEvent(resID, m.QuarantineAnnotated, requestData.Note, nil)
+	unlock()
+
+	return code, response
+}
+
+// RestoreResourceBusiness godoc
+func RestoreResourceBusiness(resID string, requestData *m.QuarantineRequest, mux *lockutil.Locks) (int, interface{}) {
+	unlock := mux.Lock(lockutil.Document("Resources", resID))
+	code, response := quarantineEvent(resID, m.QuarantineRestored, requestData.Note, nil)
+	unlock()
+
+	return code, response
+}
+
+// quarantineEvent records an event in the quarantine history of a resource and moves it to the health state the event leads to. Reports and quarantines take the resource out of rotation, restorations put it back and annotations leave it as it is. Unlike updates, events are recorded while the resource is checked out; sessions holding a quarantined resource keep it until they check it in. The resource has to be locked by the caller
+// Args:	resource id, event, note, reporting session or nil for operators
+// Rets:	http code, resource or error message
+func quarantineEvent(resID string, event string, note string, session *m.Session) (int, interface{}) {
+	var code int
+	var response interface{}
+	resource := &m.Resource{}
+
+	if err := mgm.Coll(resource).FindByID(resID, resource); err != nil {
+		code, response = http.StatusNotFound, m.ResourceNotFound
+	} else if (event == m.QuarantineAnnotated || event == m.QuarantineRestored) && !resource.Quarantined() {
+		//Only resources out of rotation are reviewed
+		code, response = http.StatusConflict, m.ResourceNotQuarantined
+	} else {
+		entry := m.QuarantineEvent{
+			Event: event,
+			Note:  note,
+			Time:  time.Now().UTC(),
+		}
+
+		if session != nil {
+			entry.Session, entry.Project, entry.Metadata = session.ID.Hex(), session.Project, &session.Metadata
+		}
+
+		resource.Quarantine = append(resource.Quarantine, entry)
+
+		if event == m.QuarantineRestored {
+			resource.Health = m.HealthHealthy
+		} else if event != m.QuarantineAnnotated {
+			resource.Health = m.HealthQuarantined
+		}
+
+		if err = mgm.Coll(resource).Update(resource); err != nil {
+			code, response = http.StatusInternalServerError, m.InternalError
+		} else {
+			code, response = http.StatusOK, resource
+		}
+	}
+
+	return code, response
+}
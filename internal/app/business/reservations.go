@@ -0,0 +1,296 @@
+package business
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	m "library/internal/app/models"
+	db "library/internal/pkg/dbutil"
+	"library/internal/pkg/lockutil"
+
+	"github.com/Kamva/mgm"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+//Range of the calendar when no end is requested, and the longest range allowed
+const defaultCalendarRange = 7 * 24 * time.Hour
+const maxCalendarRange = 366 * 24 * time.Hour
+
+// CreateReservationBusiness godoc
+func CreateReservationBusiness(requestData *m.ReservationRequest, mux *lockutil.Locks) (int, interface{}) {
+	var err error
+	var code int
+	var response interface{}
+	resource := &m.Resource{}
+
+	unlock := mux.Lock("Resources", "Projects", "Reservations")
+
+	if !db.VerifyObjectIDString(requestData.ResourceID) || !db.VerifyObjectIDString(requestData.Project) || !requestData.End.After(requestData.Start) || !requestData.End.After(time.Now()) {
+		code, response = http.StatusBadRequest, m.ReservationValidateFailed
+	} else if err = mgm.Coll(resource).FindByID(requestData.ResourceID, resource); err != nil {
+		code, response = http.StatusNotFound, m.ResourceNotFound
+	} else if err = mgm.Coll(&m.Project{}).FindByID(requestData.Project, &m.Project{}); err != nil {
+		code, response = http.StatusNotFound, m.ProjectNotFound
+	} else if !resourceInProject(resource, requestData.Project) {
+		code, response = http.StatusBadRequest, m.ReservationProjectMismatch
+	} else if err = mgm.Coll(&m.Reservation{}).First(bson.M{
+		"resourceid": requestData.ResourceID,
+		"start":      bson.M{"$lt": requestData.End},
+		"end":        bson.M{"$gt": requestData.Start},
+	}, &m.Reservation{}); err == nil {
+		//Windows of a resource cannot overlap
+		code, response = http.StatusConflict, m.ReservationOverlap
+	} else {
+		reservation := &m.Reservation{
+			ResourceID: requestData.ResourceID,
+			Project:    requestData.Project,
+			Start:      requestData.Start.UTC(),
+			End:        requestData.End.UTC(),
+			Note:       requestData.Note,
+		}
+
+		if err = mgm.Coll(reservation).Create(reservation); err != nil {
+			code, response = http.StatusInternalServerError, m.InternalError
+		} else {
+			code, response = http.StatusCreated, reservation
+		}
+	}
+
+	unlock()
+
+	return code, response
+}
+
+// ShowAllReservationsBusiness godoc
+func ShowAllReservationsBusiness(requestData *m.ListRequest) (int, interface{}) {
+	var err error
+	var code int
+	var response interface{}
+	var filter bson.M
+	reservationsFound := []m.Reservation{}
+
+	if filter, err = listFilter(requestData, "project"); err != nil {
+		code, response = http.StatusBadRequest, m.ListRequestInvalid
+	} else {
+		code, response = listDocuments(&m.Reservation{}, &reservationsFound, filter, requestData, []string{"start", "end", "resourceid", "project"})
+	}
+
+	return code, response
+}
+
+// ShowReservationBusiness godoc
+func ShowReservationBusiness(id string) (int, interface{}) {
+	var code int
+	var response interface{}
+	reservation := &m.Reservation{}
+
+	if err := mgm.Coll(reservation).FindByID(id, reservation); err != nil {
+		code, response = http.StatusNotFound, m.ReservationNotFound
+	} else {
+		code, response = http.StatusOK, reservation
+	}
+
+	return code, response
+}
+
+// DeleteReservationBusiness godoc
+func DeleteReservationBusiness(id string, mux *lockutil.Locks) (int, interface{}) {
+	var code int
+	var response interface{}
+	reservation := &m.Reservation{}
+
+	unlock := mux.Lock("Reservations")
+
+	if err := mgm.Coll(reservation).FindByID(id, reservation); err != nil {
+		code, response = http.StatusNotFound, m.ReservationNotFound
+	} else if err = mgm.Coll(reservation).Delete(reservation); err != nil {
+		code, response = http.StatusInternalServerError, m.InternalError
+	} else {
+		code, response = http.StatusOK, m.ReservationDeleteSuccess
+	}
+
+	unlock()
+
+	return code, response
+}
+
+// CalendarBusiness godoc
+func CalendarBusiness(requestData *m.CalendarRequest) (int, interface{}) {
+	var err error
+	var code int
+	var response interface{}
+	calendar := &m.Calendar{From: time.Now().UTC(), Resources: []m.CalendarEntry{}}
+	filter := bson.M{}
+	resourcesFound := []m.Resource{}
+	reservationsFound := []m.Reservation{}
+
+	if requestData.From != "" {
+		calendar.From, err = time.Parse(time.RFC3339, requestData.From)
+	}
+
+	calendar.To = calendar.From.Add(defaultCalendarRange)
+	if err == nil && requestData.To != "" {
+		calendar.To, err = time.Parse(time.RFC3339, requestData.To)
+	}
+
+	if err == nil && requestData.Resource != "" {
+		var id primitive.ObjectID
+
+		if id, err = primitive.ObjectIDFromHex(requestData.Resource); err == nil {
+			filter["_id"] = id
+		}
+	}
+
+	if requestData.Template != "" {
+		filter["templateid"] = requestData.Template
+	}
+
+	if requestData.Project != "" {
+		filter["projects"] = requestData.Project
+	}
+
+	//Templates and projects are referred to by the hex string of their ObjectID
+	for _, id := range []string{requestData.Template, requestData.Project} {
+		if id != "" && !db.VerifyObjectIDString(id) {
+			err = fmt.Errorf("error: invalid id %s", id)
+		}
+	}
+
+	if err != nil || !calendar.To.After(calendar.From) || calendar.To.Sub(calendar.From) > maxCalendarRange {
+		code, response = http.StatusBadRequest, m.CalendarRequestInvalid
+	} else if err = mgm.Coll(&m.Resource{}).SimpleFind(&resourcesFound, filter, options.Find().SetSort(bson.M{"name": 1})); err != nil {
+		code, response = http.StatusInternalServerError, m.InternalError
+	} else {
+		ids := []string{}
+		entries := map[string]int{}
+
+		for i, r := range resourcesFound {
+			ids = append(ids, r.ID.Hex())
+			entries[r.ID.Hex()] = i
+			calendar.Resources = append(calendar.Resources, m.CalendarEntry{ResourceID: r.ID.Hex(), Name: r.Name, Reservations: []m.Reservation{}})
+		}
+
+		//Reservations overlapping the range
+		if err = mgm.Coll(&m.Reservation{}).SimpleFind(&reservationsFound, bson.M{
+			"resourceid": bson.M{"$in": ids},
+			"start":      bson.M{"$lt": calendar.To},
+			"end":        bson.M{"$gt": calendar.From},
+		}, options.Find().SetSort(bson.M{"start": 1})); err != nil {
+			code, response = http.StatusInternalServerError, m.InternalError
+		} else {
+			for _, r := range reservationsFound {
+				entry := &calendar.Resources[entries[r.ResourceID]]
+				entry.Reservations = append(entry.Reservations, r)
+			}
+
+			code, response = http.StatusOK, calendar
+		}
+	}
+
+	return code, response
+}
+
+// StartReservationsBusiness gives reserving projects priority at the start of their windows: sessions of other projects holding a reserved resource have it checked in, along with the subresources they consumed and the resources checked out through its references. Reservations which fail to start are logged and retried on the next run, without holding back the others. Meant to be executed every second by the worker
+// Args:	mutexes
+// Rets:	error
+func StartReservationsBusiness(mux *lockutil.Locks) error {
+	var err error
+	now := time.Now()
+	reservationsFound := []m.Reservation{}
+
+	//Reservations due to start are looked up without locks, each one is checked again under the locks as it is started
+	err = mgm.Coll(&m.Reservation{}).SimpleFind(&reservationsFound, bson.M{
+		"started": false,
+		"start":   bson.M{"$lte": now},
+		"end":     bson.M{"$gt": now},
+	})
+
+	for _, reservation := range reservationsFound {
+		if startErr := startReservation(reservation.ID.Hex(), mux); startErr != nil {
+			log.Printf("warning: reservation %s not started: %v", reservation.ID.Hex(), startErr)
+			err = startErr
+		}
+	}
+
+	return err
+}
+
+// startReservation checks in the reserved resource from the sessions of other projects holding it and marks the reservation started, unless it was started, cancelled or its window ended since it was found
+// Args:	reservation db id, mutexes
+// Rets:	error
+func startReservation(id string, mux *lockutil.Locks) error {
+	var err error
+	reservation := &m.Reservation{}
+	holders := []m.Session{}
+
+	unlock := mux.Lock("Sessions", "Resources", "Reservations")
+
+	now := time.Now()
+	if mgm.Coll(reservation).FindByID(id, reservation) == nil && !reservation.Started && !reservation.Start.After(now) && reservation.End.After(now) {
+		if err = mgm.Coll(&m.Session{}).SimpleFind(&holders, bson.M{"resources": reservation.ResourceID, "project": bson.M{"$ne": reservation.Project}}); err == nil {
+			//The checkins of all holders are applied along with the start of the reservation, or not at all
+			err = db.Transaction(func(ctx context.Context) error {
+				var err error
+
+				for j := 0; err == nil && j < len(holders); j++ {
+					resource := &m.Resource{}
+
+					//A run retried after a transient error starts over from the stored session
+					if err = db.Reload(ctx, &holders[j]); err != nil {
+						break
+					}
+
+					if err = mgm.Coll(resource).FindByIDWithCtx(ctx, reservation.ResourceID, resource); err == nil {
+						if err = checkinResource(ctx, &holders[j], resource); err == nil {
+							if err = checkinLinkedResources(ctx, &holders[j], reservation.ResourceID); err == nil {
+								err = mgm.Coll(&holders[j]).UpdateWithCtx(ctx, &holders[j])
+							}
+						}
+					}
+				}
+
+				//The flag is only set in the database, the reservation in memory stays as it was read should the run fail
+				if err == nil {
+					_, err = mgm.Coll(reservation).UpdateOne(ctx, bson.M{"_id": reservation.ID}, bson.M{"$set": bson.M{"started": true}})
+				}
+
+				return err
+			})
+		}
+	}
+
+	unlock()
+
+	return err
+}
+
+// reservingProject returns the project holding a reservation of a resource at the current time, or an empty string when the resource isn't reserved. Reservations of the resource have to be locked by the caller
+// Args:	resource id
+// Rets:	project id
+func reservingProject(resID string) string {
+	var project string
+	now := time.Now()
+	reservation := &m.Reservation{}
+
+	if mgm.Coll(reservation).First(bson.M{"resourceid": resID, "start": bson.M{"$lte": now}, "end": bson.M{"$gt": now}}, reservation) == nil {
+		project = reservation.Project
+	}
+
+	return project
+}
+
+// resourceInProject reports whether a resource is associated with a project
+func resourceInProject(resource *m.Resource, projID string) bool {
+	member := false
+
+	for _, id := range resource.Projects {
+		member = member || id == projID
+	}
+
+	return member
+}
@@ -1,25 +1,27 @@
 package business
 
 import (
+	"context"
 	"fmt"
 	"net/http"
-	"sync"
 
 	m "library/internal/app/models"
 	db "library/internal/pkg/dbutil"
+	"library/internal/pkg/lockutil"
 
 	"github.com/Kamva/mgm"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // CreateResourceBusiness godoc
-func CreateResourceBusiness(requestData *m.ResourceRequest, mux map[string]*sync.Mutex) (int, interface{}) {
+func CreateResourceBusiness(requestData *m.ResourceRequest, mux *lockutil.Locks) (int, interface{}) {
 	var err error
 	var code int
 	var response interface{}
 	var projects []m.Project
 
-	mux["Resources"].Lock()
+	unlock := mux.Lock("Resources", "Templates", "Projects")
 
 	//Verifying that the resource name is unique
 	if err = mgm.Coll(&m.Resource{}).First(bson.M{"name": requestData.Name}, &m.Resource{}); err == nil {
@@ -32,14 +34,10 @@ func CreateResourceBusiness(requestData *m.ResourceRequest, mux map[string]*sync
 		} else {
 			template := &m.Template{}
 
-			mux["Templates"].Lock()
-
 			//Locating the template associated with the resource
 			if err = mgm.Coll(template).FindByID(requestData.TemplateID, template); err != nil {
 				code, response = http.StatusNotFound, m.TemplateNotFound
 			} else {
-				mux["Projects"].Lock()
-
 				//Making sure all project ids are unique
 				for i := 0; i < len(requestData.Projects); i++ {
 					for j := i + 1; j < len(requestData.Projects); j++ {
@@ -65,381 +63,455 @@ func CreateResourceBusiness(requestData *m.ResourceRequest, mux map[string]*sync
 
 				//No issues with projects
 				if err == nil {
-					//2nd round of validation -- against the base template
-					if len(template.Fields) != len(requestData.Fields) {
-						//Catching a general template mismatch
-						code, response = http.StatusBadRequest, m.ResourceTemplateMismatch
+					var templateFields []m.Field
+
+					//2nd round of validation -- against the effective fields of the base template, including inherited ones
+					if templateFields, code, response, err = resolveTemplateFields(template); err != nil {
+						code = http.StatusConflict
+					} else if response, err = validateResourceFields(templateFields, requestData.Fields); err != nil {
+						code = http.StatusBadRequest
+					} else if response, err = validateResourceReferences(requestData.Fields); err != nil {
+						code = http.StatusBadRequest
+					} else if err = validateLabels(requestData.Labels); err != nil {
+						code, response = http.StatusBadRequest, m.LabelsValidateFailed
 					} else {
-					out:
-						for i := 0; i < len(requestData.Fields); i++ {
-							//Ensuring that fields in template and resource have the same key names, required flags, type and order
-							if (template.Fields[i].Key != requestData.Fields[i].Key) || (template.Fields[i].Required != requestData.Fields[i].Required) || (template.Fields[i].Type != requestData.Fields[i].Type) {
-								err = fmt.Errorf("") //Filler error for logics
-								break
-							} else {
-
-								//Ensuring that the subresource value is an integer
-								if requestData.Fields[i].Type == "subresource" {
-									switch requestData.Fields[i].Value.(type) {
-									//Ensuring that the subresource value is an integer
-									case float64:
-										//Integer cast
-										requestData.Fields[i].Value = int(requestData.Fields[i].Value.(float64))
-										break
-
-									default:
-										err = fmt.Errorf("")
-										break out
-									}
-								}
+						//Transferring request into a database model
+						newResource := &m.Resource{
+							Name:            requestData.Name,
+							Description:     requestData.Description,
+							TemplateID:      requestData.TemplateID,
+							TemplateVersion: template.Version,
+							Projects:        requestData.Projects,
+							CheckedOut:      0,
+							Active:          true,
+							Health:          m.HealthHealthy,
+							Fields:          requestData.Fields,
+							Labels:          requestData.Labels,
+						}
+
+						//Insert the new resource into the db and its id into the cached project models in a single transaction
+						err = db.Transaction(func(ctx context.Context) error {
+							err := mgm.Coll(newResource).CreateWithCtx(ctx, newResource)
 
-								//Ensuring that required fields are not empty
-								if template.Fields[i].Required {
-									switch t := requestData.Fields[i].Value.(type) {
-									case string:
-										if t == "" {
-											err = fmt.Errorf("")
-											break out
-										}
-									//Case when value is []
-									case []interface{}:
-										if len(t) == 0 {
-											err = fmt.Errorf("")
-											break out
-										}
-									//Case when value is {}
-									case map[string]interface{}:
-										if len(t) == 0 {
-											err = fmt.Errorf("")
-											break out
-										}
-									default:
-										if t == nil {
-											err = fmt.Errorf("")
-											break out
-										}
-									}
+							for i := 0; err == nil && i < len(projects); i++ {
+								//A run retried after a transient error starts over from the stored project
+								if err = db.Reload(ctx, &projects[i]); err == nil {
+									projects[i].Resources = append(projects[i].Resources, newResource.ID.Hex())
+									err = mgm.Coll(&projects[i]).UpdateWithCtx(ctx, &projects[i])
 								}
 							}
-						}
 
-						//Catching a template mismatch where required fields are empty
+							return err
+						})
+
 						if err != nil {
-							code, response = http.StatusBadRequest, m.ResourceTemplateMismatchRequired
+							code, response = http.StatusInternalServerError, m.InternalError
 						} else {
-							//Transferring request into a database model
-							newResource := &m.Resource{
-								Name:        requestData.Name,
-								Description: requestData.Description,
-								TemplateID:  requestData.TemplateID,
-								Projects:    requestData.Projects,
-								CheckedOut:  0,
-								Active:      true,
-								Fields:      requestData.Fields,
-							}
-
-							//Insert the new resource into the db
-							if err = mgm.Coll(newResource).Save(newResource); err != nil {
-								code, response = http.StatusInternalServerError, m.InternalError
-							} else {
-								//Updating resource lists within projects associated with this resource
-								if err == nil {
-									//Going over cached project models and inserting a new resource id
-									for _, proj := range projects {
-										proj.Resources = append(proj.Resources, newResource.ID.Hex())
-										if err = mgm.Coll(&proj).Update(&proj); err != nil {
-											code, response = http.StatusNotFound, m.InternalError
-											break
-										}
-									}
-
-									if err == nil {
-										//Success
-										code, response = http.StatusCreated, newResource
-									}
-								}
-							}
+							//Success
+							code, response = http.StatusCreated, newResource
 						}
 					}
 				}
-				mux["Projects"].Unlock()
 			}
-			mux["Templates"].Unlock()
 		}
 	}
-	mux["Resources"].Unlock()
+	unlock()
 
 	return code, response
 }
 
 // ShowAllResourcesBusiness godoc
-func ShowAllResourcesBusiness() (int, interface{}) {
+func ShowAllResourcesBusiness(requestData *m.ListRequest, expand []string) (int, interface{}) {
+	var err error
 	var code int
 	var response interface{}
+	var filter bson.M
+	resourcesFound := []m.Resource{}
+
+	if filter, err = listFilter(requestData, "name", "template", "projects", "active", "checkedout", "field", "health", "labels"); err != nil {
+		code, response = http.StatusBadRequest, m.ListRequestInvalid
+	} else if code, response = listDocuments(&m.Resource{}, &resourcesFound, filter, requestData, []string{"name", "checkedout"}); code == http.StatusOK {
+		//References are expanded on the documents already listed; projection has to be applied again
+		if len(expand) > 0 {
+			for i := range resourcesFound {
+				expandResourceReferences(&resourcesFound[i], expand)
+			}
 
-	var resourcesFound []m.Resource
+			response.(*m.ListResponse).Items = projectListItems(&resourcesFound, requestData.Fields)
+		}
+	}
 
-	//Searching for resources
-	_ = mgm.Coll(&m.Resource{}).SimpleFind(&resourcesFound, bson.M{})
+	return code, response
+}
 
-	//Verifying whether we found any resources
-	if len(resourcesFound) == 0 {
+// ShowResourceBusiness godoc
+func ShowResourceBusiness(resID string, expand []string) (int, interface{}) {
+	var code int
+	var response interface{}
+	resource := &m.Resource{}
+
+	//Looking up a resource under passed id
+	if err := mgm.Coll(resource).FindByID(resID, resource); err != nil {
 		code, response = http.StatusNotFound, m.ResourceNotFound
 	} else {
-		code, response = http.StatusOK, resourcesFound
+		expandResourceReferences(resource, expand)
+		code, response = http.StatusOK, resource
 	}
 
 	return code, response
 }
 
 // ShowResourcesByPrjBusiness godoc
-func ShowResourcesByPrjBusiness(projID string, mux map[string]*sync.Mutex) (int, interface{}) {
+func ShowResourcesByPrjBusiness(projID string, requestData *m.ListRequest, expand []string, mux *lockutil.Locks) (int, interface{}) {
 	var err error
 	var code int
 	var response interface{}
-	var resourcesFound []m.Resource
 	project := &m.Project{}
 
-	mux["Projects"].Lock()
+	unlock := mux.Lock("Resources", "Projects")
 
 	//Searching for the project
 	if err = mgm.Coll(project).FindByID(projID, project); err != nil {
 		code, response = http.StatusNotFound, m.ProjectNotFound
 	} else {
+		//Listing resources associated with the project, with the same paging and filters as the resource list
+		requestData.Project = projID
+		code, response = ShowAllResourcesBusiness(requestData, expand)
+	}
+	unlock()
 
-		if len(project.Resources) == 0 {
-			code, response = http.StatusNotFound, m.ResourceNotFound
-		} else {
-			mux["Resources"].Lock()
+	return code, response
+}
 
-			//mgm cannot do bulk search by id natively, have to send individual queries
-			for i, resID := range project.Resources {
-				resourcesFound = append(resourcesFound, m.Resource{})
-				mgm.Coll(&m.Resource{}).FindByID(resID, &resourcesFound[i])
-			}
+// ShowAllResourcesByPrjBusiness lists every resource associated with a project, following the pages of the project resource list to the end, for the deprecated route which returned them all at once
+// Args:	project db id, reference keys to expand, locks
+// Rets:	http code, resources or error message
+func ShowAllResourcesByPrjBusiness(projID string, expand []string, mux *lockutil.Locks) (int, interface{}) {
+	var code int
+	var response interface{}
+	project := &m.Project{}
+	resources := []m.Resource{}
 
-			if len(resourcesFound) == 0 {
-				code, response = http.StatusInternalServerError, m.InternalError
-			} else {
-				code, response = http.StatusOK, resourcesFound
+	unlock := mux.Lock("Resources", "Projects")
+
+	//Searching for the project
+	if err := mgm.Coll(project).FindByID(projID, project); err != nil {
+		code, response = http.StatusNotFound, m.ProjectNotFound
+	} else {
+		requestData := &m.ListRequest{Project: projID, Limit: maxListLimit}
+
+		for more := true; more; {
+			more = false
+
+			if code, response = ShowAllResourcesBusiness(requestData, expand); code == http.StatusOK {
+				page := response.(*m.ListResponse)
+				resources = append(resources, page.Items.([]m.Resource)...)
+				requestData.Cursor, more = page.Next, page.Next != ""
 			}
+		}
 
-			mux["Resources"].Unlock()
+		if code == http.StatusOK {
+			response = resources
 		}
 	}
-	mux["Projects"].Unlock()
+	unlock()
 
 	return code, response
 }
 
 // DeleteResourceBusiness godoc
-func DeleteResourceBusiness(resID string, mux map[string]*sync.Mutex) (int, interface{}) {
+func DeleteResourceBusiness(resID string, ifMatch string, mux *lockutil.Locks) (int, interface{}) {
 	var err error
 	var code int
 	var response interface{}
 
 	resource := &m.Resource{}
 
-	mux["Resources"].Lock()
+	unlock := mux.Lock("Sessions", "Resources", "Projects", "Pools", "Reservations")
 
 	//Attempting to find a macthing resource
 	if err = mgm.Coll(resource).FindByID(resID, resource); err != nil {
 		code, response = http.StatusNotFound, m.ResourceNotFound
+	} else if !etagMatches(ifMatch, resource.Revision) {
+		code, response = http.StatusPreconditionFailed, m.PreconditionFailed
+	} else if referrers := resourceReferrers(resID); len(referrers) > 0 {
+		//Deleting the resource would leave the reference fields of other resources pointing at nothing
+		code, response = http.StatusConflict, &m.ResourceReferrers{Message: m.ResourceInUse["message"].(string), Resources: referrers}
 	} else {
+		//The resource and the references to it are deleted in a single transaction
+		err = db.Transaction(func(ctx context.Context) error { return deleteResource(ctx, resource) })
+
+		if err != nil {
+			code, response = http.StatusInternalServerError, m.InternalError
+		} else {
+			code, response = http.StatusOK, m.ResourceDeleteSuccess
+		}
+	}
+	unlock()
+
+	return code, response
+}
+
+// deleteResource deletes a resource along with references to it from associated projects, pools, sessions and the reference-type fields of other resources, and its reservations. Caller is responsible for locking Sessions, Resources, Projects, Pools and Reservations
+// Args:	transaction context, resource
+// Rets:	error
+func deleteResource(ctx context.Context, resource *m.Resource) error {
+	var err error
+
+	//Going over every associated project and deleting references to this resource
+	for _, projID := range resource.Projects {
 		project := &m.Project{}
 
-		mux["Projects"].Lock()
+		if err = mgm.Coll(project).FindByIDWithCtx(ctx, projID, project); err != nil {
+			break
+		} else {
+			project.DeleteResource(resource.ID.Hex())
 
-		//Going over every associated project and deleting references to this resource
-		for _, projID := range resource.Projects {
-			if err = mgm.Coll(project).FindByID(projID, project); err != nil {
+			if err = mgm.Coll(project).UpdateWithCtx(ctx, project); err != nil {
 				break
-			} else {
-				project.DeleteResource(projID)
-
-				if err = mgm.Coll(project).Update(project); err != nil {
-					break
-				}
 			}
 		}
+	}
 
-		mux["Projects"].Unlock()
+	if err == nil {
+		err = removePoolReferences(ctx, resource.ID.Hex(), "")
+	}
 
-		if err != nil {
-			code, response = http.StatusInternalServerError, m.InternalError
-		} else {
-			if err = mgm.Coll(resource).Delete(resource); err != nil {
-				code, response = http.StatusInternalServerError, m.InternalError
-			} else {
-				code, response = http.StatusOK, m.ResourceDeleteSuccess
+	//Sessions still holding or borrowing the resource give it back along with what they consumed from it, and its reservations go with it
+	if err == nil {
+		err = releaseDeletedResource(ctx, resource.ID.Hex())
+	}
+
+	if err == nil {
+		_, err = mgm.Coll(&m.Reservation{}).DeleteMany(ctx, bson.M{"resourceid": resource.ID.Hex()})
+	}
+
+	//Resources deleted along with a project or by a sync can't be refused, references to them are cleared instead
+	if err == nil {
+		err = clearResourceReferences(ctx, resource.ID.Hex())
+	}
+
+	if err == nil {
+		err = mgm.Coll(resource).DeleteWithCtx(ctx, resource)
+	}
+
+	return err
+}
+
+// resourceReferrers lists the other resources whose reference-type fields point at a resource
+// Args:	resource db id
+// Rets:	referencing resources
+func resourceReferrers(resID string) []m.ResourceReference {
+	var resourcesFound []m.Resource
+	referrers := []m.ResourceReference{}
+
+	_ = mgm.Coll(&m.Resource{}).SimpleFind(&resourcesFound, referrersFilter(resID))
+	for _, referrer := range resourcesFound {
+		referrers = append(referrers, m.ResourceReference{ResourceID: referrer.ID.Hex(), Name: referrer.Name})
+	}
+
+	return referrers
+}
+
+// clearResourceReferences empties the reference-type fields of other resources pointing at a resource
+// Args:	transaction context, resource db id
+// Rets:	error
+func clearResourceReferences(ctx context.Context, resID string) error {
+	var err error
+	var resourcesFound []m.Resource
+
+	if err = mgm.Coll(&m.Resource{}).SimpleFindWithCtx(ctx, &resourcesFound, referrersFilter(resID)); err == nil {
+		for i := range resourcesFound {
+			for j, f := range resourcesFound[i].Fields {
+				if id, ok := f.Value.(string); f.Type == "reference" && ok && id == resID {
+					resourcesFound[i].Fields[j].Value = ""
+				}
+			}
+
+			if err = mgm.Coll(&resourcesFound[i]).UpdateWithCtx(ctx, &resourcesFound[i]); err != nil {
+				break
 			}
 		}
 	}
-	mux["Resources"].Unlock()
 
-	return code, response
+	return err
+}
+
+// referrersFilter matches the other resources with a reference-type field pointing at a resource
+func referrersFilter(resID string) bson.M {
+	filter := bson.M{"fields": bson.M{"$elemMatch": bson.M{"type": "reference", "value": resID}}}
+
+	if id, err := primitive.ObjectIDFromHex(resID); err == nil {
+		filter["_id"] = bson.M{"$ne": id}
+	}
+
+	return filter
 }
 
 // UpdateResourceBusiness godoc
-func UpdateResourceBusiness(resID string, requestData *m.ResourceUpdateRequest, mux map[string]*sync.Mutex) (int, interface{}) {
-	var err error
+func UpdateResourceBusiness(resID string, requestData *m.ResourceUpdateRequest, ifMatch string, mux *lockutil.Locks) (int, interface{}) {
 	var code int
 	var response interface{}
-	var newProjects []m.Project
-	var oldProjects []m.Project
 	resource := &m.Resource{}
 
-	mux["Resources"].Lock()
+	unlock := mux.Lock("Resources", "Templates", "Projects")
 
 	//Looking up db entry for the existing resource
-	if err = mgm.Coll(resource).FindByID(resID, resource); err != nil {
+	if err := mgm.Coll(resource).FindByID(resID, resource); err != nil {
 		code, response = http.StatusNotFound, m.ResourceNotFound
+	} else if !etagMatches(ifMatch, resource.Revision) {
+		code, response = http.StatusPreconditionFailed, m.PreconditionFailed
 	} else {
-		//Making sure the resource isn't checked out
-		if resource.CheckedOut > 0 {
-			code, response = http.StatusConflict, m.ResourceUpdateCheckedOut
-		} else {
-			//Checking whether old name mathes new name
-			if resource.Name != requestData.Name {
-				//Making sure there's no conflict with another resource's name
-				if err = mgm.Coll(resource).First(bson.M{"name": requestData.Name}, &m.Resource{}); err == nil {
-					//There is a conflict
-					code, response = http.StatusConflict, m.ResourceExists
-					err = fmt.Errorf("") //Standin non-empty error to fail next logic check
-				} else {
-					err = nil
-				}
-			}
+		code, response = updateResource(resource, requestData)
+	}
+	unlock()
 
-			mux["Projects"].Lock()
+	return code, response
+}
 
-			//Making sure all project ids are valid and unique
-			if !db.VerifyObjectIDString(requestData.Projects) {
-				code, response = http.StatusBadRequest, m.InvalidID
-				err = fmt.Errorf("")
+// PatchResourceBusiness godoc
+func PatchResourceBusiness(resID string, patch m.MergePatch, ifMatch string, mux *lockutil.Locks) (int, interface{}) {
+	var code int
+	var response interface{}
+	resource := &m.Resource{}
+	requestData := &m.ResourceUpdateRequest{}
+
+	unlock := mux.Lock("Resources", "Templates", "Projects")
+
+	//Looking up db entry for the existing resource
+	if err := mgm.Coll(resource).FindByID(resID, resource); err != nil {
+		code, response = http.StatusNotFound, m.ResourceNotFound
+	} else if !etagMatches(ifMatch, resource.Revision) {
+		code, response = http.StatusPreconditionFailed, m.PreconditionFailed
+	} else if err = applyMergePatch(resource, patch, requestData, "name", "description", "projects", "fields", "active"); err != nil {
+		code, response = http.StatusBadRequest, m.PatchInvalid
+	} else {
+		code, response = updateResource(resource, requestData)
+	}
+	unlock()
+
+	return code, response
+}
+
+// updateResource replaces the contents of a resource, validating it against the effective fields of its template. Resources, Templates and Projects have to be locked by the caller
+// Args:	resource, update request
+// Rets:	http code, updated resource or error message
+func updateResource(resource *m.Resource, requestData *m.ResourceUpdateRequest) (int, interface{}) {
+	var err error
+	var code int
+	var response interface{}
+	var newProjects []m.Project
+	var oldProjects []m.Project
+
+	//Making sure the resource isn't checked out
+	if resource.CheckedOut > 0 {
+		code, response = http.StatusConflict, m.ResourceUpdateCheckedOut
+	} else {
+		//Checking whether old name mathes new name
+		if resource.Name != requestData.Name {
+			//Making sure there's no conflict with another resource's name
+			if err = mgm.Coll(resource).First(bson.M{"name": requestData.Name}, &m.Resource{}); err == nil {
+				//There is a conflict
+				code, response = http.StatusConflict, m.ResourceExists
+				err = fmt.Errorf("") //Standin non-empty error to fail next logic check
 			} else {
-				for i := 0; i < len(requestData.Projects); i++ {
-					for j := i + 1; j < len(requestData.Projects); j++ {
-						if requestData.Projects[i] == requestData.Projects[j] {
-							code, response = http.StatusBadRequest, m.ResourceProjectIDDuplicate
-							err = fmt.Errorf("")
-							break
-						}
+				err = nil
+			}
+		}
+
+		//Making sure all project ids are valid and unique
+		if !db.VerifyObjectIDString(requestData.Projects) {
+			code, response = http.StatusBadRequest, m.InvalidID
+			err = fmt.Errorf("")
+		} else {
+			for i := 0; i < len(requestData.Projects); i++ {
+				for j := i + 1; j < len(requestData.Projects); j++ {
+					if requestData.Projects[i] == requestData.Projects[j] {
+						code, response = http.StatusBadRequest, m.ResourceProjectIDDuplicate
+						err = fmt.Errorf("")
+						break
 					}
 				}
 			}
+		}
 
-			if err == nil {
-				//Ensure that all projects now associated with the resource are real
-				for i, projID := range requestData.Projects {
+		if err == nil {
+			//Ensure that all projects now associated with the resource are real
+			for i, projID := range requestData.Projects {
+				//Caching mongo models for later use
+				newProjects = append(newProjects, m.Project{})
+				if err = mgm.Coll(&m.Project{}).FindByID(projID, &newProjects[i]); err != nil {
+					code, response = http.StatusNotFound, m.ProjectNotFound
+					break
+				}
+			}
+		}
+
+		//No issues with the project id, validate structure
+		if err == nil {
+			var templateFields []m.Field
+			template := &m.Template{}
+
+			//Validate against the current base template rather than the old resource structure, which may conform to an older template version
+			if err = mgm.Coll(template).FindByID(resource.TemplateID, template); err != nil {
+				code, response = http.StatusNotFound, m.TemplateNotFound
+			} else if templateFields, code, response, err = resolveTemplateFields(template); err != nil {
+				code = http.StatusConflict
+			} else if response, err = validateResourceFields(templateFields, requestData.Fields); err != nil {
+				code = http.StatusBadRequest
+			} else if response, err = validateResourceReferences(requestData.Fields); err != nil {
+				code = http.StatusBadRequest
+			} else {
+				//Finding all projects associated with this resource in the past
+				for i, projID := range resource.Projects {
 					//Caching mongo models for later use
-					newProjects = append(newProjects, m.Project{})
-					if err = mgm.Coll(&m.Project{}).FindByID(projID, &newProjects[i]); err != nil {
+					oldProjects = append(oldProjects, m.Project{})
+					if err = mgm.Coll(&m.Project{}).FindByID(projID, &oldProjects[i]); err != nil {
 						code, response = http.StatusNotFound, m.ProjectNotFound
 						break
 					}
 				}
-			}
-
-			//No issues with the project id, validate structure
-			if err == nil {
-				//Validate against the old resource structure, which has already been validated on creation
-				if len(resource.Fields) != len(requestData.Fields) {
-					//Catching a general template mismatch
-					code, response = http.StatusBadRequest, m.ResourceTemplateMismatch
-				} else {
-				out:
-					//Ensuring that fields in old and new resource have the same key names and order
-					for i := 0; i < len(resource.Fields); i++ {
-						if (resource.Fields[i].Key != requestData.Fields[i].Key) || (resource.Fields[i].Required != requestData.Fields[i].Required) || (resource.Fields[i].Type != requestData.Fields[i].Type) {
-							err = fmt.Errorf("") //Filler error for logics
-							break
-						} else {
 
-							//Ensuring that the subresource value is an integer
-							if requestData.Fields[i].Type == "subresource" {
-								switch requestData.Fields[i].Value.(type) {
-								case float64:
-									//Integer cast
-									requestData.Fields[i].Value = int(requestData.Fields[i].Value.(float64))
-									break
-
-								default:
-									code, response = http.StatusBadRequest, m.TemplateValidateFailed
-									err = fmt.Errorf("")
-									break out
-								}
-							}
+				//Transferring request into a database model
+				resource.Name = requestData.Name
+				resource.Description = requestData.Description
+				resource.Projects = requestData.Projects
+				resource.Fields = requestData.Fields
+				resource.TemplateVersion = template.Version
+				resource.Active = requestData.Active
+
+				//Update resource in the db along with the resource lists within projects in a single transaction
+				err = db.Transaction(func(ctx context.Context) error {
+					var err error
+
+					//A run retried after a transient error starts over from the stored projects
+					for i := 0; err == nil && i < len(oldProjects); i++ {
+						err = db.Reload(ctx, &oldProjects[i])
+					}
 
-							//Ensuring that required fields are not empty
-							if requestData.Fields[i].Required {
-								switch t := requestData.Fields[i].Value.(type) {
-								case string:
-									if t == "" {
-										err = fmt.Errorf("")
-										break out
-									}
-								//Case when value is []
-								case []interface{}:
-									if len(t) == 0 {
-										err = fmt.Errorf("")
-										break out
-									}
-								//Case when value is {}
-								case map[string]interface{}:
-									if len(t) == 0 {
-										err = fmt.Errorf("")
-										break out
-									}
-								default:
-									if t == nil {
-										err = fmt.Errorf("")
-										break out
-									}
-								}
-							}
-						}
+					for i := 0; err == nil && i < len(newProjects); i++ {
+						err = db.Reload(ctx, &newProjects[i])
 					}
 
-					//Catching a template mismatch where required fields are empty
-					if err != nil {
-						code, response = http.StatusBadRequest, m.ResourceTemplateMismatchRequired
-					} else {
-						//Finding all projects associated with this resource in the past
-						for i, projID := range resource.Projects {
-							//Caching mongo models for later use
-							oldProjects = append(oldProjects, m.Project{})
-							if err = mgm.Coll(&m.Project{}).FindByID(projID, &oldProjects[i]); err != nil {
-								code, response = http.StatusNotFound, m.ProjectNotFound
-								break
-							}
-						}
+					if err == nil {
+						err = mgm.Coll(resource).UpdateWithCtx(ctx, resource)
+					}
 
-						//Transferring request into a database model
-						resource.Name = requestData.Name
-						resource.Description = requestData.Description
-						resource.Projects = requestData.Projects
-						resource.Fields = requestData.Fields
-						resource.Active = requestData.Active
-
-						//Update resource in the db
-						if err = mgm.Coll(resource).Update(resource); err != nil {
-							code, response = http.StatusInternalServerError, m.InternalError
-						} else {
-							//Updating resource lists within projects
-							if err = db.UpdateProjectResourceLists(resource.ID.Hex(), oldProjects, newProjects); err != nil {
-								code, response = http.StatusInternalServerError, m.InternalError
-							} else {
-								code, response = http.StatusOK, resource
-							}
-						}
+					if err == nil {
+						err = db.UpdateProjectResourceLists(ctx, resource.ID.Hex(), oldProjects, newProjects)
 					}
+
+					return err
+				})
+
+				if err != nil {
+					code, response = http.StatusInternalServerError, m.InternalError
+				} else {
+					code, response = http.StatusOK, resource
 				}
 			}
-			mux["Projects"].Unlock()
 		}
 	}
-	mux["Resources"].Unlock()
 
 	return code, response
 }
@@ -0,0 +1,22 @@
+package business
+
+import (
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestReferrersFilter(t *testing.T) {
+	id := primitive.NewObjectID()
+
+	//The resource itself isn't one of its referrers
+	want := bson.M{
+		"fields": bson.M{"$elemMatch": bson.M{"type": "reference", "value": id.Hex()}},
+		"_id":    bson.M{"$ne": id},
+	}
+	if got := referrersFilter(id.Hex()); !reflect.DeepEqual(got, want) {
+		t.Errorf("referrersFilter = %v, want %v", got, want)
+	}
+}
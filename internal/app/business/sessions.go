@@ -1,190 +1,531 @@
 package business
 
 import (
+	"context"
 	"fmt"
 	m "library/internal/app/models"
 	db "library/internal/pkg/dbutil"
+	"library/internal/pkg/lockutil"
 	"net/http"
-	"sync"
+	"net/url"
+	"sort"
 	"time"
 
 	"github.com/Kamva/mgm"
 	"github.com/dgrijalva/jwt-go"
-	"github.com/prprprus/scheduler"
 	"go.mongodb.org/mongo-driver/bson"
 )
 
 // ShowAllSessionsBusiness godoc
-func ShowAllSessionsBusiness() (int, interface{}) {
+func ShowAllSessionsBusiness(requestData *m.ListRequest) (int, interface{}) {
+	var err error
 	var code int
 	var response interface{}
+	var filter bson.M
 	sessionsFound := []m.Session{}
 
-	//Searching for sessions
-	_ = mgm.Coll(&m.Session{}).SimpleFind(&sessionsFound, bson.M{})
+	if filter, err = listFilter(requestData, "project", "owner", "runner", "commit", "job", "metadata.labels"); err != nil {
+		code, response = http.StatusBadRequest, m.ListRequestInvalid
+	} else {
+		code, response = listDocuments(&m.Session{}, &sessionsFound, filter, requestData, []string{"project", "metadata.owner", "metadata.runner"})
+	}
+
+	return code, response
+}
+
+// ShowSessionBusiness godoc
+func ShowSessionBusiness(id string) (int, interface{}) {
+	var code int
+	var response interface{}
+	session := &m.Session{}
 
-	if len(sessionsFound) == 0 {
+	//Looking up a session under passed id
+	if err := mgm.Coll(session).FindByID(id, session); err != nil {
 		code, response = http.StatusNotFound, m.SessionNotFound
 	} else {
-		code, response = http.StatusOK, sessionsFound
+		code, response = http.StatusOK, session
 	}
 
 	return code, response
 }
 
 // SessionResCheckoutBusiness godoc
-func SessionResCheckoutBusiness(resID string, sessID string, mux map[string]*sync.Mutex) (int, interface{}) {
-	var err error
+func SessionResCheckoutBusiness(resID string, sessID string, expand []string, mux *lockutil.Locks) (int, interface{}) {
 	var code int
 	var response interface{}
 
-	session := &m.Session{}
-
-	mux["Sessions"].Lock()
+	//Only the session, the resource, the resources it references for checkout and their reservations are locked, so checkouts of other resources run in parallel
+	needs := func(*m.Session) []string { return documentLocks(checkoutClosure(resID), "Resources", "Reservations") }
+	unlock, session, err := lockSession(sessID, needs, []string{lockutil.Document("Resources", resID), lockutil.Document("Reservations", resID)}, mux)
 
 	//Look up the session in the db
-	if err = mgm.Coll(session).FindByID(sessID, session); err != nil {
+	if err != nil {
 		code, response = http.StatusNotFound, m.SessionNotFound
 	} else {
-		alreadyCheckedOut := false
-
-		for _, res := range session.Resources {
-			if res == resID {
-				alreadyCheckedOut = true
-				break
-			}
-		}
-
-		if !alreadyCheckedOut {
+		if !sessionHasResource(session, resID) {
 			resource := &m.Resource{}
 
-			mux["Resources"].Lock()
-
 			//Look up the resource in the db
 			if err = mgm.Coll(resource).FindByID(resID, resource); err != nil {
 				code, response = http.StatusNotFound, m.ResourceNotFound
 			} else {
-				//Increment checkout counter
-				resource.CheckedOut++
-
-				//Updating resource db entry to checked out
-				if err = mgm.Coll(resource).Update(resource); err != nil {
-					code, response = http.StatusInternalServerError, m.InternalError
-				} else {
-					session.Resources = append(session.Resources, resID)
-
-					//Updating session db entry to include new resource
-					if err = mgm.Coll(session).Update(session); err != nil {
-						code, response = http.StatusInternalServerError, m.InternalError
-					} else {
-						code, response = http.StatusOK, resource
-					}
-				}
+				code, response = checkoutForSession(session, resource, false, expand)
 			}
-			mux["Resources"].Unlock()
 		} else {
 			code, response = http.StatusConflict, m.SessionResAlreadyCheckedOut
 		}
 
 	}
-	mux["Sessions"].Unlock()
+	unlock()
 
 	return code, response
 }
 
 // SessionResCheckinBusiness godoc
-func SessionResCheckinBusiness(sessID string, resID string, mux map[string]*sync.Mutex) (int, interface{}) {
-	var err error
+func SessionResCheckinBusiness(sessID string, resID string, mux *lockutil.Locks) (int, interface{}) {
 	var code int
 	var response interface{}
-	var i int
-
-	session := &m.Session{}
 
-	mux["Sessions"].Lock()
+	//The resource is locked along with those the session checked out through its references
+	needs := func(session *m.Session) []string { return documentLocks(linkedClosure(session, resID), "Resources") }
+	unlock, session, err := lockSession(sessID, needs, []string{lockutil.Document("Resources", resID)}, mux)
 
 	//Look up the session in the db
-	if err = mgm.Coll(session).FindByID(sessID, session); err != nil {
+	if err != nil {
 		code, response = http.StatusNotFound, m.SessionNotFound
 	} else {
-		found := false
-
 		//Ensure that the resource is checked out by this session
-		for i = 0; i < len(session.Resources); i++ {
-			if session.Resources[i] == resID {
-				found = true
-				break
-			}
-		}
-
-		if !found {
+		if !sessionHasResource(session, resID) {
 			code, response = http.StatusBadRequest, m.SessionResNotCheckedOut
 		} else {
 			resource := &m.Resource{}
 
-			mux["Resources"].Lock()
-
 			//Look up the resource in the db
 			if err = mgm.Coll(resource).FindByID(resID, resource); err != nil {
 				code, response = http.StatusNotFound, m.ResourceNotFound
 			} else {
-				resource.CheckedOut--
-
-				//Release consumed subresources, if any
-				for j := 0; j < len(session.Consumed); j++ {
-					//See if a subresource of this resource has been checked out by the session
-					if session.Consumed[j].ParentID == resID {
-						for k := 0; k < len(resource.Fields); k++ {
-							//Locate the subresource entry
-							if session.Consumed[j].Key == resource.Fields[k].Key {
-								//Since Value is an interface, have to parse it as integer before reassigning a value
-								counter := resource.Fields[k].Value.(int32) + int32(session.Consumed[j].Amount)
-								resource.Fields[k].Value = counter
-
-								//Pop subresource record from session db entry
-								session.Consumed[j] = session.Consumed[len(session.Consumed)-1]
-								session.Consumed = session.Consumed[:len(session.Consumed)-1]
+				//Updating resource db entry to checked in, along with resources checked out through its references, and the session db entry in a single transaction
+				err = db.Transaction(func(ctx context.Context) error {
+					//A run retried after a transient error starts over from the stored documents
+					err := db.Reload(ctx, session, resource)
 
-								break
-							}
-						}
+					if err == nil {
+						err = checkinResource(ctx, session, resource)
 					}
-				}
 
-				//Updating resource db entry to checked in
-				if err = mgm.Coll(resource).Update(resource); err != nil {
+					if err == nil {
+						err = checkinLinkedResources(ctx, session, resID)
+					}
+
+					if err == nil {
+						err = mgm.Coll(session).UpdateWithCtx(ctx, session)
+					}
+
+					return err
+				})
+
+				if err != nil {
 					code, response = http.StatusInternalServerError, m.InternalError
 				} else {
+					code, response = http.StatusOK, m.SessionResCheckedIn
+				}
+			}
+		}
+	}
+	unlock()
+
+	return code, response
+}
 
-					//Updating resource list on the session now that the resource is officially checked in
-					session.Resources[i] = session.Resources[len(session.Resources)-1]
-					session.Resources = session.Resources[:len(session.Resources)-1]
+// checkoutForSession checks out a resource the session doesn't hold yet, along with the resources it references for checkout, once the resource passes the checks of its state, its project and its reservations. Caller is responsible for locking the session, the resources and their reservations
+// Args:	session, resource, whether to check it out exclusively, reference keys to expand
+// Rets:	http code, resource or error message
+func checkoutForSession(session *m.Session, resource *m.Resource, exclusive bool, expand []string) (int, interface{}) {
+	var err error
+	var code int
+	var response interface{}
 
-					//Updating session db entry
-					if err = mgm.Coll(session).Update(session); err != nil {
-						code, response = http.StatusInternalServerError, m.InternalError
-					} else {
-						code, response = http.StatusOK, m.SessionResCheckedIn
-					}
-				}
+	if resource.Quarantined() {
+		code, response = http.StatusConflict, m.ResourceQuarantined
+	} else if resource.Exclusive || (exclusive && resource.CheckedOut > 0) {
+		code, response = http.StatusConflict, m.ResourceExclusive
+	} else if deniedCode, denied := resourceDenied(session, resource); denied != nil {
+		code, response = deniedCode, denied
+	} else if project := reservingProject(resource.ID.Hex()); project != "" && project != session.Project {
+		code, response = http.StatusConflict, m.ResourceReserved
+	} else {
+		//Updating resource db entry to checked out, along with resources it references for checkout, and the session db entry to include the new resources in a single transaction, so that a failed write leaves no checkout counter behind
+		err = db.Transaction(func(ctx context.Context) error {
+			//A run retried after a transient error starts over from the stored documents
+			err := db.Reload(ctx, session, resource)
+
+			if err == nil {
+				resource.Exclusive = exclusive
+				err = checkoutResource(ctx, session, resource)
 			}
-			mux["Resources"].Unlock()
+
+			if err == nil {
+				err = checkoutLinkedResources(ctx, session, resource)
+			}
+
+			if err == nil {
+				err = mgm.Coll(session).UpdateWithCtx(ctx, session)
+			}
+
+			return err
+		})
+
+		if err != nil {
+			code, response = http.StatusInternalServerError, m.InternalError
+		} else {
+			expandResourceReferences(resource, expand)
+			code, response = http.StatusOK, resource
 		}
 	}
-	mux["Sessions"].Unlock()
 
 	return code, response
 }
 
+// sessionHasResource reports whether a resource is checked out by the session
+func sessionHasResource(session *m.Session, resID string) bool {
+	found := false
+
+	for _, res := range session.Resources {
+		if res == resID {
+			found = true
+			break
+		}
+	}
+
+	return found
+}
+
+// lockSession locks a session along with the documents an operation on it needs, and reads the session under the locks. The documents are listed from the session read under the locks; when some of them aren't locked yet, the locks are released and taken again along with the missing ones
+// Args:	session db id, function listing the lock names of the documents needed, further lock names, locks
+// Rets:	unlock function, session, error
+func lockSession(sessID string, needs func(*m.Session) []string, extra []string, mux *lockutil.Locks) (func(), *m.Session, error) {
+	var err error
+	var unlock func()
+	var missing []string
+	session := &m.Session{}
+	names := append([]string{lockutil.Document("Sessions", sessID)}, extra...)
+
+	for retry := true; retry; {
+		unlock = mux.Lock(names...)
+		missing = nil
+
+		if err = mgm.Coll(session).FindByID(sessID, session); err == nil {
+			for _, name := range needs(session) {
+				if !resourceInList(names, name) && !resourceInList(missing, name) {
+					missing = append(missing, name)
+				}
+			}
+		}
+
+		if retry = len(missing) > 0; retry {
+			unlock()
+			names = append(names, missing...)
+		}
+	}
+
+	return unlock, session, err
+}
+
+// documentLocks lists the lock names of documents of the given collections under each id
+func documentLocks(ids []string, collections ...string) []string {
+	names := []string{}
+
+	for _, id := range ids {
+		for _, collection := range collections {
+			names = append(names, lockutil.Document(collection, id))
+		}
+	}
+
+	return names
+}
+
+// checkoutClosure lists a resource along with the resources it references for checkout, recursively
+// Args:	resource id
+// Rets:	resource ids
+func checkoutClosure(resID string) []string {
+	ids := []string{resID}
+
+	for i := 0; i < len(ids); i++ {
+		resource := &m.Resource{}
+
+		if mgm.Coll(resource).FindByID(ids[i], resource) == nil {
+			for _, f := range resource.Fields {
+				if id, ok := f.Value.(string); f.Type == "reference" && f.Checkout && ok && id != "" && !resourceInList(ids, id) {
+					ids = append(ids, id)
+				}
+			}
+		}
+	}
+
+	return ids
+}
+
+// linkedClosure lists a resource checked out by a session along with the resources the session checked out through its references, recursively
+// Args:	session, resource id
+// Rets:	resource ids
+func linkedClosure(session *m.Session, resID string) []string {
+	ids := []string{resID}
+
+	for i := 0; i < len(ids); i++ {
+		for _, l := range session.Linked {
+			if l.ParentID == ids[i] && !resourceInList(ids, l.ResourceID) {
+				ids = append(ids, l.ResourceID)
+			}
+		}
+	}
+
+	return ids
+}
+
+// resourceDenied checks that a session may use a resource: the resource has to be active, and associated with the project of the session unless it is a member of a pool of the project, an operator lent it to the session or it was checked out through a reference of such a resource
+// Args:	session, resource
+// Rets:	http code and error message, or nil message when the resource may be used
+func resourceDenied(session *m.Session, resource *m.Resource) (int, m.Msg) {
+	var code int
+	var denied m.Msg
+	resID := resource.ID.Hex()
+	member := false
+
+	for _, projID := range resource.Projects {
+		member = member || projID == session.Project
+	}
+
+	for _, borrowed := range session.Borrowed {
+		member = member || borrowed == resID
+	}
+
+	for _, linked := range session.Linked {
+		member = member || linked.ResourceID == resID
+	}
+
+	//Pools open their members to the projects of the pool
+	member = member || poolGrants(session.Project, resource)
+
+	if !resource.Active {
+		code, denied = http.StatusConflict, m.ResourceInactive
+	} else if !member {
+		code, denied = http.StatusForbidden, m.ResourceProjectMismatch
+	}
+
+	return code, denied
+}
+
+// checkoutResource increments the checkout counter of a resource, adds it to the session resource list and opens its checkout interval. Caller is responsible for locking the session and the resource, and for updating the session db entry
+// Args:	transaction context, session, resource
+// Rets:	error
+func checkoutResource(ctx context.Context, session *m.Session, resource *m.Resource) error {
+	var err error
+
+	//Increment checkout counter
+	resource.CheckedOut++
+
+	if err = mgm.Coll(resource).UpdateWithCtx(ctx, resource); err == nil {
+		session.Resources = append(session.Resources, resource.ID.Hex())
+		err = recordCheckout(ctx, session, resource)
+	}
+
+	return err
+}
+
+// checkoutLinkedResources checks out resources referenced by reference-type fields flagged for checkout, recursively, whichever projects they are associated with. Referenced resources already checked out by the session, quarantined, held exclusively, inactive, reserved for another project or missing are skipped. Caller is responsible for locking the referenced resources and their reservations
+// Args:	transaction context, session, referencing resource
+// Rets:	error
+func checkoutLinkedResources(ctx context.Context, session *m.Session, resource *m.Resource) error {
+	var err error
+
+	for _, f := range resource.Fields {
+		if id, ok := f.Value.(string); f.Type == "reference" && f.Checkout && ok && id != "" && !sessionHasResource(session, id) {
+			linked := &m.Resource{}
+
+			if mgm.Coll(linked).FindByIDWithCtx(ctx, id, linked) == nil && !linked.Quarantined() && !linked.Exclusive && linked.Active && linkedReservable(session, id) {
+				if err = checkoutResource(ctx, session, linked); err == nil {
+					session.Linked = append(session.Linked, m.LinkedResource{
+						ParentID:   resource.ID.Hex(),
+						ResourceID: id,
+					})
+
+					err = checkoutLinkedResources(ctx, session, linked)
+				}
+
+				if err != nil {
+					break
+				}
+			}
+		}
+	}
+
+	return err
+}
+
+// linkedReservable reports whether a resource referenced for checkout is free of reservations of projects other than the one of the session, as checkouts of the resource itself are
+func linkedReservable(session *m.Session, resID string) bool {
+	project := reservingProject(resID)
+
+	return project == "" || project == session.Project
+}
+
+// checkinResource decrements the checkout counter of a resource, releases subresources consumed by the session, removes the resource from the session resource list and closes its checkout interval. Caller is responsible for locking the session and the resource, and for updating the session db entry
+// Args:	transaction context, session, resource
+// Rets:	error
+func checkinResource(ctx context.Context, session *m.Session, resource *m.Resource) error {
+	var err error
+	resID := resource.ID.Hex()
+
+	resource.CheckedOut--
+	resource.Exclusive = false
+
+	//Release consumed subresources, if any
+	for j := 0; j < len(session.Consumed); j++ {
+		//See if a subresource of this resource has been checked out by the session
+		if session.Consumed[j].ParentID == resID {
+			for k := 0; k < len(resource.Fields); k++ {
+				//Locate the subresource entry
+				if session.Consumed[j].Key == resource.Fields[k].Key {
+					//Since Value is an interface, have to parse it as integer before reassigning a value
+					counter := resource.Fields[k].Value.(int32) + int32(session.Consumed[j].Amount)
+					resource.Fields[k].Value = counter
+					countSubResActivity(session, resID, session.Consumed[j].Key, 0, session.Consumed[j].Amount)
+
+					//Pop subresource record from session db entry
+					session.Consumed[j] = session.Consumed[len(session.Consumed)-1]
+					session.Consumed = session.Consumed[:len(session.Consumed)-1]
+					j--
+
+					break
+				}
+			}
+		}
+	}
+
+	//Updating resource db entry to checked in
+	if err = mgm.Coll(resource).UpdateWithCtx(ctx, resource); err == nil {
+		//Updating resource list on the session now that the resource is officially checked in
+		for i := 0; i < len(session.Resources); i++ {
+			if session.Resources[i] == resID {
+				session.Resources[i] = session.Resources[len(session.Resources)-1]
+				session.Resources = session.Resources[:len(session.Resources)-1]
+				break
+			}
+		}
+
+		//A resource checked in on its own is no longer tied to its parent
+		for i := 0; i < len(session.Linked); i++ {
+			if session.Linked[i].ResourceID == resID {
+				session.Linked[i] = session.Linked[len(session.Linked)-1]
+				session.Linked = session.Linked[:len(session.Linked)-1]
+				break
+			}
+		}
+
+		err = recordCheckin(ctx, session.ID.Hex(), resID)
+	}
+
+	return err
+}
+
+// checkinLinkedResources checks in resources checked out through the reference-type fields of a parent resource, recursively
+// Args:	transaction context, session, parent resource id
+// Rets:	error
+func checkinLinkedResources(ctx context.Context, session *m.Session, parentID string) error {
+	var err error
+	var children []string
+
+	for _, l := range session.Linked {
+		if l.ParentID == parentID {
+			children = append(children, l.ResourceID)
+		}
+	}
+
+	for _, childID := range children {
+		linked := &m.Resource{}
+
+		//Linked resources deleted in the meantime are released along with the session
+		if mgm.Coll(linked).FindByIDWithCtx(ctx, childID, linked) == nil {
+			if err = checkinResource(ctx, session, linked); err == nil {
+				err = checkinLinkedResources(ctx, session, childID)
+			}
+
+			if err != nil {
+				break
+			}
+		}
+	}
+
+	return err
+}
+
+// releaseDeletedResource drops a deleted resource from the sessions holding or borrowing it, along with the subresources they consumed from it, and closes its checkout intervals. Resources checked out through its references stay checked out on their own. Caller is responsible for locking the sessions and the resource
+// Args:	transaction context, resource id
+// Rets:	error
+func releaseDeletedResource(ctx context.Context, resID string) error {
+	var err error
+	sessions := []m.Session{}
+	filter := bson.M{"$or": []bson.M{{"resources": resID}, {"borrowed": resID}, {"linked.parentid": resID}}}
+
+	if err = mgm.Coll(&m.Session{}).SimpleFindWithCtx(ctx, &sessions, filter); err == nil {
+		for i := range sessions {
+			session := &sessions[i]
+			consumed := []m.SubResConsumed{}
+			linked := []m.LinkedResource{}
+			held := sessionHasResource(session, resID)
+
+			session.Resources = removeID(session.Resources, resID)
+			session.Borrowed = removeID(session.Borrowed, resID)
+
+			for _, c := range session.Consumed {
+				if c.ParentID != resID {
+					consumed = append(consumed, c)
+				}
+			}
+			session.Consumed = consumed
+
+			for _, l := range session.Linked {
+				if l.ParentID != resID && l.ResourceID != resID {
+					linked = append(linked, l)
+				}
+			}
+			session.Linked = linked
+
+			if err = mgm.Coll(session).UpdateWithCtx(ctx, session); err == nil && held {
+				err = recordCheckin(ctx, session.ID.Hex(), resID)
+			}
+
+			if err != nil {
+				break
+			}
+		}
+	}
+
+	return err
+}
+
+// removeID returns a list of ids without the given one
+func removeID(ids []string, id string) []string {
+	kept := []string{}
+
+	for _, item := range ids {
+		if item != id {
+			kept = append(kept, item)
+		}
+	}
+
+	return kept
+}
+
 // ConsumeSubResourceBusiness godoc
-func ConsumeSubResourceBusiness(sessID string, resID string, subResKey string, mux map[string]*sync.Mutex) (int, interface{}) {
+func ConsumeSubResourceBusiness(sessID string, resID string, subResKey string, mux *lockutil.Locks) (int, interface{}) {
 	var err error
 	var i int
 	var code int
 	var response interface{}
 	session := &m.Session{}
 
-	mux["Sessions"].Lock()
+	unlock := mux.Lock(lockutil.Document("Sessions", sessID), lockutil.Document("Resources", resID))
 
 	if err = mgm.Coll(session).FindByID(sessID, session); err != nil {
 		code, response = http.StatusNotFound, m.SessionNotFound
@@ -204,11 +545,12 @@ func ConsumeSubResourceBusiness(sessID string, resID string, subResKey string, m
 		} else {
 			resource := &m.Resource{}
 
-			mux["Resources"].Lock()
-
 			//Find the resource db entry
 			if err = mgm.Coll(resource).FindByID(resID, resource); err != nil {
 				code, response = http.StatusNotFound, m.ResourceNotFound
+			} else if deniedCode, denied := resourceDenied(session, resource); denied != nil {
+				//The resource may have been deactivated or moved to another project since it was checked out
+				code, response = deniedCode, denied
 			} else {
 				found = false
 
@@ -232,58 +574,70 @@ func ConsumeSubResourceBusiness(sessID string, resID string, subResKey string, m
 						counter := resource.Fields[i].Value.(int32) - 1
 						resource.Fields[i].Value = counter
 
-						if mgm.Coll(resource).Update(resource); err != nil {
-							code, response = http.StatusInternalServerError, m.InternalError
-						} else {
-							found = false
-
-							for i = 0; i < len(session.Consumed); i++ {
-								if session.Consumed[i].Key == subResKey {
-									found = true
-									session.Consumed[i].Amount++
-									break
-								}
-							}
-
-							if !found {
-								//This is the first time the session consumes this subresource
-								consumedRes := &m.SubResConsumed{
-									ParentID: resID,
-									Key:      subResKey,
-									Amount:   1,
-								}
+						found = false
 
-								//Append a new consumed entry
-								session.Consumed = append(session.Consumed, *consumedRes)
+						for i = 0; i < len(session.Consumed); i++ {
+							if session.Consumed[i].Key == subResKey {
+								found = true
+								session.Consumed[i].Amount++
+								break
 							}
+						}
 
-							//Update db entry for the session
-							if mgm.Coll(session).Update(session); err != nil {
-								code, response = http.StatusInternalServerError, m.InternalError
-							} else {
-								code, response = http.StatusOK, m.SessionSubResConsumed
+						if !found {
+							//This is the first time the session consumes this subresource
+							consumedRes := &m.SubResConsumed{
+								ParentID: resID,
+								Key:      subResKey,
+								Amount:   1,
 							}
+
+							//Append a new consumed entry
+							session.Consumed = append(session.Consumed, *consumedRes)
+						}
+
+						countSubResActivity(session, resID, subResKey, 1, 0)
+
+						//Update db entries for the resource and the session together
+						if err = updateSessionResource(session, resource); err != nil {
+							code, response = http.StatusInternalServerError, m.InternalError
+						} else {
+							code, response = http.StatusOK, m.SessionSubResConsumed
 						}
 					}
 				}
 			}
-			mux["Resources"].Unlock()
 		}
 	}
-	mux["Sessions"].Unlock()
+	unlock()
 
 	return code, response
 }
 
+// updateSessionResource updates the db entries of a session and of a resource it holds in a single transaction
+// Args:	session, resource
+// Rets:	error
+func updateSessionResource(session *m.Session, resource *m.Resource) error {
+	return db.Transaction(func(ctx context.Context) error {
+		err := mgm.Coll(resource).UpdateWithCtx(ctx, resource)
+
+		if err == nil {
+			err = mgm.Coll(session).UpdateWithCtx(ctx, session)
+		}
+
+		return err
+	})
+}
+
 // ReleaseSubResourceBusiness godoc
-func ReleaseSubResourceBusiness(sessID string, resID string, subResKey string, mux map[string]*sync.Mutex) (int, interface{}) {
+func ReleaseSubResourceBusiness(sessID string, resID string, subResKey string, mux *lockutil.Locks) (int, interface{}) {
 	var err error
 	var code int
 	var response interface{}
 	var i int
 	session := &m.Session{}
 
-	mux["Sessions"].Lock()
+	unlock := mux.Lock(lockutil.Document("Sessions", sessID), lockutil.Document("Resources", resID))
 
 	if err = mgm.Coll(session).FindByID(sessID, session); err != nil {
 		code, response = http.StatusNotFound, m.SessionNotFound
@@ -303,8 +657,6 @@ func ReleaseSubResourceBusiness(sessID string, resID string, subResKey string, m
 		} else {
 			resource := &m.Resource{}
 
-			mux["Resources"].Lock()
-
 			//Make sure the actual resource still exists
 			if err = mgm.Coll(resource).FindByID(session.Consumed[i].ParentID, resource); err != nil {
 				code, response = http.StatusNotFound, m.ResourceNotFound
@@ -332,137 +684,252 @@ func ReleaseSubResourceBusiness(sessID string, resID string, subResKey string, m
 				if !found {
 					code, response = http.StatusInternalServerError, m.InternalError
 				} else {
-					//Update session db entry
-					if err = mgm.Coll(session).Update(session); err != nil {
+					countSubResActivity(session, resID, subResKey, 0, 1)
+
+					//Update db entries for the session and the resource together
+					if err = updateSessionResource(session, resource); err != nil {
 						code, response = http.StatusInternalServerError, m.InternalError
 					} else {
-						//Update resource entry
-						if err = mgm.Coll(resource).Update(resource); err != nil {
-							code, response = http.StatusInternalServerError, m.InternalError
-						} else {
-							code, response = http.StatusOK, m.SessionSubResReleased
-						}
+						code, response = http.StatusOK, m.SessionSubResReleased
 					}
 				}
 			}
-			mux["Resources"].Unlock()
 		}
 	}
-	mux["Sessions"].Unlock()
+	unlock()
 
 	return code, response
 }
 
 // TerminateSessionBusiness godoc
-// Caller is responsible for cancelling the termination job scheduled for the session using the returned jobID
-// Args:	session db id
-// Rets:	scheduled session termination jobID, error
-func TerminateSessionBusiness(sessionID string, mux map[string]*sync.Mutex) (string, error) {
-	var err error
-	var jobID string
-	session := &m.Session{}
+// Checks in the resources of the session and moves it to the session history
+// Args:	session db id, close reason
+// Rets:	closed session, error
+func TerminateSessionBusiness(sessionID string, reason string, mux *lockutil.Locks) (*m.ClosedSession, error) {
+	return terminateSession(sessionID, func(*m.Session) string { return reason }, mux)
+}
+
+// terminateSession checks in the resources of a session and moves it to the session history, unless the session as found under its lock has no close reason
+// Args:	session db id, function returning the close reason of the session or an empty string to keep it running, locks
+// Rets:	closed session, nil if the session is kept running; error
+func terminateSession(sessionID string, closeReason func(*m.Session) string, mux *lockutil.Locks) (*m.ClosedSession, error) {
+	var closed *m.ClosedSession
 
-	mux["Sessions"].Lock()
+	needs := func(session *m.Session) []string { return documentLocks(session.Resources, "Resources") }
+	unlock, session, err := lockSession(sessionID, needs, nil, mux)
 
 	//Retrieving session info
-	if err = mgm.Coll(session).FindByID(sessionID, session); err == nil {
-		//Release associated resources
-		for _, resID := range session.Resources {
-			resource := &m.Resource{}
+	if err != nil {
+		err = fmt.Errorf("error: session not found")
+	} else if reason := closeReason(session); reason != "" {
+		//Checking in resources and moving the session to the history in a single transaction; resources deleted in the meantime have nothing left to release
+		err = db.Transaction(func(ctx context.Context) error {
+			//A run retried after a transient error starts over from the stored session
+			err := db.Reload(ctx, session)
 
-			mux["Resources"].Lock()
-
-			//Checking in resources
-			if err = mgm.Coll(resource).FindByID(resID, resource); err == nil {
-				resource.CheckedOut--
-
-				//Release consumed subresources, if any
-				for i := 0; i < len(session.Consumed); i++ {
-					//See if a subresource of this resource has been checked out by the session
-					if session.Consumed[i].ParentID == resID {
-						for j := 0; j < len(resource.Fields); j++ {
-							//Locate the subresource entry
-							if session.Consumed[i].Key == resource.Fields[j].Key {
-								//Since Value is an interface, have to parse it as integer before reassigning a value
-								counter := resource.Fields[j].Value.(int32) + int32(session.Consumed[i].Amount)
-								resource.Fields[i].Value = counter
-							}
-						}
-					}
+			//The history keeps what the session held when it was closed
+			closed = closedSession(session, reason)
+
+			for i := 0; err == nil && i < len(closed.Resources); i++ {
+				resource := &m.Resource{}
+
+				if mgm.Coll(resource).FindByIDWithCtx(ctx, closed.Resources[i], resource) == nil {
+					err = checkinResource(ctx, session, resource)
 				}
+			}
 
-				mgm.Coll(resource).Update(resource)
-			} else {
-				err = fmt.Errorf("error: resource not found")
+			if err == nil {
+				if err = recordCheckin(ctx, sessionID, ""); err == nil {
+					closed.Summary, err = sessionSummary(ctx, session, closed.Closed)
+				}
 			}
 
-			mux["Resources"].Unlock()
+			if err == nil {
+				if err = mgm.Coll(closed).CreateWithCtx(ctx, closed); err == nil {
+					err = mgm.Coll(session).DeleteWithCtx(ctx, session)
+				}
+			}
+
+			return err
+		})
+	}
+
+	unlock()
+
+	return closed, err
+}
+
+// closedSession builds the history entry of a session being closed
+// Args:	session, close reason
+// Rets:	closed session
+func closedSession(session *m.Session, reason string) *m.ClosedSession {
+	closed := &m.ClosedSession{
+		SessionID: session.ID.Hex(),
+		Project:   session.Project,
+		Resources: append([]string{}, session.Resources...),
+		Consumed:  append([]m.SubResConsumed{}, session.Consumed...),
+		Linked:    append([]m.LinkedResource{}, session.Linked...),
+		Borrowed:  append([]string{}, session.Borrowed...),
+		Metadata:  session.Metadata,
+		Started:   session.CreatedAt,
+		Renewed:   session.Renewed,
+		Closed:    time.Now().UTC(),
+		Reason:    reason,
+	}
+
+	//Sessions started before renewals were recorded were last renewed when they started, as far as is known
+	if closed.Renewed.IsZero() {
+		closed.Renewed = session.CreatedAt
+	}
+
+	return closed
+}
+
+// sessionSummary summarizes a session being closed from its checkout intervals and subresource activity. The intervals of the session have to be closed beforehand
+// Args:	transaction context, session, close time
+// Rets:	summary, error
+func sessionSummary(ctx context.Context, session *m.Session, closed time.Time) (m.SessionSummary, error) {
+	var err error
+	usages := []m.Usage{}
+	names := map[string]string{}
+	summary := m.SessionSummary{
+		Resources:    []m.SessionSummaryResource{},
+		SubResources: append([]m.SubResActivity{}, session.Activity...),
+		Duration:     closed.Sub(session.CreatedAt).Seconds(),
+		Renewals:     session.Renewals,
+	}
+
+	if err = mgm.Coll(&m.Usage{}).SimpleFindWithCtx(ctx, &usages, bson.M{"session": session.ID.Hex()}); err == nil {
+		sort.Slice(usages, func(i, j int) bool { return usages[i].CheckedOut.Before(usages[j].CheckedOut) })
+
+		for _, u := range usages {
+			//Each resource is looked up once however often it was checked out
+			if _, ok := names[u.ResourceID]; !ok {
+				resource := &m.Resource{}
+
+				if mgm.Coll(resource).FindByIDWithCtx(ctx, u.ResourceID, resource) == nil {
+					names[u.ResourceID] = resource.Name
+				} else {
+					names[u.ResourceID] = ""
+				}
+			}
+
+			summary.Resources = append(summary.Resources, m.SessionSummaryResource{
+				ResourceID: u.ResourceID,
+				Name:       names[u.ResourceID],
+				CheckedOut: u.CheckedOut,
+				CheckedIn:  u.CheckedIn,
+			})
 		}
+	}
+
+	return summary, err
+}
+
+// countSubResActivity adds subresources consumed or released by a session to its activity. Caller is responsible for updating the session db entry
+// Args:	session, parent resource id, subresource key, amount consumed, amount released
+// Rets:	none
+func countSubResActivity(session *m.Session, resID string, key string, consumed int, released int) {
+	found := false
+
+	for i := 0; i < len(session.Activity) && !found; i++ {
+		if session.Activity[i].ParentID == resID && session.Activity[i].Key == key {
+			session.Activity[i].Consumed += consumed
+			session.Activity[i].Released += released
+			found = true
+		}
+	}
 
-		jobID = session.JobID
-		mgm.Coll(session).Delete(session)
+	if !found {
+		session.Activity = append(session.Activity, m.SubResActivity{ParentID: resID, Key: key, Consumed: consumed, Released: released})
+	}
+}
+
+// ShowSessionHistoryBusiness godoc
+func ShowSessionHistoryBusiness(requestData *m.ListRequest) (int, interface{}) {
+	var err error
+	var code int
+	var response interface{}
+	var filter bson.M
+	sessionsFound := []m.ClosedSession{}
+
+	if filter, err = listFilter(requestData, "project", "owner", "runner", "commit", "job", "metadata.labels", "reason", "resources", "closed"); err != nil {
+		code, response = http.StatusBadRequest, m.ListRequestInvalid
 	} else {
-		err = fmt.Errorf("error: session not found")
+		code, response = listDocuments(&m.ClosedSession{}, &sessionsFound, filter, requestData, []string{"closed", "started", "project", "reason", "metadata.owner"})
 	}
 
-	mux["Sessions"].Unlock()
+	return code, response
+}
+
+// ShowClosedSessionBusiness godoc
+func ShowClosedSessionBusiness(sessID string) (int, interface{}) {
+	var code int
+	var response interface{}
+	closed := &m.ClosedSession{}
+
+	//Closed sessions are looked up by the id they had while running
+	if err := mgm.Coll(closed).First(bson.M{"sessionid": sessID}, closed); err != nil {
+		code, response = http.StatusNotFound, m.SessionNotFound
+	} else {
+		code, response = http.StatusOK, closed
+	}
 
-	return jobID, err
+	return code, response
 }
 
 // CreateSessionBusiness godoc
-func CreateSessionBusiness(requestData *m.SessionRequest, sessExt int, signingKey string, scheduler *scheduler.Scheduler, mux map[string]*sync.Mutex) (int, interface{}) {
+func CreateSessionBusiness(requestData *m.SessionRequest, sessExt int, signingKey string, mux *lockutil.Locks) (int, interface{}) {
 	var err error
 	var code int
 	var response interface{}
 	project := &m.Project{}
 
-	mux["Projects"].Lock()
+	unlock := mux.Lock("Projects")
 
-	//Looking for a project by the provided API key
-	if err = mgm.Coll(project).First(bson.M{"apikey": requestData.APIKey}, project); err != nil {
+	if err = validateSessionMetadata(&requestData.Metadata); err != nil {
+		code, response = http.StatusBadRequest, m.SessionMetadataInvalid
+	} else if err = mgm.Coll(project).First(bson.M{"apikey": requestData.APIKey}, project); err != nil {
+		//Looking for a project by the provided API key
 		code, response = http.StatusNotFound, m.ProjectNotFound
 	} else {
-		//Assigning project relation to a new session
+		//Assigning project relation to a new session, the worker closes it when its token runs out
+		now := time.Now().UTC()
 		newSession := &m.Session{
-			Project: project.ID.Hex(),
+			Project:  project.ID.Hex(),
+			Metadata: requestData.Metadata,
+			Renewed:  now,
+			Expires:  now.Add(time.Hour * time.Duration(sessExt)),
 		}
 
-		mux["Sessions"].Lock()
-
-		//Inserting a new session entry into the database
-		mgm.Coll(newSession).Save(newSession)
-
-		//Generating a JWT token for the session
-		token := jwt.New(jwt.SigningMethodHS256)
-		claims := token.Claims.(jwt.MapClaims)
-		claims["id"] = newSession.ID.Hex() //Passing ObjectID of the session in the token
-		claims["exp"] = time.Now().Add(time.Hour * time.Duration(sessExt)).Unix()
-
-		//Schedule a termination task
-		newSession.JobID = scheduler.Delay().Hour(sessExt).Do(TerminateSessionBusiness, newSession.ID.Hex(), mux)
-
-		mgm.Coll(newSession).Update(newSession) //Updating session db entry to include job id
-
-		if t, err := token.SignedString([]byte(signingKey)); err != nil {
+		//Inserting a new session entry into the database, no token is issued for a session which wasn't stored
+		if err = mgm.Coll(newSession).Save(newSession); err != nil {
 			code, response = http.StatusInternalServerError, m.InternalError
 		} else {
-			//Returning the new token prefixed with Bearer in a response
-			code, response = http.StatusOK, map[string]string{"token": "Bearer " + t}
+			//Generating a JWT token for the session
+			token := jwt.New(jwt.SigningMethodHS256)
+			claims := token.Claims.(jwt.MapClaims)
+			claims["id"] = newSession.ID.Hex() //Passing ObjectID of the session in the token
+			claims["exp"] = newSession.Expires.Unix()
+
+			if t, err := token.SignedString([]byte(signingKey)); err != nil {
+				code, response = http.StatusInternalServerError, m.InternalError
+			} else {
+				//Returning the new token prefixed with Bearer in a response
+				code, response = http.StatusOK, map[string]string{"token": "Bearer " + t}
+			}
 		}
-
-		mux["Sessions"].Unlock()
 	}
 
-	mux["Projects"].Unlock()
+	unlock()
 
 	return code, response
 }
 
-// RenewSessionBusiness creates new session timeout jobs for every session in the database. Meant to be executed at runtime to create timeouts for any previously created sessions
-//Args:	scheduler, delay hours
-//Rets:	error
-func RenewSessionBusiness(token *jwt.Token, sessExt int, signingKey string, scheduler *scheduler.Scheduler, mux map[string]*sync.Mutex) (int, interface{}) {
+// RenewSessionBusiness extends a session and its token by the default session extension time
+//Args:	token, delay hours, signing key, locks
+//Rets:	http code, new token or error message
+func RenewSessionBusiness(token *jwt.Token, sessExt int, signingKey string, mux *lockutil.Locks) (int, interface{}) {
 	var err error
 	var code int
 	var response interface{}
@@ -471,23 +938,22 @@ func RenewSessionBusiness(token *jwt.Token, sessExt int, signingKey string, sche
 	claims := token.Claims.(jwt.MapClaims)
 	sessID := claims["id"].(string)
 
-	mux["Sessions"].Lock()
+	unlock := mux.Lock(lockutil.Document("Sessions", sessID))
 
 	if err = mgm.Coll(session).FindByID(sessID, session); err != nil {
 		code, response = http.StatusNotFound, m.SessionNotFound
 	} else {
-		//Generating an updated expiration timestamp for a new bearer token
-		claims["exp"] = time.Now().Add(time.Hour * time.Duration(sessExt)).Unix()
-
-		//Cancel the old job, schedule a new one
-		scheduler.CancelJob(session.JobID)
-		session.JobID = scheduler.Delay().Hour(sessExt).Do(TerminateSessionBusiness, session.ID.Hex(), mux)
-
-		//Update DB entry with new job id
-		mgm.Coll(session).Update(session)
-
-		//Create and send a new token
-		if t, err := token.SignedString([]byte(signingKey)); err != nil {
+		//Pushing back the expiry of the session, and of its bearer token along with it
+		session.Renewed = time.Now().UTC()
+		session.Expires = session.Renewed.Add(time.Hour * time.Duration(sessExt))
+		session.Renewals++
+		claims["exp"] = session.Expires.Unix()
+
+		//Update DB entry with the new expiry; the worker expires sessions from the stored expiry, so no token is issued unless it was written
+		if err = mgm.Coll(session).Update(session); err != nil {
+			code, response = http.StatusInternalServerError, m.InternalError
+		} else if t, err := token.SignedString([]byte(signingKey)); err != nil {
+			//Create and send a new token
 			code, response = http.StatusInternalServerError, m.InternalError
 		} else {
 			//Returning the new token prefixed with Bearer in a response
@@ -495,53 +961,169 @@ func RenewSessionBusiness(token *jwt.Token, sessExt int, signingKey string, sche
 		}
 	}
 
-	mux["Sessions"].Unlock()
+	unlock()
 
 	return code, response
 }
 
-// RecoverSessionsBusiness godoc
-func RecoverSessionsBusiness(scheduler *scheduler.Scheduler, sessExt int, mux map[string]*sync.Mutex) error {
+// ExpireSessionsBusiness closes the sessions whose token ran out without being renewed. Meant to be executed every second by the worker
+// Args:	default session extension time in hours, locks
+// Rets:	error
+func ExpireSessionsBusiness(sessExt int, mux *lockutil.Locks) error {
 	var err error
 	sessionsFound := []m.Session{}
+	now := time.Now().UTC()
 
-	mux["Sessions"].Lock()
-
-	//Searching for sessions
-	_ = mgm.Coll(&m.Session{}).SimpleFind(&sessionsFound, bson.M{})
+	//Sessions started before expiries were stored run out sessext hours after their last renewal, they are checked one by one
+	_ = mgm.Coll(&m.Session{}).SimpleFind(&sessionsFound, bson.M{"$or": []bson.M{{"expires": bson.M{"$lte": now}}, {"expires": bson.M{"$exists": false}}}})
 
-	//Creating expiration jobs for each session
 	for _, s := range sessionsFound {
-		s.JobID = scheduler.Delay().Hour(sessExt).Do(TerminateSessionBusiness, s.ID.Hex(), mux)
-		mgm.Coll(&s).Update(&s) //At the moment each session's DB entry is updated manually as opposed to a single batch job because of mgm's limitations
-	}
+		if sessionExpiry(&s, sessExt, now) != "" {
+			//The session may have been renewed since it was found, it is checked again under its lock
+			closeReason := func(session *m.Session) string { return sessionExpiry(session, sessExt, time.Now().UTC()) }
 
-	mux["Sessions"].Unlock()
+			if _, terminateErr := terminateSession(s.ID.Hex(), closeReason, mux); terminateErr != nil {
+				err = terminateErr
+			}
+		}
+	}
 
 	return err
 }
 
+// sessionExpiry returns the reason a session is closed for when its token ran out: expired, or lease lost when it ran out well before, as no worker was running to close it
+// Args:	session, default session extension time in hours, current time
+// Rets:	close reason, empty if the session hasn't run out
+func sessionExpiry(session *m.Session, sessExt int, now time.Time) string {
+	var reason string
+	expires := session.Expires
+
+	if expires.IsZero() {
+		renewed := session.Renewed
+		if renewed.IsZero() {
+			renewed = session.CreatedAt
+		}
+
+		expires = renewed.Add(time.Hour * time.Duration(sessExt))
+	}
+
+	if now.Sub(expires) > expiryGrace {
+		reason = m.CloseLeaseLost
+	} else if !now.Before(expires) {
+		reason = m.CloseExpired
+	}
+
+	return reason
+}
+
 // CloseSessionBusiness godoc
-func CloseSessionBusiness(sessID string, scheduler *scheduler.Scheduler, mux map[string]*sync.Mutex) (int, interface{}) {
+func CloseSessionBusiness(sessID string, reason string, mux *lockutil.Locks) (int, interface{}) {
 	var err error
 	var code int
 	var response interface{}
-	var jobID string
+	var closed *m.ClosedSession
 
-	//TerminateSession has its own lock on Sessions, no need to lock here
+	//TerminateSession locks the session itself, no need to lock here
 
 	//Verifying that the ObjectID contains 24 hexademical characters
 	if !db.VerifyObjectIDString(sessID) {
 		code, response = http.StatusBadRequest, m.InvalidID
 	} else {
-		if jobID, err = TerminateSessionBusiness(sessID, mux); err != nil {
+		if closed, err = TerminateSessionBusiness(sessID, reason, mux); err != nil {
 			code, response = http.StatusNotFound, m.SessionNotFound
 		} else {
-			//Cancel scheduled termination job, if any
-			scheduler.CancelJob(jobID)
-			code, response = http.StatusOK, m.SessionTerminated
+			code, response = http.StatusOK, m.SessionClosed{Message: m.SessionTerminated["message"].(string), Summary: closed.Summary}
+		}
+	}
+
+	return code, response
+}
+
+// LendResourceBusiness godoc
+func LendResourceBusiness(sessID string, resID string, mux *lockutil.Locks) (int, interface{}) {
+	var code int
+	var response interface{}
+	session := &m.Session{}
+
+	unlock := mux.Lock(lockutil.Document("Sessions", sessID), lockutil.Document("Resources", resID))
+
+	if err := mgm.Coll(session).FindByID(sessID, session); err != nil {
+		code, response = http.StatusNotFound, m.SessionNotFound
+	} else {
+		//Only existing resources can be lent
+		if err = mgm.Coll(&m.Resource{}).FindByID(resID, &m.Resource{}); err != nil {
+			code, response = http.StatusNotFound, m.ResourceNotFound
+		} else {
+			lent := false
+			for _, borrowed := range session.Borrowed {
+				lent = lent || borrowed == resID
+			}
+
+			if !lent {
+				session.Borrowed = append(session.Borrowed, resID)
+			}
+
+			if err = mgm.Coll(session).Update(session); err != nil {
+				code, response = http.StatusInternalServerError, m.InternalError
+			} else {
+				code, response = http.StatusOK, session
+			}
 		}
 	}
+	unlock()
 
 	return code, response
 }
+
+// RevokeLendingBusiness godoc
+func RevokeLendingBusiness(sessID string, resID string, mux *lockutil.Locks) (int, interface{}) {
+	var code int
+	var response interface{}
+	session := &m.Session{}
+
+	unlock := mux.Lock(lockutil.Document("Sessions", sessID))
+
+	if err := mgm.Coll(session).FindByID(sessID, session); err != nil {
+		code, response = http.StatusNotFound, m.SessionNotFound
+	} else {
+		//A resource still checked out stays with the session until it is checked in, but its subresources can no longer be consumed
+		kept := []string{}
+		for _, borrowed := range session.Borrowed {
+			if borrowed != resID {
+				kept = append(kept, borrowed)
+			}
+		}
+		session.Borrowed = kept
+
+		if err = mgm.Coll(session).Update(session); err != nil {
+			code, response = http.StatusInternalServerError, m.InternalError
+		} else {
+			code, response = http.StatusOK, session
+		}
+	}
+	unlock()
+
+	return code, response
+}
+
+// validateSessionMetadata checks the job URL and labels of session metadata. Labels are kept sorted by key, like those of resources
+// Args:	metadata
+// Rets:	error
+func validateSessionMetadata(metadata *m.SessionMetadata) error {
+	var err error
+
+	if metadata.JobURL != "" {
+		var jobURL *url.URL
+
+		if jobURL, err = url.ParseRequestURI(metadata.JobURL); err == nil && jobURL.Scheme != "http" && jobURL.Scheme != "https" {
+			err = fmt.Errorf("error: job URL is not an http or https URL")
+		}
+	}
+
+	if err == nil {
+		sort.Slice(metadata.Labels, func(i, j int) bool { return metadata.Labels[i].Key < metadata.Labels[j].Key })
+		err = validateLabels(metadata.Labels)
+	}
+
+	return err
+}
@@ -0,0 +1,45 @@
+package business
+
+import (
+	"fmt"
+	"time"
+
+	m "library/internal/app/models"
+	a "library/internal/pkg/auth"
+
+	"github.com/Kamva/mgm"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// SigningKeyBusiness returns the JWT signing key shared by the replicas of the library, generating and storing it on the first start. Replicas starting at once all read back the key stored first. Meant to be executed at startup
+// Args:	none
+// Rets:	signing key, error
+func SigningKeyBusiness() (string, error) {
+	var err error
+	var key string
+	keySetting := &m.GlobalSetting{}
+	coll := mgm.Coll(keySetting)
+
+	//Settings are unique by key, so that concurrent inserts of the key can't both succeed
+	_, _ = coll.Indexes().CreateOne(mgm.Ctx(), mongo.IndexModel{Keys: bson.D{{Key: "key", Value: 1}}, Options: options.Index().SetUnique(true)})
+
+	if key, err = a.GenerateKey(256); err == nil {
+		now := time.Now().UTC()
+		insert := bson.M{"$setOnInsert": bson.M{"key": "signingKey", "value": key, "created_at": now, "updated_at": now}}
+		opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+		//Storing the new key unless a key is stored already, and reading back the stored one
+		if err = coll.FindOneAndUpdate(mgm.Ctx(), bson.M{"key": "signingKey"}, insert, opts).Decode(keySetting); err != nil {
+			//Another replica inserted the key in the meantime
+			err = coll.First(bson.M{"key": "signingKey"}, keySetting)
+		}
+	}
+
+	if err == nil {
+		key = fmt.Sprintf("%v", keySetting.Value)
+	}
+
+	return key, err
+}
@@ -4,18 +4,17 @@ import (
 	"context"
 	"fmt"
 	"net/http"
-	"sync"
 
 	m "library/internal/app/models"
+	db "library/internal/pkg/dbutil"
+	"library/internal/pkg/lockutil"
 
 	"github.com/Kamva/mgm"
-	"github.com/Kamva/mgm/field"
 	"go.mongodb.org/mongo-driver/bson"
-	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
 // CreateTemplateBusiness godoc
-func CreateTemplateBusiness(requestData *m.TemplateRequest, mux map[string]*sync.Mutex) (int, interface{}) {
+func CreateTemplateBusiness(requestData *m.TemplateRequest, mux *lockutil.Locks) (int, interface{}) {
 	var err error
 	var response interface{}
 	var code int
@@ -24,10 +23,12 @@ func CreateTemplateBusiness(requestData *m.TemplateRequest, mux map[string]*sync
 	newTemplate := &m.Template{
 		Name:        requestData.Name,
 		Description: requestData.Description,
+		Version:     1,
+		Extends:     requestData.Extends,
 		Fields:      requestData.Fields,
 	}
 
-	mux["Templates"].Lock()
+	unlock := mux.Lock("Templates")
 
 out:
 	for i := 0; i < len(newTemplate.Fields); i++ {
@@ -48,6 +49,19 @@ out:
 		}
 	}
 
+	if err == nil {
+		var fields []m.Field
+
+		//Verifying that base templates exist, inherited fields aren't overridden with a different type and references target existing templates
+		if !db.VerifyObjectIDString(newTemplate.Extends) {
+			code, response, err = http.StatusBadRequest, m.InvalidID, fmt.Errorf("")
+		} else if fields, code, response, err = resolveTemplateFields(newTemplate); err == nil {
+			if response, err = validateTemplateReferences(fields); err != nil {
+				code = http.StatusBadRequest
+			}
+		}
+	}
+
 	if err == nil {
 		//Verifying that the template name is unique
 		if err = mgm.Coll(newTemplate).First(bson.M{"name": newTemplate.Name}, &m.Template{}); err == nil {
@@ -64,83 +78,177 @@ out:
 		}
 	}
 
-	mux["Templates"].Unlock()
+	unlock()
 
 	return code, response
 }
 
 // ShowAllTemplatesBusiness godoc
-func ShowAllTemplatesBusiness() (int, interface{}) {
+func ShowAllTemplatesBusiness(requestData *m.ListRequest) (int, interface{}) {
+	var err error
 	var code int
 	var response interface{}
-	var templatesFound []m.Template
+	var filter bson.M
+	templatesFound := []m.Template{}
+
+	if filter, err = listFilter(requestData, "name"); err != nil {
+		code, response = http.StatusBadRequest, m.ListRequestInvalid
+	} else {
+		code, response = listDocuments(&m.Template{}, &templatesFound, filter, requestData, []string{"name", "version"})
+	}
+
+	return code, response
+}
 
-	//Searching for templates
-	_ = mgm.Coll(&m.Template{}).SimpleFind(&templatesFound, bson.M{})
+// ShowTemplateBusiness godoc
+func ShowTemplateBusiness(id string) (int, interface{}) {
+	var code int
+	var response interface{}
+	template := &m.Template{}
 
-	//Verifying whether we found any templates
-	if len(templatesFound) == 0 {
+	//Looking up a template under passed id
+	if err := mgm.Coll(template).FindByID(id, template); err != nil {
 		code, response = http.StatusNotFound, m.TemplateNotFound
 	} else {
-		code, response = http.StatusOK, templatesFound
+		code, response = http.StatusOK, template
 	}
 
 	return code, response
 }
 
 // UpdateTemplateBusiness godoc
-func UpdateTemplateBusiness(id string, requestData *m.TemplateRequest, mux map[string]*sync.Mutex) (int, interface{}) {
-	var err error
+func UpdateTemplateBusiness(id string, requestData *m.TemplateRequest, ifMatch string, mux *lockutil.Locks) (int, interface{}) {
 	var response interface{}
 	var code int
 	template := &m.Template{}
 
-	mux["Templates"].Lock()
+	unlock := mux.Lock("Templates")
 
 	//Looking up a template under passed id
-	if err = mgm.Coll(template).FindByID(id, template); err != nil {
+	if err := mgm.Coll(template).FindByID(id, template); err != nil {
 		code, response = http.StatusNotFound, m.TemplateNotFound
+	} else if !etagMatches(ifMatch, template.Revision) {
+		code, response = http.StatusPreconditionFailed, m.PreconditionFailed
 	} else {
-		//Checking whether the updated template name matches its old name
-		if template.Name != requestData.Name {
-			//Names don't match, make sure the name isn't taken by another template
-			if err = mgm.Coll(template).First(bson.M{"name": requestData.Name}, &m.Template{}); err == nil {
-				//Name taken by another template
-				code, response = http.StatusConflict, m.TemplateExists
-				err = fmt.Errorf("") //Standin non-empty error to fail next logic check
-			} else {
-				err = nil
-			}
+		code, response = updateTemplate(template, requestData)
+	}
+
+	unlock()
+
+	return code, response
+}
+
+// PatchTemplateBusiness godoc
+func PatchTemplateBusiness(id string, patch m.MergePatch, ifMatch string, mux *lockutil.Locks) (int, interface{}) {
+	var response interface{}
+	var code int
+	template := &m.Template{}
+	requestData := &m.TemplateRequest{}
+
+	unlock := mux.Lock("Templates")
+
+	//Looking up a template under passed id
+	if err := mgm.Coll(template).FindByID(id, template); err != nil {
+		code, response = http.StatusNotFound, m.TemplateNotFound
+	} else if !etagMatches(ifMatch, template.Revision) {
+		code, response = http.StatusPreconditionFailed, m.PreconditionFailed
+	} else if err = applyMergePatch(template, patch, requestData, "name", "description", "extends", "fields"); err != nil {
+		code, response = http.StatusBadRequest, m.PatchInvalid
+	} else {
+		code, response = updateTemplate(template, requestData)
+	}
+
+	unlock()
+
+	return code, response
+}
+
+// updateTemplate replaces the contents of a template, bumping its version when the structure of the effective fields changes. Templates have to be locked by the caller
+// Args:	template, update request
+// Rets:	http code, updated template or error message
+func updateTemplate(template *m.Template, requestData *m.TemplateRequest) (int, interface{}) {
+	var err error
+	var response interface{}
+	var code int
+
+	//Checking whether the updated template name matches its old name
+	if template.Name != requestData.Name {
+		//Names don't match, make sure the name isn't taken by another template
+		if err = mgm.Coll(template).First(bson.M{"name": requestData.Name}, &m.Template{}); err == nil {
+			//Name taken by another template
+			code, response = http.StatusConflict, m.TemplateExists
+			err = fmt.Errorf("") //Standin non-empty error to fail next logic check
+		} else {
+			err = nil
 		}
+	}
 
-	out:
-		//Verifying that key names are unique
-		for i := 0; i < len(requestData.Fields); i++ {
-			for j := i + 1; j < len(requestData.Fields); j++ {
-				if requestData.Fields[i].Key == requestData.Fields[j].Key {
-					code, response = http.StatusBadRequest, m.TemplateValidateFailed
-					err = fmt.Errorf("")
-					break out
-				}
+out:
+	//Verifying that key names are unique
+	for i := 0; i < len(requestData.Fields); i++ {
+		for j := i + 1; j < len(requestData.Fields); j++ {
+			if requestData.Fields[i].Key == requestData.Fields[j].Key {
+				code, response = http.StatusBadRequest, m.TemplateValidateFailed
+				err = fmt.Errorf("")
+				break out
+			}
 
-				//Verifying that each field has a type
-				if requestData.Fields[i].Type == "" {
-					code, response = http.StatusBadRequest, m.TemplateValidateFailed
-					err = fmt.Errorf("")
-					break out
-				}
+			//Verifying that each field has a type
+			if requestData.Fields[i].Type == "" {
+				code, response = http.StatusBadRequest, m.TemplateValidateFailed
+				err = fmt.Errorf("")
+				break out
 			}
 		}
+	}
 
-		//No name conflicts detected, ready to update
-		if err == nil {
+	if err == nil && !db.VerifyObjectIDString(requestData.Extends) {
+		code, response, err = http.StatusBadRequest, m.InvalidID, fmt.Errorf("")
+	}
+
+	//No name conflicts detected, ready to update
+	if err == nil {
+		var oldFields, newFields []m.Field
+
+		//The structure of the effective fields can only be compared when the current ones resolve
+		if oldFields, code, response, err = resolveTemplateFields(template); err == nil {
 			//Assigning respective data to a copy of the template
 			template.Name = requestData.Name
 			template.Description = requestData.Description
+			template.Extends = requestData.Extends
 			template.Fields = requestData.Fields
 
-			//Updating the template in the database
-			if err = mgm.Coll(template).Update(template); err != nil {
+			//Verifying the new inheritance chain and references
+			if newFields, code, response, err = resolveTemplateFields(template); err == nil {
+				if response, err = validateTemplateReferences(newFields); err != nil {
+					code = http.StatusBadRequest
+				}
+			}
+		}
+
+		if err == nil {
+			//Resources have to be migrated whenever the structure of the effective fields changes, including resources of derived templates
+			changed := fieldsStructureChanged(oldFields, newFields)
+			if changed {
+				template.Version++
+			}
+
+			//Updating the template and the versions of derived templates in a single transaction
+			err = db.Transaction(func(ctx context.Context) error {
+				var err error
+
+				if changed {
+					err = bumpDerivedTemplates(ctx, template.ID.Hex(), map[string]bool{})
+				}
+
+				if err == nil {
+					err = mgm.Coll(template).UpdateWithCtx(ctx, template)
+				}
+
+				return err
+			})
+
+			if err != nil {
 				code, response = http.StatusInternalServerError, m.InternalError
 			} else {
 				code, response = http.StatusOK, template
@@ -148,35 +256,434 @@ func UpdateTemplateBusiness(id string, requestData *m.TemplateRequest, mux map[s
 		}
 	}
 
-	mux["Templates"].Unlock()
-
 	return code, response
 }
 
-// DeleteTemplateBusiness godoc
-func DeleteTemplateBusiness(id string, mux map[string]*sync.Mutex) (int, interface{}) {
+// MigrateTemplateBusiness godoc
+func MigrateTemplateBusiness(id string, requestData *m.TemplateMigrationRequest, mux *lockutil.Locks) (int, interface{}) {
 	var err error
 	var response interface{}
 	var code int
+	var migrations []templateMigration
+	template := &m.Template{}
+
+	unlock := mux.Lock("Resources", "Templates")
+
+	//Looking up a template under passed id
+	if err = mgm.Coll(template).FindByID(id, template); err != nil {
+		code, response = http.StatusNotFound, m.TemplateNotFound
+	} else if migrations, code, response, err = templateMigrations(template); err == nil {
+		report := &m.TemplateMigrationReport{
+			TemplateID: id,
+			Version:    template.Version,
+			Derived:    []string{},
+		}
+
+		for _, migration := range migrations[1:] {
+			report.Derived = append(report.Derived, migration.template.ID.Hex())
+		}
+
+		//Resources of the template and of the templates derived from it are migrated in a single transaction, all of them or none
+		err = db.Transaction(func(ctx context.Context) error {
+			var err error
 
-	//Generating Mongo ObjectID from passed id
-	oid, _ := primitive.ObjectIDFromHex(id)
+			//A run retried after a transient error starts over with an empty report
+			report.Migrated, report.CheckedOut, report.ManualValues = []string{}, []string{}, []m.ResourceManualValues{}
+
+			for i := 0; err == nil && i < len(migrations); i++ {
+				err = migrateResources(ctx, migrations[i].template, migrations[i].fields, migrations[i].resources, requestData, report)
+			}
 
-	mux["Templates"].Lock()
+			return err
+		})
 
-	//Attempting to find and delete a matching document
-	res, err := mgm.Coll(&m.Template{}).DeleteOne(context.Background(), bson.M{field.ID: oid})
-	if err != nil || res.DeletedCount == 0 {
 		if err != nil {
 			code, response = http.StatusInternalServerError, m.InternalError
 		} else {
-			code, response = http.StatusNotFound, m.TemplateNotFound
+			code, response = http.StatusOK, report
+		}
+	}
+
+	unlock()
+
+	return code, response
+}
+
+// templateMigration is a template whose resources are migrated, along with its effective fields and its resources built from older versions
+type templateMigration struct {
+	template  *m.Template
+	fields    []m.Field
+	resources []m.Resource
+}
+
+// templateMigrations lists the migrations of a template and of the templates derived from it, directly or through other derived templates, whose versions are bumped along with it. Resources are migrated to the effective fields of their own template, including inherited ones
+// Args:	template
+// Rets:	migrations, the one of the template first; error code, error response, error
+func templateMigrations(template *m.Template) ([]templateMigration, int, interface{}, error) {
+	var err error
+	var code int
+	var response interface{}
+	migrations := []templateMigration{{template: template}}
+	visited := map[string]bool{template.ID.Hex(): true}
+
+	for i := 0; err == nil && i < len(migrations); i++ {
+		migration := &migrations[i]
+		var derivedFound []m.Template
+
+		if migration.fields, code, response, err = resolveTemplateFields(migration.template); err != nil {
+			break
+		}
+
+		//Looking up resources which don't conform to the current template version, and the templates extending this one
+		if err = mgm.Coll(&m.Resource{}).SimpleFind(&migration.resources, bson.M{"templateid": migration.template.ID.Hex(), "templateversion": bson.M{"$ne": migration.template.Version}}); err == nil {
+			err = mgm.Coll(&m.Template{}).SimpleFind(&derivedFound, bson.M{"extends": migration.template.ID.Hex()})
+		}
+
+		if err != nil {
+			code, response = http.StatusInternalServerError, m.InternalError
+			break
+		}
+
+		for j := range derivedFound {
+			if !visited[derivedFound[j].ID.Hex()] {
+				visited[derivedFound[j].ID.Hex()] = true
+				migrations = append(migrations, templateMigration{template: &derivedFound[j]})
+			}
+		}
+	}
+
+	return migrations, code, response, err
+}
+
+// migrateResources migrates resources to the current version of their template, recording the outcome in the report
+// Args:	transaction context, template, effective fields of the template, resources to migrate, migration request, report
+// Rets:	error
+func migrateResources(ctx context.Context, template *m.Template, templateFields []m.Field, resourcesFound []m.Resource, requestData *m.TemplateMigrationRequest, report *m.TemplateMigrationReport) error {
+	var err error
+
+	for i := range resourcesFound {
+		resource := &resourcesFound[i]
+
+		//Starting over from the stored resource in case a previous run changed it
+		if err = db.Reload(ctx, resource); err != nil {
+			break
+		}
+
+		//Checked out resources are in use, their fields cannot change under the session
+		if resource.CheckedOut > 0 {
+			report.CheckedOut = append(report.CheckedOut, resource.ID.Hex())
+			continue
+		}
+
+		fields, missing := migrateResourceFields(templateFields, resource.Fields, requestData.Renames, requestData.Defaults)
+
+		resource.Fields = fields
+		resource.TemplateVersion = template.Version
+
+		//Keeping resources with missing required values out of rotation until an admin fills them in
+		if len(missing) > 0 {
+			resource.Active = false
+			report.ManualValues = append(report.ManualValues, m.ResourceManualValues{
+				ResourceID: resource.ID.Hex(),
+				Name:       resource.Name,
+				Keys:       missing,
+			})
+		}
+
+		if err = mgm.Coll(resource).UpdateWithCtx(ctx, resource); err != nil {
+			break
 		}
+
+		report.Migrated = append(report.Migrated, resource.ID.Hex())
+	}
+
+	return err
+}
+
+// DeleteTemplateBusiness godoc
+func DeleteTemplateBusiness(id string, requestData *m.TemplateDeleteRequest, ifMatch string, mux *lockutil.Locks) (int, interface{}) {
+	var err error
+	var response interface{}
+	var code int
+	var resourcesFound []m.Resource
+	var derivedFound []m.Template
+	var targetFields []m.Field
+	template := &m.Template{}
+	target := &m.Template{}
+
+	unlock := mux.Lock("Sessions", "Resources", "Templates", "Projects", "Pools", "Reservations")
+
+	//Looking up a template under passed id
+	if err = mgm.Coll(template).FindByID(id, template); err != nil {
+		code, response = http.StatusNotFound, m.TemplateNotFound
+	} else if !etagMatches(ifMatch, template.Revision) {
+		code, response = http.StatusPreconditionFailed, m.PreconditionFailed
+	} else if (requestData.Cascade != "" && requestData.Cascade != "delete" && requestData.Cascade != "reassign") || (requestData.Cascade == "reassign" && (requestData.Target == "" || requestData.Target == id)) {
+		code, response = http.StatusBadRequest, m.TemplateCascadeInvalid
+	} else if requestData.Cascade == "reassign" && mgm.Coll(target).FindByID(requestData.Target, target) != nil {
+		code, response = http.StatusNotFound, m.TemplateNotFound
 	} else {
-		code, response = http.StatusOK, m.TemplateDeleteSuccess
+		//Resources are reassigned to the effective fields of the target template
+		if requestData.Cascade == "reassign" {
+			targetFields, code, response, err = resolveTemplateFields(target)
+		}
+
+		report := &m.TemplateDeleteReport{
+			Resources:    []m.ResourceReference{},
+			Derived:      []string{},
+			Deleted:      []string{},
+			Reassigned:   []string{},
+			ManualValues: []m.ResourceManualValues{},
+		}
+
+		//Templates extending this one would lose their inherited fields and templates referencing it their reference target, cascades don't apply to them
+		_ = mgm.Coll(template).SimpleFind(&derivedFound, bson.M{"$or": []bson.M{{"extends": id}, {"fields.target": id}}})
+		for _, derived := range derivedFound {
+			report.Derived = append(report.Derived, derived.ID.Hex())
+		}
+
+		//Looking up resources built from the template, unless deletion is already blocked
+		if err == nil && len(report.Derived) == 0 {
+			_ = mgm.Coll(&m.Resource{}).SimpleFind(&resourcesFound, bson.M{"templateid": id})
+		}
+
+		//The cascade and the deletion of the template are applied in a single transaction
+		if err == nil {
+			err = db.Transaction(func(ctx context.Context) error {
+				//A run retried after a transient error starts over with an empty report
+				report.Resources, report.Deleted, report.Reassigned, report.ManualValues = []m.ResourceReference{}, []string{}, []string{}, []m.ResourceManualValues{}
+
+				return cascadeTemplateDelete(ctx, template, target, targetFields, resourcesFound, requestData.Cascade, report)
+			})
+
+			if err != nil {
+				code, response = http.StatusInternalServerError, m.InternalError
+			} else if len(report.Resources) > 0 || len(report.Derived) > 0 {
+				//Resources or templates still reference the template, deleting it would leave them orphaned
+				report.Message = m.TemplateInUse["message"].(string)
+				code, response = http.StatusConflict, report
+			} else {
+				report.Message = m.TemplateDeleteSuccess["message"].(string)
+				code, response = http.StatusOK, report
+			}
+		}
+	}
+
+	unlock()
+
+	return code, response
+}
+
+// cascadeTemplateDelete applies the cascade of a template deletion to the resources built from the template and deletes the template unless resources or templates still reference it, recording the outcome in the report
+// Args:	transaction context, template, reassignment target, effective fields of the target, resources built from the template, cascade, report
+// Rets:	error
+func cascadeTemplateDelete(ctx context.Context, template *m.Template, target *m.Template, targetFields []m.Field, resourcesFound []m.Resource, cascade string, report *m.TemplateDeleteReport) error {
+	var err error
+
+	for i := range resourcesFound {
+		resource := &resourcesFound[i]
+
+		//Starting over from the stored resource in case a previous run changed it
+		if err = db.Reload(ctx, resource); err != nil {
+			break
+		}
+
+		switch {
+		//Without a cascade, and for checked out resources, the reference stays in place and blocks deletion
+		case cascade == "" || resource.CheckedOut > 0:
+			report.Resources = append(report.Resources, m.ResourceReference{
+				ResourceID: resource.ID.Hex(),
+				Name:       resource.Name,
+			})
+
+		case cascade == "delete":
+			if err = deleteResource(ctx, resource); err == nil {
+				report.Deleted = append(report.Deleted, resource.ID.Hex())
+			}
+
+		default:
+			//Rebuilding resource fields in the structure of the target template
+			fields, missing := migrateResourceFields(targetFields, resource.Fields, nil, nil)
+
+			resource.TemplateID = target.ID.Hex()
+			resource.TemplateVersion = target.Version
+			resource.Fields = fields
+
+			//Keeping resources with missing required values out of rotation until an admin fills them in
+			if len(missing) > 0 {
+				resource.Active = false
+				report.ManualValues = append(report.ManualValues, m.ResourceManualValues{
+					ResourceID: resource.ID.Hex(),
+					Name:       resource.Name,
+					Keys:       missing,
+				})
+			}
+
+			if err = mgm.Coll(resource).UpdateWithCtx(ctx, resource); err == nil {
+				report.Reassigned = append(report.Reassigned, resource.ID.Hex())
+			}
+		}
+
+		if err != nil {
+			break
+		}
+	}
+
+	//Resources or templates still referencing the template keep it in place
+	if err == nil && len(report.Resources) == 0 && len(report.Derived) == 0 {
+		err = mgm.Coll(template).DeleteWithCtx(ctx, template)
 	}
 
-	mux["Templates"].Unlock()
+	return err
+}
+
+// ShowTemplateFieldsBusiness godoc
+func ShowTemplateFieldsBusiness(id string) (int, interface{}) {
+	var err error
+	var response interface{}
+	var code int
+	var fields []m.Field
+	template := &m.Template{}
+
+	//Looking up a template under passed id
+	if err = mgm.Coll(template).FindByID(id, template); err != nil {
+		code, response = http.StatusNotFound, m.TemplateNotFound
+	} else if fields, code, response, err = resolveTemplateFields(template); err == nil {
+		code, response = http.StatusOK, fields
+	}
 
 	return code, response
 }
+
+// resolveTemplateFields builds the effective field list of a template: fields inherited from base templates in order, followed by its own fields. A field with the key of an inherited field overrides the inherited required and checkout flags and, when set, value in place
+// Args:	template
+// Rets:	effective fields, error code, error response, error
+func resolveTemplateFields(template *m.Template) ([]m.Field, int, interface{}, error) {
+	return resolveInheritedFields(template, map[string]bool{}, findTemplate)
+}
+
+// resolveInheritedFields resolves template fields recursively, tracking the current inheritance path to detect cycles
+// Args:	template, ids of templates on the current inheritance path, base template lookup
+// Rets:	effective fields, error code, error response, error
+func resolveInheritedFields(template *m.Template, path map[string]bool, lookup templateLookup) ([]m.Field, int, interface{}, error) {
+	var err error
+	var code int
+	var response interface{}
+	var fields []m.Field
+	id := template.ID.Hex()
+
+	if path[id] {
+		code, response, err = http.StatusBadRequest, m.TemplateInheritanceCycle, fmt.Errorf("")
+	} else {
+		path[id] = true
+
+		for _, baseID := range template.Extends {
+			var baseFields []m.Field
+			var base *m.Template
+
+			if base, err = lookup(baseID); err != nil {
+				code, response = http.StatusNotFound, m.TemplateBaseNotFound
+			} else if baseFields, code, response, err = resolveInheritedFields(base, path, lookup); err == nil {
+				fields, err = overrideFields(fields, baseFields)
+			}
+
+			if err != nil {
+				break
+			}
+		}
+
+		if err == nil {
+			fields, err = overrideFields(fields, template.Fields)
+		}
+
+		//Mismatched types are the only error left unassigned by this point
+		if err != nil && response == nil {
+			code, response = http.StatusBadRequest, m.TemplateOverrideMismatch
+		}
+
+		//Diamond-shaped inheritance is allowed, only the current path is checked for cycles
+		delete(path, id)
+	}
+
+	return fields, code, response, err
+}
+
+// templateLookup finds a template by id
+type templateLookup func(id string) (*m.Template, error)
+
+// findTemplate looks up a template in the database
+func findTemplate(id string) (*m.Template, error) {
+	template := &m.Template{}
+	err := mgm.Coll(template).FindByID(id, template)
+
+	return template, err
+}
+
+// overrideFields appends fields to a field list, overriding fields with matching keys in place
+// Args:	field list, overriding fields
+// Rets:	combined field list, error
+func overrideFields(fields []m.Field, overrides []m.Field) ([]m.Field, error) {
+	var err error
+	combined := append([]m.Field{}, fields...)
+
+	for _, o := range overrides {
+		found := false
+
+		for i := range combined {
+			if combined[i].Key == o.Key {
+				found = true
+
+				if combined[i].Type != o.Type || combined[i].Target != o.Target {
+					err = fmt.Errorf("error: field %s overridden with a different type or reference target", o.Key)
+				} else {
+					combined[i].Required = o.Required
+					combined[i].Checkout = o.Checkout
+
+					if o.Value != nil {
+						combined[i].Value = o.Value
+					}
+				}
+				break
+			}
+		}
+
+		if err != nil {
+			break
+		}
+
+		if !found {
+			combined = append(combined, o)
+		}
+	}
+
+	return combined, err
+}
+
+// bumpDerivedTemplates increments the version of every template extending the given template, directly or transitively. Caller is responsible for locking Templates
+// Args:	transaction context, template id, ids of templates already bumped
+// Rets:	error
+func bumpDerivedTemplates(ctx context.Context, id string, bumped map[string]bool) error {
+	var err error
+	var derivedFound []m.Template
+
+	_ = mgm.Coll(&m.Template{}).SimpleFindWithCtx(ctx, &derivedFound, bson.M{"extends": id})
+
+	for i := range derivedFound {
+		derived := &derivedFound[i]
+
+		if !bumped[derived.ID.Hex()] {
+			bumped[derived.ID.Hex()] = true
+			derived.Version++
+
+			if err = mgm.Coll(derived).UpdateWithCtx(ctx, derived); err == nil {
+				err = bumpDerivedTemplates(ctx, derived.ID.Hex(), bumped)
+			}
+
+			if err != nil {
+				break
+			}
+		}
+	}
+
+	return err
+}
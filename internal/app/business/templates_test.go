@@ -0,0 +1,257 @@
+package business
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	m "library/internal/app/models"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//fakeTemplates is a template lookup over templates held in memory, keyed by name in the tests
+type fakeTemplates map[string]*m.Template
+
+//add stores a template under a name, extending the templates of the given names
+func (templates fakeTemplates) add(name string, extends []string, fields ...m.Field) *m.Template {
+	template := &m.Template{Name: name, Fields: fields, Extends: []string{}}
+	template.ID = primitive.NewObjectID()
+
+	for _, base := range extends {
+		template.Extends = append(template.Extends, templates.id(base))
+	}
+
+	templates[name] = template
+
+	return template
+}
+
+//id returns the id of a template by name, or a fresh id for templates which don't exist
+func (templates fakeTemplates) id(name string) string {
+	id := primitive.NewObjectID().Hex()
+
+	if template, ok := templates[name]; ok {
+		id = template.ID.Hex()
+	}
+
+	return id
+}
+
+func (templates fakeTemplates) lookup(id string) (*m.Template, error) {
+	for _, template := range templates {
+		if template.ID.Hex() == id {
+			return template, nil
+		}
+	}
+
+	return nil, fmt.Errorf("template %s not found", id)
+}
+
+func TestResolveInheritedFields(t *testing.T) {
+	sims := m.Field{Type: "subresource", Key: "sims", Value: int32(3)}
+	os := m.Field{Type: "string", Key: "os", Value: "android"}
+
+	tests := []struct {
+		name     string
+		build    func(templates fakeTemplates) *m.Template
+		fields   []m.Field
+		code     int
+		response interface{}
+	}{
+		{
+			name: "own fields after inherited ones",
+			build: func(templates fakeTemplates) *m.Template {
+				templates.add("phone", nil, sims)
+				return templates.add("android", []string{"phone"}, os)
+			},
+			fields: []m.Field{sims, os},
+		},
+		{
+			name: "diamond inherits the shared base once",
+			build: func(templates fakeTemplates) *m.Template {
+				templates.add("device", nil, sims)
+				templates.add("phone", []string{"device"})
+				templates.add("tablet", []string{"device"}, os)
+				return templates.add("phablet", []string{"phone", "tablet"})
+			},
+			fields: []m.Field{sims, os},
+		},
+		{
+			name: "override of the required flag and value",
+			build: func(templates fakeTemplates) *m.Template {
+				templates.add("phone", nil, sims)
+				return templates.add("dual sim", []string{"phone"}, m.Field{Type: "subresource", Key: "sims", Required: true, Value: int32(2)})
+			},
+			fields: []m.Field{{Type: "subresource", Key: "sims", Required: true, Value: int32(2)}},
+		},
+		{
+			name: "override without a value keeps the inherited one",
+			build: func(templates fakeTemplates) *m.Template {
+				templates.add("phone", nil, sims)
+				return templates.add("dual sim", []string{"phone"}, m.Field{Type: "subresource", Key: "sims", Required: true})
+			},
+			fields: []m.Field{{Type: "subresource", Key: "sims", Required: true, Value: int32(3)}},
+		},
+		{
+			name: "override of the type",
+			build: func(templates fakeTemplates) *m.Template {
+				templates.add("phone", nil, sims)
+				return templates.add("broken", []string{"phone"}, m.Field{Type: "string", Key: "sims"})
+			},
+			code:     http.StatusBadRequest,
+			response: m.TemplateOverrideMismatch,
+		},
+		{
+			name: "override of the reference target",
+			build: func(templates fakeTemplates) *m.Template {
+				templates.add("phone", nil, m.Field{Type: "reference", Key: "hub", Target: "5f19a22e5b40abf84d198e53"})
+				return templates.add("broken", []string{"phone"}, m.Field{Type: "reference", Key: "hub", Target: "5f19a22e5b40abf84d198e54"})
+			},
+			code:     http.StatusBadRequest,
+			response: m.TemplateOverrideMismatch,
+		},
+		{
+			name: "cycle",
+			build: func(templates fakeTemplates) *m.Template {
+				phone := templates.add("phone", nil, sims)
+				templates.add("android", []string{"phone"}, os)
+				phone.Extends = []string{templates.id("android")}
+				return templates["android"]
+			},
+			code:     http.StatusBadRequest,
+			response: m.TemplateInheritanceCycle,
+		},
+		{
+			name: "template extending itself",
+			build: func(templates fakeTemplates) *m.Template {
+				phone := templates.add("phone", nil, sims)
+				phone.Extends = []string{phone.ID.Hex()}
+				return phone
+			},
+			code:     http.StatusBadRequest,
+			response: m.TemplateInheritanceCycle,
+		},
+		{
+			name: "missing base template",
+			build: func(templates fakeTemplates) *m.Template {
+				return templates.add("android", []string{"deleted"}, os)
+			},
+			code:     http.StatusNotFound,
+			response: m.TemplateBaseNotFound,
+		},
+	}
+
+	for _, test := range tests {
+		templates := fakeTemplates{}
+		template := test.build(templates)
+
+		fields, code, response, err := resolveInheritedFields(template, map[string]bool{}, templates.lookup)
+
+		if test.code == 0 {
+			if err != nil || !reflect.DeepEqual(fields, test.fields) {
+				t.Errorf("%s: fields = %+v, err %v; want %+v", test.name, fields, err, test.fields)
+			}
+		} else if err == nil || code != test.code || !reflect.DeepEqual(response, test.response) {
+			t.Errorf("%s: code %d, response %v, err %v; want %d, %v", test.name, code, response, err, test.code, test.response)
+		}
+	}
+}
+
+func TestTemplateExtends(t *testing.T) {
+	templates := fakeTemplates{}
+	templates.add("device", nil)
+	templates.add("phone", []string{"device"})
+	templates.add("camera", nil)
+	templates.add("phablet", []string{"camera", "phone"})
+	templates.add("other", nil)
+
+	//A cycle between templates unrelated to the target ends the search
+	loop := templates.add("loop", nil)
+	templates.add("loop back", []string{"loop"})
+	loop.Extends = []string{templates.id("loop back")}
+
+	tests := []struct {
+		template string
+		target   string
+		extends  bool
+	}{
+		{"device", "device", true},
+		{"phone", "device", true},
+		{"phablet", "device", true},
+		{"phablet", "camera", true},
+		{"device", "phone", false},
+		{"other", "device", false},
+		{"loop", "device", false},
+	}
+
+	for _, test := range tests {
+		if extends := templateExtends(templates.id(test.template), templates.id(test.target), map[string]bool{}, templates.lookup); extends != test.extends {
+			t.Errorf("templateExtends(%s, %s) = %v, want %v", test.template, test.target, extends, test.extends)
+		}
+	}
+}
+
+func TestOverrideFields(t *testing.T) {
+	fields := []m.Field{
+		{Type: "subresource", Key: "sims", Value: int32(3)},
+		{Type: "string", Key: "os", Value: "android", Checkout: true},
+	}
+
+	tests := []struct {
+		name      string
+		overrides []m.Field
+		want      []m.Field
+		wantErr   bool
+	}{
+		{
+			name:      "no overrides",
+			overrides: []m.Field{},
+			want:      fields,
+		},
+		{
+			name:      "required and value",
+			overrides: []m.Field{{Type: "subresource", Key: "sims", Required: true, Value: int32(1)}},
+			want: []m.Field{
+				{Type: "subresource", Key: "sims", Required: true, Value: int32(1)},
+				{Type: "string", Key: "os", Value: "android", Checkout: true},
+			},
+		},
+		{
+			name:      "checkout without a value",
+			overrides: []m.Field{{Type: "string", Key: "os"}},
+			want: []m.Field{
+				{Type: "subresource", Key: "sims", Value: int32(3)},
+				{Type: "string", Key: "os", Value: "android"},
+			},
+		},
+		{
+			name:      "new key appended",
+			overrides: []m.Field{{Type: "string", Key: "vendor", Value: "acme"}},
+			want: []m.Field{
+				{Type: "subresource", Key: "sims", Value: int32(3)},
+				{Type: "string", Key: "os", Value: "android", Checkout: true},
+				{Type: "string", Key: "vendor", Value: "acme"},
+			},
+		},
+		{
+			name:      "type mismatch",
+			overrides: []m.Field{{Type: "string", Key: "sims"}},
+			wantErr:   true,
+		},
+	}
+
+	for _, test := range tests {
+		base := make([]m.Field, len(fields))
+		copy(base, fields)
+
+		got, err := overrideFields(base, test.overrides)
+
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s: err = %v, wantErr %v", test.name, err, test.wantErr)
+		} else if !test.wantErr && !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%s: got = %+v, want %+v", test.name, got, test.want)
+		}
+	}
+}
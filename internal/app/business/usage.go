@@ -0,0 +1,378 @@
+package business
+
+import (
+	"bytes"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	m "library/internal/app/models"
+	db "library/internal/pkg/dbutil"
+
+	"github.com/Kamva/mgm"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+//Range of a usage report when no start is requested
+const defaultUsageRange = 30 * 24 * time.Hour
+
+//Columns of usage reports exported as CSV; projects holds name=seconds pairs separated by semicolons
+var usageCSVColumns = []string{"id", "name", "resources", "checkouts", "held", "utilization", "peak", "averagehold", "averagewait", "projects"}
+
+// ShowAllUsageBusiness godoc
+func ShowAllUsageBusiness(requestData *m.ListRequest) (int, interface{}) {
+	var err error
+	var code int
+	var response interface{}
+	var filter bson.M
+	usageFound := []m.Usage{}
+
+	if filter, err = listFilter(requestData, "template", "project"); err != nil {
+		code, response = http.StatusBadRequest, m.ListRequestInvalid
+	} else {
+		code, response = listDocuments(&m.Usage{}, &usageFound, filter, requestData, []string{"checkedout", "checkedin", "resourceid", "project"})
+	}
+
+	return code, response
+}
+
+// UsageReportBusiness godoc
+// Reports are returned as models.UsageReport, or as CSV bytes when requested
+func UsageReportBusiness(requestData *m.UsageRequest) (int, interface{}) {
+	var err error
+	var code int
+	var response interface{}
+	now := time.Now().UTC()
+	report := &m.UsageReport{To: now, Group: requestData.Group, Rows: []m.UsageRow{}}
+	filter := bson.M{}
+	resourcesFound := []m.Resource{}
+	usageFound := []m.Usage{}
+
+	if requestData.To != "" {
+		report.To, err = time.Parse(time.RFC3339, requestData.To)
+	}
+
+	report.From = report.To.Add(-defaultUsageRange)
+	if err == nil && requestData.From != "" {
+		report.From, err = time.Parse(time.RFC3339, requestData.From)
+	}
+
+	if report.Group == "" {
+		report.Group = "resource"
+	}
+
+	if requestData.Top == 0 {
+		requestData.Top = 5
+	}
+
+	if err == nil && requestData.Resource != "" {
+		var id primitive.ObjectID
+
+		if id, err = primitive.ObjectIDFromHex(requestData.Resource); err == nil {
+			filter["_id"] = id
+		}
+	}
+
+	if requestData.Template != "" {
+		filter["templateid"] = requestData.Template
+	}
+
+	if requestData.Project != "" {
+		filter["projects"] = requestData.Project
+	}
+
+	//Templates and projects are referred to by the hex string of their ObjectID
+	for _, id := range []string{requestData.Template, requestData.Project} {
+		if id != "" && !db.VerifyObjectIDString(id) {
+			err = fmt.Errorf("error: invalid id %s", id)
+		}
+	}
+
+	if err != nil || !report.To.After(report.From) || report.To.Sub(report.From) > maxCalendarRange ||
+		(report.Group != "resource" && report.Group != "template") || requestData.Top < 1 || requestData.Top > 100 ||
+		(requestData.Format != "" && requestData.Format != "json" && requestData.Format != "csv") {
+		code, response = http.StatusBadRequest, m.UsageRequestInvalid
+	} else if err = mgm.Coll(&m.Resource{}).SimpleFind(&resourcesFound, filter); err != nil {
+		code, response = http.StatusInternalServerError, m.InternalError
+	} else {
+		ids := []string{}
+
+		for _, r := range resourcesFound {
+			ids = append(ids, r.ID.Hex())
+		}
+
+		//Intervals overlapping the range, including those still held
+		if err = mgm.Coll(&m.Usage{}).SimpleFind(&usageFound, bson.M{
+			"resourceid": bson.M{"$in": ids},
+			"checkedout": bson.M{"$lt": report.To},
+			"$or":        []bson.M{{"checkedin": nil}, {"checkedin": bson.M{"$gt": report.From}}},
+		}); err != nil {
+			code, response = http.StatusInternalServerError, m.InternalError
+		} else if report.Rows = usageRows(report, resourcesFound, usageFound, requestData.Top, now); requestData.Format == "csv" {
+			if response, err = encodeUsageCSV(report.Rows); err != nil {
+				code, response = http.StatusInternalServerError, m.InternalError
+			} else {
+				code = http.StatusOK
+			}
+		} else {
+			code, response = http.StatusOK, report
+		}
+	}
+
+	return code, response
+}
+
+// usageRows aggregates checkout intervals into report rows, one per resource or template. Intervals are clipped to the range of the report for the time held; hold times cover whole intervals
+// Args:	report with range and grouping, resources, intervals, number of top projects, current time
+// Rets:	rows by utilization
+func usageRows(report *m.UsageReport, resources []m.Resource, usage []m.Usage, top int, now time.Time) []m.UsageRow {
+	rows := []m.UsageRow{}
+	index := map[string]int{}
+	groups := map[string]string{}
+	intervals := map[string][][2]time.Time{}
+	projects := map[string]map[string]*m.UsageProject{}
+	holds := map[string]float64{}
+	waits := map[string][]float64{}
+	names := map[string]string{}
+
+	for _, r := range resources {
+		key, name := r.ID.Hex(), r.Name
+
+		if report.Group == "template" {
+			key = r.TemplateID
+		}
+
+		if _, ok := index[key]; !ok {
+			if report.Group == "template" {
+				template := &m.Template{}
+
+				if name = ""; mgm.Coll(template).FindByID(key, template) == nil {
+					name = template.Name
+				}
+			}
+
+			index[key] = len(rows)
+			rows = append(rows, m.UsageRow{ID: key, Name: name, Projects: []m.UsageProject{}})
+			projects[key] = map[string]*m.UsageProject{}
+		}
+
+		rows[index[key]].Resources++
+		groups[r.ID.Hex()] = key
+	}
+
+	for _, u := range usage {
+		key := groups[u.ResourceID]
+		row := &rows[index[key]]
+		end := now
+
+		if u.CheckedIn != nil {
+			end = *u.CheckedIn
+		}
+
+		start, stop := u.CheckedOut, end
+		if start.Before(report.From) {
+			start = report.From
+		}
+		if stop.After(report.To) {
+			stop = report.To
+		}
+
+		held := stop.Sub(start).Seconds()
+		if held < 0 {
+			held = 0
+		}
+
+		row.Checkouts++
+		row.Held += held
+		holds[key] += end.Sub(u.CheckedOut).Seconds()
+		intervals[key] = append(intervals[key], [2]time.Time{start, stop})
+
+		//Waits count toward the range the checkout falls in
+		if u.Waited && !u.CheckedOut.Before(report.From) && u.CheckedOut.Before(report.To) {
+			waits[key] = append(waits[key], u.Wait)
+		}
+
+		if projects[key][u.Project] == nil {
+			projects[key][u.Project] = &m.UsageProject{Project: u.Project}
+		}
+		projects[key][u.Project].Checkouts++
+		projects[key][u.Project].Held += held
+	}
+
+	for i := range rows {
+		row := &rows[i]
+		span := report.To.Sub(report.From).Seconds() * float64(row.Resources)
+
+		if span > 0 {
+			row.Utilization = 100 * row.Held / span
+		}
+
+		if row.Checkouts > 0 {
+			row.AverageHold = holds[row.ID] / float64(row.Checkouts)
+		}
+
+		for _, w := range waits[row.ID] {
+			row.AverageWait += w / float64(len(waits[row.ID]))
+		}
+
+		row.Peak = peakConcurrency(intervals[row.ID])
+
+		for _, p := range projects[row.ID] {
+			if _, ok := names[p.Project]; !ok {
+				project := &m.Project{}
+
+				if mgm.Coll(project).FindByID(p.Project, project) == nil {
+					names[p.Project] = project.Name
+				} else {
+					names[p.Project] = ""
+				}
+			}
+
+			p.Name = names[p.Project]
+			row.Projects = append(row.Projects, *p)
+		}
+
+		sort.Slice(row.Projects, func(a, b int) bool {
+			if row.Projects[a].Held != row.Projects[b].Held {
+				return row.Projects[a].Held > row.Projects[b].Held
+			}
+			return row.Projects[a].Project < row.Projects[b].Project
+		})
+
+		if len(row.Projects) > top {
+			row.Projects = row.Projects[:top]
+		}
+	}
+
+	sort.SliceStable(rows, func(a, b int) bool {
+		if rows[a].Utilization != rows[b].Utilization {
+			return rows[a].Utilization > rows[b].Utilization
+		}
+		return rows[a].Name < rows[b].Name
+	})
+
+	return rows
+}
+
+// peakConcurrency returns the most intervals overlapping at any time. An interval ending when another starts doesn't overlap it
+// Args:	intervals as start and end
+// Rets:	peak
+func peakConcurrency(intervals [][2]time.Time) int {
+	var peak, current int
+	type event struct {
+		time  time.Time
+		delta int
+	}
+	events := []event{}
+
+	for _, i := range intervals {
+		if i[1].After(i[0]) {
+			events = append(events, event{i[0], 1}, event{i[1], -1})
+		}
+	}
+
+	//Ends sort before starts at the same time
+	sort.Slice(events, func(a, b int) bool {
+		if !events[a].time.Equal(events[b].time) {
+			return events[a].time.Before(events[b].time)
+		}
+		return events[a].delta < events[b].delta
+	})
+
+	for _, e := range events {
+		current += e.delta
+		if current > peak {
+			peak = current
+		}
+	}
+
+	return peak
+}
+
+// encodeUsageCSV encodes the rows of a usage report as CSV, one row per resource or template
+// Args:	rows
+// Rets:	encoded rows, error
+func encodeUsageCSV(rows []m.UsageRow) ([]byte, error) {
+	var buffer bytes.Buffer
+	writer := csv.NewWriter(&buffer)
+	decimal := func(v float64) string { return strconv.FormatFloat(v, 'f', 2, 64) }
+
+	writer.Write(usageCSVColumns)
+
+	for _, r := range rows {
+		projects := []string{}
+
+		for _, p := range r.Projects {
+			name := p.Name
+			if name == "" {
+				name = p.Project
+			}
+			projects = append(projects, name+"="+decimal(p.Held))
+		}
+
+		writer.Write([]string{
+			r.ID,
+			r.Name,
+			strconv.Itoa(r.Resources),
+			strconv.Itoa(r.Checkouts),
+			decimal(r.Held),
+			decimal(r.Utilization),
+			strconv.Itoa(r.Peak),
+			decimal(r.AverageHold),
+			decimal(r.AverageWait),
+			strings.Join(projects, ";"),
+		})
+	}
+
+	writer.Flush()
+
+	return buffer.Bytes(), writer.Error()
+}
+
+// recordCheckout opens the checkout interval of a resource held by a session. The first checkout of a template by the session records how long the session waited since it started. Caller is responsible for locking the session and the resource
+// Args:	transaction context, session, resource
+// Rets:	error
+func recordCheckout(ctx context.Context, session *m.Session, resource *m.Resource) error {
+	var err error
+	var previous int64
+	now := time.Now().UTC()
+	usage := &m.Usage{
+		ResourceID: resource.ID.Hex(),
+		TemplateID: resource.TemplateID,
+		Project:    session.Project,
+		Session:    session.ID.Hex(),
+		CheckedOut: now,
+	}
+
+	if previous, err = mgm.Coll(usage).CountDocuments(ctx, bson.M{"session": usage.Session, "templateid": usage.TemplateID}); err == nil {
+		if previous == 0 {
+			usage.Waited = true
+			usage.Wait = now.Sub(session.CreatedAt).Seconds()
+		}
+
+		err = mgm.Coll(usage).CreateWithCtx(ctx, usage)
+	}
+
+	return err
+}
+
+// recordCheckin closes the open checkout intervals of a session, of a single resource or of every resource when the id is empty
+// Args:	transaction context, session id, resource id or empty string
+// Rets:	error
+func recordCheckin(ctx context.Context, sessID string, resID string) error {
+	filter := bson.M{"session": sessID, "checkedin": nil}
+
+	if resID != "" {
+		filter["resourceid"] = resID
+	}
+
+	_, err := mgm.Coll(&m.Usage{}).UpdateMany(ctx, filter, bson.M{"$set": bson.M{"checkedin": time.Now().UTC()}})
+
+	return err
+}
@@ -0,0 +1,63 @@
+package business
+
+import (
+	"sync"
+	"time"
+
+	"library/internal/pkg/leaseutil"
+	"library/internal/pkg/lockutil"
+)
+
+//Lease of the worker running expiry and maintenance jobs, held by a single replica at a time and taken over by another one when its holder stops renewing it
+const workerLease = "worker"
+const workerLeaseTime = 10 * time.Second
+
+//Time after which a session which ran out is deemed to have run out while no worker was running
+const expiryGrace = time.Minute
+
+//Interval of the maintenance jobs, and the time they last ran on this replica
+const maintenanceInterval = time.Minute
+
+var maintenance struct {
+	guard sync.Mutex
+	last  time.Time
+}
+
+// RunWorkerBusiness runs the expiry and maintenance jobs of the library on the replica holding the worker lease: sessions are expired and reservations started on every run, so reserving projects get their resources as their windows start, and unused locks are pruned when they haven't been on this replica for a minute, so that a replica taking the lease over prunes them right away. Meant to be executed every second by every replica
+// Args:	replica id, default session extension time in hours, locks
+// Rets:	error
+func RunWorkerBusiness(replica string, sessExt int, mux *lockutil.Locks) error {
+	var err error
+
+	if leaseutil.Hold(workerLease, replica, workerLeaseTime) {
+		err = ExpireSessionsBusiness(sessExt, mux)
+
+		if reservationErr := StartReservationsBusiness(mux); reservationErr != nil {
+			err = reservationErr
+		}
+
+		if maintenanceDue(time.Now()) {
+			if pruneErr := leaseutil.PruneLocks(); pruneErr != nil {
+				err = pruneErr
+			}
+		}
+	}
+
+	return err
+}
+
+// maintenanceDue reports whether the maintenance jobs have to run, recording the run when they do. Runs are timed rather than bound to a second of the minute, so slow or skipped runs don't skip them
+// Args:	current time
+// Rets:	whether the jobs have to run
+func maintenanceDue(now time.Time) bool {
+	maintenance.guard.Lock()
+
+	due := now.Sub(maintenance.last) >= maintenanceInterval
+	if due {
+		maintenance.last = now
+	}
+
+	maintenance.guard.Unlock()
+
+	return due
+}
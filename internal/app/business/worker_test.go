@@ -0,0 +1,29 @@
+package business
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMaintenanceDue(t *testing.T) {
+	start := time.Date(2020, 7, 28, 9, 0, 30, 0, time.UTC)
+	maintenance.last = time.Time{}
+
+	//A replica taking the lease over mid-minute runs the jobs right away
+	if !maintenanceDue(start) {
+		t.Error("first run not due")
+	}
+
+	if maintenanceDue(start.Add(59 * time.Second)) {
+		t.Error("run due before a minute passed")
+	}
+
+	//Runs skipped past the start of a minute don't skip the jobs
+	if !maintenanceDue(start.Add(61 * time.Second)) {
+		t.Error("run not due after a minute passed")
+	}
+
+	if maintenanceDue(start.Add(62 * time.Second)) {
+		t.Error("run due twice within a minute")
+	}
+}
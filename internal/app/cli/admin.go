@@ -0,0 +1,188 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+//Keyed lists which -set patches by element key, e.g. fields.os=android
+var keyedLists = map[string]string{"fields": "value", "settings": "value"}
+
+//assignments collects repeated key=value flags
+type assignments []string
+
+//String returns the assignments as passed
+func (a *assignments) String() string {
+	return strings.Join(*a, ",")
+}
+
+//Set adds an assignment
+func (a *assignments) Set(value string) error {
+	var err error
+
+	if !strings.Contains(value, "=") {
+		err = fmt.Errorf("%s is not key=value", value)
+	} else {
+		*a = append(*a, value)
+	}
+
+	return err
+}
+
+//mergePatch builds a JSON merge patch from assignments. Values which parse as JSON are sent as such and anything else as a string; fields.KEY and settings.KEY patch the value of the list element with that key
+func (a *assignments) mergePatch() map[string]interface{} {
+	patch := map[string]interface{}{}
+
+	for _, assignment := range *a {
+		var value interface{}
+		pair := strings.SplitN(assignment, "=", 2)
+
+		if json.Unmarshal([]byte(pair[1]), &value) != nil {
+			value = pair[1]
+		}
+
+		path := strings.SplitN(pair[0], ".", 2)
+		if property, ok := keyedLists[path[0]]; ok && len(path) == 2 {
+			list, _ := patch[path[0]].(map[string]interface{})
+			if list == nil {
+				list = map[string]interface{}{}
+				patch[path[0]] = list
+			}
+
+			list[path[1]] = map[string]interface{}{property: value}
+		} else {
+			patch[pair[0]] = value
+		}
+	}
+
+	return patch
+}
+
+//labelPatch builds a merge patch of labels from KEY=VALUE terms, which set a label, and KEY- terms, which remove one
+func labelPatch(terms []string) (map[string]interface{}, error) {
+	var err error
+	patch := map[string]interface{}{}
+
+	for _, term := range terms {
+		if pair := strings.SplitN(term, "=", 2); len(pair) == 2 {
+			patch[pair[0]] = pair[1]
+		} else if strings.HasSuffix(term, "-") {
+			patch[strings.TrimSuffix(term, "-")] = nil
+		} else {
+			err = fmt.Errorf("label change %s is neither KEY=VALUE nor KEY-", term)
+		}
+	}
+
+	return patch, err
+}
+
+//admin runs the list, get, create, update, patch and delete subcommands of a collection
+//Args:	collection, arguments, standard output
+//Rets:	error
+func admin(coll collection, args []string, stdout io.Writer) error {
+	var err error
+	var data []byte
+	var docs []json.RawMessage
+	var body interface{}
+	var ids []string
+	flags := flag.NewFlagSet(coll.name, flag.ContinueOnError)
+	opts := addOptions(flags)
+	file := flags.String("f", "", "JSON request body file, - for the standard input")
+	note := flags.String("note", "", "quarantine reason or annotation")
+	set := &assignments{}
+	filters := map[string]*string{}
+	query := url.Values{}
+	usage := fmt.Errorf("usage: library %s list [filters] | get ID | create -f FILE | update ID -f FILE | patch ID -f FILE|-set KEY=VALUE... | delete ID | quarantine|annotate|restore ID -note NOTE | label ID KEY=VALUE|KEY-...", coll.name)
+	action := ""
+
+	flags.Var(set, "set", "patch KEY=VALUE, or fields.KEY=VALUE and settings.KEY=VALUE; repeatable")
+	for _, name := range []string{"name", "template", "project", "active", "checkedout", "field", "health", "labels", "sort", "cascade", "target"} {
+		filters[name] = flags.String(name, "", name+" list filter, or delete option of templates")
+	}
+
+	if len(args) > 0 {
+		action = args[0]
+		ids, err = parseArgs(flags, args[1:])
+	}
+
+	//Every action but list and create takes the document id, label takes label changes after it
+	if err == nil {
+		if action == "" || (action == "list" || action == "create") != (len(ids) == 0) || (len(ids) > 1) != (action == "label") {
+			err = usage
+		}
+	}
+
+	endpoint := server(*opts.server) + coll.path
+	if len(ids) > 0 {
+		endpoint += "/" + ids[0]
+	}
+
+	for name, value := range filters {
+		if *value != "" {
+			query.Set(name, *value)
+		}
+	}
+
+	if err == nil {
+		switch action {
+		case "list":
+			docs, err = listAll(endpoint, query)
+		case "get":
+			data, err = call(http.MethodGet, endpoint, "", nil)
+		case "create", "update":
+			method := map[string]string{"create": http.MethodPost, "update": http.MethodPut}[action]
+
+			if body, err = readBody(*file); err == nil {
+				data, err = call(method, endpoint, "", body)
+			}
+		case "patch":
+			if len(*set) > 0 {
+				body = set.mergePatch()
+			} else {
+				body, err = readBody(*file)
+			}
+
+			if err == nil {
+				data, err = call(http.MethodPatch, endpoint, "", body)
+			}
+		case "quarantine", "annotate", "restore":
+			if coll.name != "resource" {
+				err = usage
+			} else {
+				data, err = call(http.MethodPost, endpoint+"/"+action, "", map[string]string{"note": *note})
+			}
+		case "label":
+			if coll.name != "resource" {
+				err = usage
+			} else if body, err = labelPatch(ids[1:]); err == nil {
+				data, err = call(http.MethodPatch, endpoint+"/labels", "", body)
+			}
+		case "delete":
+			if len(query) > 0 {
+				endpoint += "?" + query.Encode()
+			}
+			data, err = call(http.MethodDelete, endpoint, "", nil)
+		default:
+			err = usage
+		}
+	}
+
+	if err == nil {
+		if action == "list" {
+			err = printDocuments(coll, docs, *opts.json, stdout)
+		} else if action == "delete" {
+			err = printMessage(data, stdout)
+		} else if *opts.json {
+			err = printJSON(data, stdout)
+		} else {
+			err = printDocument(coll, data, stdout)
+		}
+	}
+
+	return err
+}
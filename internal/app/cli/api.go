@@ -0,0 +1,216 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+
+	m "library/internal/app/models"
+)
+
+//Page size used to fetch whole lists
+const listPageSize = 1000
+
+//options are the flags shared by the session and admin commands
+type options struct {
+	server  *string
+	session *string
+	json    *bool
+}
+
+//apiError is returned for responses outside the 2xx range
+type apiError struct {
+	StatusCode int
+	Status     string
+	Body       []byte
+}
+
+//Error prints the status followed by the message of the library, or the raw body when it carries none
+func (e *apiError) Error() string {
+	msg := m.Msg{}
+	text := string(bytes.TrimSpace(e.Body))
+
+	if json.Unmarshal(e.Body, &msg) == nil {
+		if message, ok := msg["message"].(string); ok && len(msg) == 1 {
+			text = message
+		}
+	}
+
+	return fmt.Sprintf("%s: %s", e.Status, text)
+}
+
+//addOptions registers the shared flags on a command
+func addOptions(flags *flag.FlagSet) *options {
+	return &options{
+		server:  flags.String("server", "", "library URL; defaults to LIBRARY_URL or "+defaultServer),
+		session: flags.String("session", "", "session file; defaults to LIBRARY_SESSION or ~/.library/session.json"),
+		json:    flags.Bool("json", false, "print JSON instead of tables"),
+	}
+}
+
+//parseArgs parses flags placed anywhere among the positional arguments, so that e.g. library resource get ID -json works like library resource get -json ID
+//Args:	flag set, arguments
+//Rets:	positional arguments, error
+func parseArgs(flags *flag.FlagSet, args []string) ([]string, error) {
+	var err error
+	positional := []string{}
+
+	for err == nil && len(args) > 0 {
+		if err = flags.Parse(args); err == nil {
+			args = flags.Args()
+
+			if len(args) > 0 {
+				positional = append(positional, args[0])
+				args = args[1:]
+			}
+		}
+	}
+
+	return positional, err
+}
+
+//call sends a request to the library API and returns the response body. The body is encoded as JSON unless it is already a byte slice, and the token, if any, is sent as the authorization header
+//Args:	method, URL, bearer token, request body or nil
+//Rets:	response body, error
+func call(method string, endpoint string, token string, body interface{}) ([]byte, error) {
+	var err error
+	var req *http.Request
+	var resp *http.Response
+	var data []byte
+	var reader io.Reader
+
+	if raw, ok := body.([]byte); ok {
+		reader = bytes.NewReader(raw)
+	} else if body != nil {
+		if data, err = json.Marshal(body); err == nil {
+			reader = bytes.NewReader(data)
+		}
+	}
+
+	if err == nil {
+		if req, err = http.NewRequest(method, endpoint, reader); err == nil {
+			req.Header.Set("Accept", "application/json")
+
+			if reader != nil {
+				req.Header.Set("Content-Type", "application/json")
+			}
+
+			if token != "" {
+				req.Header.Set("Authorization", token)
+			}
+
+			if resp, err = http.DefaultClient.Do(req); err == nil {
+				defer resp.Body.Close()
+
+				if data, err = ioutil.ReadAll(resp.Body); err == nil && (resp.StatusCode < 200 || resp.StatusCode > 299) {
+					err = &apiError{StatusCode: resp.StatusCode, Status: resp.Status, Body: data}
+				}
+			}
+		}
+	}
+
+	return data, err
+}
+
+//listAll fetches every page of a list endpoint
+//Args:	URL, list filters
+//Rets:	documents, error
+func listAll(endpoint string, query url.Values) ([]json.RawMessage, error) {
+	var err error
+	var data []byte
+	items := []json.RawMessage{}
+	page := struct {
+		Items []json.RawMessage `json:"items"`
+		Next  string            `json:"next"`
+	}{}
+
+	query.Set("limit", fmt.Sprintf("%d", listPageSize))
+
+	for more := true; more && err == nil; more = page.Next != "" {
+		if page.Next != "" {
+			query.Set("cursor", page.Next)
+		}
+
+		if data, err = call(http.MethodGet, endpoint+"?"+query.Encode(), "", nil); err == nil {
+			page.Items, page.Next = nil, ""
+
+			if err = json.Unmarshal(data, &page); err == nil {
+				items = append(items, page.Items...)
+			}
+		}
+	}
+
+	return items, err
+}
+
+//printJSON prints a response body indented
+func printJSON(data []byte, stdout io.Writer) error {
+	var out bytes.Buffer
+	err := json.Indent(&out, data, "", "  ")
+
+	if err == nil {
+		out.WriteString("\n")
+		_, err = out.WriteTo(stdout)
+	}
+
+	return err
+}
+
+//printMessage prints the message of a library response, or the indented response when it is not a plain message
+func printMessage(data []byte, stdout io.Writer) error {
+	var err error
+	msg := m.Msg{}
+
+	if json.Unmarshal(data, &msg) != nil || len(msg) != 1 || msg["message"] == nil {
+		err = printJSON(data, stdout)
+	} else {
+		fmt.Fprintln(stdout, msg["message"])
+	}
+
+	return err
+}
+
+//readBody reads a JSON request body from a file, or the standard input when the name is -
+//Args:	file name
+//Rets:	body, error
+func readBody(name string) ([]byte, error) {
+	var err error
+	var data []byte
+
+	if name == "" {
+		err = fmt.Errorf("missing -f FILE with the JSON body")
+	} else if name == "-" {
+		data, err = ioutil.ReadAll(os.Stdin)
+	} else {
+		data, err = ioutil.ReadFile(name)
+	}
+
+	if err == nil && !json.Valid(data) {
+		err = fmt.Errorf("%s is not valid JSON", name)
+	}
+
+	return data, err
+}
+
+//sessionPath returns the file the session is stored in between invocations
+func sessionPath(flagValue string) string {
+	name := flagValue
+
+	if name == "" {
+		name = os.Getenv("LIBRARY_SESSION")
+	}
+
+	if name == "" {
+		home, _ := os.UserHomeDir()
+		name = filepath.Join(home, ".library", "session.json")
+	}
+
+	return name
+}
@@ -0,0 +1,107 @@
+package cli
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+//Server the commands talk to unless -server or LIBRARY_URL is set
+const defaultServer = "http://localhost:8888"
+
+//Usage printed for unknown commands
+const usage = `usage: library COMMAND [flags]
+
+inventory:
+  export                    write the inventory to a file
+  import FILE               import an inventory file
+  sync DIR                  converge the library to a directory of YAML manifests
+
+session:
+  session start             start a session with -apikey or LIBRARY_APIKEY; -job, -owner, -commit and -label describe it
+  session renew             renew the stored session
+  session close [ID]        close the stored session, or any session by ID, and print its summary; -summary FILE saves it
+  session show [ID]         print the stored session, or any session by ID
+  session list              list sessions, filtered by -project, -owner, -runner, -commit, -job or -labels
+  session history [ID]      list closed sessions, filtered by -reason, -resource, -from, -to and the list filters, or show one
+  session lend SESSION RES  lend a resource of another project to a session; -revoke takes it back
+  checkout [ID...]          check out resources by ID, or the first available match of -selector and -labels
+  checkout -pool ID         check out a member of a pool picked by its policy, narrowed by -labels; -mode exclusive holds it alone
+  checkin [ID...]           check in resources by ID, matches of -selector and -labels, or -all
+  consume ID KEY            consume a subresource of a checked out resource
+  release ID KEY            release a consumed subresource
+  report ID -note NOTE      quarantine a faulty resource checked out by the session
+
+reports:
+  usage                     utilization of resources, or templates with -group template; -csv for CSV
+
+admin:
+  template|project|resource list|get|create|update|patch|delete
+  pool list|get|create|update|delete
+  resource quarantine|annotate|restore ID -note NOTE
+  resource label ID KEY=VALUE|KEY-...`
+
+//Run executes a command line subcommand and returns the exit code of the process
+func Run(args []string) int {
+	var err error
+
+	switch args[0] {
+	case "export":
+		err = export(args[1:], os.Stdout)
+	case "import":
+		err = importFile(args[1:], os.Stdout)
+	case "sync":
+		err = syncDir(args[1:], os.Stdout)
+	case "session":
+		err = session(args[1:], os.Stdout)
+	case "checkout":
+		err = checkout(args[1:], os.Stdout)
+	case "checkin":
+		err = checkin(args[1:], os.Stdout)
+	case "consume":
+		err = subResource(args[1:], "checkout", os.Stdout)
+	case "release":
+		err = subResource(args[1:], "checkin", os.Stdout)
+	case "report":
+		err = report(args[1:], os.Stdout)
+	case "usage":
+		err = usageReport(args[1:], os.Stdout)
+	case "template", "project", "resource", "pool":
+		err = admin(collections[args[0]], args[1:], os.Stdout)
+	default:
+		err = fmt.Errorf("unknown command %s\n%s", args[0], usage)
+	}
+
+	if err != nil && err != flag.ErrHelp {
+		fmt.Fprintln(os.Stderr, err)
+	}
+
+	return exitCode(err)
+}
+
+//exitCode maps a command error to an exit code
+func exitCode(err error) int {
+	code := 0
+
+	if err != nil {
+		code = 1
+	}
+
+	return code
+}
+
+//server returns the base URL of the library API
+func server(flagValue string) string {
+	base := flagValue
+
+	if base == "" {
+		base = os.Getenv("LIBRARY_URL")
+	}
+
+	if base == "" {
+		base = defaultServer
+	}
+
+	return strings.TrimSuffix(base, "/") + "/v1"
+}
@@ -0,0 +1,210 @@
+package cli
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	m "library/internal/app/models"
+)
+
+//Content types sent with imported files, by extension
+var contentTypes = map[string]string{
+	".json": "application/json",
+	".yaml": "application/x-yaml",
+	".yml":  "application/x-yaml",
+	".csv":  "text/csv",
+}
+
+//export writes the inventory, or a filtered subset of it, to a file or the standard output
+func export(args []string, stdout io.Writer) error {
+	var err error
+	var resp *http.Response
+	flags := flag.NewFlagSet("export", flag.ContinueOnError)
+	serverURL := flags.String("server", "", "library URL; defaults to LIBRARY_URL or "+defaultServer)
+	format := flags.String("format", "yaml", "json, yaml or csv")
+	output := flags.String("o", "", "output file; defaults to the standard output")
+	query := url.Values{}
+
+	//Resource filters are passed through to the list filters of the API
+	filters := map[string]*string{}
+	for _, name := range []string{"name", "template", "project", "active", "checkedout", "field"} {
+		filters[name] = flags.String(name, "", "resource "+name+" filter")
+	}
+
+	if err = flags.Parse(args); err == nil {
+		query.Set("format", *format)
+
+		for name, value := range filters {
+			if *value != "" {
+				query.Set(name, *value)
+			}
+		}
+
+		if resp, err = http.Get(server(*serverURL) + "/inventory/export?" + query.Encode()); err == nil {
+			defer resp.Body.Close()
+
+			if resp.StatusCode != http.StatusOK {
+				body, _ := ioutil.ReadAll(resp.Body)
+				err = fmt.Errorf("export failed: %s\n%s", resp.Status, body)
+			} else if *output == "" {
+				_, err = io.Copy(stdout, resp.Body)
+			} else {
+				var file *os.File
+
+				if file, err = os.Create(*output); err == nil {
+					defer file.Close()
+					_, err = io.Copy(file, resp.Body)
+				}
+			}
+		}
+	}
+
+	return err
+}
+
+//importFile sends an inventory file to the library and prints the report of planned or applied changes
+func importFile(args []string, stdout io.Writer) error {
+	var err error
+	var data []byte
+	flags := flag.NewFlagSet("import", flag.ContinueOnError)
+	serverURL := flags.String("server", "", "library URL; defaults to LIBRARY_URL or "+defaultServer)
+	format := flags.String("format", "", "json, yaml or csv; defaults to the file extension")
+	dryRun := flags.Bool("dry-run", false, "print the planned changes without applying them")
+
+	if err = flags.Parse(args); err == nil && flags.NArg() != 1 {
+		err = fmt.Errorf("usage: library import [-server URL] [-format json|yaml|csv] [-dry-run] FILE")
+	}
+
+	if err == nil {
+		if data, err = ioutil.ReadFile(flags.Arg(0)); err == nil {
+			query := url.Values{}
+			query.Set("dryrun", fmt.Sprintf("%t", *dryRun))
+
+			if *format != "" {
+				query.Set("format", *format)
+			}
+
+			ctype, ok := contentTypes[strings.ToLower(filepath.Ext(flags.Arg(0)))]
+			if !ok {
+				ctype = "application/json"
+			}
+
+			err = postInventory(server(*serverURL)+"/inventory/import?"+query.Encode(), ctype, data, stdout)
+		}
+	}
+
+	return err
+}
+
+//syncDir converges the library to the YAML manifests in a directory and its subdirectories
+func syncDir(args []string, stdout io.Writer) error {
+	var err error
+	var manifests bytes.Buffer
+	flags := flag.NewFlagSet("sync", flag.ContinueOnError)
+	serverURL := flags.String("server", "", "library URL; defaults to LIBRARY_URL or "+defaultServer)
+	dryRun := flags.Bool("dry-run", false, "print the plan without applying it")
+	force := flags.Bool("force", false, "update and delete checked out resources")
+
+	if err = flags.Parse(args); err == nil && flags.NArg() != 1 {
+		err = fmt.Errorf("usage: library sync [-server URL] [-dry-run] [-force] DIR")
+	}
+
+	//Manifests are joined into a single stream of YAML documents, in lexical order
+	if err == nil {
+		err = filepath.Walk(flags.Arg(0), func(path string, info os.FileInfo, walkErr error) error {
+			ext := strings.ToLower(filepath.Ext(path))
+
+			if walkErr == nil && !info.IsDir() && (ext == ".yaml" || ext == ".yml") {
+				var data []byte
+
+				if data, walkErr = ioutil.ReadFile(path); walkErr == nil {
+					manifests.WriteString("---\n")
+					manifests.Write(data)
+					manifests.WriteString("\n")
+				}
+			}
+
+			return walkErr
+		})
+	}
+
+	if err == nil {
+		query := url.Values{}
+		query.Set("dryrun", fmt.Sprintf("%t", *dryRun))
+		query.Set("force", fmt.Sprintf("%t", *force))
+
+		err = postInventory(server(*serverURL)+"/inventory/sync?"+query.Encode(), "application/x-yaml", manifests.Bytes(), stdout)
+	}
+
+	return err
+}
+
+//postInventory sends a batch to an import or sync endpoint and prints the returned plan
+func postInventory(endpoint string, ctype string, data []byte, stdout io.Writer) error {
+	var err error
+	var resp *http.Response
+	var body []byte
+
+	if resp, err = http.Post(endpoint, ctype, bytes.NewReader(data)); err == nil {
+		defer resp.Body.Close()
+
+		if body, err = ioutil.ReadAll(resp.Body); err == nil {
+			report := &m.InventoryReport{}
+
+			if json.Unmarshal(body, report) != nil || report.Changes == nil {
+				//Not a report, e.g. a malformed batch
+				fmt.Fprintf(stdout, "%s\n", body)
+			} else {
+				printReport(report, stdout)
+			}
+
+			if resp.StatusCode != http.StatusOK {
+				err = fmt.Errorf("%s failed: %s", path.Base(strings.SplitN(endpoint, "?", 2)[0]), resp.Status)
+			}
+		}
+	}
+
+	return err
+}
+
+//printReport prints a plan with one line per change, marked + for create, ~ for update and - for delete, followed by errors
+func printReport(report *m.InventoryReport, stdout io.Writer) {
+	counts := map[string]int{}
+	marks := map[string]string{"create": "+", "update": "~", "delete": "-"}
+
+	for _, change := range report.Changes {
+		counts[change.Action]++
+
+		if mark, ok := marks[change.Action]; ok {
+			fmt.Fprintf(stdout, "%s %s %s\n", mark, change.Kind, change.Name)
+
+			for _, diff := range change.Diff {
+				oldValue, _ := json.Marshal(diff.Old)
+				newValue, _ := json.Marshal(diff.New)
+				fmt.Fprintf(stdout, "    %s: %s => %s\n", diff.Key, oldValue, newValue)
+			}
+		}
+	}
+
+	for _, e := range report.Errors {
+		fmt.Fprintf(stdout, "! %s %s: %s\n", e.Kind, e.Name, e.Message)
+	}
+
+	status := "planned"
+	if report.Applied {
+		status = "applied"
+	}
+
+	fmt.Fprintf(stdout, "%d to create, %d to update, %d to delete, %d unchanged; %s, %d errors\n",
+		counts["create"], counts["update"], counts["delete"], counts["unchanged"], status, len(report.Errors))
+}
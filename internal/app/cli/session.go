@@ -0,0 +1,671 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	m "library/internal/app/models"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+//Selector keys passed to the list filters as they are; any other key matches a resource field
+var selectorFilters = map[string]bool{"name": true, "template": true, "project": true, "active": true, "checkedout": true, "health": true}
+
+//storedSession is the session kept in the session file between invocations
+type storedSession struct {
+	ID      string `json:"id"`
+	Project string `json:"project"`
+	Token   string `json:"token"` //Bearer token, including the Bearer prefix
+}
+
+//loadSession reads the stored session
+func loadSession(name string) (*storedSession, error) {
+	var err error
+	var data []byte
+	stored := &storedSession{}
+
+	if data, err = ioutil.ReadFile(name); os.IsNotExist(err) {
+		err = fmt.Errorf("no session in %s; run library session start first", name)
+	} else if err == nil {
+		err = json.Unmarshal(data, stored)
+	}
+
+	return stored, err
+}
+
+//saveSession writes the session file, readable by the current user only since the token grants access to the project
+func saveSession(name string, stored *storedSession) error {
+	var err error
+	var data []byte
+
+	if err = os.MkdirAll(filepath.Dir(name), 0700); err == nil {
+		if data, err = json.MarshalIndent(stored, "", "  "); err == nil {
+			err = ioutil.WriteFile(name, data, 0600)
+		}
+	}
+
+	return err
+}
+
+//tokenSessionID reads the session id from the claims of a bearer token. The signature can only be verified by the library, which does so on every call
+func tokenSessionID(token string) (string, error) {
+	claims := jwt.MapClaims{}
+	_, _, err := new(jwt.Parser).ParseUnverified(strings.TrimPrefix(token, "Bearer "), claims)
+
+	id, _ := claims["id"].(string)
+	if err == nil && id == "" {
+		err = fmt.Errorf("session token carries no session id")
+	}
+
+	return id, err
+}
+
+//session runs the session subcommands
+func session(args []string, stdout io.Writer) error {
+	var err error
+	commands := map[string]func([]string, io.Writer) error{
+		"start":   sessionStart,
+		"renew":   sessionRenew,
+		"close":   sessionClose,
+		"show":    sessionShow,
+		"list":    sessionList,
+		"lend":    sessionLend,
+		"history": sessionHistory,
+	}
+
+	if len(args) == 0 || commands[args[0]] == nil {
+		err = fmt.Errorf("usage: library session start|renew|close|show|list|lend|history [flags]")
+	} else {
+		err = commands[args[0]](args[1:], stdout)
+	}
+
+	return err
+}
+
+//sessionStart creates a session for the project of an API key and stores its token
+func sessionStart(args []string, stdout io.Writer) error {
+	var err error
+	var data []byte
+	flags := flag.NewFlagSet("session start", flag.ContinueOnError)
+	opts := addOptions(flags)
+	apiKey := flags.String("apikey", "", "project API key; defaults to LIBRARY_APIKEY")
+	labels := &assignments{}
+	metadata := m.SessionMetadata{}
+	stored := &storedSession{}
+
+	//Metadata tells operators which job holds the resources of the session
+	metadata.Runner, _ = os.Hostname()
+	flags.StringVar(&metadata.JobURL, "job", "", "URL of the CI job running the session")
+	flags.StringVar(&metadata.Runner, "runner", metadata.Runner, "hostname of the machine running the session")
+	flags.StringVar(&metadata.Owner, "owner", "", "person or team responsible for the session")
+	flags.StringVar(&metadata.Commit, "commit", "", "revision under test")
+	flags.Var(labels, "label", "session label KEY=VALUE; repeatable")
+	created := map[string]string{}
+
+	if err = flags.Parse(args); err == nil {
+		if *apiKey == "" {
+			*apiKey = os.Getenv("LIBRARY_APIKEY")
+		}
+
+		if *apiKey == "" {
+			err = fmt.Errorf("usage: library session start -apikey KEY [-job URL] [-runner HOST] [-owner OWNER] [-commit SHA] [-label KEY=VALUE...]")
+		}
+
+		for _, label := range *labels {
+			pair := strings.SplitN(label, "=", 2)
+			metadata.Labels = append(metadata.Labels, m.Label{Key: pair[0], Value: pair[1]})
+		}
+	}
+
+	if err == nil {
+		if data, err = call(http.MethodPost, server(*opts.server)+"/session", "", m.SessionRequest{APIKey: *apiKey, Metadata: metadata}); err == nil {
+			if err = json.Unmarshal(data, &created); err == nil {
+				stored.Token = created["token"]
+				stored.ID, err = tokenSessionID(stored.Token)
+			}
+		}
+	}
+
+	//The project is kept so that selectors only match resources the session may check out
+	if err == nil {
+		if data, err = call(http.MethodGet, server(*opts.server)+"/session/"+stored.ID, "", nil); err == nil {
+			started := m.Session{}
+
+			if err = json.Unmarshal(data, &started); err == nil {
+				stored.Project = started.Project
+				err = saveSession(sessionPath(*opts.session), stored)
+			}
+		}
+	}
+
+	if err == nil {
+		if *opts.json {
+			err = printJSON(data, stdout)
+		} else {
+			fmt.Fprintln(stdout, stored.ID)
+		}
+	}
+
+	return err
+}
+
+//sessionRenew extends the stored session and stores the renewed token
+func sessionRenew(args []string, stdout io.Writer) error {
+	var err error
+	var data []byte
+	var stored *storedSession
+	flags := flag.NewFlagSet("session renew", flag.ContinueOnError)
+	opts := addOptions(flags)
+	renewed := map[string]string{}
+
+	if err = flags.Parse(args); err == nil {
+		if stored, err = loadSession(sessionPath(*opts.session)); err == nil {
+			if data, err = call(http.MethodPut, server(*opts.server)+"/session/authorized", stored.Token, nil); err == nil {
+				if err = json.Unmarshal(data, &renewed); err == nil {
+					stored.Token = renewed["token"]
+					err = saveSession(sessionPath(*opts.session), stored)
+				}
+			}
+		}
+	}
+
+	if err == nil {
+		fmt.Fprintf(stdout, "session %s renewed\n", stored.ID)
+	}
+
+	return err
+}
+
+//sessionClose closes the stored session and removes the session file, or closes any session by id as an operator
+func sessionClose(args []string, stdout io.Writer) error {
+	var err error
+	var data []byte
+	var stored *storedSession
+	var ids []string
+	flags := flag.NewFlagSet("session close", flag.ContinueOnError)
+	opts := addOptions(flags)
+	output := flags.String("summary", "", "also write the session summary as JSON to this file, e.g. to attach it to a test report")
+	closed := m.SessionClosed{}
+
+	if ids, err = parseArgs(flags, args); err == nil {
+		if len(ids) == 1 {
+			data, err = call(http.MethodDelete, server(*opts.server)+"/session/"+ids[0], "", nil)
+		} else if stored, err = loadSession(sessionPath(*opts.session)); err == nil {
+			data, err = call(http.MethodDelete, server(*opts.server)+"/session/authorized", stored.Token, nil)
+
+			//A session which is already gone, e.g. expired, leaves nothing to keep the file for
+			if apiErr, ok := err.(*apiError); err == nil || ok && apiErr.StatusCode == http.StatusNotFound {
+				_ = os.Remove(sessionPath(*opts.session))
+			}
+		}
+	}
+
+	if err == nil {
+		err = json.Unmarshal(data, &closed)
+	}
+
+	if err == nil && *output != "" {
+		var summary []byte
+
+		if summary, err = json.MarshalIndent(closed.Summary, "", "  "); err == nil {
+			err = ioutil.WriteFile(*output, summary, 0644)
+		}
+	}
+
+	if err == nil {
+		if *opts.json {
+			err = printJSON(data, stdout)
+		} else {
+			fmt.Fprintln(stdout, closed.Message)
+			err = printSummary(closed.Summary, stdout)
+		}
+	}
+
+	return err
+}
+
+//printSummary prints the checkouts and subresource activity of a closed session as tables, followed by its duration and renewals
+func printSummary(summary m.SessionSummary, stdout io.Writer) error {
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+
+	if len(summary.Resources) > 0 {
+		fmt.Fprintln(w, "\nRESOURCE\tNAME\tCHECKED OUT\tCHECKED IN")
+
+		for _, r := range summary.Resources {
+			checkedIn := ""
+			if r.CheckedIn != nil {
+				checkedIn = r.CheckedIn.Format(time.RFC3339)
+			}
+
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", r.ResourceID, r.Name, r.CheckedOut.Format(time.RFC3339), checkedIn)
+		}
+	}
+
+	if len(summary.SubResources) > 0 {
+		fmt.Fprintln(w, "\nRESOURCE\tKEY\tCONSUMED\tRELEASED")
+
+		for _, a := range summary.SubResources {
+			fmt.Fprintf(w, "%s\t%s\t%d\t%d\n", a.ParentID, a.Key, a.Consumed, a.Released)
+		}
+	}
+
+	fmt.Fprintf(w, "\nduration %s, renewed %d times\n", time.Duration(summary.Duration*float64(time.Second)).Round(time.Second), summary.Renewals)
+
+	return w.Flush()
+}
+
+//sessionShow prints the stored session, or any session by id
+func sessionShow(args []string, stdout io.Writer) error {
+	var err error
+	var data []byte
+	var stored *storedSession
+	var ids []string
+	flags := flag.NewFlagSet("session show", flag.ContinueOnError)
+	opts := addOptions(flags)
+
+	if ids, err = parseArgs(flags, args); err == nil {
+		id := ""
+
+		if len(ids) > 0 {
+			id = ids[0]
+		} else {
+			if stored, err = loadSession(sessionPath(*opts.session)); err == nil {
+				id = stored.ID
+			}
+		}
+
+		if err == nil {
+			data, err = call(http.MethodGet, server(*opts.server)+"/session/"+id, "", nil)
+		}
+	}
+
+	if err == nil {
+		if *opts.json {
+			err = printJSON(data, stdout)
+		} else {
+			err = printDocument(collections["session"], data, stdout)
+		}
+	}
+
+	return err
+}
+
+//sessionList prints all sessions, or the sessions matching filters such as the project or owner
+func sessionList(args []string, stdout io.Writer) error {
+	var err error
+	var docs []json.RawMessage
+	flags := flag.NewFlagSet("session list", flag.ContinueOnError)
+	opts := addOptions(flags)
+	filters := map[string]*string{}
+	query := url.Values{}
+
+	for _, name := range []string{"project", "owner", "runner", "commit", "job", "labels"} {
+		filters[name] = flags.String(name, "", name+" filter")
+	}
+
+	if err = flags.Parse(args); err == nil {
+		for name, value := range filters {
+			if *value != "" {
+				query.Set(name, *value)
+			}
+		}
+
+		docs, err = listAll(server(*opts.server)+"/session", query)
+	}
+
+	if err == nil {
+		err = printDocuments(collections["session"], docs, *opts.json, stdout)
+	}
+
+	return err
+}
+
+//sessionHistory prints closed sessions matching filters such as the owner or close reason, or a closed session by id
+func sessionHistory(args []string, stdout io.Writer) error {
+	var err error
+	var data []byte
+	var docs []json.RawMessage
+	var ids []string
+	flags := flag.NewFlagSet("session history", flag.ContinueOnError)
+	opts := addOptions(flags)
+	filters := map[string]*string{}
+	query := url.Values{}
+
+	for _, name := range []string{"project", "owner", "runner", "commit", "job", "labels", "reason", "resource", "from", "to", "sort"} {
+		filters[name] = flags.String(name, "", name+" filter")
+	}
+
+	if ids, err = parseArgs(flags, args); err == nil && len(ids) > 1 {
+		err = fmt.Errorf("usage: library session history [ID] [filters]")
+	}
+
+	if err == nil {
+		if len(ids) == 1 {
+			data, err = call(http.MethodGet, server(*opts.server)+"/session/history/"+ids[0], "", nil)
+		} else {
+			for name, value := range filters {
+				if *value != "" {
+					query.Set(name, *value)
+				}
+			}
+
+			docs, err = listAll(server(*opts.server)+"/session/history", query)
+		}
+	}
+
+	if err == nil {
+		if len(ids) == 0 {
+			err = printDocuments(collections["history"], docs, *opts.json, stdout)
+		} else if *opts.json {
+			err = printJSON(data, stdout)
+		} else {
+			err = printDocument(collections["history"], data, stdout)
+		}
+	}
+
+	return err
+}
+
+//sessionLend lends a resource of another project to a session as an operator, or revokes the loan
+func sessionLend(args []string, stdout io.Writer) error {
+	var err error
+	var data []byte
+	var ids []string
+	flags := flag.NewFlagSet("session lend", flag.ContinueOnError)
+	opts := addOptions(flags)
+	revoke := flags.Bool("revoke", false, "take back the resource lent to the session")
+	method := http.MethodPut
+
+	if ids, err = parseArgs(flags, args); err == nil && len(ids) != 2 {
+		err = fmt.Errorf("usage: library session lend [-revoke] SESSION RESOURCE")
+	}
+
+	if err == nil {
+		if *revoke {
+			method = http.MethodDelete
+		}
+
+		data, err = call(method, server(*opts.server)+"/session/"+ids[0]+"/borrow/"+ids[1], "", nil)
+	}
+
+	if err == nil {
+		if *opts.json {
+			err = printJSON(data, stdout)
+		} else {
+			err = printDocument(collections["session"], data, stdout)
+		}
+	}
+
+	return err
+}
+
+//selectorQuery converts a selector of comma-separated key=value terms into resource list filters. Keys accepted by the list filters are passed as they are; any other key matches a resource field with that value, and since the list filters match a single field, only one such term is allowed
+//Args:	selector
+//Rets:	list filters, error
+func selectorQuery(selector string) (url.Values, error) {
+	var err error
+	query := url.Values{}
+
+	for _, term := range strings.Split(selector, ",") {
+		pair := strings.SplitN(strings.TrimSpace(term), "=", 2)
+
+		if len(pair) != 2 || pair[0] == "" {
+			err = fmt.Errorf("selector term %q is not key=value", term)
+		} else if selectorFilters[pair[0]] {
+			query.Set(pair[0], pair[1])
+		} else if query.Get("field") != "" {
+			err = fmt.Errorf("selector can match one field only")
+		} else {
+			query.Set("field", pair[0]+":"+pair[1])
+		}
+	}
+
+	return query, err
+}
+
+//selectResources lists the ids of the resources matching a selector and a label selector, either of which may be empty, restricted to the project of the session unless the selector names one
+//Args:	server URL, selector, label selector, stored session, filters applied unless set by the selector
+//Rets:	resource ids, error
+func selectResources(base string, selector string, labels string, stored *storedSession, defaults url.Values) ([]string, error) {
+	var err error
+	var docs []json.RawMessage
+	query := url.Values{}
+	ids := []string{}
+
+	if selector != "" {
+		query, err = selectorQuery(selector)
+	}
+
+	if labels != "" {
+		query.Set("labels", labels)
+	}
+
+	if err == nil {
+		defaults.Set("project", stored.Project)
+
+		for key := range defaults {
+			if query.Get(key) == "" {
+				query.Set(key, defaults.Get(key))
+			}
+		}
+
+		if docs, err = listAll(base+"/resource", query); err == nil {
+			for _, doc := range docs {
+				resource := m.Resource{}
+
+				if err = json.Unmarshal(doc, &resource); err == nil {
+					ids = append(ids, resource.ID.Hex())
+				}
+			}
+		}
+	}
+
+	return ids, err
+}
+
+//checkout checks out resources by id, or the first available resource matching a selector, and prints them
+func checkout(args []string, stdout io.Writer) error {
+	var err error
+	var data []byte
+	var stored *storedSession
+	var candidates []string
+	flags := flag.NewFlagSet("checkout", flag.ContinueOnError)
+	opts := addOptions(flags)
+	selector := flags.String("selector", "", "check out the first available resource matching comma-separated key=value terms, e.g. template=ID,os=android")
+	labels := flags.String("labels", "", "check out the first available resource matching a label selector, e.g. region in (eu-west,eu-north),!broken")
+	pool := flags.String("pool", "", "check out a member of the pool with this id, picked by the server")
+	mode := flags.String("mode", "", "pool checkout mode, shared or exclusive; defaults to the mode of the pool")
+	expand := flags.String("expand", "", "comma-separated keys of reference-type fields to replace with the referenced resources")
+	docs := []json.RawMessage{}
+
+	candidates, err = parseArgs(flags, args)
+	selecting := *selector != "" || *labels != ""
+
+	if err == nil && ((len(candidates) == 0) != (selecting || *pool != "") || *pool != "" && *selector != "" || *pool == "" && *mode != "") {
+		err = fmt.Errorf("usage: library checkout [-expand KEYS] ID... | -selector SELECTOR | -labels SELECTOR | -pool ID [-labels SELECTOR] [-mode MODE]")
+	}
+
+	if err == nil {
+		if stored, err = loadSession(sessionPath(*opts.session)); err == nil {
+			if selecting && *pool == "" {
+				candidates, err = selectResources(server(*opts.server), *selector, *labels, stored, url.Values{"active": {"true"}, "checkedout": {"false"}, "health": {"healthy"}})
+			}
+		}
+	}
+
+	query := url.Values{}
+	if *expand != "" {
+		query.Set("expand", *expand)
+	}
+
+	//The server picks the member of a pool, so a pool checkout is a single call
+	if err == nil && *pool != "" {
+		for name, value := range map[string]string{"labels": *labels, "mode": *mode} {
+			if value != "" {
+				query.Set(name, value)
+			}
+		}
+
+		if data, err = call(http.MethodPut, server(*opts.server)+"/session/authorized/pool/"+*pool+"/checkout?"+query.Encode(), stored.Token, nil); err == nil {
+			docs = append(docs, data)
+		}
+	}
+
+	for i := 0; err == nil && i < len(candidates); i++ {
+		if data, err = call(http.MethodPut, server(*opts.server)+"/session/authorized/checkout/"+candidates[i]+"?"+query.Encode(), stored.Token, nil); err == nil {
+			docs = append(docs, data)
+
+			//A selector checks out a single resource
+			if selecting {
+				break
+			}
+		} else if apiErr, ok := err.(*apiError); ok && apiErr.StatusCode == http.StatusConflict && selecting {
+			//Already held by the session, try the next match
+			err = nil
+		}
+	}
+
+	if err == nil && len(docs) == 0 {
+		err = fmt.Errorf("no available resource matches %s", strings.TrimSpace(*selector+" "+*labels))
+	}
+
+	//A single checkout prints the resource itself rather than a list
+	if err == nil && *opts.json && len(docs) == 1 {
+		err = printJSON(docs[0], stdout)
+	} else if err == nil {
+		err = printDocuments(collections["resource"], docs, *opts.json, stdout)
+	}
+
+	return err
+}
+
+//checkin checks in resources by id, the resources of the session matching a selector, or all resources of the session
+func checkin(args []string, stdout io.Writer) error {
+	var err error
+	var data []byte
+	var stored *storedSession
+	var ids []string
+	flags := flag.NewFlagSet("checkin", flag.ContinueOnError)
+	opts := addOptions(flags)
+	selector := flags.String("selector", "", "check in the resources of the session matching comma-separated key=value terms")
+	labels := flags.String("labels", "", "check in the resources of the session matching a label selector")
+	all := flags.Bool("all", false, "check in every resource of the session")
+	held := m.Session{}
+
+	ids, err = parseArgs(flags, args)
+	selecting := *selector != "" || *labels != ""
+
+	if err == nil && (len(ids) > 0) == (selecting || *all) {
+		err = fmt.Errorf("usage: library checkin ID... | -selector SELECTOR | -labels SELECTOR | -all")
+	}
+
+	if err == nil {
+		if stored, err = loadSession(sessionPath(*opts.session)); err == nil {
+			if selecting || *all {
+				if data, err = call(http.MethodGet, server(*opts.server)+"/session/"+stored.ID, "", nil); err == nil {
+					err = json.Unmarshal(data, &held)
+				}
+			}
+		}
+	}
+
+	if err == nil && (selecting || *all) {
+		ids = held.Resources
+
+		if selecting {
+			var matches []string
+			selected := map[string]bool{}
+
+			if matches, err = selectResources(server(*opts.server), *selector, *labels, stored, url.Values{}); err == nil {
+				for _, id := range matches {
+					selected[id] = true
+				}
+
+				ids = []string{}
+				for _, id := range held.Resources {
+					if selected[id] {
+						ids = append(ids, id)
+					}
+				}
+			}
+		}
+	}
+
+	for i := 0; err == nil && i < len(ids); i++ {
+		if _, err = call(http.MethodPut, server(*opts.server)+"/session/authorized/checkin/"+ids[i], stored.Token, nil); err == nil {
+			fmt.Fprintf(stdout, "%s checked in\n", ids[i])
+		}
+	}
+
+	return err
+}
+
+//subResource consumes or releases a subresource of a resource checked out by the session
+//Args:	arguments, checkout to consume or checkin to release, standard output
+//Rets:	error
+func subResource(args []string, action string, stdout io.Writer) error {
+	var err error
+	var data []byte
+	var stored *storedSession
+	var ids []string
+	flags := flag.NewFlagSet(action, flag.ContinueOnError)
+	opts := addOptions(flags)
+
+	if ids, err = parseArgs(flags, args); err == nil && len(ids) != 2 {
+		err = fmt.Errorf("usage: library consume|release ID KEY")
+	}
+
+	if err == nil {
+		if stored, err = loadSession(sessionPath(*opts.session)); err == nil {
+			endpoint := fmt.Sprintf("%s/session/authorized/%s/%s/%s", server(*opts.server), action, ids[0], url.PathEscape(ids[1]))
+
+			if data, err = call(http.MethodPut, endpoint, stored.Token, nil); err == nil {
+				err = printMessage(data, stdout)
+			}
+		}
+	}
+
+	return err
+}
+
+//report reports a resource checked out by the session as faulty, taking it out of rotation
+func report(args []string, stdout io.Writer) error {
+	var err error
+	var data []byte
+	var stored *storedSession
+	var ids []string
+	flags := flag.NewFlagSet("report", flag.ContinueOnError)
+	opts := addOptions(flags)
+	note := flags.String("note", "", "what is wrong with the resource")
+
+	if ids, err = parseArgs(flags, args); err == nil && (len(ids) != 1 || *note == "") {
+		err = fmt.Errorf("usage: library report ID -note NOTE")
+	}
+
+	if err == nil {
+		if stored, err = loadSession(sessionPath(*opts.session)); err == nil {
+			data, err = call(http.MethodPost, server(*opts.server)+"/session/authorized/report/"+ids[0], stored.Token, m.QuarantineRequest{Note: *note})
+		}
+	}
+
+	if err == nil {
+		if *opts.json {
+			err = printJSON(data, stdout)
+		} else {
+			err = printDocument(collections["resource"], data, stdout)
+		}
+	}
+
+	return err
+}
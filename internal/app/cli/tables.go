@@ -0,0 +1,176 @@
+package cli
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	m "library/internal/app/models"
+)
+
+//collection describes an API collection and how its documents are printed as table rows
+type collection struct {
+	name    string
+	path    string
+	columns []string
+	row     func(doc json.RawMessage) []string
+}
+
+//Collections managed by the admin commands, by command name
+var collections = map[string]collection{
+	"template": {
+		name:    "template",
+		path:    "/template",
+		columns: []string{"ID", "NAME", "VERSION", "EXTENDS", "FIELDS"},
+		row: func(doc json.RawMessage) []string {
+			t := m.Template{}
+			_ = json.Unmarshal(doc, &t)
+			return []string{t.ID.Hex(), t.Name, fmt.Sprint(t.Version), strings.Join(t.Extends, ","), fmt.Sprint(len(t.Fields))}
+		},
+	},
+	"project": {
+		name:    "project",
+		path:    "/project",
+		columns: []string{"ID", "NAME", "RESOURCES", "SETTINGS"},
+		row: func(doc json.RawMessage) []string {
+			p := m.Project{}
+			_ = json.Unmarshal(doc, &p)
+			return []string{p.ID.Hex(), p.Name, fmt.Sprint(len(p.Resources)), fmt.Sprint(len(p.Settings))}
+		},
+	},
+	"resource": {
+		name:    "resource",
+		path:    "/resource",
+		columns: []string{"ID", "NAME", "TEMPLATE", "ACTIVE", "HEALTH", "CHECKEDOUT", "LABELS"},
+		row: func(doc json.RawMessage) []string {
+			r := m.Resource{}
+			_ = json.Unmarshal(doc, &r)
+
+			health := r.Health
+			if health == "" {
+				health = m.HealthHealthy
+			}
+
+			labels := []string{}
+			for _, l := range r.Labels {
+				labels = append(labels, l.Key+"="+l.Value)
+			}
+
+			return []string{r.ID.Hex(), r.Name, r.TemplateID, fmt.Sprint(r.Active), health, fmt.Sprint(r.CheckedOut), strings.Join(labels, ",")}
+		},
+	},
+	"pool": {
+		name:    "pool",
+		path:    "/pool",
+		columns: []string{"ID", "NAME", "RESOURCES", "SELECTOR", "PROJECTS", "MODE", "STRATEGY"},
+		row: func(doc json.RawMessage) []string {
+			p := m.Pool{}
+			_ = json.Unmarshal(doc, &p)
+			return []string{p.ID.Hex(), p.Name, fmt.Sprint(len(p.Resources)), p.Selector, strings.Join(p.Projects, ","), p.Policy.Mode, p.Policy.Strategy}
+		},
+	},
+	"session": {
+		name:    "session",
+		path:    "/session",
+		columns: []string{"ID", "PROJECT", "OWNER", "RUNNER", "JOB", "RESOURCES", "CONSUMED"},
+		row: func(doc json.RawMessage) []string {
+			s := m.Session{}
+			_ = json.Unmarshal(doc, &s)
+			return []string{s.ID.Hex(), s.Project, s.Metadata.Owner, s.Metadata.Runner, s.Metadata.JobURL, strings.Join(s.Resources, ","), fmt.Sprint(len(s.Consumed))}
+		},
+	},
+	"history": {
+		name:    "history",
+		path:    "/session/history",
+		columns: []string{"SESSION", "PROJECT", "OWNER", "JOB", "STARTED", "CLOSED", "REASON", "RESOURCES"},
+		row: func(doc json.RawMessage) []string {
+			s := m.ClosedSession{}
+			_ = json.Unmarshal(doc, &s)
+			return []string{s.SessionID, s.Project, s.Metadata.Owner, s.Metadata.JobURL, s.Started.Format(time.RFC3339), s.Closed.Format(time.RFC3339), s.Reason, strings.Join(s.Resources, ",")}
+		},
+	},
+}
+
+//printTable prints documents of a collection as a table, one row per document
+func printTable(coll collection, docs []json.RawMessage, stdout io.Writer) error {
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintln(w, strings.Join(coll.columns, "\t"))
+
+	for _, doc := range docs {
+		fmt.Fprintln(w, strings.Join(coll.row(doc), "\t"))
+	}
+
+	return w.Flush()
+}
+
+//printDocuments prints documents as a table, or as a JSON list
+func printDocuments(coll collection, docs []json.RawMessage, asJSON bool, stdout io.Writer) error {
+	var err error
+	var data []byte
+
+	if !asJSON {
+		err = printTable(coll, docs, stdout)
+	} else if data, err = json.Marshal(docs); err == nil {
+		err = printJSON(data, stdout)
+	}
+
+	return err
+}
+
+//printDocument prints a single document as a table row, followed by its fields or settings
+func printDocument(coll collection, doc []byte, stdout io.Writer) error {
+	var err error
+	entries := struct {
+		Fields     []m.Field           `json:"fields"`
+		Settings   []m.ProjectSetting  `json:"settings"`
+		Quarantine []m.QuarantineEvent `json:"quarantine"`
+	}{}
+
+	if err = printTable(coll, []json.RawMessage{doc}, stdout); err == nil && json.Unmarshal(doc, &entries) == nil {
+		w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+
+		if len(entries.Fields) > 0 {
+			fmt.Fprintln(w, "\nKEY\tTYPE\tREQUIRED\tVALUE")
+
+			for _, f := range entries.Fields {
+				fmt.Fprintf(w, "%s\t%s\t%t\t%s\n", f.Key, f.Type, f.Required, cell(f.Value))
+			}
+		}
+
+		if len(entries.Settings) > 0 {
+			fmt.Fprintln(w, "\nKEY\tVALUE")
+
+			for _, s := range entries.Settings {
+				fmt.Fprintf(w, "%s\t%s\n", s.Key, cell(s.Value))
+			}
+		}
+
+		if len(entries.Quarantine) > 0 {
+			fmt.Fprintln(w, "\nTIME\tEVENT\tSESSION\tNOTE")
+
+			for _, e := range entries.Quarantine {
+				fmt.Fprintf(w, "%s\t%s\t%s\t%s\n", e.Time.Format(time.RFC3339), e.Event, e.Session, e.Note)
+			}
+		}
+
+		err = w.Flush()
+	}
+
+	return err
+}
+
+//cell formats a value for a table cell; strings are printed as they are and other values as JSON
+func cell(value interface{}) string {
+	text, ok := value.(string)
+
+	if !ok {
+		encoded, _ := json.Marshal(value)
+		text = string(encoded)
+	}
+
+	return text
+}
@@ -0,0 +1,89 @@
+package cli
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	m "library/internal/app/models"
+)
+
+//usageReport prints a utilization report of resources or templates, or writes it as CSV
+func usageReport(args []string, stdout io.Writer) error {
+	var err error
+	var data []byte
+	flags := flag.NewFlagSet("usage", flag.ContinueOnError)
+	opts := addOptions(flags)
+	asCSV := flags.Bool("csv", false, "print CSV instead of a table")
+	output := flags.String("o", "", "output file; defaults to the standard output")
+	query := url.Values{}
+
+	//Report parameters are passed through to the API
+	params := map[string]*string{}
+	for _, name := range []string{"from", "to", "group", "resource", "template", "project", "top"} {
+		params[name] = flags.String(name, "", "report "+name)
+	}
+
+	if err = flags.Parse(args); err == nil {
+		for name, value := range params {
+			if *value != "" {
+				query.Set(name, *value)
+			}
+		}
+
+		if *asCSV {
+			query.Set("format", "csv")
+		}
+
+		data, err = call(http.MethodGet, server(*opts.server)+"/usage/report?"+query.Encode(), "", nil)
+	}
+
+	if err == nil && *output != "" {
+		err = ioutil.WriteFile(*output, data, 0644)
+	} else if err == nil && (*asCSV || *opts.json) {
+		if *asCSV {
+			_, err = stdout.Write(data)
+		} else {
+			err = printJSON(data, stdout)
+		}
+	} else if err == nil {
+		report := &m.UsageReport{}
+
+		if err = json.Unmarshal(data, report); err == nil {
+			err = printUsage(report, stdout)
+		}
+	}
+
+	return err
+}
+
+//printUsage prints the rows of a utilization report as a table, times in minutes
+func printUsage(report *m.UsageReport, stdout io.Writer) error {
+	w := tabwriter.NewWriter(stdout, 0, 4, 2, ' ', 0)
+	minutes := func(seconds float64) string { return strconv.FormatFloat(seconds/60, 'f', 1, 64) }
+
+	fmt.Fprintln(w, "ID\tNAME\tRESOURCES\tCHECKOUTS\tUTILIZATION\tPEAK\tAVG HOLD (MIN)\tAVG WAIT (MIN)\tTOP PROJECTS")
+
+	for _, r := range report.Rows {
+		projects := []string{}
+
+		for _, p := range r.Projects {
+			name := p.Name
+			if name == "" {
+				name = p.Project
+			}
+			projects = append(projects, name)
+		}
+
+		fmt.Fprintf(w, "%s\t%s\t%d\t%d\t%.1f%%\t%d\t%s\t%s\t%s\n", r.ID, r.Name, r.Resources, r.Checkouts, r.Utilization, r.Peak, minutes(r.AverageHold), minutes(r.AverageWait), strings.Join(projects, ", "))
+	}
+
+	return w.Flush()
+}
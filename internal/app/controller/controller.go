@@ -1,24 +1,37 @@
 package controller
 
 import (
+	"encoding/json"
 	"html/template"
 	"io"
 	"library/internal/app/business"
-	"sync"
+	m "library/internal/app/models"
+	db "library/internal/pkg/dbutil"
+	"library/internal/pkg/leaseutil"
+	"library/internal/pkg/lockutil"
+	"log"
+	"os"
+	"strings"
+	"time"
 
 	"fmt"
 
 	"github.com/labstack/echo/v4"
 	"github.com/prprprus/scheduler"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 )
 
+//Time locks held in the database are held for; replicas renew the locks they hold well before they run out
+const lockLeaseTime = 30 * time.Second
+
 //Controller structure
 type Controller struct {
 	Scheduler  *scheduler.Scheduler
-	SigningKey string                 //JWT token signing key
-	DefSessExt int                    //0-23; default session extension time in hours
-	Mux        map[string]*sync.Mutex //Mutex map
-	Renderer   *TemplateMap           //Map of templates used for the public views
+	SigningKey string          //JWT token signing key
+	DefSessExt int             //0-23; default session extension time in hours
+	Mux        *lockutil.Locks //Collection locks, acquired in a global order
+	Replica    string          //Id of this replica among the replicas sharing the database
+	Renderer   *TemplateMap    //Map of templates used for the public views
 }
 
 //NewController returns a controller reference
@@ -28,12 +41,15 @@ func NewController(config map[string]interface{}) *Controller {
 	c.SigningKey = config["SigningKey"].(string)
 	c.DefSessExt = config["DefSessExt"].(int)
 
-	//Initialize mutex map
-	c.Mux = map[string]*sync.Mutex{
-		"Templates": {},
-		"Projects":  {},
-		"Resources": {},
-		"Sessions":  {},
+	//Identify the replica to the other replicas sharing the database
+	hostname, _ := os.Hostname()
+	c.Replica = hostname + "/" + primitive.NewObjectID().Hex()
+	log.Println("starting replica", c.Replica)
+
+	//Initialize collection locks, shared with the other replicas through the database
+	c.Mux = lockutil.New()
+	if config["Replicated"].(bool) {
+		c.Mux.Store = leaseutil.NewStore(c.Replica, lockLeaseTime)
 	}
 
 	//Initialize renderer
@@ -46,8 +62,14 @@ func NewController(config map[string]interface{}) *Controller {
 		templates: tempMap,
 	}
 
-	//Recover any sessions which were running before termination
-	business.RecoverSessionsBusiness(c.Scheduler, c.DefSessExt, c.Mux)
+	//Run multi-document writes in transactions where the deployment supports them, warning when it doesn't
+	db.DetectTransactions()
+
+	//Index the keys list filters and reports query by
+	business.EnsureIndexesBusiness()
+
+	//Expire sessions and give reserving projects priority at the start of their windows, on whichever replica holds the worker lease
+	c.Scheduler.Every().Do(business.RunWorkerBusiness, c.Replica, c.DefSessExt, c.Mux)
 
 	return c
 }
@@ -69,3 +91,54 @@ func (t *TemplateMap) Render(w io.Writer, name string, data interface{}, c echo.
 
 	return err
 }
+
+//expandParam returns the reference-type field keys listed in the expand query parameter
+func expandParam(c echo.Context) []string {
+	var keys []string
+
+	for _, key := range strings.Split(c.QueryParam("expand"), ",") {
+		if key = strings.TrimSpace(key); key != "" {
+			keys = append(keys, key)
+		}
+	}
+
+	return keys
+}
+
+//bindMergePatch decodes a JSON merge patch from the request body. Both application/merge-patch+json and application/json are accepted
+func bindMergePatch(c echo.Context) (m.MergePatch, error) {
+	var err error
+	var patch m.MergePatch
+	ctype := c.Request().Header.Get(echo.HeaderContentType)
+
+	if !strings.HasPrefix(ctype, "application/merge-patch+json") && !strings.HasPrefix(ctype, echo.MIMEApplicationJSON) {
+		err = fmt.Errorf("error: unsupported patch content type %s", ctype)
+	} else if err = json.NewDecoder(c.Request().Body).Decode(&patch); err == nil && patch == nil {
+		//A patch replacing the whole document is not a partial update
+		err = fmt.Errorf("error: patch is not an object")
+	}
+
+	return patch, err
+}
+
+//setETag sets the ETag header when the response is a single stored document
+func setETag(c echo.Context, response interface{}) {
+	var etag string
+
+	switch doc := response.(type) {
+	case *m.Template:
+		etag = m.ETag(doc.Revision)
+	case *m.Project:
+		etag = m.ETag(doc.Revision)
+	case *m.Resource:
+		etag = m.ETag(doc.Revision)
+	case *m.Session:
+		etag = m.ETag(doc.Revision)
+	case *m.Pool:
+		etag = m.ETag(doc.Revision)
+	}
+
+	if etag != "" {
+		c.Response().Header().Set("ETag", etag)
+	}
+}
@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"library/internal/app/business"
+	m "library/internal/app/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ExportInventory godoc
+// @Summary Export inventory
+// @Description Exports templates, projects and resources in a portable form which refers to other documents by name. Filters select a subset of resources, exported together with the templates and projects they depend on. CSV holds resources only
+// @Tags inventory
+// @Accept json
+// @Produce json,application/x-yaml,text/csv
+// @Param format query string false "json, yaml or csv; defaults to json"
+// @Param name query string false "Name prefix"
+// @Param template query string false "Template ObjectID"
+// @Param project query string false "Project ObjectID"
+// @Param active query bool false "Active flag"
+// @Param checkedout query bool false "Whether the resource is checked out by any session"
+// @Param field query string false "Field key, or key:value"
+// @Param health query string false "Health state, healthy or quarantined"
+// @Param labels query string false "Label selector, e.g. os=android,region in (eu-west,eu-north),!broken"
+// @Success 200 {object} models.Inventory
+// @Failure 400 {object} models.Msg
+// @Failure 500 {object} models.Msg
+// @Router /inventory/export [get]
+func (controller *Controller) ExportInventory(c echo.Context) error {
+	var err error
+	requestData := &m.InventoryExportRequest{}
+
+	if err = c.Bind(requestData); err != nil {
+		err = c.JSON(http.StatusBadRequest, m.ListRequestInvalid)
+	} else if code, response := business.ExportInventoryBusiness(requestData); code == http.StatusOK {
+		format, _ := business.InventoryFormat(requestData.Format, "")
+		err = c.Blob(code, business.InventoryContentType(format), response.([]byte))
+	} else {
+		err = c.JSON(code, response)
+	}
+
+	return err
+}
+
+// ImportInventory godoc
+// @Summary Import inventory
+// @Description Imports templates, projects and resources in the form produced by export. Documents are matched by name: missing ones are created and existing ones updated. Every document is validated before anything is written, and the batch is applied all-or-nothing. A dry run returns the planned changes without applying them
+// @Tags inventory
+// @Accept json,application/x-yaml,text/csv
+// @Produce json
+// @Param format query string false "json, yaml or csv; taken from the Content-Type when not passed"
+// @Param dryrun query bool false "Plan and validate without applying"
+// @Param inventory body models.Inventory true "Inventory"
+// @Success 200 {object} models.InventoryReport
+// @Failure 400 {object} models.InventoryReport
+// @Failure 500 {object} models.Msg
+// @Router /inventory/import [post]
+func (controller *Controller) ImportInventory(c echo.Context) error {
+	return controller.runInventory(c, false)
+}
+
+// SyncInventory godoc
+// @Summary Sync inventory
+// @Description Converges the library to a declared inventory, such as a directory of YAML manifests joined into one stream with document separators. Documents are matched by name: missing ones are created, existing ones updated and documents left out of the inventory deleted. Checked out resources are neither updated nor deleted unless forced. The plan is validated as a whole and applied all-or-nothing; a dry run returns the plan only
+// @Tags inventory
+// @Accept json,application/x-yaml
+// @Produce json
+// @Param format query string false "json or yaml; taken from the Content-Type when not passed"
+// @Param dryrun query bool false "Plan and validate without applying"
+// @Param force query bool false "Update and delete checked out resources"
+// @Param inventory body models.Inventory true "Inventory"
+// @Success 200 {object} models.InventoryReport
+// @Failure 400 {object} models.InventoryReport
+// @Failure 500 {object} models.Msg
+// @Router /inventory/sync [post]
+func (controller *Controller) SyncInventory(c echo.Context) error {
+	return controller.runInventory(c, true)
+}
+
+//runInventory reads a batch from the request and imports or syncs it
+func (controller *Controller) runInventory(c echo.Context, sync bool) error {
+	var err error
+	var format string
+	var data []byte
+	var dryRun, force bool
+
+	if format, err = business.InventoryFormat(c.QueryParam("format"), c.Request().Header.Get(echo.HeaderContentType)); err != nil || (sync && format == "csv") {
+		err = c.JSON(http.StatusBadRequest, m.InventoryFormatInvalid)
+	} else if dryRun, err = boolParam(c, "dryrun"); err != nil {
+		err = c.JSON(http.StatusBadRequest, m.Msg{"dryrun": "true or false"})
+	} else if force, err = boolParam(c, "force"); err != nil {
+		err = c.JSON(http.StatusBadRequest, m.Msg{"force": "true or false"})
+	} else if data, err = ioutil.ReadAll(c.Request().Body); err != nil {
+		err = c.JSON(http.StatusBadRequest, m.InventoryFormatInvalid)
+	} else if sync {
+		err = c.JSON(business.SyncInventoryBusiness(data, format, dryRun, force, controller.Mux))
+	} else {
+		err = c.JSON(business.ImportInventoryBusiness(data, format, dryRun, controller.Mux))
+	}
+
+	return err
+}
+
+//boolParam parses an optional boolean query parameter
+func boolParam(c echo.Context, name string) (bool, error) {
+	var err error
+	var value bool
+
+	if param := c.QueryParam(name); param != "" {
+		value, err = strconv.ParseBool(param)
+	}
+
+	return value, err
+}
@@ -0,0 +1,233 @@
+package controller
+
+import (
+	"net/http"
+
+	"library/internal/app/business"
+	m "library/internal/app/models"
+	db "library/internal/pkg/dbutil"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+)
+
+// CreatePool godoc
+// @Summary Create a pool
+// @Description Creates a named pool of resources, listed statically and/or matched by a label selector. Sessions of the projects of the pool may check out its members whichever projects the resources are associated with, under the policy of the pool: the share of the pool each project may hold at once, the default checkout mode and the strategy picking among matching members
+// @Tags pool
+// @Accept json
+// @Produce json
+// @Param pool body models.PoolRequest true "Pool"
+// @Success 201 {object} models.Pool
+// @Failure 400 {object} models.Msg
+// @Failure 404 {object} models.Msg
+// @Failure 409 {object} models.Msg
+// @Failure 500 {object} models.Msg
+// @Router /pool [post]
+func (controller *Controller) CreatePool(c echo.Context) error {
+	var err error
+	requestData := &m.PoolRequest{}
+
+	//Validating the passed JSON structure
+	if err = c.Bind(requestData); err != nil {
+		err = c.JSON(http.StatusBadRequest, m.PoolValidateFailed)
+	} else {
+		err = c.JSON(business.CreatePoolBusiness(requestData, controller.Mux))
+	}
+
+	return err
+}
+
+// ShowAllPools godoc
+// @Summary Show all pools
+// @Description Returns a page of pools, sortable by _id, created_at, updated_at or name
+// @Tags pool
+// @Accept json
+// @Produce json
+// @Param limit query int false "Page size, 1-1000; defaults to 100"
+// @Param cursor query string false "Next cursor returned with the previous page"
+// @Param sort query string false "Sort key, prefixed with - for descending order"
+// @Param fields query string false "Comma-separated keys to include in each document"
+// @Param name query string false "Name prefix"
+// @Param project query string false "Project ObjectID"
+// @Success 200 {object} models.ListResponse
+// @Failure 400 {object} models.Msg
+// @Router /pool [get]
+func (controller *Controller) ShowAllPools(c echo.Context) error {
+	var err error
+	requestData := &m.ListRequest{}
+
+	if err = c.Bind(requestData); err != nil {
+		err = c.JSON(http.StatusBadRequest, m.ListRequestInvalid)
+	} else {
+		err = c.JSON(business.ShowAllPoolsBusiness(requestData))
+	}
+
+	return err
+}
+
+// ShowPool godoc
+// @Summary Show pool by ID
+// @Description Returns a single pool
+// @Tags pool
+// @Accept json
+// @Produce json
+// @Param id path string true "Pool ObjectID"
+// @Success 200 {object} models.Pool
+// @Header 200 {string} ETag "Entity tag of the document, derived from its revision"
+// @Failure 400 {object} models.Msg
+// @Failure 404 {object} models.Msg
+// @Router /pool/{id} [get]
+func (controller *Controller) ShowPool(c echo.Context) error {
+	var err error
+	id := c.Param("id")
+
+	//Verifying that the ObjectID contains 24 hexademical characters
+	if !db.VerifyObjectIDString(id) {
+		err = c.JSON(http.StatusBadRequest, m.InvalidID)
+	} else {
+		code, response := business.ShowPoolBusiness(id)
+		setETag(c, response)
+		err = c.JSON(code, response)
+	}
+
+	return err
+}
+
+// ShowPoolResources godoc
+// @Summary Show pool members
+// @Description Returns a page of the resources of a pool, static members and those matching its selector, with the paging and filters of the resource list
+// @Tags pool
+// @Accept json
+// @Produce json
+// @Param id path string true "Pool ObjectID"
+// @Param limit query int false "Page size, 1-1000; defaults to 100"
+// @Param cursor query string false "Next cursor returned with the previous page"
+// @Param sort query string false "Sort key, prefixed with - for descending order"
+// @Param fields query string false "Comma-separated keys to include in each document"
+// @Param name query string false "Name prefix"
+// @Param template query string false "Template ObjectID"
+// @Param project query string false "Project ObjectID"
+// @Param active query bool false "Active flag"
+// @Param checkedout query bool false "Whether the resource is checked out by any session"
+// @Param field query string false "Field key, or key:value"
+// @Param health query string false "Health state, healthy or quarantined"
+// @Param labels query string false "Label selector, e.g. os=android,region in (eu-west,eu-north),!broken"
+// @Param expand query string false "Comma-separated keys of reference-type fields to replace with the referenced resources"
+// @Success 200 {object} models.ListResponse
+// @Failure 400 {object} models.Msg
+// @Failure 404 {object} models.Msg
+// @Router /pool/{id}/resources [get]
+func (controller *Controller) ShowPoolResources(c echo.Context) error {
+	var err error
+	id := c.Param("id")
+	requestData := &m.ListRequest{}
+
+	//Verifying that the ObjectID contains 24 hexademical characters
+	if !db.VerifyObjectIDString(id) {
+		err = c.JSON(http.StatusBadRequest, m.InvalidID)
+	} else if err = c.Bind(requestData); err != nil {
+		err = c.JSON(http.StatusBadRequest, m.ListRequestInvalid)
+	} else {
+		err = c.JSON(business.ShowPoolResourcesBusiness(id, requestData, expandParam(c)))
+	}
+
+	return err
+}
+
+// UpdatePool godoc
+// @Summary Update pool contents
+// @Description Replaces the members, projects and policy of a pool. Sessions keep resources the change takes out of their reach until they check them in
+// @Tags pool
+// @Accept json
+// @Produce json
+// @Param id path string true "Pool ObjectID"
+// @Param pool body models.PoolRequest true "Pool"
+// @Param If-Match header string false "ETag of the document the change is based on; the request fails with 412 if the document has been modified since"
+// @Success 200 {object} models.Pool
+// @Header 200 {string} ETag "Entity tag of the document, derived from its revision"
+// @Failure 400 {object} models.Msg
+// @Failure 404 {object} models.Msg
+// @Failure 409 {object} models.Msg
+// @Failure 412 {object} models.Msg
+// @Failure 500 {object} models.Msg
+// @Router /pool/{id} [put]
+func (controller *Controller) UpdatePool(c echo.Context) error {
+	var err error
+	id := c.Param("id")
+	requestData := &m.PoolRequest{}
+
+	//Verifying that the ObjectID contains 24 hexademical characters
+	if !db.VerifyObjectIDString(id) {
+		err = c.JSON(http.StatusBadRequest, m.InvalidID)
+	} else if err = c.Bind(requestData); err != nil {
+		err = c.JSON(http.StatusBadRequest, m.PoolValidateFailed)
+	} else {
+		code, response := business.UpdatePoolBusiness(id, requestData, c.Request().Header.Get("If-Match"), controller.Mux)
+		setETag(c, response)
+		err = c.JSON(code, response)
+	}
+
+	return err
+}
+
+// DeletePool godoc
+// @Summary Delete pool by ID
+// @Description Deletes a pool, leaving its resources as they are
+// @Tags pool
+// @Accept json
+// @Produce json
+// @Param id path string true "Pool ObjectID"
+// @Param If-Match header string false "ETag of the document the change is based on; the request fails with 412 if the document has been modified since"
+// @Success 200 {object} models.Msg
+// @Failure 400 {object} models.Msg
+// @Failure 404 {object} models.Msg
+// @Failure 412 {object} models.Msg
+// @Failure 500 {object} models.Msg
+// @Router /pool/{id} [delete]
+func (controller *Controller) DeletePool(c echo.Context) error {
+	var err error
+	id := c.Param("id")
+
+	//Verifying that the ObjectID contains 24 hexademical characters
+	if !db.VerifyObjectIDString(id) {
+		err = c.JSON(http.StatusBadRequest, m.InvalidID)
+	} else {
+		err = c.JSON(business.DeletePoolBusiness(id, c.Request().Header.Get("If-Match"), controller.Mux))
+	}
+
+	return err
+}
+
+// PoolCheckout godoc
+// @Summary Check out any resource of a pool
+// @Description Checks out an available member of a pool matching an optional label selector, picked by the strategy of the pool, e.g. any Android 14 phone of the eu-lab pool. Exclusive checkouts only pick resources no session holds and keep other sessions from checking them out until they are checked in. Members reserved for another project are passed over; the project of the session has to be a project of the pool and hold less than its share of the pool
+// @Tags session
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer {token}"
+// @Param id path string true "Pool ObjectID"
+// @Param labels query string false "Label selector narrowing down the members of the pool"
+// @Param mode query string false "shared or exclusive; defaults to the mode of the pool"
+// @Param expand query string false "Comma-separated keys of reference-type fields to replace with the referenced resources"
+// @Success 200 {object} models.Resource
+// @Failure 400 {object} models.Msg
+// @Failure 403 {object} models.Msg
+// @Failure 404 {object} models.Msg
+// @Failure 409 {object} models.Msg
+// @Failure 500 {object} models.Msg
+// @Router /session/authorized/pool/{id}/checkout [put]
+func (controller *Controller) PoolCheckout(c echo.Context) error {
+	var err error
+	sessID := c.Get("user").(*jwt.Token).Claims.(jwt.MapClaims)["id"].(string)
+	poolID := c.Param("id")
+
+	//Verifying that the ObjectID contains 24 hexademical characters
+	if !db.VerifyObjectIDString(poolID) {
+		err = c.JSON(http.StatusBadRequest, m.InvalidID)
+	} else {
+		err = c.JSON(business.PoolCheckoutBusiness(sessID, poolID, c.QueryParam("labels"), c.QueryParam("mode"), expandParam(c), controller.Mux))
+	}
+
+	return err
+}
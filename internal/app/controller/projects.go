@@ -18,6 +18,7 @@ import (
 // @Produce json
 // @Param project body models.ProjectRequest true "Add new project"
 // @Success 201 {object} models.Project
+// @Header 201 {string} ETag "Entity tag of the document, derived from its revision"
 // @Failure 400 {object} models.ProjectRequest
 // @Failure 409 {object} models.Msg
 // @Failure 500 {object} models.Msg
@@ -30,7 +31,9 @@ func (controller *Controller) CreateProject(c echo.Context) error {
 	if err = c.Bind(requestData); err != nil {
 		err = c.JSON(http.StatusBadRequest, m.ProjectValidateFailed)
 	} else {
-		err = c.JSON(business.CreateProjectBusiness(requestData, controller.Mux))
+		code, response := business.CreateProjectBusiness(requestData, controller.Mux)
+		setETag(c, response)
+		err = c.JSON(code, response)
 	}
 
 	return err
@@ -38,15 +41,57 @@ func (controller *Controller) CreateProject(c echo.Context) error {
 
 // ShowAllProjects godoc
 // @Summary Show all projects
-// @Description Returns all projects stored in the database
+// @Description Returns a page of projects stored in the database, sortable by _id, created_at, updated_at or name
 // @Tags project
 // @Accept json
 // @Produce json
-// @Success 200 {object} models.Project
-// @Failure 404 {object} models.Msg
+// @Param limit query int false "Page size, 1-1000; defaults to 100"
+// @Param cursor query string false "Next cursor returned with the previous page"
+// @Param sort query string false "Sort key, prefixed with - for descending order"
+// @Param fields query string false "Comma-separated keys to include in each document"
+// @Param name query string false "Name prefix"
+// @Success 200 {object} models.ListResponse
+// @Failure 400 {object} models.Msg
 // @Router /project [get]
 func (controller *Controller) ShowAllProjects(c echo.Context) error {
-	return c.JSON(business.ShowAllProjectsBusiness())
+	var err error
+	requestData := &m.ListRequest{}
+
+	if err = c.Bind(requestData); err != nil {
+		err = c.JSON(http.StatusBadRequest, m.ListRequestInvalid)
+	} else {
+		err = c.JSON(business.ShowAllProjectsBusiness(requestData))
+	}
+
+	return err
+}
+
+// ShowProject godoc
+// @Summary Show project by ID
+// @Description Returns a single project
+// @Tags project
+// @Accept json
+// @Produce json
+// @Param id path string true "Project ObjectID"
+// @Success 200 {object} models.Project
+// @Header 200 {string} ETag "Entity tag of the document, derived from its revision"
+// @Failure 400 {object} models.Msg
+// @Failure 404 {object} models.Msg
+// @Router /project/{id} [get]
+func (controller *Controller) ShowProject(c echo.Context) error {
+	var err error
+	id := c.Param("id")
+
+	//Verifying that the ObjectID contains 24 hexademical characters
+	if !db.VerifyObjectIDString(id) {
+		err = c.JSON(http.StatusBadRequest, m.InvalidID)
+	} else {
+		code, response := business.ShowProjectBusiness(id)
+		setETag(c, response)
+		err = c.JSON(code, response)
+	}
+
+	return err
 }
 
 // UpdateAPIKey godoc
@@ -56,9 +101,12 @@ func (controller *Controller) ShowAllProjects(c echo.Context) error {
 // @Accept json
 // @Produce json
 // @Param id path string true "Project ObjectID"
+// @Param If-Match header string false "ETag of the document the change is based on; the request fails with 412 if the document has been modified since"
 // @Success 200 {object} models.Project
+// @Header 200 {string} ETag "Entity tag of the document, derived from its revision"
 // @Failure 400 {object} models.Msg
 // @Failure 404 {object} models.Msg
+// @Failure 412 {object} models.Msg
 // @Failure 500 {object} models.Msg
 // @Router /project/{id}/newkey [put]
 func (controller *Controller) UpdateAPIKey(c echo.Context) error {
@@ -69,7 +117,9 @@ func (controller *Controller) UpdateAPIKey(c echo.Context) error {
 	if !db.VerifyObjectIDString(id) {
 		err = c.JSON(http.StatusBadRequest, m.InvalidID)
 	} else {
-		err = c.JSON(business.UpdateAPIKeyBusiness(id, controller.Mux))
+		code, response := business.UpdateAPIKeyBusiness(id, c.Request().Header.Get("If-Match"), controller.Mux)
+		setETag(c, response)
+		err = c.JSON(code, response)
 	}
 
 	return err
@@ -83,10 +133,13 @@ func (controller *Controller) UpdateAPIKey(c echo.Context) error {
 // @Produce json
 // @Param id path string true "Project ObjectID"
 // @Param project body models.ProjectRequest true "Update project"
+// @Param If-Match header string false "ETag of the document the change is based on; the request fails with 412 if the document has been modified since"
 // @Success 200 {object} models.Project
+// @Header 200 {string} ETag "Entity tag of the document, derived from its revision"
 // @Failure 400 {object} models.ProjectRequest
 // @Failure 404 {object} models.Msg
 // @Failure 409 {object} models.Msg
+// @Failure 412 {object} models.Msg
 // @Failure 500 {object} models.Msg
 // @Router /project/{id} [put]
 func (controller *Controller) UpdateProject(c echo.Context) error {
@@ -102,13 +155,51 @@ func (controller *Controller) UpdateProject(c echo.Context) error {
 		if err = c.Bind(requestData); err != nil {
 			err = c.JSON(http.StatusBadRequest, m.ProjectValidateFailed)
 		} else {
-			err = c.JSON(business.UpdateProjectBusiness(id, requestData, controller.Mux))
+			code, response := business.UpdateProjectBusiness(id, requestData, c.Request().Header.Get("If-Match"), controller.Mux)
+			setETag(c, response)
+			err = c.JSON(code, response)
 		}
 	}
 
 	return err
 }
 
+// PatchProject godoc
+// @Summary Patch project contents
+// @Description Applies an RFC 7396 JSON merge patch to a project. Settings can be replaced as a list or patched by key with an object keyed by setting key; null removes a setting
+// @Tags project
+// @Accept json
+// @Produce json
+// @Param id path string true "Project ObjectID"
+// @Param patch body models.MergePatch true "JSON merge patch"
+// @Param If-Match header string false "ETag of the document the change is based on; the request fails with 412 if the document has been modified since"
+// @Success 200 {object} models.Project
+// @Header 200 {string} ETag "Entity tag of the document, derived from its revision"
+// @Failure 400 {object} models.Msg
+// @Failure 404 {object} models.Msg
+// @Failure 409 {object} models.Msg
+// @Failure 412 {object} models.Msg
+// @Failure 500 {object} models.Msg
+// @Router /project/{id} [patch]
+func (controller *Controller) PatchProject(c echo.Context) error {
+	var err error
+	var patch m.MergePatch
+	id := c.Param("id")
+
+	//Verifying that the ObjectID contains 24 hexademical characters
+	if !db.VerifyObjectIDString(id) {
+		err = c.JSON(http.StatusBadRequest, m.InvalidID)
+	} else if patch, err = bindMergePatch(c); err != nil {
+		err = c.JSON(http.StatusBadRequest, m.PatchInvalid)
+	} else {
+		code, response := business.PatchProjectBusiness(id, patch, c.Request().Header.Get("If-Match"), controller.Mux)
+		setETag(c, response)
+		err = c.JSON(code, response)
+	}
+
+	return err
+}
+
 // DeleteProject godoc
 // @Summary Delete project by ID
 // @Description Allows the user to delete a project using its ID. If some resource associated with the deleted resource has no other project associations, the resource is also deleted.
@@ -116,9 +207,11 @@ func (controller *Controller) UpdateProject(c echo.Context) error {
 // @Accept json
 // @Produce json
 // @Param id path string true "Project ObjectID"
+// @Param If-Match header string false "ETag of the document the change is based on; the request fails with 412 if the document has been modified since"
 // @Success 200 {object} models.Msg
 // @Failure 400 {object} models.Msg
 // @Failure 404 {object} models.Msg
+// @Failure 412 {object} models.Msg
 // @Failure 500 {object} models.Msg
 // @Router /project/{id} [delete]
 func (controller *Controller) DeleteProject(c echo.Context) error {
@@ -129,7 +222,7 @@ func (controller *Controller) DeleteProject(c echo.Context) error {
 	if !db.VerifyObjectIDString(id) {
 		err = c.JSON(http.StatusBadRequest, m.InvalidID)
 	} else {
-		err = c.JSON(business.DeleteProjectBusiness(id, controller.Mux))
+		err = c.JSON(business.DeleteProjectBusiness(id, c.Request().Header.Get("If-Match"), controller.Mux))
 	}
 
 	return err
@@ -0,0 +1,122 @@
+package controller
+
+import (
+	"net/http"
+	"strings"
+
+	"library/internal/app/business"
+	m "library/internal/app/models"
+	db "library/internal/pkg/dbutil"
+	"library/internal/pkg/lockutil"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/labstack/echo/v4"
+)
+
+// ReportResource godoc
+// @Summary Report a resource as faulty
+// @Description Quarantines a resource checked out by the session, e.g. a broken device or a locked out account, recording the reason in its quarantine history. Quarantined resources cannot be checked out until an operator restores them; the session keeps the resource until it checks it in
+// @Tags session
+// @Accept json
+// @Produce json
+// @Param Authorization header string true "Bearer {token}"
+// @Param id path string true "Resource ObjectID"
+// @Param report body models.QuarantineRequest true "Reason"
+// @Success 200 {object} models.Resource
+// @Failure 400 {object} models.Msg
+// @Failure 401 {object} models.Msg
+// @Failure 404 {object} models.Msg
+// @Failure 500 {object} models.Msg
+// @Router /session/authorized/report/{id} [post]
+func (controller *Controller) ReportResource(c echo.Context) error {
+	var err error
+	sessID := c.Get("user").(*jwt.Token).Claims.(jwt.MapClaims)["id"].(string)
+	resID := c.Param("id")
+	requestData := &m.QuarantineRequest{}
+
+	//Verifying that the ObjectID contains 24 hexademical characters
+	if !db.VerifyObjectIDString(resID) {
+		err = c.JSON(http.StatusBadRequest, m.InvalidID)
+	} else if err = c.Bind(requestData); err != nil || strings.TrimSpace(requestData.Note) == "" {
+		err = c.JSON(http.StatusBadRequest, m.QuarantineValidateFailed)
+	} else {
+		code, response := business.ReportResourceBusiness(sessID, resID, requestData, controller.Mux)
+		setETag(c, response)
+		err = c.JSON(code, response)
+	}
+
+	return err
+}
+
+// QuarantineResource godoc
+// @Summary Quarantine a resource
+// @Description Takes a resource out of rotation with a reason recorded in its quarantine history. Quarantined resources cannot be checked out; sessions holding the resource keep it until they check it in
+// @Tags resource
+// @Accept json
+// @Produce json
+// @Param id path string true "Resource ObjectID"
+// @Param quarantine body models.QuarantineRequest true "Reason"
+// @Success 200 {object} models.Resource
+// @Failure 400 {object} models.Msg
+// @Failure 404 {object} models.Msg
+// @Failure 500 {object} models.Msg
+// @Router /resource/{id}/quarantine [post]
+func (controller *Controller) QuarantineResource(c echo.Context) error {
+	return controller.quarantineAction(c, true, business.QuarantineResourceBusiness)
+}
+
+// AnnotateResource godoc
+// @Summary Annotate a quarantined resource
+// @Description Adds a note to the quarantine history of a quarantined resource, e.g. findings of its review
+// @Tags resource
+// @Accept json
+// @Produce json
+// @Param id path string true "Resource ObjectID"
+// @Param annotation body models.QuarantineRequest true "Note"
+// @Success 200 {object} models.Resource
+// @Failure 400 {object} models.Msg
+// @Failure 404 {object} models.Msg
+// @Failure 409 {object} models.Msg
+// @Failure 500 {object} models.Msg
+// @Router /resource/{id}/annotate [post]
+func (controller *Controller) AnnotateResource(c echo.Context) error {
+	return controller.quarantineAction(c, true, business.AnnotateResourceBusiness)
+}
+
+// RestoreResource godoc
+// @Summary Restore a quarantined resource
+// @Description Puts a quarantined resource back into rotation, recording the restoration and an optional note in its quarantine history
+// @Tags resource
+// @Accept json
+// @Produce json
+// @Param id path string true "Resource ObjectID"
+// @Param restoration body models.QuarantineRequest false "Note"
+// @Success 200 {object} models.Resource
+// @Failure 400 {object} models.Msg
+// @Failure 404 {object} models.Msg
+// @Failure 409 {object} models.Msg
+// @Failure 500 {object} models.Msg
+// @Router /resource/{id}/restore [post]
+func (controller *Controller) RestoreResource(c echo.Context) error {
+	return controller.quarantineAction(c, false, business.RestoreResourceBusiness)
+}
+
+//quarantineAction validates a quarantine request of an operator and passes it on to the business function of the action
+func (controller *Controller) quarantineAction(c echo.Context, noteRequired bool, action func(string, *m.QuarantineRequest, *lockutil.Locks) (int, interface{})) error {
+	var err error
+	resID := c.Param("id")
+	requestData := &m.QuarantineRequest{}
+
+	//Verifying that the ObjectID contains 24 hexademical characters
+	if !db.VerifyObjectIDString(resID) {
+		err = c.JSON(http.StatusBadRequest, m.InvalidID)
+	} else if err = c.Bind(requestData); err != nil || (noteRequired && strings.TrimSpace(requestData.Note) == "") {
+		err = c.JSON(http.StatusBadRequest, m.QuarantineValidateFailed)
+	} else {
+		code, response := action(resID, requestData, controller.Mux)
+		setETag(c, response)
+		err = c.JSON(code, response)
+	}
+
+	return err
+}
@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"net/http"
+
+	"library/internal/app/business"
+	m "library/internal/app/models"
+	db "library/internal/pkg/dbutil"
+
+	"github.com/labstack/echo/v4"
+)
+
+// CreateReservation godoc
+// @Summary Reserve a resource
+// @Description Reserves a resource for a project during a window. While the window lasts, sessions of other projects cannot check out the resource, and those holding it when the window starts have it checked in. Windows of a resource cannot overlap
+// @Tags reservation
+// @Accept json
+// @Produce json
+// @Param reservation body models.ReservationRequest true "Resource, project and window"
+// @Success 201 {object} models.Reservation
+// @Failure 400 {object} models.Msg
+// @Failure 404 {object} models.Msg
+// @Failure 409 {object} models.Msg
+// @Failure 500 {object} models.Msg
+// @Router /reservation [post]
+func (controller *Controller) CreateReservation(c echo.Context) error {
+	var err error
+	requestData := &m.ReservationRequest{}
+
+	//Validating the passed JSON structure
+	if err = c.Bind(requestData); err != nil {
+		err = c.JSON(http.StatusBadRequest, m.ReservationValidateFailed)
+	} else {
+		err = c.JSON(business.CreateReservationBusiness(requestData, controller.Mux))
+	}
+
+	return err
+}
+
+// ShowAllReservations godoc
+// @Summary Show all reservations
+// @Description Returns a page of reservations, sortable by _id, created_at, updated_at, start, end, resourceid or project
+// @Tags reservation
+// @Accept json
+// @Produce json
+// @Param limit query int false "Page size, 1-1000; defaults to 100"
+// @Param cursor query string false "Next cursor returned with the previous page"
+// @Param sort query string false "Sort key, prefixed with - for descending order"
+// @Param fields query string false "Comma-separated keys to include in each document"
+// @Param project query string false "Project ObjectID"
+// @Success 200 {object} models.ListResponse
+// @Failure 400 {object} models.Msg
+// @Router /reservation [get]
+func (controller *Controller) ShowAllReservations(c echo.Context) error {
+	var err error
+	requestData := &m.ListRequest{}
+
+	if err = c.Bind(requestData); err != nil {
+		err = c.JSON(http.StatusBadRequest, m.ListRequestInvalid)
+	} else {
+		err = c.JSON(business.ShowAllReservationsBusiness(requestData))
+	}
+
+	return err
+}
+
+// ShowCalendar godoc
+// @Summary Show the reservation calendar
+// @Description Returns resources by name with their reservations overlapping a time range, including resources without any, so that free windows can be found
+// @Tags reservation
+// @Accept json
+// @Produce json
+// @Param from query string false "Start of the range, RFC 3339; defaults to now"
+// @Param to query string false "End of the range, RFC 3339; defaults to a week after its start"
+// @Param resource query string false "Resource ObjectID"
+// @Param template query string false "Template ObjectID"
+// @Param project query string false "Project ObjectID"
+// @Success 200 {object} models.Calendar
+// @Failure 400 {object} models.Msg
+// @Failure 500 {object} models.Msg
+// @Router /reservation/calendar [get]
+func (controller *Controller) ShowCalendar(c echo.Context) error {
+	var err error
+	requestData := &m.CalendarRequest{}
+
+	if err = c.Bind(requestData); err != nil {
+		err = c.JSON(http.StatusBadRequest, m.CalendarRequestInvalid)
+	} else {
+		err = c.JSON(business.CalendarBusiness(requestData))
+	}
+
+	return err
+}
+
+// ShowReservation godoc
+// @Summary Show reservation by ID
+// @Description Returns a single reservation
+// @Tags reservation
+// @Accept json
+// @Produce json
+// @Param id path string true "Reservation ObjectID"
+// @Success 200 {object} models.Reservation
+// @Failure 400 {object} models.Msg
+// @Failure 404 {object} models.Msg
+// @Router /reservation/{id} [get]
+func (controller *Controller) ShowReservation(c echo.Context) error {
+	var err error
+	id := c.Param("id")
+
+	//Verifying that the ObjectID contains 24 hexademical characters
+	if !db.VerifyObjectIDString(id) {
+		err = c.JSON(http.StatusBadRequest, m.InvalidID)
+	} else {
+		err = c.JSON(business.ShowReservationBusiness(id))
+	}
+
+	return err
+}
+
+// DeleteReservation godoc
+// @Summary Cancel a reservation
+// @Description Deletes a reservation, including one whose window has started
+// @Tags reservation
+// @Accept json
+// @Produce json
+// @Param id path string true "Reservation ObjectID"
+// @Success 200 {object} models.Msg
+// @Failure 400 {object} models.Msg
+// @Failure 404 {object} models.Msg
+// @Failure 500 {object} models.Msg
+// @Router /reservation/{id} [delete]
+func (controller *Controller) DeleteReservation(c echo.Context) error {
+	var err error
+	id := c.Param("id")
+
+	//Verifying that the ObjectID contains 24 hexademical characters
+	if !db.VerifyObjectIDString(id) {
+		err = c.JSON(http.StatusBadRequest, m.InvalidID)
+	} else {
+		err = c.JSON(business.DeleteReservationBusiness(id, controller.Mux))
+	}
+
+	return err
+}
@@ -11,12 +11,13 @@ import (
 
 // CreateResource godoc
 // @Summary Create a new resource
-// @Description Create a new resource with a passed json
+// @Description Create a new resource with a passed json. Reference-type fields take the ID of a resource built from the field's target template
 // @Tags resource
 // @Accept json
 // @Produce json
 // @Param resource body models.ResourceRequest true "Add resource"
 // @Success 201 {object} models.Resource
+// @Header 201 {string} ETag "Entity tag of the document, derived from its revision"
 // @Failure 400 {object} models.Msg
 // @Failure 409 {object} models.Msg
 // @Failure 500 {object} models.Msg
@@ -29,7 +30,9 @@ func (controller *Controller) CreateResource(c echo.Context) error {
 	if err = c.Bind(requestData); err != nil {
 		err = c.JSON(http.StatusBadRequest, m.ResourceValidateFailed)
 	} else {
-		err = c.JSON(business.CreateResourceBusiness(requestData, controller.Mux))
+		code, response := business.CreateResourceBusiness(requestData, controller.Mux)
+		setETag(c, response)
+		err = c.JSON(code, response)
 	}
 
 	return err
@@ -37,37 +40,113 @@ func (controller *Controller) CreateResource(c echo.Context) error {
 
 // ShowAllResources godoc
 // @Summary Show all resources
-// @Description Returns all resources stored in the database
+// @Description Returns a page of resources stored in the database, sortable by _id, created_at, updated_at, name or checkedout
 // @Tags resource
 // @Accept json
 // @Produce json
-// @Success 200 {object} models.Resource
-// @Failure 404 {object} models.Msg
+// @Param limit query int false "Page size, 1-1000; defaults to 100"
+// @Param cursor query string false "Next cursor returned with the previous page"
+// @Param sort query string false "Sort key, prefixed with - for descending order"
+// @Param fields query string false "Comma-separated keys to include in each document"
+// @Param name query string false "Name prefix"
+// @Param template query string false "Template ObjectID"
+// @Param project query string false "Project ObjectID"
+// @Param active query bool false "Active flag"
+// @Param checkedout query bool false "Whether the resource is checked out by any session"
+// @Param field query string false "Field key, or key:value"
+// @Param health query string false "Health state, healthy or quarantined"
+// @Param labels query string false "Label selector, e.g. os=android,region in (eu-west,eu-north),!broken"
+// @Param expand query string false "Comma-separated keys of reference-type fields to replace with the referenced resources"
+// @Success 200 {object} models.ListResponse
+// @Failure 400 {object} models.Msg
 // @Router /resource [get]
 func (controller *Controller) ShowAllResources(c echo.Context) error {
-	return c.JSON(business.ShowAllResourcesBusiness())
+	var err error
+	requestData := &m.ListRequest{}
+
+	if err = c.Bind(requestData); err != nil {
+		err = c.JSON(http.StatusBadRequest, m.ListRequestInvalid)
+	} else {
+		err = c.JSON(business.ShowAllResourcesBusiness(requestData, expandParam(c)))
+	}
+
+	return err
 }
 
-// ShowResourcesByPrj godoc
-// @Summary Show project resources
-// @Description Returns all resources associated with a particular project stored in the database
+// ShowResource godoc
+// @Summary Show resource by ID
+// @Description Returns a single resource. Deprecated: when no resource exists under the ID but a project does, the resources associated with the project are returned as they were before GET /project/{id}/resources was introduced, with a Deprecation header
 // @Tags resource
 // @Accept json
 // @Produce json
-// @Param id path string true "Project ObjectID"
+// @Param id path string true "Resource ObjectID"
+// @Param expand query string false "Comma-separated keys of reference-type fields to replace with the referenced resources"
 // @Success 200 {object} models.Resource
+// @Header 200 {string} ETag "Entity tag of the document, derived from its revision"
 // @Failure 400 {object} models.Msg
 // @Failure 404 {object} models.Msg
 // @Router /resource/{id} [get]
+func (controller *Controller) ShowResource(c echo.Context) error {
+	var err error
+	id := c.Param("id")
+
+	//Verifying that the ObjectID contains 24 hexademical characters
+	if !db.VerifyObjectIDString(id) {
+		err = c.JSON(http.StatusBadRequest, m.InvalidID)
+	} else {
+		code, response := business.ShowResourceBusiness(id, expandParam(c))
+
+		//The route used to list resources by project ID, kept as an alias until clients move over
+		if code == http.StatusNotFound && business.ProjectExistsBusiness(id) {
+			c.Response().Header().Set("Deprecation", "true")
+			c.Response().Header().Set("Link", "</v1/project/"+id+"/resources>; rel=\"successor-version\"")
+
+			//All of the resources are returned, as before pagination
+			code, response = business.ShowAllResourcesByPrjBusiness(id, expandParam(c), controller.Mux)
+		}
+
+		setETag(c, response)
+		err = c.JSON(code, response)
+	}
+
+	return err
+}
+
+// ShowResourcesByPrj godoc
+// @Summary Show project resources
+// @Description Returns a page of resources associated with a particular project stored in the database, with the same paging and filters as the resource list
+// @Tags project
+// @Accept json
+// @Produce json
+// @Param id path string true "Project ObjectID"
+// @Param limit query int false "Page size, 1-1000; defaults to 100"
+// @Param cursor query string false "Next cursor returned with the previous page"
+// @Param sort query string false "Sort key, prefixed with - for descending order"
+// @Param fields query string false "Comma-separated keys to include in each document"
+// @Param name query string false "Name prefix"
+// @Param template query string false "Template ObjectID"
+// @Param active query bool false "Active flag"
+// @Param checkedout query bool false "Whether the resource is checked out by any session"
+// @Param field query string false "Field key, or key:value"
+// @Param health query string false "Health state, healthy or quarantined"
+// @Param labels query string false "Label selector, e.g. os=android,region in (eu-west,eu-north),!broken"
+// @Param expand query string false "Comma-separated keys of reference-type fields to replace with the referenced resources"
+// @Success 200 {object} models.ListResponse
+// @Failure 400 {object} models.Msg
+// @Failure 404 {object} models.Msg
+// @Router /project/{id}/resources [get]
 func (controller *Controller) ShowResourcesByPrj(c echo.Context) error {
 	var err error
 	projID := c.Param("id")
+	requestData := &m.ListRequest{}
 
 	//Verifying that the ObjectID contains 24 hexademical characters
 	if !db.VerifyObjectIDString(projID) {
 		err = c.JSON(http.StatusBadRequest, m.InvalidID)
+	} else if err = c.Bind(requestData); err != nil {
+		err = c.JSON(http.StatusBadRequest, m.ListRequestInvalid)
 	} else {
-		err = c.JSON(business.ShowResourcesByPrjBusiness(projID, controller.Mux))
+		err = c.JSON(business.ShowResourcesByPrjBusiness(projID, requestData, expandParam(c), controller.Mux))
 	}
 
 	return err
@@ -75,14 +154,17 @@ func (controller *Controller) ShowResourcesByPrj(c echo.Context) error {
 
 // DeleteResource godoc
 // @Summary Delete resource by ID
-// @Description Allows the user to delete a resource using its ID
+// @Description Allows the user to delete a resource using its ID. Resources referenced by reference-type fields of other resources can't be deleted
 // @Tags resource
 // @Accept json
 // @Produce json
 // @Param id path string true "Resource ObjectID"
+// @Param If-Match header string false "ETag of the document the change is based on; the request fails with 412 if the document has been modified since"
 // @Success 200 {object} models.Msg
 // @Failure 400 {object} models.Msg
 // @Failure 404 {object} models.Msg
+// @Failure 409 {object} models.ResourceReferrers
+// @Failure 412 {object} models.Msg
 // @Failure 500 {object} models.Msg
 // @Router /resource/{id} [delete]
 func (controller *Controller) DeleteResource(c echo.Context) error {
@@ -92,7 +174,7 @@ func (controller *Controller) DeleteResource(c echo.Context) error {
 	if !db.VerifyObjectIDString(resID) {
 		err = c.JSON(http.StatusBadRequest, m.InvalidID)
 	} else {
-		err = c.JSON(business.DeleteResourceBusiness(resID, controller.Mux))
+		err = c.JSON(business.DeleteResourceBusiness(resID, c.Request().Header.Get("If-Match"), controller.Mux))
 	}
 
 	return err
@@ -106,10 +188,13 @@ func (controller *Controller) DeleteResource(c echo.Context) error {
 // @Produce json
 // @Param id path string true "Resource ObjectID"
 // @Param resource body models.ResourceUpdateRequest true "Update resource"
+// @Param If-Match header string false "ETag of the document the change is based on; the request fails with 412 if the document has been modified since"
 // @Success 200 {object} models.Resource
+// @Header 200 {string} ETag "Entity tag of the document, derived from its revision"
 // @Failure 400 {object} models.Msg
 // @Failure 404 {object} models.Msg
 // @Failure 409 {object} models.Msg
+// @Failure 412 {object} models.Msg
 // @Failure 500 {object} models.Msg
 // @Router /resource/{id} [put]
 func (controller *Controller) UpdateResource(c echo.Context) error {
@@ -125,9 +210,82 @@ func (controller *Controller) UpdateResource(c echo.Context) error {
 		if err = c.Bind(requestData); err != nil {
 			err = c.JSON(http.StatusBadRequest, m.ResourceValidateFailed)
 		} else {
-			err = c.JSON(business.UpdateResourceBusiness(resID, requestData, controller.Mux))
+			code, response := business.UpdateResourceBusiness(resID, requestData, c.Request().Header.Get("If-Match"), controller.Mux)
+			setETag(c, response)
+			err = c.JSON(code, response)
 		}
 	}
 
 	return err
 }
+
+// LabelResource godoc
+// @Summary Edit resource labels
+// @Description Applies a merge patch of label keys to values, where null removes a label, e.g. {"region": "eu-west", "shelf": null}. Labels are edited apart from the template-defined fields, also while the resource is checked out
+// @Tags resource
+// @Accept json
+// @Produce json
+// @Param id path string true "Resource ObjectID"
+// @Param labels body models.MergePatch true "Label keys to values or null"
+// @Param If-Match header string false "ETag of the document the change is based on; the request fails with 412 if the document has been modified since"
+// @Success 200 {object} models.Resource
+// @Header 200 {string} ETag "Entity tag of the document, derived from its revision"
+// @Failure 400 {object} models.Msg
+// @Failure 404 {object} models.Msg
+// @Failure 412 {object} models.Msg
+// @Failure 500 {object} models.Msg
+// @Router /resource/{id}/labels [patch]
+func (controller *Controller) LabelResource(c echo.Context) error {
+	var err error
+	var patch m.MergePatch
+	resID := c.Param("id")
+
+	//Verifying that the ObjectID contains 24 hexadecimal characters
+	if !db.VerifyObjectIDString(resID) {
+		err = c.JSON(http.StatusBadRequest, m.InvalidID)
+	} else if patch, err = bindMergePatch(c); err != nil {
+		err = c.JSON(http.StatusBadRequest, m.LabelsValidateFailed)
+	} else {
+		code, response := business.LabelResourceBusiness(resID, patch, c.Request().Header.Get("If-Match"), controller.Mux)
+		setETag(c, response)
+		err = c.JSON(code, response)
+	}
+
+	return err
+}
+
+// PatchResource godoc
+// @Summary Patch resource contents
+// @Description Applies an RFC 7396 JSON merge patch to a resource. Field values can be updated by key, e.g. {"fields": {"os": {"value": "android"}}}, without re-sending the other fields. The patched resource is validated like a full update
+// @Tags resource
+// @Accept json
+// @Produce json
+// @Param id path string true "Resource ObjectID"
+// @Param patch body models.MergePatch true "JSON merge patch"
+// @Param If-Match header string false "ETag of the document the change is based on; the request fails with 412 if the document has been modified since"
+// @Success 200 {object} models.Resource
+// @Header 200 {string} ETag "Entity tag of the document, derived from its revision"
+// @Failure 400 {object} models.Msg
+// @Failure 404 {object} models.Msg
+// @Failure 409 {object} models.Msg
+// @Failure 412 {object} models.Msg
+// @Failure 500 {object} models.Msg
+// @Router /resource/{id} [patch]
+func (controller *Controller) PatchResource(c echo.Context) error {
+	var err error
+	var patch m.MergePatch
+	resID := c.Param("id")
+
+	//Verifying that the ObjectID contains 24 hexadecimal characters
+	if !db.VerifyObjectIDString(resID) {
+		err = c.JSON(http.StatusBadRequest, m.InvalidID)
+	} else if patch, err = bindMergePatch(c); err != nil {
+		err = c.JSON(http.StatusBadRequest, m.PatchInvalid)
+	} else {
+		code, response := business.PatchResourceBusiness(resID, patch, c.Request().Header.Get("If-Match"), controller.Mux)
+		setETag(c, response)
+		err = c.JSON(code, response)
+	}
+
+	return err
+}
@@ -12,7 +12,7 @@ import (
 
 // CreateSession godoc
 // @Summary Start a new session
-// @Description Initiates a new session using a project-specific API key and assigns a JWT token to the session
+// @Description Initiates a new session using a project-specific API key and assigns a JWT token to the session. Optional metadata, such as the CI job URL, runner hostname, owner, commit and labels, is kept on the session to tell who holds its resources
 // @Tags session
 // @Accept json
 // @Produce json
@@ -29,7 +29,7 @@ func (controller *Controller) CreateSession(c echo.Context) error {
 	if err = c.Bind(requestData); err != nil {
 		err = c.JSON(http.StatusBadRequest, m.SessionValidateFailed)
 	} else {
-		err = c.JSON(business.CreateSessionBusiness(requestData, controller.DefSessExt, controller.SigningKey, controller.Scheduler, controller.Mux))
+		err = c.JSON(business.CreateSessionBusiness(requestData, controller.DefSessExt, controller.SigningKey, controller.Mux))
 	}
 
 	return err
@@ -37,15 +37,62 @@ func (controller *Controller) CreateSession(c echo.Context) error {
 
 // ShowAllSessions godoc
 // @Summary Show all sessions
-// @Description Returns a list of all ongoing sessions
+// @Description Returns a page of ongoing sessions, sortable by _id, created_at, updated_at, project, metadata.owner or metadata.runner
 // @Tags session
 // @Accept json
 // @Produce json
-// @Success 200 {object} models.Session
-// @Failure 404 {object} models.Msg
+// @Param limit query int false "Page size, 1-1000; defaults to 100"
+// @Param cursor query string false "Next cursor returned with the previous page"
+// @Param sort query string false "Sort key, prefixed with - for descending order"
+// @Param fields query string false "Comma-separated keys to include in each document"
+// @Param project query string false "Project ObjectID"
+// @Param owner query string false "Owner of the session"
+// @Param runner query string false "Runner hostname"
+// @Param commit query string false "Commit prefix"
+// @Param job query string false "CI job URL prefix"
+// @Param labels query string false "Label selector matched against the metadata labels, e.g. pipeline=nightly,!manual"
+// @Success 200 {object} models.ListResponse
+// @Failure 400 {object} models.Msg
 // @Router /session [get]
 func (controller *Controller) ShowAllSessions(c echo.Context) error {
-	return c.JSON(business.ShowAllSessionsBusiness())
+	var err error
+	requestData := &m.ListRequest{}
+
+	if err = c.Bind(requestData); err != nil {
+		err = c.JSON(http.StatusBadRequest, m.ListRequestInvalid)
+	} else {
+		err = c.JSON(business.ShowAllSessionsBusiness(requestData))
+	}
+
+	return err
+}
+
+// ShowSession godoc
+// @Summary Show session by ID
+// @Description Returns a single ongoing session
+// @Tags session
+// @Accept json
+// @Produce json
+// @Param id path string true "Session ObjectID"
+// @Success 200 {object} models.Session
+// @Header 200 {string} ETag "Entity tag of the document, derived from its revision"
+// @Failure 400 {object} models.Msg
+// @Failure 404 {object} models.Msg
+// @Router /session/{id} [get]
+func (controller *Controller) ShowSession(c echo.Context) error {
+	var err error
+	id := c.Param("id")
+
+	//Verifying that the ObjectID contains 24 hexademical characters
+	if !db.VerifyObjectIDString(id) {
+		err = c.JSON(http.StatusBadRequest, m.InvalidID)
+	} else {
+		code, response := business.ShowSessionBusiness(id)
+		setETag(c, response)
+		err = c.JSON(code, response)
+	}
+
+	return err
 }
 
 // RenewSession godoc
@@ -59,58 +106,122 @@ func (controller *Controller) ShowAllSessions(c echo.Context) error {
 // @Failure 400 {object} models.Msg
 // @Failure 401 {object} models.Msg
 // @Failure 404 {object} models.Msg
+// @Failure 500 {object} models.Msg
 // @Router /session/authorized [put]
 func (controller *Controller) RenewSession(c echo.Context) error {
 	token := c.Get("user").(*jwt.Token)
 
-	return c.JSON(business.RenewSessionBusiness(token, controller.DefSessExt, controller.SigningKey, controller.Scheduler, controller.Mux))
+	return c.JSON(business.RenewSessionBusiness(token, controller.DefSessExt, controller.SigningKey, controller.Mux))
 }
 
 // CloseSessionByToken godoc
 // @Summary Terminate a session with a bearer token
-// @Description Terminates a running session and releases associated resources. Meant to be used by the test suite to terminate the session. Authorized with a bearer token.
+// @Description Terminates a running session, releases associated resources and moves the session to the session history with the reason explicit. Meant to be used by the test suite to terminate the session. Authorized with a bearer token. Returns a summary of the session: each checkout with its checkout and checkin times, subresources consumed and released per key, the duration in seconds and the number of renewals
 // @Tags session
 // @Accept json
 // @Produce json
 // @Param Authorization header string true "Bearer {token}"
-// @Success 200 {object} models.Msg
+// @Success 200 {object} models.SessionClosed
 // @Failure 401 {object} models.Msg
 // @Failure 404 {object} models.Msg
 // @Router /session/authorized [delete]
 func (controller *Controller) CloseSessionByToken(c echo.Context) error {
 	sessID := c.Get("user").(*jwt.Token).Claims.(jwt.MapClaims)["id"].(string)
 
-	return c.JSON(business.CloseSessionBusiness(sessID, controller.Scheduler, controller.Mux))
+	return c.JSON(business.CloseSessionBusiness(sessID, m.CloseExplicit, controller.Mux))
 }
 
 // CloseSessionByID godoc
 // @Summary Terminate a session by session id
-// @Description Terminates a running session and releases associated resources. Meant to be used by a human operator with foreknowledge of the session ID within the database.
+// @Description Terminates a running session, releases associated resources and moves the session to the session history with the reason admin. Meant to be used by a human operator with foreknowledge of the session ID within the database. Returns a summary of the session
 // @Tags session
 // @Accept json
 // @Produce json
 // @Param id path string true "Session ObjectID"
-// @Success 200 {object} models.Msg
+// @Success 200 {object} models.SessionClosed
 // @Failure 400 {object} models.Msg
 // @Failure 404 {object} models.Msg
 // @Router /session/{id} [delete]
 func (controller *Controller) CloseSessionByID(c echo.Context) error {
 	sessID := c.Param("id")
 
-	return c.JSON(business.CloseSessionBusiness(sessID, controller.Scheduler, controller.Mux))
+	return c.JSON(business.CloseSessionBusiness(sessID, m.CloseAdmin, controller.Mux))
+}
+
+// ShowSessionHistory godoc
+// @Summary Show closed sessions
+// @Description Returns a page of closed sessions with the resources and subresources they held when they were closed, their start, last renewal and close times, and why they were closed: explicit, expired, admin, or lease lost for sessions whose token ran out while no server was running. Sortable by _id, created_at, updated_at, closed, started, project, reason or metadata.owner
+// @Tags session
+// @Accept json
+// @Produce json
+// @Param limit query int false "Page size, 1-1000; defaults to 100"
+// @Param cursor query string false "Next cursor returned with the previous page"
+// @Param sort query string false "Sort key, prefixed with - for descending order"
+// @Param fields query string false "Comma-separated keys to include in each document"
+// @Param project query string false "Project ObjectID"
+// @Param owner query string false "Owner of the session"
+// @Param runner query string false "Runner hostname"
+// @Param commit query string false "Commit prefix"
+// @Param job query string false "CI job URL prefix"
+// @Param labels query string false "Label selector matched against the metadata labels"
+// @Param reason query string false "Close reason"
+// @Param resource query string false "Resource ObjectID the session held when it was closed"
+// @Param from query string false "Closed at or after, RFC 3339"
+// @Param to query string false "Closed before, RFC 3339"
+// @Success 200 {object} models.ListResponse
+// @Failure 400 {object} models.Msg
+// @Router /session/history [get]
+func (controller *Controller) ShowSessionHistory(c echo.Context) error {
+	var err error
+	requestData := &m.ListRequest{}
+
+	if err = c.Bind(requestData); err != nil {
+		err = c.JSON(http.StatusBadRequest, m.ListRequestInvalid)
+	} else {
+		err = c.JSON(business.ShowSessionHistoryBusiness(requestData))
+	}
+
+	return err
+}
+
+// ShowClosedSession godoc
+// @Summary Show closed session by ID
+// @Description Returns the history entry of a closed session, looked up by the id the session had while running
+// @Tags session
+// @Accept json
+// @Produce json
+// @Param id path string true "Session ObjectID"
+// @Success 200 {object} models.ClosedSession
+// @Failure 400 {object} models.Msg
+// @Failure 404 {object} models.Msg
+// @Router /session/history/{id} [get]
+func (controller *Controller) ShowClosedSession(c echo.Context) error {
+	var err error
+	id := c.Param("id")
+
+	//Verifying that the ObjectID contains 24 hexademical characters
+	if !db.VerifyObjectIDString(id) {
+		err = c.JSON(http.StatusBadRequest, m.InvalidID)
+	} else {
+		err = c.JSON(business.ShowClosedSessionBusiness(id))
+	}
+
+	return err
 }
 
 // SessionResCheckout godoc
 // @Summary Check out a resource
-// @Description Checks out a resource and returns its information to the caller
+// @Description Checks out a resource and returns its information to the caller. Resources referenced by reference-type fields flagged for checkout are checked out together with it, and checked in with it. Only active resources associated with the project of the session, members of pools of the project, or resources lent to the session by an operator can be checked out; quarantined resources, resources checked out exclusively by another session, and resources reserved for another project at the time, cannot be checked out
 // @Tags session
 // @Accept json
 // @Produce json
 // @Param Authorization header string true "Bearer {token}"
 // @Param id path string true "Resource ObjectID"
+// @Param expand query string false "Comma-separated keys of reference-type fields to replace with the referenced resources"
 // @Success 200 {object} models.Resource
 // @Failure 400 {object} models.Msg
 // @Failure 404 {object} models.Msg
+// @Failure 403 {object} models.Msg
 // @Failure 409 {object} models.Msg
 // @Failure 500 {object} models.Msg
 // @Router /session/authorized/checkout/{id} [put]
@@ -123,7 +234,7 @@ func (controller *Controller) SessionResCheckout(c echo.Context) error {
 	if !db.VerifyObjectIDString(resID) {
 		err = c.JSON(http.StatusBadRequest, m.InvalidID)
 	} else {
-		err = c.JSON(business.SessionResCheckoutBusiness(resID, sessID, controller.Mux))
+		err = c.JSON(business.SessionResCheckoutBusiness(resID, sessID, expandParam(c), controller.Mux))
 	}
 
 	return err
@@ -159,7 +270,7 @@ func (controller *Controller) SessionResCheckin(c echo.Context) error {
 
 // ConsumeSubResource godoc
 // @Summary Consume a subresource
-// @Description Consumes a subresource belonging to a checked out resource
+// @Description Consumes a subresource belonging to a checked out resource. The resource has to be active, and associated with the project of the session or lent to the session
 // @Tags session
 // @Accept json
 // @Produce json
@@ -170,6 +281,7 @@ func (controller *Controller) SessionResCheckin(c echo.Context) error {
 // @Failure 400 {object} models.Msg
 // @Failure 401 {object} models.Msg
 // @Failure 404 {object} models.Msg
+// @Failure 403 {object} models.Msg
 // @Failure 409 {object} models.Msg
 // @Failure 500 {object} models.Msg
 // @Router /session/authorized/checkout/{id}/{key} [put]
@@ -217,3 +329,59 @@ func (controller *Controller) ReleaseSubResource(c echo.Context) error {
 
 	return err
 }
+
+// LendResource godoc
+// @Summary Lend a resource to a session
+// @Description Allows a session to check out a resource which is not associated with its project, and to consume its subresources. Meant to be used by a human operator to let a test suite borrow a resource of another project
+// @Tags session
+// @Accept json
+// @Produce json
+// @Param id path string true "Session ObjectID"
+// @Param resid path string true "Resource ObjectID"
+// @Success 200 {object} models.Session
+// @Failure 400 {object} models.Msg
+// @Failure 404 {object} models.Msg
+// @Failure 500 {object} models.Msg
+// @Router /session/{id}/borrow/{resid} [put]
+func (controller *Controller) LendResource(c echo.Context) error {
+	var err error
+	sessID := c.Param("id")
+	resID := c.Param("resid")
+
+	//Verifying that the ObjectIDs contain 24 hexademical characters
+	if !db.VerifyObjectIDString(sessID) || !db.VerifyObjectIDString(resID) {
+		err = c.JSON(http.StatusBadRequest, m.InvalidID)
+	} else {
+		err = c.JSON(business.LendResourceBusiness(sessID, resID, controller.Mux))
+	}
+
+	return err
+}
+
+// RevokeLending godoc
+// @Summary Revoke a resource lent to a session
+// @Description Takes back the permission to check out a resource of another project. A resource the session has checked out stays with it until it is checked in, but its subresources can no longer be consumed
+// @Tags session
+// @Accept json
+// @Produce json
+// @Param id path string true "Session ObjectID"
+// @Param resid path string true "Resource ObjectID"
+// @Success 200 {object} models.Session
+// @Failure 400 {object} models.Msg
+// @Failure 404 {object} models.Msg
+// @Failure 500 {object} models.Msg
+// @Router /session/{id}/borrow/{resid} [delete]
+func (controller *Controller) RevokeLending(c echo.Context) error {
+	var err error
+	sessID := c.Param("id")
+	resID := c.Param("resid")
+
+	//Verifying that the ObjectIDs contain 24 hexademical characters
+	if !db.VerifyObjectIDString(sessID) || !db.VerifyObjectIDString(resID) {
+		err = c.JSON(http.StatusBadRequest, m.InvalidID)
+	} else {
+		err = c.JSON(business.RevokeLendingBusiness(sessID, resID, controller.Mux))
+	}
+
+	return err
+}
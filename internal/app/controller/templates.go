@@ -12,12 +12,13 @@ import (
 
 // CreateTemplate godoc
 // @Summary Create a new template
-// @Description Create a new template with a passed json. When creating a template with a subresource (streams, et cetera), designate a Field element's type as "subresource" and use an integer Value
+// @Description Create a new template with a passed json. When creating a template with a subresource (streams, et cetera), designate a Field element's type as "subresource" and use an integer Value. A template can extend base templates listed in Extends, inheriting their fields; an own field with the key of an inherited field overrides its required flag and value, but not its type
 // @Tags template
 // @Accept json
 // @Produce json
 // @Param template body models.TemplateRequest true "Add template"
 // @Success 201 {object} models.Template
+// @Header 201 {string} ETag "Entity tag of the document, derived from its revision"
 // @Failure 400 {object} models.TemplateRequest
 // @Failure 409 {object} models.Msg
 // @Failure 500 {object} models.Msg
@@ -30,7 +31,9 @@ func (controller *Controller) CreateTemplate(c echo.Context) error {
 	if err = c.Bind(requestData); err != nil {
 		err = c.JSON(http.StatusBadRequest, m.TemplateValidateFailed)
 	} else {
-		err = c.JSON(business.CreateTemplateBusiness(requestData, controller.Mux))
+		code, response := business.CreateTemplateBusiness(requestData, controller.Mux)
+		setETag(c, response)
+		err = c.JSON(code, response)
 	}
 
 	return err
@@ -38,29 +41,99 @@ func (controller *Controller) CreateTemplate(c echo.Context) error {
 
 // ShowAllTemplates godoc
 // @Summary Show all templates
-// @Description Returns all templates stored in the database
+// @Description Returns a page of templates stored in the database, sortable by _id, created_at, updated_at, name or version
 // @Tags template
 // @Accept json
 // @Produce json
-// @Success 200 {object} models.Template
-// @Failure 404 {object} models.Msg
+// @Param limit query int false "Page size, 1-1000; defaults to 100"
+// @Param cursor query string false "Next cursor returned with the previous page"
+// @Param sort query string false "Sort key, prefixed with - for descending order"
+// @Param fields query string false "Comma-separated keys to include in each document"
+// @Param name query string false "Name prefix"
+// @Success 200 {object} models.ListResponse
+// @Failure 400 {object} models.Msg
 // @Router /template [get]
 func (controller *Controller) ShowAllTemplates(c echo.Context) error {
-	return c.JSON(business.ShowAllTemplatesBusiness())
+	var err error
+	requestData := &m.ListRequest{}
+
+	if err = c.Bind(requestData); err != nil {
+		err = c.JSON(http.StatusBadRequest, m.ListRequestInvalid)
+	} else {
+		err = c.JSON(business.ShowAllTemplatesBusiness(requestData))
+	}
+
+	return err
+}
+
+// ShowTemplate godoc
+// @Summary Show template by ID
+// @Description Returns a single template
+// @Tags template
+// @Accept json
+// @Produce json
+// @Param id path string true "Template ObjectID"
+// @Success 200 {object} models.Template
+// @Header 200 {string} ETag "Entity tag of the document, derived from its revision"
+// @Failure 400 {object} models.Msg
+// @Failure 404 {object} models.Msg
+// @Router /template/{id} [get]
+func (controller *Controller) ShowTemplate(c echo.Context) error {
+	var err error
+	id := c.Param("id")
+
+	//Verifying that the ObjectID contains 24 hexademical characters
+	if !db.VerifyObjectIDString(id) {
+		err = c.JSON(http.StatusBadRequest, m.InvalidID)
+	} else {
+		code, response := business.ShowTemplateBusiness(id)
+		setETag(c, response)
+		err = c.JSON(code, response)
+	}
+
+	return err
+}
+
+// ShowTemplateFields godoc
+// @Summary Show effective template fields
+// @Description Returns the fields resources built from the template have to match, including fields inherited from base templates
+// @Tags template
+// @Accept json
+// @Produce json
+// @Param id path string true "Template ObjectID"
+// @Success 200 {array} models.Field
+// @Failure 400 {object} models.Msg
+// @Failure 404 {object} models.Msg
+// @Router /template/{id}/fields [get]
+func (controller *Controller) ShowTemplateFields(c echo.Context) error {
+	var err error
+	id := c.Param("id")
+
+	//Verifying that the ObjectID contains 24 hexademical characters
+	if !db.VerifyObjectIDString(id) {
+		err = c.JSON(http.StatusBadRequest, m.InvalidID)
+	} else {
+		err = c.JSON(business.ShowTemplateFieldsBusiness(id))
+	}
+
+	return err
 }
 
 // UpdateTemplate godoc
 // @Summary Update template contents
-// @Description Allows the user to update any information stored in a template, including the customizable fields
+// @Description Allows the user to update any information stored in a template, including the customizable fields. Changing the key names, required flags, types or order of the fields increments the template version; resources built from older versions have to be migrated
 // @Tags template
 // @Accept json
 // @Produce json
 // @Param id path string true "Template ObjectID"
 // @Param template body models.TemplateRequest true "Update template"
+// @Param If-Match header string false "ETag of the document the change is based on; the request fails with 412 if the document has been modified since"
 // @Success 200 {object} models.Template
+// @Header 200 {string} ETag "Entity tag of the document, derived from its revision"
 // @Failure 400 {object} models.Msg
 // @Failure 404 {object} models.Msg
 // @Failure 409 {object} models.Msg
+// @Failure 412 {object} models.Msg
 // @Failure 500 {object} models.Msg
 // @Router /template/{id} [put]
 func (controller *Controller) UpdateTemplate(c echo.Context) error {
@@ -76,7 +149,78 @@ func (controller *Controller) UpdateTemplate(c echo.Context) error {
 		if err = c.Bind(requestData); err != nil {
 			err = c.JSON(http.StatusBadRequest, m.TemplateValidateFailed)
 		} else {
-			err = c.JSON(business.UpdateTemplateBusiness(id, requestData, controller.Mux))
+			code, response := business.UpdateTemplateBusiness(id, requestData, c.Request().Header.Get("If-Match"), controller.Mux)
+			setETag(c, response)
+			err = c.JSON(code, response)
+		}
+	}
+
+	return err
+}
+
+// PatchTemplate godoc
+// @Summary Patch template contents
+// @Description Applies an RFC 7396 JSON merge patch to a template. Fields can be replaced as a list or patched by key with an object keyed by field key; null removes a field. The patched template is validated like a full update
+// @Tags template
+// @Accept json
+// @Produce json
+// @Param id path string true "Template ObjectID"
+// @Param patch body models.MergePatch true "JSON merge patch"
+// @Param If-Match header string false "ETag of the document the change is based on; the request fails with 412 if the document has been modified since"
+// @Success 200 {object} models.Template
+// @Header 200 {string} ETag "Entity tag of the document, derived from its revision"
+// @Failure 400 {object} models.Msg
+// @Failure 404 {object} models.Msg
+// @Failure 409 {object} models.Msg
+// @Failure 412 {object} models.Msg
+// @Failure 500 {object} models.Msg
+// @Router /template/{id} [patch]
+func (controller *Controller) PatchTemplate(c echo.Context) error {
+	var err error
+	var patch m.MergePatch
+	id := c.Param("id")
+
+	//Verifying that the ObjectID contains 24 hexademical characters
+	if !db.VerifyObjectIDString(id) {
+		err = c.JSON(http.StatusBadRequest, m.InvalidID)
+	} else if patch, err = bindMergePatch(c); err != nil {
+		err = c.JSON(http.StatusBadRequest, m.PatchInvalid)
+	} else {
+		code, response := business.PatchTemplateBusiness(id, patch, c.Request().Header.Get("If-Match"), controller.Mux)
+		setETag(c, response)
+		err = c.JSON(code, response)
+	}
+
+	return err
+}
+
+// MigrateTemplate godoc
+// @Summary Migrate resources to the current template version
+// @Description Rebuilds the fields of every resource built from an older version of the template, or of a template derived from it. Values are carried over by key, following any passed renames; added fields receive the passed defaults or the template field values. Checked out resources are skipped, and resources left with empty required fields are deactivated and reported for manual values
+// @Tags template
+// @Accept json
+// @Produce json
+// @Param id path string true "Template ObjectID"
+// @Param migration body models.TemplateMigrationRequest true "Field renames and defaults"
+// @Success 200 {object} models.TemplateMigrationReport
+// @Failure 400 {object} models.Msg
+// @Failure 404 {object} models.Msg
+// @Failure 500 {object} models.Msg
+// @Router /template/{id}/migrate [post]
+func (controller *Controller) MigrateTemplate(c echo.Context) error {
+	var err error
+	id := c.Param("id")
+	requestData := &m.TemplateMigrationRequest{}
+
+	//Verifying that the ObjectID contains 24 hexademical characters
+	if !db.VerifyObjectIDString(id) {
+		err = c.JSON(http.StatusBadRequest, m.InvalidID)
+	} else {
+		//Validating the migration structure
+		if err = c.Bind(requestData); err != nil {
+			err = c.JSON(http.StatusBadRequest, m.TemplateMigrationValidateFailed)
+		} else {
+			err = c.JSON(business.MigrateTemplateBusiness(id, requestData, controller.Mux))
 		}
 	}
 
@@ -85,25 +229,37 @@ func (controller *Controller) UpdateTemplate(c echo.Context) error {
 
 // DeleteTemplate godoc
 // @Summary Delete template by ID
-// @Description Allows the user to delete a template using its ID
+// @Description Allows the user to delete a template using its ID. Deletion is refused while resources are built from the template unless a cascade is requested: cascade=delete deletes the dependent resources, cascade=reassign moves them to the target template. Checked out resources are skipped by the cascade and keep blocking deletion
 // @Tags template
 // @Accept json
 // @Produce json
 // @Param id path string true "Template ObjectID"
-// @Success 200 {object} models.Msg
+// @Param cascade query string false "delete or reassign"
+// @Param target query string false "Template ObjectID to reassign dependent resources to"
+// @Param If-Match header string false "ETag of the document the change is based on; the request fails with 412 if the document has been modified since"
+// @Success 200 {object} models.TemplateDeleteReport
 // @Failure 400 {object} models.Msg
 // @Failure 404 {object} models.Msg
+// @Failure 409 {object} models.TemplateDeleteReport
+// @Failure 412 {object} models.Msg
 // @Failure 500 {object} models.Msg
 // @Router /template/{id} [delete]
 func (controller *Controller) DeleteTemplate(c echo.Context) error {
 	var err error
 	id := c.Param("id")
+	requestData := &m.TemplateDeleteRequest{}
 
 	//Verifying that the ID contains 24 hexademical characters
 	if !db.VerifyObjectIDString(id) {
 		err = c.JSON(http.StatusBadRequest, m.InvalidID)
 	} else {
-		err = c.JSON(business.DeleteTemplateBusiness(id, controller.Mux))
+		if err = c.Bind(requestData); err != nil {
+			err = c.JSON(http.StatusBadRequest, m.TemplateCascadeInvalid)
+		} else if requestData.Target != "" && !db.VerifyObjectIDString(requestData.Target) {
+			err = c.JSON(http.StatusBadRequest, m.InvalidID)
+		} else {
+			err = c.JSON(business.DeleteTemplateBusiness(id, requestData, c.Request().Header.Get("If-Match"), controller.Mux))
+		}
 	}
 
 	return err
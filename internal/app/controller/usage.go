@@ -0,0 +1,71 @@
+package controller
+
+import (
+	"net/http"
+
+	"library/internal/app/business"
+	m "library/internal/app/models"
+
+	"github.com/labstack/echo/v4"
+)
+
+// ShowAllUsage godoc
+// @Summary Show checkout intervals
+// @Description Returns a page of checkout intervals, each the time a session held a resource, sortable by _id, created_at, updated_at, checkedout, checkedin, resourceid or project. Intervals still held have no checkedin
+// @Tags usage
+// @Accept json
+// @Produce json
+// @Param limit query int false "Page size, 1-1000; defaults to 100"
+// @Param cursor query string false "Next cursor returned with the previous page"
+// @Param sort query string false "Sort key, prefixed with - for descending order"
+// @Param fields query string false "Comma-separated keys to include in each document"
+// @Param template query string false "Template ObjectID"
+// @Param project query string false "Project ObjectID"
+// @Success 200 {object} models.ListResponse
+// @Failure 400 {object} models.Msg
+// @Router /usage [get]
+func (controller *Controller) ShowAllUsage(c echo.Context) error {
+	var err error
+	requestData := &m.ListRequest{}
+
+	if err = c.Bind(requestData); err != nil {
+		err = c.JSON(http.StatusBadRequest, m.ListRequestInvalid)
+	} else {
+		err = c.JSON(business.ShowAllUsageBusiness(requestData))
+	}
+
+	return err
+}
+
+// ShowUsageReport godoc
+// @Summary Show a utilization report
+// @Description Aggregates the checkout intervals of resources over a time range, per resource or per template: utilization as the percentage of the range the resources were held, peak concurrency, average hold time, average wait time and the top consuming projects. The wait of a session is the time from its start to its first checkout of a template. Rows come by utilization, highest first
+// @Tags usage
+// @Accept json
+// @Produce json,text/csv
+// @Param from query string false "Start of the range, RFC 3339; defaults to 30 days before its end"
+// @Param to query string false "End of the range, RFC 3339; defaults to now"
+// @Param group query string false "resource or template; defaults to resource"
+// @Param resource query string false "Resource ObjectID"
+// @Param template query string false "Template ObjectID"
+// @Param project query string false "Project ObjectID"
+// @Param top query int false "Number of top consuming projects per row, 1-100; defaults to 5"
+// @Param format query string false "json or csv; defaults to json"
+// @Success 200 {object} models.UsageReport
+// @Failure 400 {object} models.Msg
+// @Failure 500 {object} models.Msg
+// @Router /usage/report [get]
+func (controller *Controller) ShowUsageReport(c echo.Context) error {
+	var err error
+	requestData := &m.UsageRequest{}
+
+	if err = c.Bind(requestData); err != nil {
+		err = c.JSON(http.StatusBadRequest, m.UsageRequestInvalid)
+	} else if code, response := business.UsageReportBusiness(requestData); code == http.StatusOK && requestData.Format == "csv" {
+		err = c.Blob(code, "text/csv", response.([]byte))
+	} else {
+		err = c.JSON(code, response)
+	}
+
+	return err
+}
@@ -0,0 +1,10 @@
+package models
+
+import (
+	"fmt"
+)
+
+//ETag returns the entity tag of a stored document, derived from its revision, which every write of the document increments
+func ETag(revision int64) string {
+	return fmt.Sprintf("\"%x\"", revision)
+}
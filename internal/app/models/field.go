@@ -5,5 +5,7 @@ type Field struct {
 	Type     string      `json:"type" example:"subresource" format:"string"`
 	Required bool        `json:"required" example:"true" format:"boolean"`
 	Key      string      `json:"key" example:"someKey" format:"string"`
-	Value    interface{} `json:"value"` //Any data type
+	Value    interface{} `json:"value"`                                                                                       //Any data type
+	Target   string      `json:"target,omitempty" yaml:"target,omitempty" example:"5f19a22e5b40abf84d198e53" format:"string"` //Reference-type fields only; template the referenced resource has to be built from
+	Checkout bool        `json:"checkout,omitempty" yaml:"checkout,omitempty" example:"false" format:"boolean"`               //Reference-type fields only; check out the referenced resource together with the referencing one
 }
@@ -0,0 +1,69 @@
+package models
+
+//InventoryTemplate structure, a template referring to other templates by name
+type InventoryTemplate struct {
+	Name        string   `json:"name" yaml:"name" example:"template name" format:"string"`
+	Description string   `json:"description" yaml:"description" example:"template description" format:"string"`
+	Extends     []string `json:"extends" yaml:"extends,omitempty" example:"base template name" format:"string"` //Base template names
+	Fields      []Field  `json:"fields" yaml:"fields"`                                                          //Target of reference-type fields holds the template name
+}
+
+//InventoryProject structure, a project without its API key and resource list
+type InventoryProject struct {
+	Name     string           `json:"name" yaml:"name" example:"project name" format:"string"`
+	Settings []ProjectSetting `json:"settings" yaml:"settings,omitempty"`
+}
+
+//InventoryResource structure, a resource referring to its template, projects and referenced resources by name
+type InventoryResource struct {
+	Name        string   `json:"name" yaml:"name" example:"resource name" format:"string"`
+	Description string   `json:"description" yaml:"description" example:"resource description" format:"string"`
+	Template    string   `json:"template" yaml:"template" example:"template name" format:"string"`
+	Projects    []string `json:"projects" yaml:"projects" example:"project name" format:"string"`
+	Fields      []Field  `json:"fields" yaml:"fields"`                                                     //Only key and value are imported; fields left out keep their current value, or the template value for new resources
+	Active      *bool    `json:"active,omitempty" yaml:"active,omitempty" example:"true" format:"boolean"` //New resources are active unless set otherwise; existing ones keep their flag
+	Labels      []Label  `json:"labels,omitempty" yaml:"labels,omitempty"`                                 //Existing resources keep their labels when left out
+}
+
+//Inventory structure, a portable set of templates, projects and resources which can be exported from one library and imported into another
+type Inventory struct {
+	Templates []InventoryTemplate `json:"templates" yaml:"templates"`
+	Projects  []InventoryProject  `json:"projects" yaml:"projects"`
+	Resources []InventoryResource `json:"resources" yaml:"resources"`
+}
+
+//InventoryDiff structure
+type InventoryDiff struct {
+	Key string      `json:"key" example:"fields.os" format:"string"` //Changed key; fields and settings are listed per key
+	Old interface{} `json:"old"`
+	New interface{} `json:"new"`
+}
+
+//InventoryChange structure
+type InventoryChange struct {
+	Kind   string          `json:"kind" example:"resource" format:"string"` //template, project or resource
+	Name   string          `json:"name" example:"pixel 4" format:"string"`  //Document name
+	Action string          `json:"action" example:"update" format:"string"` //create, update, delete or unchanged
+	Diff   []InventoryDiff `json:"diff,omitempty"`
+}
+
+//InventoryError structure
+type InventoryError struct {
+	Kind    string `json:"kind" example:"resource" format:"string"`
+	Name    string `json:"name" example:"pixel 4" format:"string"`
+	Message string `json:"message" example:"template not found" format:"string"`
+}
+
+//InventoryReport structure
+type InventoryReport struct {
+	DryRun  bool              `json:"dryrun" example:"true" format:"boolean"`
+	Applied bool              `json:"applied" example:"false" format:"boolean"` //Changes are applied all-or-nothing; false whenever there are errors
+	Changes []InventoryChange `json:"changes"`
+	Errors  []InventoryError  `json:"errors"`
+}
+
+//InventoryExportRequest structure
+type InventoryExportRequest struct {
+	ListRequest
+	Format string `query:"format" example:"yaml" format:"string"` //json, yaml or csv; defaults to json
+}
@@ -0,0 +1,32 @@
+package models
+
+//ListRequest structure
+type ListRequest struct {
+	Limit      int    `query:"limit" example:"50" format:"integer"`                         //Page size, 1-1000; defaults to 100
+	Cursor     string `query:"cursor" format:"string"`                                      //Next cursor returned with the previous page
+	Sort       string `query:"sort" example:"-created_at" format:"string"`                  //Sort key, prefixed with - for descending order
+	Fields     string `query:"fields" example:"name,fields" format:"string"`                //Comma-separated keys to include in each document; _id is always included
+	Name       string `query:"name" example:"android" format:"string"`                      //Name prefix
+	Template   string `query:"template" example:"5f19a22e5b40abf84d198e53" format:"string"` //Resources built from the template
+	Project    string `query:"project" example:"5f19a22e5b40abf84d198e53" format:"string"`  //Resources or sessions associated with the project
+	Active     string `query:"active" example:"true" format:"boolean"`
+	CheckedOut string `query:"checkedout" example:"false" format:"boolean"`                                      //Whether resources are checked out by any session
+	Field      string `query:"field" example:"os:android" format:"string"`                                       //Resources with a field of this key, and value if given as key:value
+	Health     string `query:"health" example:"quarantined" format:"string"`                                     //Resources in this health state, healthy or quarantined
+	Labels     string `query:"labels" example:"os=android,region in (eu-west,eu-north),!broken" format:"string"` //Resources, or sessions by their metadata, matching a label selector
+	Owner      string `query:"owner" example:"jdoe" format:"string"`                                             //Sessions started for this owner
+	Runner     string `query:"runner" example:"runner-eu-07" format:"string"`                                    //Sessions started on this runner
+	Commit     string `query:"commit" example:"9fceb02d" format:"string"`                                        //Sessions testing a revision, matched by prefix
+	Job        string `query:"job" example:"https://ci.example.com/job/android-e2e/" format:"string"`            //Sessions of CI jobs, matched by URL prefix
+	Reason     string `query:"reason" example:"expired" format:"string"`                                         //Closed sessions closed for this reason
+	Resource   string `query:"resource" example:"5f19a22e5b40abf84d198e53" format:"string"`                      //Closed sessions which held the resource
+	From       string `query:"from" example:"2020-07-01T00:00:00Z" format:"date-time"`                           //Closed sessions closed at or after this time
+	To         string `query:"to" example:"2020-08-01T00:00:00Z" format:"date-time"`                             //Closed sessions closed before this time
+}
+
+//ListResponse structure
+type ListResponse struct {
+	Items interface{} `json:"items"`                              //Documents on the current page
+	Total int64       `json:"total" example:"1" format:"integer"` //Number of documents matching the filters across all pages
+	Next  string      `json:"next" format:"string"`               //Cursor of the next page; empty on the last page
+}
@@ -15,16 +15,38 @@ var TemplateExists = Msg{"message": "template with this name already exists"}
 //TemplateValidateFailed error
 var TemplateValidateFailed = Msg{
 	"description":  "cannot be blank",
+	"extends":      "list of base template ids",
 	"fields":       "cannot be blank, field keys have to be unique, field type cannot be empty",
 	"templatename": "cannot be blank",
 }
 
+//TemplateBaseNotFound error
+var TemplateBaseNotFound = Msg{"message": "base template not found"}
+
+//TemplateInheritanceCycle error
+var TemplateInheritanceCycle = Msg{"message": "template cannot extend itself, directly or through its base templates"}
+
+//TemplateOverrideMismatch error
+var TemplateOverrideMismatch = Msg{"message": "a field overriding an inherited field has to keep its type"}
+
+//TemplateMigrationValidateFailed error
+var TemplateMigrationValidateFailed = Msg{
+	"renames":  "list of objects with from and to field keys",
+	"defaults": "list of objects with field key and value",
+}
+
 //InvalidID error
 var InvalidID = Msg{"message": "ID is a hexademical string of length 24; check template, project, session or resource ID"}
 
 //TemplateDeleteSuccess message
 var TemplateDeleteSuccess = Msg{"message": "template deleted successfully"}
 
+//TemplateInUse error
+var TemplateInUse = Msg{"message": "template is referenced by resources or extended by other templates; delete the dependent templates, delete the resources or pass cascade=delete or cascade=reassign&target={id}"}
+
+//TemplateCascadeInvalid error
+var TemplateCascadeInvalid = Msg{"message": "cascade can be delete or reassign; reassign requires a target template other than the deleted one"}
+
 //ProjectValidateFailed error
 var ProjectValidateFailed = Msg{
 	"name":     "cannot be blank",
@@ -45,6 +67,12 @@ var SessionValidateFailed = Msg{
 	"apikey": "cannot be blank",
 }
 
+//SessionMetadataInvalid error
+var SessionMetadataInvalid = Msg{
+	"joburl": "absolute http or https URL",
+	"labels": "unique keys of letters, digits and ._/- up to 63 characters, values of letters, digits and ._- up to 63 characters",
+}
+
 //SigningKeyError error
 var SigningKeyError = Msg{
 	"message": "JWT signing key corrupted or missing",
@@ -95,6 +123,12 @@ var ResourceTemplateMismatch = Msg{"message": "mismatched base template, cannot
 //ResourceTemplateMismatchRequired error
 var ResourceTemplateMismatchRequired = Msg{"message": "mismatched base template, cannot validate resource structure; make sure that required fields are not empty and subresource-type Fields have integers in Value"}
 
+//ResourceReferenceInvalid error
+var ResourceReferenceInvalid = Msg{"message": "reference-type fields take the ID of an existing resource built from the target template, or the target template extended by its template"}
+
+//TemplateReferenceInvalid error
+var TemplateReferenceInvalid = Msg{"message": "reference-type fields need the ID of an existing template in Target"}
+
 //ResourceExists error
 var ResourceExists = Msg{"message": "resource with this name already exists"}
 
@@ -104,11 +138,155 @@ var ResourceNotFound = Msg{"message": "resource not found"}
 //ResourceDeleteSuccess message
 var ResourceDeleteSuccess = Msg{"message": "resource deleted successfully"}
 
+//ResourceInUse error
+var ResourceInUse = Msg{"message": "resource is referenced by other resources; clear their reference fields or delete them first"}
+
 //ResourceProjectIDDuplicate error
 var ResourceProjectIDDuplicate = Msg{"message": "duplicate project ids not allowed"}
 
 //ResourceUpdateCheckedOut error
 var ResourceUpdateCheckedOut = Msg{"message": "resource is checked out; cannot update a checked out resource"}
 
+//ResourceQuarantined error
+var ResourceQuarantined = Msg{"message": "resource is quarantined; cannot check out a quarantined resource"}
+
+//ResourceInactive error
+var ResourceInactive = Msg{"message": "resource is inactive; cannot check out an inactive resource or consume its subresources"}
+
+//ResourceProjectMismatch error
+var ResourceProjectMismatch = Msg{"message": "resource is not associated with the project of the session; an operator has to lend it to the session"}
+
+//ResourceNotQuarantined error
+var ResourceNotQuarantined = Msg{"message": "resource is not quarantined"}
+
+//QuarantineValidateFailed error
+var QuarantineValidateFailed = Msg{
+	"note": "cannot be blank",
+}
+
+//LabelsValidateFailed error
+var LabelsValidateFailed = Msg{
+	"key":   "letters, digits and ._/- up to 63 characters, starting with a letter or digit; unique per resource",
+	"value": "letters, digits and ._- up to 63 characters, or empty",
+	"patch": "object of label keys to values, or to null to remove a label",
+}
+
+//ResourceExclusive error
+var ResourceExclusive = Msg{"message": "resource is checked out exclusively by another session"}
+
+//PoolValidateFailed error
+var PoolValidateFailed = Msg{
+	"name":      "non-empty string, unique among pools",
+	"resources": "resource ObjectIDs, each listed once",
+	"selector":  "label selector of dynamic members, or empty",
+	"projects":  "project ObjectIDs, each listed once",
+	"shares":    "listed projects of the pool with a share of 1-100 percent, each listed once",
+	"mode":      "shared or exclusive; defaults to shared",
+	"strategy":  "first, random or leastused; defaults to first",
+}
+
+//PoolExists error
+var PoolExists = Msg{"message": "pool with this name already exists"}
+
+//PoolNotFound error
+var PoolNotFound = Msg{"message": "pool not found"}
+
+//PoolDeleteSuccess message
+var PoolDeleteSuccess = Msg{"message": "pool deleted successfully"}
+
+//PoolProjectMismatch error
+var PoolProjectMismatch = Msg{"message": "project of the session may not use this pool"}
+
+//PoolShareExceeded error
+var PoolShareExceeded = Msg{"message": "project of the session holds its share of the pool; check in resources of the pool first"}
+
+//PoolExhausted error
+var PoolExhausted = Msg{"message": "no resource of the pool matching the request is available"}
+
+//PoolCheckoutInvalid error
+var PoolCheckoutInvalid = Msg{
+	"labels": "label selector, or empty",
+	"mode":   "shared or exclusive, or empty for the mode of the pool",
+}
+
+//ResourceReserved error
+var ResourceReserved = Msg{"message": "resource is reserved for another project at this time"}
+
+//ReservationValidateFailed error
+var ReservationValidateFailed = Msg{
+	"resourceid": "resource ObjectID",
+	"project":    "project ObjectID",
+	"start":      "RFC 3339 date-time",
+	"end":        "RFC 3339 date-time after start and in the future",
+}
+
+//ReservationNotFound error
+var ReservationNotFound = Msg{"message": "reservation not found"}
+
+//ReservationOverlap error
+var ReservationOverlap = Msg{"message": "resource is already reserved during this window"}
+
+//ReservationProjectMismatch error
+var ReservationProjectMismatch = Msg{"message": "resource is not associated with the project"}
+
+//ReservationDeleteSuccess message
+var ReservationDeleteSuccess = Msg{"message": "reservation deleted successfully"}
+
+//CalendarRequestInvalid error
+var CalendarRequestInvalid = Msg{
+	"from":     "RFC 3339 date-time",
+	"to":       "RFC 3339 date-time after from, at most a year later",
+	"resource": "resource ObjectID",
+	"template": "template ObjectID",
+	"project":  "project ObjectID",
+}
+
+//UsageRequestInvalid error
+var UsageRequestInvalid = Msg{
+	"from":     "RFC 3339 date-time",
+	"to":       "RFC 3339 date-time after from, at most a year later",
+	"group":    "resource or template",
+	"resource": "resource ObjectID",
+	"template": "template ObjectID",
+	"project":  "project ObjectID",
+	"top":      "integer between 1 and 100",
+	"format":   "json or csv",
+}
+
+//ListRequestInvalid error
+var ListRequestInvalid = Msg{
+	"limit":      "integer between 1 and 1000",
+	"cursor":     "has to be passed back unchanged, with the same sort",
+	"sort":       "one of the sortable keys of the collection, prefixed with - for descending order",
+	"template":   "template ObjectID",
+	"project":    "project ObjectID",
+	"active":     "true or false",
+	"checkedout": "true or false",
+	"health":     "healthy or quarantined",
+	"labels":     "comma-separated requirements: key, !key, key=value, key!=value, key in (value,...) or key notin (value,...)",
+	"reason":     "explicit, expired, admin or lease lost",
+	"resource":   "resource ObjectID",
+	"from":       "RFC 3339 time",
+	"to":         "RFC 3339 time",
+}
+
 //PageNotFound error
 var PageNotFound = Msg{"message": "page not found"}
+
+//PatchInvalid error
+var PatchInvalid = Msg{
+	"message": "body has to be a JSON merge patch object of the keys accepted by the update request",
+	"fields":  "list replacing all fields, or object keyed by field key with an object merged into each field; null removes a field",
+}
+
+//PreconditionFailed error
+var PreconditionFailed = Msg{"message": "document was modified since the ETag passed in If-Match was issued; fetch it again and reapply the change"}
+
+//InventoryFormatInvalid error
+var InventoryFormatInvalid = Msg{
+	"format":    "json, yaml or csv; taken from the Content-Type of the request when not passed",
+	"templates": "list of templates with name, description, base template names in extends and fields; reference targets are template names",
+	"projects":  "list of projects with name and settings",
+	"resources": "list of resources with name, description, template name, project names, fields by key and active flag; reference values are resource names",
+	"csv":       "resources only, with name, template and projects columns, projects separated by semicolons, and a fields.{key} column per field",
+}
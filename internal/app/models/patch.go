@@ -0,0 +1,5 @@
+package models
+
+//MergePatch structure, an RFC 7396 JSON merge patch of the keys accepted by the matching PUT request
+//Fields and project settings can also be patched by key by passing an object keyed by field or setting key in place of the list, e.g. {"fields": {"os": {"value": "android"}}}
+type MergePatch map[string]interface{}
@@ -0,0 +1,75 @@
+package models
+
+import (
+	"github.com/Kamva/mgm"
+)
+
+//Pool checkout modes
+const (
+	ModeShared    = "shared"
+	ModeExclusive = "exclusive"
+)
+
+//Pool selection strategies
+const (
+	StrategyFirst     = "first"
+	StrategyRandom    = "random"
+	StrategyLeastUsed = "leastused"
+)
+
+//PoolShare structure
+type PoolShare struct {
+	Project string `json:"project" example:"5f19a22e5b40abf84d198e53" format:"string"`
+	Share   int    `json:"share" example:"50" format:"integer"` //Percentage of the pool the sessions of the project may hold at once, 1-100
+}
+
+//PoolPolicy structure
+type PoolPolicy struct {
+	Shares   []PoolShare `json:"shares"`                                    //Projects left out are only limited by the size of the pool
+	Mode     string      `json:"mode" example:"exclusive" format:"string"`  //Default checkout mode, shared or exclusive; defaults to shared
+	Strategy string      `json:"strategy" example:"random" format:"string"` //Selection among matching resources, first by name, random or leastused; defaults to first
+}
+
+//PoolRequest structure
+type PoolRequest struct {
+	Name        string     `json:"name" example:"eu-lab" format:"string"`
+	Description string     `json:"description" example:"phones on the shelves of the EU lab" format:"string"`
+	Resources   []string   `json:"resources" example:"5f19a22e5b40abf84d198e53" format:"string"` //Static members
+	Selector    string     `json:"selector" example:"region=eu-west" format:"string"`            //Label selector of dynamic members
+	Projects    []string   `json:"projects" example:"5f19a22e5b40abf84d198e53" format:"string"`  //Projects whose sessions may use the pool
+	Policy      PoolPolicy `json:"policy"`
+}
+
+//Pool structure, a named group of resources shared by projects under a policy. Sessions of the projects of a pool may check out its members whichever projects the resources are associated with
+type Pool struct {
+	mgm.DefaultModel `bson:",inline"` //Default mgm-defined fields
+
+	Name        string     `json:"name" example:"eu-lab" format:"string"`
+	Description string     `json:"description" example:"phones on the shelves of the EU lab" format:"string"`
+	Resources   []string   `json:"resources" example:"5f19a22e5b40abf84d198e53" format:"string"` //Static members
+	Selector    string     `json:"selector" example:"region=eu-west" format:"string"`            //Label selector of dynamic members
+	Projects    []string   `json:"projects" example:"5f19a22e5b40abf84d198e53" format:"string"`  //Projects whose sessions may use the pool
+	Policy      PoolPolicy `json:"policy"`
+
+	Revision int64 `json:"revision" example:"3" format:"integer"` //Incremented by every write of the document; its entity tag is derived from it
+}
+
+//Saving increments the revision of the pool on every create and update
+func (pool *Pool) Saving() error {
+	pool.Revision++
+
+	return pool.DefaultModel.Saving()
+}
+
+//Share returns the share of a project in the pool in percent, 100 when the policy doesn't limit the project
+func (pool *Pool) Share(projID string) int {
+	share := 100
+
+	for _, s := range pool.Policy.Shares {
+		if s.Project == projID {
+			share = s.Share
+		}
+	}
+
+	return share
+}
@@ -20,6 +20,15 @@ type Project struct {
 	APIKey    string           `json:"apikey" example:"ba5e7c738d40bbeacdcad85191872171d917afa5d680e11590d281f8cb59ebe3" format:"string"`
 	Resources []string         `json:"resources" example:"5f19a22e5b40abf84d198e53" format:"string"`
 	Settings  []ProjectSetting `json:"settings"`
+
+	Revision int64 `json:"revision" example:"3" format:"integer"` //Incremented by every write of the document; its entity tag is derived from it
+}
+
+//Saving increments the revision of the project on every create and update
+func (proj *Project) Saving() error {
+	proj.Revision++
+
+	return proj.DefaultModel.Saving()
 }
 
 //ProjectRequest structure
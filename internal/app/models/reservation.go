@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Kamva/mgm"
+)
+
+//Reservation structure
+type Reservation struct {
+	mgm.DefaultModel `bson:",inline"` //Default mgm-defined fields
+
+	ResourceID string    `json:"resourceid" example:"5f19a22e5b40abf84d198e53" format:"string"`
+	Project    string    `json:"project" example:"5f19a22e5b40abf84d198e53" format:"string"` //Project whose sessions have the resource to themselves during the window
+	Start      time.Time `json:"start" example:"2020-07-28T09:00:00Z" format:"date-time"`
+	End        time.Time `json:"end" example:"2020-07-28T17:00:00Z" format:"date-time"`
+	Note       string    `json:"note" example:"release testing" format:"string"`
+	Started    bool      `json:"started" example:"false" format:"boolean"` //Whether sessions of other projects have been made to give the resource back at the start of the window
+}
+
+//ReservationRequest structure
+type ReservationRequest struct {
+	ResourceID string    `json:"resourceid" example:"5f19a22e5b40abf84d198e53" format:"string"`
+	Project    string    `json:"project" example:"5f19a22e5b40abf84d198e53" format:"string"`
+	Start      time.Time `json:"start" example:"2020-07-28T09:00:00Z" format:"date-time"`
+	End        time.Time `json:"end" example:"2020-07-28T17:00:00Z" format:"date-time"`
+	Note       string    `json:"note" example:"release testing" format:"string"`
+}
+
+//CalendarRequest structure
+type CalendarRequest struct {
+	From     string `query:"from" example:"2020-07-27T00:00:00Z" format:"date-time"`      //Start of the range; defaults to now
+	To       string `query:"to" example:"2020-08-03T00:00:00Z" format:"date-time"`        //End of the range; defaults to a week after its start
+	Resource string `query:"resource" example:"5f19a22e5b40abf84d198e53" format:"string"` //Single resource
+	Template string `query:"template" example:"5f19a22e5b40abf84d198e53" format:"string"` //Resources built from the template
+	Project  string `query:"project" example:"5f19a22e5b40abf84d198e53" format:"string"`  //Resources associated with the project
+}
+
+//CalendarEntry structure
+type CalendarEntry struct {
+	ResourceID   string        `json:"resourceid" example:"5f19a22e5b40abf84d198e53" format:"string"`
+	Name         string        `json:"name" example:"pixel 4" format:"string"`
+	Reservations []Reservation `json:"reservations"` //Reservations overlapping the range, by start
+}
+
+//Calendar structure
+type Calendar struct {
+	From      time.Time       `json:"from" example:"2020-07-27T00:00:00Z" format:"date-time"`
+	To        time.Time       `json:"to" example:"2020-08-03T00:00:00Z" format:"date-time"`
+	Resources []CalendarEntry `json:"resources"` //Matching resources by name, including those without reservations
+}
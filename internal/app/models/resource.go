@@ -1,6 +1,24 @@
 package models
 
-import "github.com/Kamva/mgm"
+import (
+	"time"
+
+	"github.com/Kamva/mgm"
+)
+
+//Resource health states
+const (
+	HealthHealthy     = "healthy"
+	HealthQuarantined = "quarantined"
+)
+
+//Quarantine history events
+const (
+	QuarantineReported    = "reported"
+	QuarantineQuarantined = "quarantined"
+	QuarantineAnnotated   = "annotated"
+	QuarantineRestored    = "restored"
+)
 
 //ResourceUpdateRequest structure
 type ResourceUpdateRequest struct {
@@ -18,19 +36,68 @@ type ResourceRequest struct {
 	TemplateID  string   `json:"templateid" example:"5f19a22e5b40abf84d198e53" format:"string"`
 	Projects    []string `json:"projects" example:"5f19a22e5b40abf84d198e53" format:"string"` //Name of the project this resource is associated with
 	Fields      []Field  `json:"fields"`
+	Labels      []Label  `json:"labels"`
 }
 
 //Resource structure
 type Resource struct {
 	mgm.DefaultModel `bson:",inline"` //Default mgm-defined fields
 
-	Name        string   `json:"name" example:"resource name" format:"string"`
-	Description string   `json:"description" example:"resource description" format:"string"`
-	TemplateID  string   `json:"templateid" example:"5f19a22e5b40abf84d198e53" format:"string"`
-	Projects    []string `json:"projects" example:"5f19a22e5b40abf84d198e53" format:"string"` //Name of the project this resource is associated with
-	Fields      []Field  `json:"fields"`
-	CheckedOut  int      `json:"checkedout" example:"0" format:"boolean"` //Number of sessions which have this resource checked out
-	Active      bool     `json:"active" example:"true" format:"boolean"`
+	Name            string   `json:"name" example:"resource name" format:"string"`
+	Description     string   `json:"description" example:"resource description" format:"string"`
+	TemplateID      string   `json:"templateid" example:"5f19a22e5b40abf84d198e53" format:"string"`
+	TemplateVersion int      `json:"templateversion" example:"1" format:"integer"`                //Version of the base template the fields conform to
+	Projects        []string `json:"projects" example:"5f19a22e5b40abf84d198e53" format:"string"` //Name of the project this resource is associated with
+	Fields          []Field  `json:"fields"`
+	CheckedOut      int      `json:"checkedout" example:"0" format:"boolean"`    //Number of sessions which have this resource checked out
+	Exclusive       bool     `json:"exclusive" example:"false" format:"boolean"` //Whether the session holding the resource checked it out exclusively, keeping other sessions from checking it out
+	Active          bool     `json:"active" example:"true" format:"boolean"`
+
+	Health     string            `json:"health" example:"healthy" format:"string"` //healthy or quarantined; quarantined resources cannot be checked out
+	Quarantine []QuarantineEvent `json:"quarantine"`                               //Quarantine history, oldest first
+
+	Labels []Label `json:"labels"` //Free-form labels, edited apart from the template-defined fields
+
+	Revision int64 `json:"revision" example:"3" format:"integer"` //Incremented by every write of the document; its entity tag is derived from it
+}
+
+//Saving increments the revision of the resource on every create and update
+func (res *Resource) Saving() error {
+	res.Revision++
+
+	return res.DefaultModel.Saving()
+}
+
+//Label structure
+type Label struct {
+	Key   string `json:"key" example:"region" format:"string"`    //Letters, digits and ._/- up to 63 characters, starting with a letter or digit
+	Value string `json:"value" example:"eu-west" format:"string"` //Letters, digits and ._- up to 63 characters, or empty
+}
+
+//QuarantineRequest structure
+type QuarantineRequest struct {
+	Note string `json:"note" example:"screen cracked, touch input unreliable" format:"string"` //Reason for a report or quarantine, or an annotation
+}
+
+//QuarantineEvent structure
+type QuarantineEvent struct {
+	Event    string           `json:"event" example:"reported" format:"string"` //reported, quarantined, annotated or restored
+	Note     string           `json:"note" example:"screen cracked, touch input unreliable" format:"string"`
+	Session  string           `json:"session,omitempty" example:"5f19a22e5b40abf84d198e53" format:"string"` //Session which reported the resource; empty for events of operators
+	Project  string           `json:"project,omitempty" example:"5f19a22e5b40abf84d198e53" format:"string"` //Project of the reporting session
+	Metadata *SessionMetadata `json:"metadata,omitempty"`                                                   //Job, runner and owner of the reporting session
+	Time     time.Time        `json:"time" example:"2020-07-23T15:04:05Z" format:"date-time"`
+}
+
+//ResourceReferrers structure, lists the resources whose reference-type fields point at a resource
+type ResourceReferrers struct {
+	Message   string              `json:"message" example:"resource is referenced by other resources" format:"string"`
+	Resources []ResourceReference `json:"resources"`
+}
+
+//Quarantined reports whether the resource is out of rotation. Resources created before health states existed are healthy
+func (res *Resource) Quarantined() bool {
+	return res.Health == HealthQuarantined
 }
 
 //DeleteProject removes a project id from the list
@@ -1,9 +1,19 @@
 package models
 
 import (
+	"time"
+
 	"github.com/Kamva/mgm"
 )
 
+//Reasons a session was closed for
+const (
+	CloseExplicit  = "explicit"   //Closed with its own token
+	CloseExpired   = "expired"    //Not renewed in time
+	CloseAdmin     = "admin"      //Closed by an operator
+	CloseLeaseLost = "lease lost" //Ran out of time while no server was running to expire it
+)
+
 //SubResConsumed structure
 type SubResConsumed struct {
 	ParentID string `json:"parentid" example:"5f19a22e5b40abf84d198e53" format:"string"` //MongoDB ID of the parent resource this subresource belongs to
@@ -11,17 +21,96 @@ type SubResConsumed struct {
 	Amount   int    `json:"amount" example:"2" format:"integer"`                         //How many subresources of this type have been consumed by the session
 }
 
+//LinkedResource structure
+type LinkedResource struct {
+	ParentID   string `json:"parentid" example:"5f19a22e5b40abf84d198e53" format:"string"`   //Resource whose reference field caused the checkout
+	ResourceID string `json:"resourceid" example:"5f19a22e5b40abf84d198e53" format:"string"` //Referenced resource checked out together with the parent
+}
+
+//SubResActivity structure, how many subresources of a key a session consumed and released over its lifetime
+type SubResActivity struct {
+	ParentID string `json:"parentid" example:"5f19a22e5b40abf84d198e53" format:"string"`
+	Key      string `json:"key" example:"keyName" format:"string"`
+	Consumed int    `json:"consumed" example:"3" format:"integer"`
+	Released int    `json:"released" example:"3" format:"integer"` //Released explicitly or by checking in the parent resource
+}
+
+//SessionSummaryResource structure, a checkout of a resource by a session
+type SessionSummaryResource struct {
+	ResourceID string     `json:"resourceid" example:"5f19a22e5b40abf84d198e53" format:"string"`
+	Name       string     `json:"name" example:"resource name" format:"string"` //Empty for resources deleted since
+	CheckedOut time.Time  `json:"checkedout" example:"2020-07-28T09:00:00Z" format:"date-time"`
+	CheckedIn  *time.Time `json:"checkedin" example:"2020-07-28T10:30:00Z" format:"date-time"`
+}
+
+//SessionSummary structure, what a session did over its lifetime
+type SessionSummary struct {
+	Resources    []SessionSummaryResource `json:"resources"`                               //Checkouts in the order they were made; a resource checked out twice is listed twice
+	SubResources []SubResActivity         `json:"subresources"`                            //Subresources consumed and released, per resource and key
+	Duration     float64                  `json:"duration" example:"5400" format:"number"` //Seconds from the start of the session to its close
+	Renewals     int                      `json:"renewals" example:"2" format:"integer"`
+}
+
+//SessionClosed structure, the response to closing a session
+type SessionClosed struct {
+	Message string         `json:"message" example:"session terminated" format:"string"`
+	Summary SessionSummary `json:"summary"`
+}
+
+//SessionMetadata structure, describes who or what runs a session
+type SessionMetadata struct {
+	JobURL string  `json:"joburl,omitempty" example:"https://ci.example.com/job/android-e2e/1234" format:"string"` //CI job running the session
+	Runner string  `json:"runner,omitempty" example:"runner-eu-07" format:"string"`                                //Hostname of the machine running the session
+	Owner  string  `json:"owner,omitempty" example:"jdoe" format:"string"`                                         //Person or team responsible for the session
+	Commit string  `json:"commit,omitempty" example:"9fceb02d0ae598e95dc970b74767f19372d61af8" format:"string"`    //Revision under test
+	Labels []Label `json:"labels,omitempty"`                                                                       //Free-form labels, with the syntax of resource labels
+}
+
 //SessionRequest structure
 type SessionRequest struct {
-	APIKey string `json:"apikey" example:"R_l7fU2h7ROa8W62xmpTo-FUSVadckpxzga_QWXvY2tsAapPff46d9JR9Fvn7wosx6Y0wfw9dsvuMgb3GSZKNg==" format:"string"`
+	APIKey   string          `json:"apikey" example:"R_l7fU2h7ROa8W62xmpTo-FUSVadckpxzga_QWXvY2tsAapPff46d9JR9Fvn7wosx6Y0wfw9dsvuMgb3GSZKNg==" format:"string"`
+	Metadata SessionMetadata `json:"metadata"` //Optional description of the job running the session
 }
 
 //Session structure
 type Session struct {
 	mgm.DefaultModel `bson:",inline"` //Default mgm-defined fields
 
-	JobID     string           `json:"jobid" example:"6b5df1009a275789275b76e6540d3d74" format:"string"` //Session's ID within the scheduler
-	Project   string           `json:"project" example:"5f19a22e5b40abf84d198e53" format:"string"`       //Project this session is associated with
-	Resources []string         `json:"resources" example:"5f19a22e5b40abf84d198e53" format:"string"`     //List of resources checked out by the session
+	Project   string           `json:"project" example:"5f19a22e5b40abf84d198e53" format:"string"`   //Project this session is associated with
+	Resources []string         `json:"resources" example:"5f19a22e5b40abf84d198e53" format:"string"` //List of resources checked out by the session
 	Consumed  []SubResConsumed `json:"consumed"`
+	Linked    []LinkedResource `json:"linked"`                                                      //Resources checked out automatically through reference fields
+	Borrowed  []string         `json:"borrowed" example:"5f19a22e5b40abf84d198e53" format:"string"` //Resources of other projects an operator lent to the session
+	Metadata  SessionMetadata  `json:"metadata"`                                                    //Job, runner and owner the session was started for
+	Renewed   time.Time        `json:"renewed" example:"2020-07-23T15:04:05Z" format:"date-time"`   //Last start or renewal of the token
+	Expires   time.Time        `json:"expires" example:"2020-07-24T11:04:05Z" format:"date-time"`   //Time the token runs out, when the worker closes the session unless it is renewed
+	Renewals  int              `json:"renewals" example:"2" format:"integer"`
+	Activity  []SubResActivity `json:"activity"` //Subresources consumed and released so far
+
+	Revision int64 `json:"revision" example:"3" format:"integer"` //Incremented by every write of the document; its entity tag is derived from it
+}
+
+//Saving increments the revision of the session on every create and update
+func (session *Session) Saving() error {
+	session.Revision++
+
+	return session.DefaultModel.Saving()
+}
+
+//ClosedSession structure, the final state of a session kept in the session history once it is closed
+type ClosedSession struct {
+	mgm.DefaultModel `bson:",inline"` //Default mgm-defined fields
+
+	SessionID string           `json:"sessionid" example:"5f19a22e5b40abf84d198e53" format:"string"`
+	Project   string           `json:"project" example:"5f19a22e5b40abf84d198e53" format:"string"`
+	Resources []string         `json:"resources" example:"5f19a22e5b40abf84d198e53" format:"string"` //Resources the session held when it was closed
+	Consumed  []SubResConsumed `json:"consumed"`                                                     //Subresources the session held when it was closed
+	Linked    []LinkedResource `json:"linked"`
+	Borrowed  []string         `json:"borrowed" example:"5f19a22e5b40abf84d198e53" format:"string"`
+	Metadata  SessionMetadata  `json:"metadata"`
+	Started   time.Time        `json:"started" example:"2020-07-23T15:04:05Z" format:"date-time"`
+	Renewed   time.Time        `json:"renewed" example:"2020-07-23T15:04:05Z" format:"date-time"` //Last start or renewal of the token
+	Closed    time.Time        `json:"closed" example:"2020-07-23T15:04:05Z" format:"date-time"`
+	Reason    string           `json:"reason" example:"expired" format:"string"` //explicit, expired, admin or lease lost
+	Summary   SessionSummary   `json:"summary"`
 }
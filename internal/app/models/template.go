@@ -8,14 +8,83 @@ import (
 type Template struct {
 	mgm.DefaultModel `bson:",inline"` //Default mgm-defined fields
 
-	Name        string  `json:"name" example:"template name" format:"string"`
-	Description string  `json:"description" example:"template description" format:"string"`
-	Fields      []Field `json:"fields"`
+	Name        string   `json:"name" example:"template name" format:"string"`
+	Description string   `json:"description" example:"template description" format:"string"`
+	Version     int      `json:"version" example:"1" format:"integer"`                       //Incremented every time the structure of the template fields changes
+	Extends     []string `json:"extends" example:"5f19a22e5b40abf84d198e53" format:"string"` //Base templates whose fields are inherited, in order
+	Fields      []Field  `json:"fields"`                                                     //Own fields; a field with the key of an inherited field overrides its required flag and value
+
+	Revision int64 `json:"revision" example:"3" format:"integer"` //Incremented by every write of the document; its entity tag is derived from it
+}
+
+//Saving increments the revision of the template on every create and update
+func (template *Template) Saving() error {
+	template.Revision++
+
+	return template.DefaultModel.Saving()
 }
 
 //TemplateRequest structure
 type TemplateRequest struct {
-	Name        string  `json:"name" example:"template name" format:"string"`
-	Description string  `json:"description" example:"template description" format:"string"`
-	Fields      []Field `json:"fields"`
+	Name        string   `json:"name" example:"template name" format:"string"`
+	Description string   `json:"description" example:"template description" format:"string"`
+	Extends     []string `json:"extends" example:"5f19a22e5b40abf84d198e53" format:"string"`
+	Fields      []Field  `json:"fields"`
+}
+
+//FieldRename structure
+type FieldRename struct {
+	From string `json:"from" example:"oldKey" format:"string"` //Field key used by the resources being migrated
+	To   string `json:"to" example:"newKey" format:"string"`   //Field key used by the current template version
+}
+
+//FieldDefault structure
+type FieldDefault struct {
+	Key   string      `json:"key" example:"someKey" format:"string"`
+	Value interface{} `json:"value"` //Any data type
+}
+
+//TemplateMigrationRequest structure
+type TemplateMigrationRequest struct {
+	Renames  []FieldRename  `json:"renames"`
+	Defaults []FieldDefault `json:"defaults"` //Values for fields added to the template; template field values are used when omitted
+}
+
+//ResourceManualValues structure
+type ResourceManualValues struct {
+	ResourceID string   `json:"resourceid" example:"5f19a22e5b40abf84d198e53" format:"string"`
+	Name       string   `json:"name" example:"resource name" format:"string"`
+	Keys       []string `json:"keys" example:"someKey" format:"string"` //Required fields which could not be populated during migration
+}
+
+//TemplateMigrationReport structure
+type TemplateMigrationReport struct {
+	TemplateID   string                 `json:"templateid" example:"5f19a22e5b40abf84d198e53" format:"string"`
+	Version      int                    `json:"version" example:"2" format:"integer"`
+	Migrated     []string               `json:"migrated" example:"5f19a22e5b40abf84d198e53" format:"string"`   //Resources brought up to the current template version
+	CheckedOut   []string               `json:"checkedout" example:"5f19a22e5b40abf84d198e53" format:"string"` //Resources skipped because they are checked out
+	ManualValues []ResourceManualValues `json:"manualvalues"`                                                  //Migrated resources deactivated until their missing values are provided
+	Derived      []string               `json:"derived" example:"5f19a22e5b40abf84d198e53" format:"string"`    //Templates derived from the template, whose resources were migrated along with its own
+}
+
+//TemplateDeleteRequest structure
+type TemplateDeleteRequest struct {
+	Cascade string `query:"cascade" example:"reassign" format:"string"`                //Empty, "delete" or "reassign"; what happens to resources built from the template
+	Target  string `query:"target" example:"5f19a22e5b40abf84d198e53" format:"string"` //Template the resources are reassigned to
+}
+
+//ResourceReference structure
+type ResourceReference struct {
+	ResourceID string `json:"resourceid" example:"5f19a22e5b40abf84d198e53" format:"string"`
+	Name       string `json:"name" example:"resource name" format:"string"`
+}
+
+//TemplateDeleteReport structure
+type TemplateDeleteReport struct {
+	Message      string                 `json:"message" example:"template deleted successfully" format:"string"`
+	Resources    []ResourceReference    `json:"resources"`    //Resources which still reference the template
+	Derived      []string               `json:"derived"`      //Templates which extend the template or target it in reference-type fields
+	Deleted      []string               `json:"deleted"`      //Resources deleted by the cascade
+	Reassigned   []string               `json:"reassigned"`   //Resources moved to the target template by the cascade
+	ManualValues []ResourceManualValues `json:"manualvalues"` //Reassigned resources deactivated until their missing values are provided
 }
@@ -0,0 +1,63 @@
+package models
+
+import (
+	"time"
+
+	"github.com/Kamva/mgm"
+)
+
+//Usage structure, the interval during which a session held a resource
+type Usage struct {
+	mgm.DefaultModel `bson:",inline"` //Default mgm-defined fields
+
+	ResourceID string     `json:"resourceid" example:"5f19a22e5b40abf84d198e53" format:"string"`
+	TemplateID string     `json:"templateid" example:"5f19a22e5b40abf84d198e53" format:"string"` //Template of the resource at checkout
+	Project    string     `json:"project" example:"5f19a22e5b40abf84d198e53" format:"string"`    //Project of the session
+	Session    string     `json:"session" example:"5f19a22e5b40abf84d198e53" format:"string"`
+	CheckedOut time.Time  `json:"checkedout" example:"2020-07-28T09:00:00Z" format:"date-time"`
+	CheckedIn  *time.Time `json:"checkedin" example:"2020-07-28T10:30:00Z" format:"date-time"` //Empty while the session holds the resource
+	Waited     bool       `json:"waited" example:"true" format:"boolean"`                      //Whether this was the first checkout of the template by the session, the one its wait counts toward
+	Wait       float64    `json:"wait" example:"42.5" format:"number"`                         //Seconds between the start of the session and the checkout
+}
+
+//UsageRequest structure
+type UsageRequest struct {
+	From     string `query:"from" example:"2020-07-01T00:00:00Z" format:"date-time"`      //Start of the range; defaults to 30 days before its end
+	To       string `query:"to" example:"2020-08-01T00:00:00Z" format:"date-time"`        //End of the range; defaults to now
+	Group    string `query:"group" example:"template" format:"string"`                    //resource or template; defaults to resource
+	Resource string `query:"resource" example:"5f19a22e5b40abf84d198e53" format:"string"` //Single resource
+	Template string `query:"template" example:"5f19a22e5b40abf84d198e53" format:"string"` //Resources built from the template
+	Project  string `query:"project" example:"5f19a22e5b40abf84d198e53" format:"string"`  //Resources associated with the project
+	Top      int    `query:"top" example:"5" format:"integer"`                            //Number of top consuming projects per row, 1-100; defaults to 5
+	Format   string `query:"format" example:"csv" format:"string"`                        //json or csv; defaults to json
+}
+
+//UsageProject structure
+type UsageProject struct {
+	Project   string  `json:"project" example:"5f19a22e5b40abf84d198e53" format:"string"`
+	Name      string  `json:"name" example:"project name" format:"string"`
+	Checkouts int     `json:"checkouts" example:"12" format:"integer"`
+	Held      float64 `json:"held" example:"5400" format:"number"` //Seconds of holding within the range
+}
+
+//UsageRow structure
+type UsageRow struct {
+	ID          string         `json:"id" example:"5f19a22e5b40abf84d198e53" format:"string"` //Resource or template
+	Name        string         `json:"name" example:"pixel 4" format:"string"`
+	Resources   int            `json:"resources" example:"4" format:"integer"`     //Number of resources the row covers
+	Checkouts   int            `json:"checkouts" example:"12" format:"integer"`    //Intervals overlapping the range
+	Held        float64        `json:"held" example:"5400" format:"number"`        //Seconds of holding within the range, summed over intervals
+	Utilization float64        `json:"utilization" example:"37.5" format:"number"` //Percentage of the range the resources were held, averaged over the resources
+	Peak        int            `json:"peak" example:"3" format:"integer"`          //Most intervals held at once
+	AverageHold float64        `json:"averagehold" example:"450" format:"number"`  //Average length of the intervals in seconds, up to now for those still held
+	AverageWait float64        `json:"averagewait" example:"42.5" format:"number"` //Average wait of sessions in seconds, over their first checkouts of a template within the range
+	Projects    []UsageProject `json:"projects"`                                   //Top consuming projects by time held
+}
+
+//UsageReport structure
+type UsageReport struct {
+	From  time.Time  `json:"from" example:"2020-07-01T00:00:00Z" format:"date-time"`
+	To    time.Time  `json:"to" example:"2020-08-01T00:00:00Z" format:"date-time"`
+	Group string     `json:"group" example:"template" format:"string"`
+	Rows  []UsageRow `json:"rows"` //By utilization, highest first
+}
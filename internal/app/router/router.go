@@ -1,18 +1,14 @@
 package router
 
 import (
-	"fmt"
 	"library/internal/app/business"
 	"library/internal/app/controller"
-	m "library/internal/app/models"
-	a "library/internal/pkg/auth"
+	"log"
 
-	"github.com/Kamva/mgm"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/prprprus/scheduler"
 	swag "github.com/swaggo/echo-swagger"
-	"go.mongodb.org/mongo-driver/bson"
 
 	//Swagger documentation
 	_ "library/docs/swagger"
@@ -20,28 +16,19 @@ import (
 
 //New sets up middleware and registers handlers for given routes/paths
 func New(conf *business.Config) *echo.Echo {
-	var signingKey string
-	keySetting := &m.GlobalSetting{}
 	contConfig := map[string]interface{}{}
 
-	//Attempting to locate an old JWT signing key
-	if err := mgm.Coll(keySetting).First(bson.M{"key": "signingKey"}, keySetting); err == nil {
-		//Reading back previously stored JWT signing key
-		signingKey = fmt.Sprintf("%v", keySetting.Value)
-	} else {
-		//Generating a new JWT signing key
-		signingKey, _ = a.GenerateKey(256)
-
-		//Inserting the new signing key into the database
-		keySetting.Key = "signingKey"
-		keySetting.Value = signingKey
-		mgm.Coll(keySetting).Save(keySetting)
+	//Reading the JWT signing key shared by all replicas, generated by the first one to start
+	signingKey, err := business.SigningKeyBusiness()
+	if err != nil {
+		log.Fatalln("error: couldn't read or store the JWT signing key:", err)
 	}
 
 	//Setting controller configuration
 	contConfig["Scheduler"], _ = scheduler.NewScheduler(5000)
 	contConfig["SigningKey"] = signingKey
 	contConfig["DefSessExt"] = conf.SessExt
+	contConfig["Replicated"] = conf.Replicated
 
 	e := echo.New()
 	c := controller.NewController(contConfig)
@@ -63,7 +50,11 @@ func New(conf *business.Config) *echo.Echo {
 		{
 			template.POST("", c.CreateTemplate)
 			template.GET("", c.ShowAllTemplates)
+			template.GET("/:id", c.ShowTemplate)
+			template.GET("/:id/fields", c.ShowTemplateFields)
 			template.PUT("/:id", c.UpdateTemplate)
+			template.PATCH("/:id", c.PatchTemplate)
+			template.POST("/:id/migrate", c.MigrateTemplate)
 			template.DELETE("/:id", c.DeleteTemplate)
 		}
 
@@ -71,8 +62,11 @@ func New(conf *business.Config) *echo.Echo {
 		{
 			project.POST("", c.CreateProject)
 			project.GET("", c.ShowAllProjects)
+			project.GET("/:id", c.ShowProject)
+			project.GET("/:id/resources", c.ShowResourcesByPrj)
 			project.PUT("/:id/newkey", c.UpdateAPIKey)
 			project.PUT("/:id", c.UpdateProject)
+			project.PATCH("/:id", c.PatchProject)
 			project.DELETE("/:id", c.DeleteProject)
 		}
 
@@ -80,7 +74,12 @@ func New(conf *business.Config) *echo.Echo {
 		{
 			session.GET("", c.ShowAllSessions)
 			session.POST("", c.CreateSession)
+			session.GET("/history", c.ShowSessionHistory)
+			session.GET("/history/:id", c.ShowClosedSession)
+			session.GET("/:id", c.ShowSession)
 			session.DELETE("/:id", c.CloseSessionByID)
+			session.PUT("/:id/borrow/:resid", c.LendResource)
+			session.DELETE("/:id/borrow/:resid", c.RevokeLending)
 
 			sessionRestricted := session.Group("/authorized")
 			{
@@ -96,16 +95,57 @@ func New(conf *business.Config) *echo.Echo {
 
 				sessionRestricted.PUT("/checkout/:id/:key", c.ConsumeSubResource)
 				sessionRestricted.PUT("/checkin/:id/:key", c.ReleaseSubResource)
+
+				sessionRestricted.POST("/report/:id", c.ReportResource)
+
+				sessionRestricted.PUT("/pool/:id/checkout", c.PoolCheckout)
 			}
 		}
 
+		pool := v1.Group("/pool")
+		{
+			pool.POST("", c.CreatePool)
+			pool.GET("", c.ShowAllPools)
+			pool.GET("/:id", c.ShowPool)
+			pool.GET("/:id/resources", c.ShowPoolResources)
+			pool.PUT("/:id", c.UpdatePool)
+			pool.DELETE("/:id", c.DeletePool)
+		}
+
+		reservation := v1.Group("/reservation")
+		{
+			reservation.POST("", c.CreateReservation)
+			reservation.GET("", c.ShowAllReservations)
+			reservation.GET("/calendar", c.ShowCalendar)
+			reservation.GET("/:id", c.ShowReservation)
+			reservation.DELETE("/:id", c.DeleteReservation)
+		}
+
+		usage := v1.Group("/usage")
+		{
+			usage.GET("", c.ShowAllUsage)
+			usage.GET("/report", c.ShowUsageReport)
+		}
+
+		inventory := v1.Group("/inventory")
+		{
+			inventory.GET("/export", c.ExportInventory)
+			inventory.POST("/import", c.ImportInventory)
+			inventory.POST("/sync", c.SyncInventory)
+		}
+
 		resource := v1.Group("/resource")
 		{
 			resource.POST("", c.CreateResource)
 			resource.GET("", c.ShowAllResources)
-			resource.GET("/:id", c.ShowResourcesByPrj)
+			resource.GET("/:id", c.ShowResource)
 			resource.PUT("/:id", c.UpdateResource)
+			resource.PATCH("/:id", c.PatchResource)
+			resource.PATCH("/:id/labels", c.LabelResource)
 			resource.DELETE("/:id", c.DeleteResource)
+			resource.POST("/:id/quarantine", c.QuarantineResource)
+			resource.POST("/:id/annotate", c.AnnotateResource)
+			resource.POST("/:id/restore", c.RestoreResource)
 		}
 	}
 
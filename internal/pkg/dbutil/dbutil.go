@@ -1,12 +1,19 @@
 package dbutil
 
 import (
+	"context"
 	m "library/internal/app/models"
+	"log"
+	"reflect"
 	"regexp"
 
 	"github.com/Kamva/mgm"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
 )
 
+var transactions bool //Whether the deployment supports multi-document transactions
+
 /*VerifyObjectIDString verifies a string intended to be used as a MongoDB ObjectID
 Args:	objectid as string
 Rets:	error*/
@@ -34,7 +41,7 @@ func VerifyObjectIDString(id interface{}) bool {
 }
 
 //UpdateProjectResourceLists godoc
-func UpdateProjectResourceLists(resID string, oldProjects []m.Project, newProjects []m.Project) error {
+func UpdateProjectResourceLists(ctx context.Context, resID string, oldProjects []m.Project, newProjects []m.Project) error {
 
 	/* It does not seem that setting arrays to only include unique elements is possible in mongo with mgm / mongo-go-driver, so we have to iterate manually to ensure uniqueness of resource entries per-project. Potentially slow, but should not matter given the nature of the operation (update is not expected to take place often) and real-world project sizes */
 
@@ -65,7 +72,7 @@ func UpdateProjectResourceLists(resID string, oldProjects []m.Project, newProjec
 	for _, proj := range projOldRemove {
 		proj.DeleteResource(resID)
 
-		if err = mgm.Coll(&proj).Update(&proj); err != nil {
+		if err = mgm.Coll(&proj).UpdateWithCtx(ctx, &proj); err != nil {
 			break
 		}
 	}
@@ -77,7 +84,7 @@ func UpdateProjectResourceLists(resID string, oldProjects []m.Project, newProjec
 				//This project wasn't associated with the resource in the past, have to update
 				newProjects[i].Resources = append(newProjects[i].Resources, resID)
 
-				if err = mgm.Coll(&newProjects[i]).Update(&newProjects[i]); err != nil {
+				if err = mgm.Coll(&newProjects[i]).UpdateWithCtx(ctx, &newProjects[i]); err != nil {
 					break
 				}
 			}
@@ -86,3 +93,71 @@ func UpdateProjectResourceLists(resID string, oldProjects []m.Project, newProjec
 
 	return err
 }
+
+// DetectTransactions checks whether the MongoDB deployment supports multi-document transactions, which take a replica set or a sharded cluster, and logs a warning when it doesn't. Meant to be executed at startup
+// Args:	none
+// Rets:	whether transactions are supported
+func DetectTransactions() bool {
+	result := bson.M{}
+
+	if _, _, db, err := mgm.DefaultConfigs(); err == nil && db.RunCommand(context.Background(), bson.D{{Key: "isMaster", Value: 1}}).Decode(&result) == nil {
+		_, replicaSet := result["setName"]
+		transactions = replicaSet || result["msg"] == "isdbgrid"
+	}
+
+	if !transactions {
+		log.Println("warning: mongo deployment is not a replica set and doesn't support transactions; multi-document writes are not atomic and a failed write can leave them half applied")
+	}
+
+	return transactions
+}
+
+// TransactionsSupported reports whether Transaction runs functions in transactions, as found by DetectTransactions
+// Args:	none
+// Rets:	whether transactions are supported
+func TransactionsSupported() bool {
+	return transactions
+}
+
+// Transaction runs a function writing several documents in a transaction, committed when the function succeeds and aborted when it fails, so that its writes are applied all-or-nothing. Reads and writes join the transaction through the passed context. A transaction failing on a transient error, such as an election of a new primary, runs again from the start, and a commit with an unknown outcome is retried; the function has to read the documents it changes with Reload rather than rely on what a failed run left in memory. On deployments without transactions the function runs once on its own
+// Args:	function taking the context of the transaction
+// Rets:	error
+func Transaction(f func(ctx context.Context) error) error {
+	var err error
+	var client *mongo.Client
+	var session mongo.Session
+
+	if !transactions {
+		err = f(context.Background())
+	} else if _, client, _, err = mgm.DefaultConfigs(); err == nil {
+		if session, err = client.StartSession(); err == nil {
+			_, err = session.WithTransaction(context.Background(), func(sc mongo.SessionContext) (interface{}, error) {
+				return nil, f(sc)
+			})
+
+			session.EndSession(context.Background())
+		}
+	}
+
+	return err
+}
+
+// Reload reads documents again under the passed context, replacing them in memory with what is stored
+// Args:	context, documents
+// Rets:	error
+func Reload(ctx context.Context, docs ...mgm.Model) error {
+	var err error
+
+	for _, doc := range docs {
+		//Decoding into a new document, so no value of the old one is left over
+		fresh := reflect.New(reflect.TypeOf(doc).Elem())
+
+		if err = mgm.Coll(doc).FindByIDWithCtx(ctx, doc.GetID(), fresh.Interface().(mgm.Model)); err != nil {
+			break
+		}
+
+		reflect.ValueOf(doc).Elem().Set(fresh.Elem())
+	}
+
+	return err
+}
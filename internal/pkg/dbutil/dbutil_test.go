@@ -0,0 +1,61 @@
+package dbutil
+
+import (
+	"context"
+	"os"
+	"testing"
+	"time"
+
+	m "library/internal/app/models"
+
+	"github.com/Kamva/mgm"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+//connect points mgm at a scratch database and empties it, skipping the test when no MongoDB is reachable. The server is read from LIBRARY_TEST_MONGO, localhost by default
+func connect(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	uri := os.Getenv("LIBRARY_TEST_MONGO")
+	if uri == "" {
+		uri = "mongodb://localhost:27017"
+	}
+
+	err := mgm.SetDefaultConfig(nil, "library_dbutil_test", options.Client().ApplyURI(uri).SetServerSelectionTimeout(2*time.Second))
+	if err == nil {
+		_, client, _, _ := mgm.DefaultConfigs()
+		err = client.Ping(ctx, nil)
+	}
+
+	if err != nil {
+		t.Skip("mongo unavailable:", err)
+	}
+
+	_, _, db, _ := mgm.DefaultConfigs()
+	if err := db.Drop(ctx); err != nil {
+		t.Fatal("dropping the scratch database:", err)
+	}
+}
+
+func TestReloadReplacesChangedValues(t *testing.T) {
+	connect(t)
+
+	session := &m.Session{Resources: []string{"a"}, Consumed: []m.SubResConsumed{{ParentID: "a", Key: "sims", Amount: 1}}}
+	if err := mgm.Coll(session).Create(session); err != nil {
+		t.Fatal("creating the session:", err)
+	}
+
+	//Changing the session the way a failed transaction run does
+	session.Resources = append(session.Resources, "b")
+	session.Consumed[0].Amount++
+	session.Borrowed = []string{"c"}
+
+	if err := Reload(context.Background(), session); err != nil {
+		t.Fatal("reloading the session:", err)
+	}
+
+	if len(session.Resources) != 1 || session.Consumed[0].Amount != 1 || len(session.Borrowed) != 0 || session.ID.IsZero() {
+		t.Errorf("session not reloaded: %+v", session)
+	}
+}
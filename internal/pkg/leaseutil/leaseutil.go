@@ -0,0 +1,198 @@
+package leaseutil
+
+import (
+	"sync"
+	"time"
+
+	"github.com/Kamva/mgm"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+//Collections of the lock and lease documents. Locks are documents named after the lock, listing their holders, each holding the lock until it releases it or its lease runs out
+const (
+	locksCollection  = "locks"
+	leasesCollection = "leases"
+)
+
+//Store keeps locks in the database, so that replicas of the library sharing the database exclude each other as operations of a single process do. The locks of a replica are held under leases the replica renews while it holds them, so that they lapse when the replica stops
+type Store struct {
+	Replica string        //Id of the replica, recorded with the locks it holds
+	TTL     time.Duration //Time a lock is held for without being renewed
+
+	guard sync.Mutex      //Guards held
+	held  map[string]bool //Holders of the replica currently holding or waiting for locks
+}
+
+/*NewStore returns the lock store of a replica and starts renewing the locks it holds
+Args:	replica id, time a lock is held for without being renewed
+Rets:	lock store*/
+func NewStore(replica string, ttl time.Duration) *Store {
+	store := &Store{
+		Replica: replica,
+		TTL:     ttl,
+		held:    map[string]bool{},
+	}
+
+	go store.renew()
+
+	return store
+}
+
+/*Acquire waits until a holder of the replica holds the named lock. Shared locks are held together with other shared holders, exclusive locks alone; an exclusive waiter keeps new shared holders out until it holds the lock. Database errors are retried
+Args:	lock name, whether the lock is shared, holder id, unique within the replica
+Rets:	none*/
+func (store *Store) Acquire(name string, shared bool, holder string) {
+	coll := mgm.CollectionByName(locksCollection)
+	delay := time.Millisecond
+
+	store.guard.Lock()
+	store.held[holder] = true
+	store.guard.Unlock()
+
+	for {
+		now := time.Now().UTC()
+		entry := bson.M{"replica": store.Replica, "holder": holder, "shared": shared, "expires": now.Add(store.TTL)}
+		lapsed := bson.M{"writer.expires": bson.M{"$not": bson.M{"$gt": now}}}
+		var filter, update bson.M
+
+		if shared {
+			//Shared holders wait for exclusive holders and waiters
+			filter = bson.M{
+				"_id":            name,
+				"holders":        bson.M{"$not": bson.M{"$elemMatch": bson.M{"shared": false, "expires": bson.M{"$gt": now}}}},
+				"writer.expires": bson.M{"$not": bson.M{"$gt": now}},
+			}
+			update = bson.M{"$push": bson.M{"holders": entry}}
+		} else {
+			//Exclusive holders wait for all holders and for exclusive waiters ahead of them
+			filter = bson.M{
+				"_id":     name,
+				"holders": bson.M{"$not": bson.M{"$elemMatch": bson.M{"expires": bson.M{"$gt": now}}}},
+				"$or":     []bson.M{lapsed, {"writer.replica": store.Replica, "writer.holder": holder}},
+			}
+			update = bson.M{"$set": bson.M{"holders": bson.A{entry}}, "$unset": bson.M{"writer": ""}}
+		}
+
+		//A lock document is created by the first holder; when the document exists and the lock is held, the insert fails
+		_, err := coll.UpdateOne(mgm.Ctx(), filter, update, options.Update().SetUpsert(true))
+		if err == nil {
+			break
+		}
+
+		//Registering the exclusive waiter, unless another one is ahead of it
+		if !shared && duplicateKey(err) {
+			filter = bson.M{"_id": name, "$or": []bson.M{lapsed, {"writer.replica": store.Replica, "writer.holder": holder}}}
+			_, _ = coll.UpdateOne(mgm.Ctx(), filter, bson.M{"$set": bson.M{"writer": bson.M{"replica": store.Replica, "holder": holder, "expires": now.Add(store.TTL)}}})
+		}
+
+		time.Sleep(delay)
+		if delay < 64*time.Millisecond {
+			delay *= 2
+		}
+	}
+}
+
+/*Release releases the locks of a holder of the replica. Locks which can't be released lapse once their lease runs out
+Args:	lock names, holder id
+Rets:	none*/
+func (store *Store) Release(names []string, holder string) {
+	coll := mgm.CollectionByName(locksCollection)
+
+	store.guard.Lock()
+	delete(store.held, holder)
+	store.guard.Unlock()
+
+	for retries := 0; retries < 3; retries++ {
+		filter := bson.M{"_id": bson.M{"$in": names}}
+		update := bson.M{"$pull": bson.M{"holders": bson.M{"replica": store.Replica, "holder": holder}}}
+
+		if _, err := coll.UpdateMany(mgm.Ctx(), filter, update); err == nil {
+			break
+		}
+	}
+}
+
+//renew extends the leases of the locks the replica holds, several times within their lifetime
+func (store *Store) renew() {
+	coll := mgm.CollectionByName(locksCollection)
+
+	for range time.Tick(store.TTL / 3) {
+		holders := []string{}
+
+		store.guard.Lock()
+		for holder := range store.held {
+			holders = append(holders, holder)
+		}
+		store.guard.Unlock()
+
+		if len(holders) > 0 {
+			filter := bson.M{"holders.replica": store.Replica}
+			update := bson.M{"$set": bson.M{"holders.$[h].expires": time.Now().UTC().Add(store.TTL)}}
+			arrayFilters := options.ArrayFilters{Filters: []interface{}{bson.M{"h.replica": store.Replica, "h.holder": bson.M{"$in": holders}}}}
+
+			_, _ = coll.UpdateMany(mgm.Ctx(), filter, update, options.Update().SetArrayFilters(arrayFilters))
+		}
+	}
+}
+
+/*PruneLocks deletes lock documents no replica holds or waits for
+Args:	none
+Rets:	error*/
+func PruneLocks() error {
+	now := time.Now().UTC()
+	filter := bson.M{
+		"holders":        bson.M{"$not": bson.M{"$elemMatch": bson.M{"expires": bson.M{"$gt": now}}}},
+		"writer.expires": bson.M{"$not": bson.M{"$gt": now}},
+	}
+
+	_, err := mgm.CollectionByName(locksCollection).DeleteMany(mgm.Ctx(), filter)
+
+	return err
+}
+
+/*Hold takes the named lease for a replica, or extends it when the replica already holds it. A lease is held by a single replica at a time, until it runs out without being extended; another replica may take it over then
+Args:	lease name, replica id, time the lease is held for
+Rets:	whether the replica holds the lease*/
+func Hold(name string, replica string, ttl time.Duration) bool {
+	now := time.Now().UTC()
+	filter := bson.M{"_id": name, "$or": []bson.M{{"replica": replica}, {"expires": bson.M{"$lte": now}}}}
+	update := bson.M{"$set": bson.M{"replica": replica, "expires": now.Add(ttl)}}
+
+	//The lease document is created by its first holder; when the document exists and another replica holds the lease, the insert fails
+	_, err := mgm.CollectionByName(leasesCollection).UpdateOne(mgm.Ctx(), filter, update, options.Update().SetUpsert(true))
+
+	return err == nil
+}
+
+/*Holder returns the replica holding the named lease, empty when the lease has run out
+Args:	lease name
+Rets:	replica id*/
+func Holder(name string) string {
+	lease := struct {
+		Replica string    `bson:"replica"`
+		Expires time.Time `bson:"expires"`
+	}{}
+
+	if mgm.CollectionByName(leasesCollection).FindOne(mgm.Ctx(), bson.M{"_id": name}).Decode(&lease) != nil || !lease.Expires.After(time.Now()) {
+		lease.Replica = ""
+	}
+
+	return lease.Replica
+}
+
+//duplicateKey reports whether a write failed on a duplicate key
+func duplicateKey(err error) bool {
+	duplicate := false
+
+	if e, ok := err.(mongo.WriteException); ok {
+		for _, we := range e.WriteErrors {
+			duplicate = duplicate || we.Code == 11000
+		}
+	} else if e, ok := err.(mongo.CommandError); ok {
+		duplicate = e.Code == 11000
+	}
+
+	return duplicate
+}
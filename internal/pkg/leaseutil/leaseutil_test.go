@@ -0,0 +1,212 @@
+package leaseutil
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Kamva/mgm"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+//Time after which an acquisition still waiting is deemed blocked
+const blockTime = 200 * time.Millisecond
+
+//Outcome of connecting to the scratch database, tried once for all tests
+var connection struct {
+	once sync.Once
+	err  error
+}
+
+//connect points mgm at a scratch database and empties it, skipping the test when no MongoDB is reachable. The server is read from LIBRARY_TEST_MONGO, localhost by default
+func connect(t *testing.T) {
+	ctx, cancel := context.WithTimeout(context.Background(), 2*time.Second)
+	defer cancel()
+
+	connection.once.Do(func() {
+		uri := os.Getenv("LIBRARY_TEST_MONGO")
+		if uri == "" {
+			uri = "mongodb://localhost:27017"
+		}
+
+		if connection.err = mgm.SetDefaultConfig(nil, "library_leaseutil_test", options.Client().ApplyURI(uri).SetServerSelectionTimeout(2*time.Second)); connection.err == nil {
+			_, client, _, _ := mgm.DefaultConfigs()
+			connection.err = client.Ping(ctx, nil)
+		}
+	})
+
+	if connection.err != nil {
+		t.Skip("mongo unavailable:", connection.err)
+	}
+
+	_, _, db, _ := mgm.DefaultConfigs()
+	if err := db.Drop(ctx); err != nil {
+		t.Fatal("dropping the scratch database:", err)
+	}
+}
+
+//acquire acquires a lock in the background, returning a channel closed once it is held
+func acquire(store *Store, name string, shared bool, holder string) chan struct{} {
+	held := make(chan struct{})
+
+	go func() {
+		store.Acquire(name, shared, holder)
+		close(held)
+	}()
+
+	return held
+}
+
+//waits reports whether an acquisition is still waiting after blockTime
+func waits(held chan struct{}) bool {
+	waiting := false
+
+	select {
+	case <-held:
+	case <-time.After(blockTime):
+		waiting = true
+	}
+
+	return waiting
+}
+
+func TestAcquireExclusive(t *testing.T) {
+	connect(t)
+	a, b := NewStore("a", 10*time.Second), NewStore("b", 10*time.Second)
+
+	a.Acquire("Resources", false, "1")
+
+	held := acquire(b, "Resources", false, "1")
+	if !waits(held) {
+		t.Fatal("exclusive lock held by two replicas")
+	}
+
+	a.Release([]string{"Resources"}, "1")
+	if waits(held) {
+		t.Error("released lock not taken over")
+	}
+
+	b.Release([]string{"Resources"}, "1")
+}
+
+func TestAcquireShared(t *testing.T) {
+	connect(t)
+	a, b := NewStore("a", 10*time.Second), NewStore("b", 10*time.Second)
+
+	a.Acquire("Sessions", true, "1")
+	if waits(acquire(b, "Sessions", true, "1")) {
+		t.Fatal("shared lock not held by two replicas")
+	}
+
+	held := acquire(a, "Sessions", false, "2")
+	if !waits(held) {
+		t.Fatal("exclusive lock held along with shared holders")
+	}
+
+	//The exclusive waiter keeps new shared holders out
+	shared := acquire(b, "Sessions", true, "2")
+	if !waits(shared) {
+		t.Error("shared lock taken ahead of an exclusive waiter")
+	}
+
+	a.Release([]string{"Sessions"}, "1")
+	b.Release([]string{"Sessions"}, "1")
+	if waits(held) {
+		t.Fatal("exclusive waiter not served once shared holders left")
+	}
+
+	a.Release([]string{"Sessions"}, "2")
+	if waits(shared) {
+		t.Error("shared waiter not served once the exclusive holder left")
+	}
+
+	b.Release([]string{"Sessions"}, "2")
+}
+
+func TestAcquireLapsed(t *testing.T) {
+	connect(t)
+
+	//A replica which stopped renewing its locks
+	stopped := &Store{Replica: "a", TTL: 500 * time.Millisecond, held: map[string]bool{}}
+	b := NewStore("b", 10*time.Second)
+
+	stopped.Acquire("Projects", false, "1")
+
+	select {
+	case <-acquire(b, "Projects", false, "1"):
+	case <-time.After(5 * time.Second):
+		t.Fatal("lock of a stopped replica didn't lapse")
+	}
+
+	b.Release([]string{"Projects"}, "1")
+}
+
+func TestAcquireRenewed(t *testing.T) {
+	connect(t)
+	a, b := NewStore("a", 300*time.Millisecond), NewStore("b", 300*time.Millisecond)
+
+	a.Acquire("Pools", false, "1")
+
+	//The holder keeps renewing the lock past its lease time
+	held := acquire(b, "Pools", false, "1")
+	time.Sleep(time.Second)
+	if !waits(held) {
+		t.Fatal("renewed lock lapsed")
+	}
+
+	a.Release([]string{"Pools"}, "1")
+	if waits(held) {
+		t.Error("released lock not taken over")
+	}
+
+	b.Release([]string{"Pools"}, "1")
+}
+
+func TestPruneLocks(t *testing.T) {
+	connect(t)
+	a := NewStore("a", 10*time.Second)
+
+	a.Acquire("Templates", false, "1")
+	a.Acquire("Reservations", false, "1")
+	a.Release([]string{"Templates"}, "1")
+
+	if err := PruneLocks(); err != nil {
+		t.Fatal("pruning locks:", err)
+	}
+
+	if count, err := mgm.CollectionByName(locksCollection).CountDocuments(mgm.Ctx(), bson.M{}); err != nil || count != 1 {
+		t.Errorf("%d locks left, want the one held; err %v", count, err)
+	}
+
+	a.Release([]string{"Reservations"}, "1")
+}
+
+func TestHold(t *testing.T) {
+	connect(t)
+	ttl := 500 * time.Millisecond
+
+	if !Hold("worker", "a", ttl) || !Hold("worker", "a", ttl) {
+		t.Fatal("free lease not taken and extended")
+	}
+
+	if Hold("worker", "b", ttl) {
+		t.Error("lease taken from its holder")
+	}
+
+	if holder := Holder("worker"); holder != "a" {
+		t.Errorf("holder = %q, want a", holder)
+	}
+
+	time.Sleep(ttl + 100*time.Millisecond)
+
+	if holder := Holder("worker"); holder != "" {
+		t.Errorf("holder of a lease which ran out = %q, want none", holder)
+	}
+
+	if !Hold("worker", "b", ttl) || Holder("worker") != "b" {
+		t.Error("lease which ran out not taken over")
+	}
+}
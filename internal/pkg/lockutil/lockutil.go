@@ -0,0 +1,203 @@
+package lockutil
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//Order is the global order in which collection locks are acquired. Reservations are looked up during checkouts and are always locked last
+var Order = []string{"Sessions", "Resources", "Templates", "Projects", "Pools", "Reservations"}
+
+//Locks guards the collections of the library and their documents. Every operation takes all of the locks it needs in a single call to Lock, which acquires them in the global order whatever order they are named in, so that no two operations can wait for each other
+//A collection named on its own is locked as a whole. A document, named with Document, is locked along with a shared lock on its collection, so operations on different documents run in parallel while operations on the whole collection wait for all of them
+type Locks struct {
+	Coarse bool  //Lock the whole collection of every named document, as before documents had locks of their own; meant for comparisons
+	Store  Store //Locks shared with the other replicas of the library, taken after those of the process; nil when the library runs as a single process
+
+	holders     uint64 //Number of holds taken in the store so far, numbering them
+	collections map[string]*sync.RWMutex
+	rank        map[string]int
+	guard       sync.Mutex           //Guards documents and holders
+	documents   map[string]*document //Locks of the documents in use, dropped once no operation holds or waits for them
+}
+
+//Store holds locks shared by several processes, such as the replicas of the library sharing a database. Locks are named after the collections and documents they guard
+type Store interface {
+	Acquire(name string, shared bool, holder string) //Waits until the holder holds the lock, shared or exclusive
+	Release(names []string, holder string)           //Releases the locks of the holder
+}
+
+//document is the lock of a document along with the number of operations holding or waiting for it
+type document struct {
+	mutex sync.Mutex
+	refs  int
+}
+
+//lock is a single lock taken by Lock
+type lock struct {
+	collection string
+	document   string //Empty for collection locks
+	shared     bool
+}
+
+//name returns the name of the lock
+func (l lock) name() string {
+	name := l.collection
+
+	if l.document != "" {
+		name = l.document
+	}
+
+	return name
+}
+
+/*New returns the locks of the collections named in Order
+Args:	none
+Rets:	locks*/
+func New() *Locks {
+	locks := &Locks{
+		collections: map[string]*sync.RWMutex{},
+		rank:        map[string]int{},
+		documents:   map[string]*document{},
+	}
+
+	for i, name := range Order {
+		locks.collections[name] = &sync.RWMutex{}
+		locks.rank[name] = i
+	}
+
+	return locks
+}
+
+/*Document returns the lock name of a document of a collection
+Args:	collection name, document id
+Rets:	lock name*/
+func Document(collection string, id string) string {
+	return collection + "/" + id
+}
+
+/*Lock acquires the locks of the named collections and documents in the global order and returns a function releasing them in reverse order. With a store, the same locks are then acquired in the store in the same order, so that processes sharing the store don't wait for each other either. Callers must not hold any lock while calling Lock; naming an unknown collection is a programming error and panics
+Args:	collection names, and document names returned by Document
+Rets:	unlock function*/
+func (locks *Locks) Lock(names ...string) func() {
+	var holder string
+	var stored []string
+	ordered := locks.sorted(names)
+
+	for _, l := range ordered {
+		if l.document != "" {
+			locks.acquire(l.document).mutex.Lock()
+		} else if l.shared {
+			locks.collections[l.collection].RLock()
+		} else {
+			locks.collections[l.collection].Lock()
+		}
+	}
+
+	if locks.Store != nil {
+		locks.guard.Lock()
+		locks.holders++
+		holder = strconv.FormatUint(locks.holders, 10)
+		locks.guard.Unlock()
+
+		for _, l := range ordered {
+			locks.Store.Acquire(l.name(), l.shared, holder)
+			stored = append(stored, l.name())
+		}
+	}
+
+	return func() {
+		if locks.Store != nil {
+			locks.Store.Release(stored, holder)
+		}
+
+		for i := len(ordered) - 1; i >= 0; i-- {
+			if l := ordered[i]; l.document != "" {
+				locks.release(l.document)
+			} else if l.shared {
+				locks.collections[l.collection].RUnlock()
+			} else {
+				locks.collections[l.collection].Unlock()
+			}
+		}
+	}
+}
+
+//sorted returns the distinct locks taken for the names: collection locks in the global order, then the locks of the documents of collections not locked as a whole, by collection and id
+func (locks *Locks) sorted(names []string) []lock {
+	ordered := []lock{}
+	whole := map[string]bool{}
+	documents := map[string]string{}
+
+	for _, name := range names {
+		collection := name
+
+		if i := strings.Index(name, "/"); i >= 0 {
+			collection = name[:i]
+			documents[name] = collection
+		}
+
+		if _, ok := locks.rank[collection]; !ok {
+			panic(fmt.Sprintf("lockutil: unknown collection %s", collection))
+		}
+
+		whole[collection] = whole[collection] || collection == name || locks.Coarse
+	}
+
+	for collection, exclusive := range whole {
+		ordered = append(ordered, lock{collection: collection, shared: !exclusive})
+	}
+
+	for name, collection := range documents {
+		if !whole[collection] {
+			ordered = append(ordered, lock{collection: collection, document: name})
+		}
+	}
+
+	sort.Slice(ordered, func(i, j int) bool {
+		a, b := ordered[i], ordered[j]
+
+		if (a.document == "") != (b.document == "") {
+			return a.document == ""
+		} else if locks.rank[a.collection] != locks.rank[b.collection] {
+			return locks.rank[a.collection] < locks.rank[b.collection]
+		}
+
+		return a.document < b.document
+	})
+
+	return ordered
+}
+
+//acquire returns the lock of a document, counting the caller as one of its holders
+func (locks *Locks) acquire(name string) *document {
+	locks.guard.Lock()
+
+	doc, ok := locks.documents[name]
+	if !ok {
+		doc = &document{}
+		locks.documents[name] = doc
+	}
+	doc.refs++
+
+	locks.guard.Unlock()
+
+	return doc
+}
+
+//release unlocks the lock of a document and drops it once it has no holders left
+func (locks *Locks) release(name string) {
+	locks.guard.Lock()
+
+	doc := locks.documents[name]
+	doc.mutex.Unlock()
+
+	if doc.refs--; doc.refs == 0 {
+		delete(locks.documents, name)
+	}
+
+	locks.guard.Unlock()
+}
@@ -0,0 +1,280 @@
+package lockutil
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+//Time after which an operation waiting for locks is deemed blocked, and after which a set of operations is deemed deadlocked
+const (
+	blockTime    = 50 * time.Millisecond
+	deadlockTime = 10 * time.Second
+)
+
+//blocks reports whether a function is still running after blockTime, waiting for it to finish once released
+func blocks(f func()) (bool, func()) {
+	done := make(chan struct{})
+
+	go func() {
+		f()
+		close(done)
+	}()
+
+	blocked := false
+	select {
+	case <-done:
+	case <-time.After(blockTime):
+		blocked = true
+	}
+
+	return blocked, func() { <-done }
+}
+
+//finishes fails the test when a set of operations doesn't finish within deadlockTime
+func finishes(t *testing.T, wg *sync.WaitGroup) {
+	done := make(chan struct{})
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(deadlockTime):
+		t.Fatal("operations deadlocked")
+	}
+}
+
+func TestLockOppositeOrders(t *testing.T) {
+	locks := New()
+	wg := &sync.WaitGroup{}
+	orders := [][]string{
+		{"Sessions", "Resources", "Reservations"},
+		{"Reservations", "Resources", "Sessions"},
+		{Document("Sessions", "s"), Document("Resources", "a"), Document("Resources", "b")},
+		{Document("Resources", "b"), Document("Resources", "a"), Document("Sessions", "s")},
+		{Document("Resources", "a"), "Pools", Document("Sessions", "s")},
+		{"Pools", Document("Sessions", "s"), Document("Resources", "a")},
+	}
+	counter := 0
+
+	for i := 0; i < 64; i++ {
+		wg.Add(1)
+
+		go func(names []string) {
+			for j := 0; j < 200; j++ {
+				unlock := locks.Lock(names...)
+				counter++
+				unlock()
+			}
+			wg.Done()
+		}(orders[i%len(orders)])
+	}
+
+	finishes(t, wg)
+
+	//Every order shares a lock with every other, so the counter is never updated concurrently
+	if counter != 64*200 {
+		t.Errorf("counter = %d, want %d", counter, 64*200)
+	}
+}
+
+func TestLockRepeatedNames(t *testing.T) {
+	locks := New()
+	wg := &sync.WaitGroup{}
+	wg.Add(1)
+
+	go func() {
+		unlock := locks.Lock("Resources", "Resources", Document("Sessions", "s"), Document("Sessions", "s"), Document("Resources", "a"))
+		unlock()
+		wg.Done()
+	}()
+
+	finishes(t, wg)
+
+	want := []lock{{collection: "Sessions", shared: true}, {collection: "Resources"}, {collection: "Sessions", document: Document("Sessions", "s")}}
+	if got := locks.sorted([]string{Document("Sessions", "s"), "Resources", Document("Resources", "a"), Document("Sessions", "s"), "Resources"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("sorted = %+v, want %+v", got, want)
+	}
+}
+
+func TestLockExcludes(t *testing.T) {
+	locks := New()
+	unlock := locks.Lock("Resources")
+
+	if blocked, wait := blocks(func() { locks.Lock("Projects")() }); blocked {
+		unlock()
+		wait()
+		t.Fatal("lock of another collection waits")
+	}
+
+	blocked, wait := blocks(func() { locks.Lock("Sessions", "Resources")() })
+	if !blocked {
+		t.Error("lock of a held collection doesn't wait")
+	}
+
+	unlock()
+	wait()
+}
+
+func TestLockDocuments(t *testing.T) {
+	locks := New()
+	unlock := locks.Lock(Document("Resources", "a"))
+
+	if blocked, wait := blocks(func() { locks.Lock(Document("Resources", "b"))() }); blocked {
+		unlock()
+		wait()
+		t.Fatal("lock of another document waits")
+	}
+
+	blockedDoc, waitDoc := blocks(func() { locks.Lock(Document("Resources", "a"))() })
+	blockedColl, waitColl := blocks(func() { locks.Lock("Resources")() })
+
+	if !blockedDoc {
+		t.Error("lock of the same document doesn't wait")
+	}
+
+	if !blockedColl {
+		t.Error("lock of the whole collection doesn't wait for a document")
+	}
+
+	unlock()
+	waitDoc()
+	waitColl()
+}
+
+func TestLockCoarse(t *testing.T) {
+	locks := New()
+	locks.Coarse = true
+	unlock := locks.Lock(Document("Resources", "a"))
+
+	blocked, wait := blocks(func() { locks.Lock(Document("Resources", "b"))() })
+	if !blocked {
+		t.Error("coarse lock of another document doesn't wait")
+	}
+
+	unlock()
+	wait()
+
+	if len(locks.documents) != 0 {
+		t.Errorf("coarse locks took document locks: %v", locks.documents)
+	}
+}
+
+func TestLockReleasesDocuments(t *testing.T) {
+	locks := New()
+	wg := &sync.WaitGroup{}
+
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+
+		go func(i int) {
+			for j := 0; j < 100; j++ {
+				unlock := locks.Lock(Document("Sessions", fmt.Sprint(i%4)), Document("Resources", fmt.Sprint(j%8)))
+				unlock()
+			}
+			wg.Done()
+		}(i)
+	}
+
+	finishes(t, wg)
+
+	if len(locks.documents) != 0 {
+		t.Errorf("%d document locks left behind", len(locks.documents))
+	}
+}
+
+func TestLockUnknownCollection(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("locking an unknown collection didn't panic")
+		}
+	}()
+
+	New().Lock("Resources", "Widgets")
+}
+
+//fakeStore records the locks acquired and released in a store
+type fakeStore struct {
+	guard    sync.Mutex
+	acquired map[string][]string //Lock names by holder, in order
+	released map[string][]string
+}
+
+func (store *fakeStore) Acquire(name string, shared bool, holder string) {
+	store.guard.Lock()
+	store.acquired[holder] = append(store.acquired[holder], name)
+	store.guard.Unlock()
+}
+
+func (store *fakeStore) Release(names []string, holder string) {
+	store.guard.Lock()
+	store.released[holder] = append(store.released[holder], names...)
+	store.guard.Unlock()
+}
+
+func TestLockStore(t *testing.T) {
+	store := &fakeStore{acquired: map[string][]string{}, released: map[string][]string{}}
+	locks := New()
+	locks.Store = store
+
+	locks.Lock(Document("Resources", "b"), "Reservations", Document("Sessions", "s"), Document("Resources", "a"))()
+
+	want := []string{"Sessions", "Resources", "Reservations", Document("Sessions", "s"), Document("Resources", "a"), Document("Resources", "b")}
+	if len(store.acquired) != 1 || !reflect.DeepEqual(store.acquired["1"], want) {
+		t.Errorf("acquired = %v, want %v for holder 1", store.acquired, want)
+	}
+
+	if !reflect.DeepEqual(store.released["1"], want) {
+		t.Errorf("released = %v, want %v", store.released, want)
+	}
+}
+
+//Time a checkout holds its locks for in the benchmarks, standing in for its database round trips
+const holdTime = 100 * time.Microsecond
+
+//benchmarkCheckouts takes the locks of checkouts from concurrent sessions, each checking out a resource of its own, b.N checkouts in all
+func benchmarkCheckouts(b *testing.B, coarse bool, sessions int) {
+	locks := New()
+	locks.Coarse = coarse
+	wg := &sync.WaitGroup{}
+	remaining := int64(b.N)
+
+	b.ResetTimer()
+
+	for i := 0; i < sessions; i++ {
+		wg.Add(1)
+
+		go func(id string) {
+			names := []string{Document("Sessions", id), Document("Resources", id), Document("Reservations", id)}
+
+			for atomic.AddInt64(&remaining, -1) >= 0 {
+				unlock := locks.Lock(names...)
+				time.Sleep(holdTime)
+				unlock()
+			}
+			wg.Done()
+		}(fmt.Sprint(i))
+	}
+
+	wg.Wait()
+}
+
+//BenchmarkLock compares checkouts of distinct resources by concurrent sessions with document locks and with whole collections locked, as in Coarse mode
+func BenchmarkLock(b *testing.B) {
+	for _, mode := range []struct {
+		name   string
+		coarse bool
+	}{{"documents", false}, {"coarse", true}} {
+		for _, sessions := range []int{1, 8, 32} {
+			coarse, sessions := mode.coarse, sessions
+
+			b.Run(fmt.Sprintf("%s/sessions=%d", mode.name, sessions), func(b *testing.B) { benchmarkCheckouts(b, coarse, sessions) })
+		}
+	}
+}
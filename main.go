@@ -3,6 +3,7 @@ package main
 import (
 	"fmt"
 	"library/internal/app/business"
+	"library/internal/app/cli"
 	"library/internal/app/router"
 	"log"
 	"os"
@@ -31,8 +32,18 @@ var mongoURI string = "mongodb://mongodb:27017"
 func main() {
 	var conf business.Config
 
-	//Get application configuration
-	if _, err := toml.DecodeFile("conf/library.toml", &conf); err != nil {
+	//Subcommands are run as a client of a running library
+	if len(os.Args) > 1 {
+		os.Exit(cli.Run(os.Args[1:]))
+	}
+
+	//Get application configuration, from another file when several replicas run on one machine
+	confFile := "conf/library.toml"
+	if path := os.Getenv("LIBRARY_CONF"); path != "" {
+		confFile = path
+	}
+
+	if _, err := toml.DecodeFile(confFile, &conf); err != nil {
 		//Can't read config, log to console
 		fmt.Printf("%s couldn't open configuration file: %s", time.Now().Format(time.RFC3339), err)
 	} else {
@@ -46,7 +57,9 @@ func main() {
 				log.Println("error: invalid sessext in config file; value 0<sessext<24 (integer) allowed")
 			} else {
 				//Configure Mongo access
-				if conf.Runmode == "dev" {
+				if conf.MongoURI != "" {
+					mongoURI = conf.MongoURI
+				} else if conf.Runmode == "dev" {
 					mongoURI = "mongodb://localhost:27017"
 				}
 
@@ -0,0 +1,178 @@
+//Package client is a typed client of the library API for test harnesses. A Session renews its bearer token in the background and is closed when its context is cancelled, so that a failing test does not keep its resources checked out
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+)
+
+//Client talks to a library over HTTP
+type Client struct {
+	BaseURL string       //Library URL, e.g. http://localhost:8888
+	HTTP    *http.Client //Client used for every request
+}
+
+//Error is returned for responses outside the 2xx range
+type Error struct {
+	StatusCode int
+	Message    string //Message of the library, or the raw response body
+}
+
+//Error prints the status and the message
+func (e *Error) Error() string {
+	return fmt.Sprintf("library: %d %s: %s", e.StatusCode, http.StatusText(e.StatusCode), e.Message)
+}
+
+//IsStatus reports whether err is an Error with the given status code, e.g. http.StatusConflict for a resource already checked out by the session
+func IsStatus(err error, code int) bool {
+	apiErr, ok := err.(*Error)
+
+	return ok && apiErr.StatusCode == code
+}
+
+//New returns a client of the library at baseURL
+func New(baseURL string) *Client {
+	return &Client{
+		BaseURL: strings.TrimSuffix(baseURL, "/"),
+		HTTP:    &http.Client{Timeout: 30 * time.Second},
+	}
+}
+
+//Template returns a template by id
+func (c *Client) Template(ctx context.Context, id string) (*Template, error) {
+	template := &Template{}
+
+	return template, c.do(ctx, http.MethodGet, "/template/"+url.PathEscape(id), "", nil, template)
+}
+
+//Project returns a project by id
+func (c *Client) Project(ctx context.Context, id string) (*Project, error) {
+	project := &Project{}
+
+	return project, c.do(ctx, http.MethodGet, "/project/"+url.PathEscape(id), "", nil, project)
+}
+
+//Resource returns a resource by id
+func (c *Client) Resource(ctx context.Context, id string) (*Resource, error) {
+	resource := &Resource{}
+
+	return resource, c.do(ctx, http.MethodGet, "/resource/"+url.PathEscape(id), "", nil, resource)
+}
+
+//Resources returns every resource matching the filters of a list request, following the next cursors from the cursor of the request on
+func (c *Client) Resources(ctx context.Context, filters ListRequest) ([]Resource, error) {
+	var err error
+	resources := []Resource{}
+	page := struct {
+		Items []Resource `json:"items"`
+		Next  string     `json:"next"`
+	}{Next: filters.Cursor}
+
+	for more := true; more && err == nil; more = page.Next != "" {
+		filters.Cursor, page.Items, page.Next = page.Next, nil, ""
+
+		if err = c.do(ctx, http.MethodGet, "/resource?"+listQuery(filters).Encode(), "", nil, &page); err == nil {
+			resources = append(resources, page.Items...)
+		}
+	}
+
+	return resources, err
+}
+
+//SessionDocument returns a session by id, with the resources and subresources it holds
+func (c *Client) SessionDocument(ctx context.Context, id string) (*SessionDocument, error) {
+	session := &SessionDocument{}
+
+	return session, c.do(ctx, http.MethodGet, "/session/"+url.PathEscape(id), "", nil, session)
+}
+
+//ClosedSession returns a closed session from the session history by the id it had while running
+func (c *Client) ClosedSession(ctx context.Context, id string) (*ClosedSession, error) {
+	session := &ClosedSession{}
+
+	return session, c.do(ctx, http.MethodGet, "/session/history/"+url.PathEscape(id), "", nil, session)
+}
+
+//listQuery encodes the non-empty fields of a list request as query parameters, named by their query tags
+func listQuery(filters ListRequest) url.Values {
+	query := url.Values{}
+	value := reflect.ValueOf(filters)
+
+	for i := 0; i < value.NumField(); i++ {
+		name := value.Type().Field(i).Tag.Get("query")
+
+		if field := value.Field(i); name != "" && !field.IsZero() {
+			query.Set(name, fmt.Sprint(field.Interface()))
+		}
+	}
+
+	return query
+}
+
+//do sends a request to the library API and decodes the JSON response into out, unless out is nil
+//Args:	context, method, path under /v1, bearer token, request body or nil, response destination or nil
+//Rets:	error
+func (c *Client) do(ctx context.Context, method string, path string, token string, body interface{}, out interface{}) error {
+	var err error
+	var req *http.Request
+	var resp *http.Response
+	var data []byte
+	var reader io.Reader
+
+	if body != nil {
+		if data, err = json.Marshal(body); err == nil {
+			reader = bytes.NewReader(data)
+		}
+	}
+
+	if err == nil {
+		if req, err = http.NewRequestWithContext(ctx, method, c.BaseURL+"/v1"+path, reader); err == nil {
+			req.Header.Set("Accept", "application/json")
+
+			if reader != nil {
+				req.Header.Set("Content-Type", "application/json")
+			}
+
+			if token != "" {
+				req.Header.Set("Authorization", token)
+			}
+
+			if resp, err = c.HTTP.Do(req); err == nil {
+				defer resp.Body.Close()
+
+				if data, err = ioutil.ReadAll(resp.Body); err == nil {
+					if resp.StatusCode < 200 || resp.StatusCode > 299 {
+						err = responseError(resp.StatusCode, data)
+					} else if out != nil {
+						err = json.Unmarshal(data, out)
+					}
+				}
+			}
+		}
+	}
+
+	return err
+}
+
+//responseError builds the error of a failed call from the message of the library
+func responseError(code int, data []byte) error {
+	msg := map[string]interface{}{}
+	apiErr := &Error{StatusCode: code, Message: string(bytes.TrimSpace(data))}
+
+	if json.Unmarshal(data, &msg) == nil {
+		if message, ok := msg["message"].(string); ok {
+			apiErr.Message = message
+		}
+	}
+
+	return apiErr
+}
@@ -0,0 +1,73 @@
+package client
+
+import (
+	m "library/internal/app/models"
+)
+
+//Types of the documents and requests of the library API, shared with the server so that they cannot drift apart
+
+//Template structure
+type Template = m.Template
+
+//Project structure
+type Project = m.Project
+
+//ProjectSetting structure
+type ProjectSetting = m.ProjectSetting
+
+//Resource structure
+type Resource = m.Resource
+
+//Field structure
+type Field = m.Field
+
+//Label structure
+type Label = m.Label
+
+//QuarantineEvent structure
+type QuarantineEvent = m.QuarantineEvent
+
+//SessionDocument structure, the session as stored by the library
+type SessionDocument = m.Session
+
+//SessionMetadata structure, the job, runner and owner a session is started for
+type SessionMetadata = m.SessionMetadata
+
+//ClosedSession structure, a session in the session history
+type ClosedSession = m.ClosedSession
+
+//SessionSummary structure, what a session did over its lifetime
+type SessionSummary = m.SessionSummary
+
+//SessionSummaryResource structure
+type SessionSummaryResource = m.SessionSummaryResource
+
+//SubResActivity structure
+type SubResActivity = m.SubResActivity
+
+//SubResConsumed structure
+type SubResConsumed = m.SubResConsumed
+
+//LinkedResource structure
+type LinkedResource = m.LinkedResource
+
+//ListRequest structure, the filters, sort key and cursor of list calls
+type ListRequest = m.ListRequest
+
+//Pool structure
+type Pool = m.Pool
+
+//PoolPolicy structure
+type PoolPolicy = m.PoolPolicy
+
+//PoolShare structure
+type PoolShare = m.PoolShare
+
+//Reservation structure
+type Reservation = m.Reservation
+
+//Usage structure, the interval during which a session held a resource
+type Usage = m.Usage
+
+//UsageReport structure
+type UsageReport = m.UsageReport
@@ -0,0 +1,255 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	m "library/internal/app/models"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+//Failed renewals are retried after this delay for as long as the token is valid
+var renewRetry = 30 * time.Second
+
+//Time allowed for closing a session once the context it was started with is cancelled
+var closeTimeout = 30 * time.Second
+
+//ErrSessionClosed is returned by Err once the session has been closed
+var ErrSessionClosed = errors.New("library: session closed")
+
+//Session is a session of a project. Its token is renewed in the background when two thirds of its lifetime have passed, until the session is closed explicitly or by cancelling the context it was started with
+type Session struct {
+	ID string //Session ObjectID
+
+	client  *Client
+	mux     sync.Mutex
+	token   string    //Bearer token, including the Bearer prefix
+	renewAt time.Time //When the background renewal sends the next request
+	expires time.Time
+	err     error
+
+	closeOnce sync.Once
+	closeErr  error
+	summary   *SessionSummary //Returned by the library when the session was closed
+	closed    chan struct{}   //Closed when closing starts, stopping the renewal
+	done      chan struct{}   //Closed when the renewal has stopped
+}
+
+//StartSession creates a session for the project of an API key. Cancelling ctx closes the session and checks in its resources, so ctx should live as long as the test run, e.g. a context cancelled on SIGINT and SIGTERM
+func (c *Client) StartSession(ctx context.Context, apiKey string) (*Session, error) {
+	return c.StartSessionWithMetadata(ctx, apiKey, SessionMetadata{})
+}
+
+//StartSessionWithMetadata creates a session like StartSession, describing the job which runs it so that operators can tell who holds its resources
+func (c *Client) StartSessionWithMetadata(ctx context.Context, apiKey string, metadata SessionMetadata) (*Session, error) {
+	var err error
+	var session *Session
+	created := map[string]string{}
+
+	if err = c.do(ctx, http.MethodPost, "/session", "", m.SessionRequest{APIKey: apiKey, Metadata: metadata}, &created); err == nil {
+		session = &Session{
+			client: c,
+			closed: make(chan struct{}),
+			done:   make(chan struct{}),
+		}
+
+		if session.ID, err = session.setToken(created["token"]); err == nil {
+			go session.keepAlive(ctx)
+		}
+	}
+
+	return session, err
+}
+
+//Token returns the current bearer token, including the Bearer prefix
+func (s *Session) Token() string {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.token
+}
+
+//Expires returns the expiry of the current token
+func (s *Session) Expires() time.Time {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.expires
+}
+
+//Done returns a channel closed once the session is no longer renewed, because it was closed or its renewal failed for good
+func (s *Session) Done() <-chan struct{} {
+	return s.done
+}
+
+//Err returns nil while the session is renewed, and why it stopped once Done is closed: ErrSessionClosed, the error of the context it was started with, or the error of the last renewal
+func (s *Session) Err() error {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.err
+}
+
+//Renew extends the session and replaces its token
+func (s *Session) Renew(ctx context.Context) error {
+	renewed := map[string]string{}
+	err := s.client.do(ctx, http.MethodPut, "/session/authorized", s.Token(), nil, &renewed)
+
+	if err == nil {
+		_, err = s.setToken(renewed["token"])
+	}
+
+	return err
+}
+
+//Close closes the session, checking in its resources, and stops the renewal. Only the first call closes the session; later calls return its result
+func (s *Session) Close(ctx context.Context) error {
+	err := s.close(ctx, ErrSessionClosed)
+
+	<-s.done
+
+	return err
+}
+
+//Summary returns the summary the library returned when the session was closed: the checkouts of the session, the subresources it consumed and released, its duration and renewals. Sessions which aren't closed yet, or failed to close, have none
+func (s *Session) Summary() *SessionSummary {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.summary
+}
+
+//Checkout checks out a resource, along with the resources its reference fields flag for checkout. The keys of reference fields listed in expand are replaced with the referenced resources
+func (s *Session) Checkout(ctx context.Context, resID string, expand ...string) (*Resource, error) {
+	resource := &Resource{}
+	path := "/session/authorized/checkout/" + url.PathEscape(resID)
+
+	if len(expand) > 0 {
+		path += "?" + url.Values{"expand": {strings.Join(expand, ",")}}.Encode()
+	}
+
+	return resource, s.client.do(ctx, http.MethodPut, path, s.Token(), nil, resource)
+}
+
+//Checkin checks in a resource checked out by the session
+func (s *Session) Checkin(ctx context.Context, resID string) error {
+	return s.client.do(ctx, http.MethodPut, "/session/authorized/checkin/"+url.PathEscape(resID), s.Token(), nil, nil)
+}
+
+//Consume consumes a subresource of a resource checked out by the session
+func (s *Session) Consume(ctx context.Context, resID string, key string) error {
+	return s.client.do(ctx, http.MethodPut, "/session/authorized/checkout/"+url.PathEscape(resID)+"/"+url.PathEscape(key), s.Token(), nil, nil)
+}
+
+//Release releases a subresource consumed by the session
+func (s *Session) Release(ctx context.Context, resID string, key string) error {
+	return s.client.do(ctx, http.MethodPut, "/session/authorized/checkin/"+url.PathEscape(resID)+"/"+url.PathEscape(key), s.Token(), nil, nil)
+}
+
+//Report reports a resource checked out by the session as faulty, quarantining it until an operator restores it
+func (s *Session) Report(ctx context.Context, resID string, note string) (*Resource, error) {
+	resource := &Resource{}
+
+	return resource, s.client.do(ctx, http.MethodPost, "/session/authorized/report/"+url.PathEscape(resID), s.Token(), m.QuarantineRequest{Note: note}, resource)
+}
+
+//Document returns the session as stored by the library, with the resources and subresources it holds
+func (s *Session) Document(ctx context.Context) (*SessionDocument, error) {
+	return s.client.SessionDocument(ctx, s.ID)
+}
+
+//setToken stores a token along with the expiry from its claims and returns the session id it carries. The signature is verified by the library on every call
+func (s *Session) setToken(token string) (string, error) {
+	claims := jwt.MapClaims{}
+	_, _, err := new(jwt.Parser).ParseUnverified(strings.TrimPrefix(token, "Bearer "), claims)
+
+	id, _ := claims["id"].(string)
+	exp, _ := claims["exp"].(float64)
+
+	if err == nil && (id == "" || exp == 0) {
+		err = fmt.Errorf("library: session token carries no session id or expiry")
+	}
+
+	if err == nil {
+		s.mux.Lock()
+		now := time.Now()
+		s.token, s.expires = token, time.Unix(int64(exp), 0)
+		s.renewAt = now.Add(s.expires.Sub(now) * 2 / 3)
+		s.mux.Unlock()
+	}
+
+	return id, err
+}
+
+//close closes the session once, stopping the renewal
+//Args:	context of the request, reason reported by Err
+//Rets:	error of the request closing the session
+func (s *Session) close(ctx context.Context, reason error) error {
+	s.closeOnce.Do(func() {
+		s.mux.Lock()
+		if s.err == nil {
+			s.err = reason
+		}
+		s.mux.Unlock()
+
+		close(s.closed)
+		closed := &m.SessionClosed{}
+
+		if s.closeErr = s.client.do(ctx, http.MethodDelete, "/session/authorized", s.Token(), nil, closed); s.closeErr == nil {
+			s.mux.Lock()
+			s.summary = &closed.Summary
+			s.mux.Unlock()
+		}
+	})
+
+	return s.closeErr
+}
+
+//keepAlive renews the session until it is closed, and closes it once ctx is cancelled. A session the library no longer knows about, e.g. closed by an operator, stops the renewal; other failures are retried while the token is valid
+func (s *Session) keepAlive(ctx context.Context) {
+	timer := time.NewTimer(time.Until(s.nextRenewal()))
+
+	for running := true; running; {
+		select {
+		case <-ctx.Done():
+			closeCtx, cancel := context.WithTimeout(context.Background(), closeTimeout)
+			_ = s.close(closeCtx, ctx.Err())
+			cancel()
+			running = false
+		case <-s.closed:
+			running = false
+		case <-timer.C:
+			if err := s.Renew(ctx); err == nil {
+				timer.Reset(time.Until(s.nextRenewal()))
+			} else if ctx.Err() != nil {
+				//The session is closed on the next pass
+				timer.Reset(renewRetry)
+			} else if IsStatus(err, http.StatusNotFound) || IsStatus(err, http.StatusUnauthorized) || time.Now().Add(renewRetry).After(s.Expires()) {
+				s.mux.Lock()
+				s.err = err
+				s.mux.Unlock()
+				running = false
+			} else {
+				timer.Reset(renewRetry)
+			}
+		}
+	}
+
+	timer.Stop()
+	close(s.done)
+}
+
+//nextRenewal returns when the current token is renewed
+func (s *Session) nextRenewal() time.Time {
+	s.mux.Lock()
+	defer s.mux.Unlock()
+
+	return s.renewAt
+}
@@ -0,0 +1,210 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	m "library/internal/app/models"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+//fakeLibrary serves the session endpoints of the library, issuing tokens which run out after lifetime
+type fakeLibrary struct {
+	lifetime    time.Duration
+	renewStatus int  //Status of renewals; renewals succeed when 0
+	closeHangs  bool //Whether closing hangs until the request is cancelled
+
+	mux       sync.Mutex
+	token     string //Last token issued
+	issued    int
+	renewals  int
+	closes    int
+	staleAuth bool //Whether a request carried a token other than the last one issued
+}
+
+func (lib *fakeLibrary) issue() map[string]string {
+	lib.issued++
+	claims := jwt.MapClaims{"id": "5f19a22e5b40abf84d198e53", "exp": time.Now().Add(lib.lifetime).Unix(), "n": lib.issued}
+	signed, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte("test"))
+	lib.token = "Bearer " + signed
+
+	return map[string]string{"token": lib.token}
+}
+
+func (lib *fakeLibrary) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var status int
+	var response interface{}
+
+	lib.mux.Lock()
+	if r.Header.Get("Authorization") != "" && r.Header.Get("Authorization") != lib.token {
+		lib.staleAuth = true
+	}
+
+	switch r.Method + " " + r.URL.Path {
+	case "POST /v1/session":
+		status, response = http.StatusCreated, lib.issue()
+	case "PUT /v1/session/authorized":
+		lib.renewals++
+		if lib.renewStatus != 0 {
+			status, response = lib.renewStatus, map[string]string{"message": "session not found"}
+		} else {
+			status, response = http.StatusOK, lib.issue()
+		}
+	case "DELETE /v1/session/authorized":
+		lib.closes++
+		status, response = http.StatusOK, m.SessionClosed{Message: "session terminated", Summary: m.SessionSummary{Renewals: lib.renewals}}
+	default:
+		status, response = http.StatusNotFound, map[string]string{"message": "not found"}
+	}
+	hangs := lib.closeHangs && r.Method == http.MethodDelete
+	lib.mux.Unlock()
+
+	if hangs {
+		<-r.Context().Done()
+	} else {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_ = json.NewEncoder(w).Encode(response)
+	}
+}
+
+//counts returns the number of renewals and closes served so far
+func (lib *fakeLibrary) counts() (int, int) {
+	lib.mux.Lock()
+	defer lib.mux.Unlock()
+
+	return lib.renewals, lib.closes
+}
+
+//start serves a fake library and starts a session against it
+func start(t *testing.T, ctx context.Context, lib *fakeLibrary) (*Session, func()) {
+	server := httptest.NewServer(lib)
+
+	session, err := New(server.URL).StartSession(ctx, "apikey")
+	if err != nil {
+		server.Close()
+		t.Fatal("starting the session:", err)
+	}
+
+	return session, server.Close
+}
+
+//stops fails the test unless the renewal of a session stops within timeout
+func stops(t *testing.T, session *Session, timeout time.Duration) {
+	select {
+	case <-session.Done():
+	case <-time.After(timeout):
+		t.Fatal("session renewal didn't stop")
+	}
+}
+
+func TestSessionRenewsBeforeExpiry(t *testing.T) {
+	lib := &fakeLibrary{lifetime: 3 * time.Second}
+	session, stop := start(t, context.Background(), lib)
+	defer stop()
+
+	token, expires := session.Token(), session.Expires()
+
+	for renewals, _ := lib.counts(); renewals == 0; renewals, _ = lib.counts() {
+		if time.Now().After(expires) {
+			t.Fatal("token not renewed before it ran out")
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	if session.Token() == token || !session.Expires().After(expires) {
+		t.Errorf("renewal didn't replace the token: expires %v, was %v", session.Expires(), expires)
+	}
+
+	if err := session.Close(context.Background()); err != nil {
+		t.Fatal("closing the session:", err)
+	}
+
+	if session.Err() != ErrSessionClosed || session.Summary() == nil || session.Summary().Renewals < 1 {
+		t.Errorf("closed session: err %v, summary %+v", session.Err(), session.Summary())
+	}
+
+	lib.mux.Lock()
+	if lib.staleAuth {
+		t.Error("request sent with a replaced token")
+	}
+	lib.mux.Unlock()
+}
+
+func TestSessionClosesOnCancel(t *testing.T) {
+	lib := &fakeLibrary{lifetime: time.Hour}
+	ctx, cancel := context.WithCancel(context.Background())
+	session, stop := start(t, ctx, lib)
+	defer stop()
+
+	cancel()
+	stops(t, session, 5*time.Second)
+
+	if _, closes := lib.counts(); closes != 1 {
+		t.Errorf("session closed %d times, want once", closes)
+	}
+
+	if session.Err() != context.Canceled || session.Summary() == nil {
+		t.Errorf("session closed on cancel: err %v, summary %+v", session.Err(), session.Summary())
+	}
+
+	//Closing again returns the result of the first close
+	if err := session.Close(context.Background()); err != nil {
+		t.Error("closing a closed session:", err)
+	}
+
+	if _, closes := lib.counts(); closes != 1 {
+		t.Errorf("session closed %d times, want once", closes)
+	}
+}
+
+func TestSessionCloseTimeout(t *testing.T) {
+	defer func(timeout time.Duration) { closeTimeout = timeout }(closeTimeout)
+	closeTimeout = 200 * time.Millisecond
+
+	lib := &fakeLibrary{lifetime: time.Hour, closeHangs: true}
+	ctx, cancel := context.WithCancel(context.Background())
+	session, stop := start(t, ctx, lib)
+	defer stop()
+
+	//The close request is given up once closeTimeout passes
+	cancel()
+	stops(t, session, 5*time.Second)
+
+	if session.Err() != context.Canceled || session.Summary() != nil {
+		t.Errorf("session with a hanging close: err %v, summary %+v", session.Err(), session.Summary())
+	}
+
+	if err := session.Close(context.Background()); err == nil {
+		t.Error("close which timed out reported success")
+	}
+
+	if _, closes := lib.counts(); closes != 1 {
+		t.Errorf("session closed %d times, want once", closes)
+	}
+}
+
+func TestSessionStopsOnRejectedRenewal(t *testing.T) {
+	for _, status := range []int{http.StatusUnauthorized, http.StatusNotFound} {
+		lib := &fakeLibrary{lifetime: 2 * time.Second, renewStatus: status}
+		session, stop := start(t, context.Background(), lib)
+
+		stops(t, session, 5*time.Second)
+
+		if !IsStatus(session.Err(), status) {
+			t.Errorf("renewal rejected with %d: err %v", status, session.Err())
+		}
+
+		if renewals, closes := lib.counts(); renewals != 1 || closes != 0 {
+			t.Errorf("renewal rejected with %d: %d renewals and %d closes, want 1 and 0", status, renewals, closes)
+		}
+
+		stop()
+	}
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"library/internal/app/business"
+	m "library/internal/app/models"
+	"library/internal/pkg/lockutil"
+
+	"github.com/Kamva/mgm"
+	"github.com/dgrijalva/jwt-go"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+	Summary:
+		Checkout benchmark: measures the throughput of checkouts, subresource consumption and checkins
+		by concurrent sessions against a scratch database, with document locks and, for comparison,
+		with the whole collections locked as before documents had locks of their own
+
+	Usage:
+		go run ./scripts/checkoutbench -mongo mongodb://localhost:27017 -workers 1,8,32 -resources 32
+*/
+
+const signingKey = "checkoutbench"
+
+//result holds the measurements of a run
+type result struct {
+	locking    string
+	workers    int
+	operations int
+	elapsed    time.Duration
+	latencies  []time.Duration
+}
+
+func main() {
+	mongoURI := flag.String("mongo", "mongodb://localhost:27017", "MongoDB connection string")
+	dbName := flag.String("db", "library_checkoutbench", "scratch database, dropped before and after the run")
+	workerCounts := flag.String("workers", "1,8,32", "comma-separated numbers of concurrent sessions to run with")
+	resourceCount := flag.Int("resources", 32, "resources shared by the sessions; sessions contend for a resource when there are fewer resources than sessions")
+	duration := flag.Duration("duration", 10*time.Second, "length of each run")
+	flag.Parse()
+
+	if err := mgm.SetDefaultConfig(nil, *dbName, options.Client().ApplyURI(*mongoURI)); err != nil {
+		fmt.Println("error: invalid mongo configuration:", err)
+		os.Exit(1)
+	}
+
+	dropDatabase()
+	defer dropDatabase()
+
+	apiKey, resources, err := seed(*resourceCount)
+	if err != nil {
+		fmt.Println("error: seeding the scratch database:", err)
+		os.Exit(1)
+	}
+
+	fmt.Printf("%-10s %8s %10s %10s %10s %10s\n", "LOCKING", "WORKERS", "OPS", "OPS/S", "P50", "P99")
+
+	for _, count := range strings.Split(*workerCounts, ",") {
+		var workers int
+
+		if _, err = fmt.Sscan(count, &workers); err != nil || workers < 1 {
+			fmt.Println("error: invalid number of workers:", count)
+			os.Exit(1)
+		}
+
+		for _, coarse := range []bool{true, false} {
+			mux := lockutil.New()
+			mux.Coarse = coarse
+
+			r := run(mux, apiKey, resources, workers, *duration)
+			sort.Slice(r.latencies, func(i, j int) bool { return r.latencies[i] < r.latencies[j] })
+
+			fmt.Printf("%-10s %8d %10d %10.0f %10s %10s\n", r.locking, r.workers, r.operations,
+				float64(r.operations)/r.elapsed.Seconds(), percentile(r.latencies, 50), percentile(r.latencies, 99))
+		}
+	}
+}
+
+//dropDatabase removes the scratch database
+func dropDatabase() {
+	if _, _, db, err := mgm.DefaultConfigs(); err == nil {
+		_ = db.Drop(context.Background())
+	}
+}
+
+//seed creates a project and its resources, each with a subresource
+func seed(count int) (string, []string, error) {
+	var err error
+	var apiKey string
+	var resources []string
+	mux := lockutil.New()
+	fields := []m.Field{{Type: "subresource", Key: "slots", Value: float64(1 << 30)}}
+
+	code, response := business.CreateTemplateBusiness(&m.TemplateRequest{Name: "bench", Fields: fields}, mux)
+	if code != http.StatusCreated {
+		return "", nil, fmt.Errorf("template: %v", response)
+	}
+	template := response.(*m.Template).ID.Hex()
+
+	if code, response = business.CreateProjectBusiness(&m.ProjectRequest{Name: "bench"}, mux); code != http.StatusCreated {
+		return "", nil, fmt.Errorf("project: %v", response)
+	}
+	project := response.(*m.Project)
+	apiKey = project.APIKey
+
+	for i := 0; i < count && err == nil; i++ {
+		request := &m.ResourceRequest{
+			Name:       fmt.Sprintf("bench-%d", i),
+			TemplateID: template,
+			Projects:   []string{project.ID.Hex()},
+			Fields:     []m.Field{{Type: "subresource", Key: "slots", Value: float64(1 << 30)}},
+		}
+
+		if code, response = business.CreateResourceBusiness(request, mux); code != http.StatusCreated {
+			err = fmt.Errorf("resource: %v", response)
+		} else {
+			resources = append(resources, response.(*m.Resource).ID.Hex())
+		}
+	}
+
+	return apiKey, resources, err
+}
+
+//run lets the workers check resources out and in, each with a session of its own, for the duration of the run
+func run(mux *lockutil.Locks, apiKey string, resources []string, workers int, duration time.Duration) result {
+	var mutex sync.Mutex
+	wg := &sync.WaitGroup{}
+	r := result{locking: "document", workers: workers}
+
+	if mux.Coarse {
+		r.locking = "collection"
+	}
+
+	start := time.Now()
+	deadline := start.Add(duration)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+
+		go func(resID string) {
+			defer wg.Done()
+			latencies := []time.Duration{}
+			sessID := session(apiKey, mux)
+
+			for sessID != "" && time.Now().Before(deadline) {
+				began := time.Now()
+
+				//Sessions sharing a resource hold it at once, shared checkouts don't exclude each other
+				if code, _ := business.SessionResCheckoutBusiness(resID, sessID, nil, mux); code == http.StatusOK {
+					business.ConsumeSubResourceBusiness(sessID, resID, "slots", mux)
+					business.ReleaseSubResourceBusiness(sessID, resID, "slots", mux)
+					business.SessionResCheckinBusiness(sessID, resID, mux)
+					latencies = append(latencies, time.Since(began))
+				}
+			}
+
+			if sessID != "" {
+				business.CloseSessionBusiness(sessID, m.CloseExplicit, mux)
+			}
+
+			mutex.Lock()
+			r.latencies = append(r.latencies, latencies...)
+			mutex.Unlock()
+		}(resources[i%len(resources)])
+	}
+
+	wg.Wait()
+	r.elapsed = time.Since(start)
+	r.operations = len(r.latencies)
+
+	return r
+}
+
+//session starts a session and returns its id
+func session(apiKey string, mux *lockutil.Locks) string {
+	var sessID string
+
+	if code, response := business.CreateSessionBusiness(&m.SessionRequest{APIKey: apiKey}, 1, signingKey, mux); code == http.StatusOK {
+		bearer := strings.TrimPrefix(response.(map[string]string)["token"], "Bearer ")
+
+		if token, err := jwt.Parse(bearer, func(*jwt.Token) (interface{}, error) { return []byte(signingKey), nil }); err == nil {
+			sessID = token.Claims.(jwt.MapClaims)["id"].(string)
+		}
+	}
+
+	return sessID
+}
+
+//percentile returns the p-th percentile of sorted latencies
+func percentile(latencies []time.Duration, p int) time.Duration {
+	var latency time.Duration
+
+	if len(latencies) > 0 {
+		latency = latencies[(len(latencies)-1)*p/100].Round(time.Microsecond)
+	}
+
+	return latency
+}
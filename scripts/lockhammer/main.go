@@ -0,0 +1,303 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"runtime/pprof"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"library/internal/app/business"
+	m "library/internal/app/models"
+	"library/internal/pkg/lockutil"
+
+	"github.com/Kamva/mgm"
+	"github.com/dgrijalva/jwt-go"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+	Summary:
+		Lock hammer: runs the business functions of the library concurrently against a scratch database
+		through a single set of collection locks and fails when the operations stop making progress,
+		i.e. when two operations wait for each other's locks
+
+	Usage:
+		go run ./scripts/lockhammer -mongo mongodb://localhost:27017 -workers 32 -duration 1m
+*/
+
+const signingKey = "lockhammer"
+
+//hammer holds the shared state of the workers
+type hammer struct {
+	mux       *lockutil.Locks
+	template  string
+	projects  []string
+	apiKeys   []string
+	resources []string
+	pool      string
+	done      int64 //Completed operations
+}
+
+func main() {
+	mongoURI := flag.String("mongo", "mongodb://localhost:27017", "MongoDB connection string")
+	dbName := flag.String("db", "library_lockhammer", "scratch database, dropped before and after the run")
+	workers := flag.Int("workers", 16, "concurrent workers")
+	duration := flag.Duration("duration", 30*time.Second, "length of the run")
+	stall := flag.Duration("stall", 10*time.Second, "time without any completed operation after which the run fails")
+	flag.Parse()
+
+	if err := mgm.SetDefaultConfig(nil, *dbName, options.Client().ApplyURI(*mongoURI)); err != nil {
+		fmt.Println("error: invalid mongo configuration:", err)
+		os.Exit(1)
+	}
+
+	dropDatabase()
+	defer dropDatabase()
+
+	h := &hammer{mux: lockutil.New()}
+
+	if err := h.seed(); err != nil {
+		fmt.Println("error: seeding the scratch database:", err)
+		os.Exit(1)
+	}
+
+	stop := make(chan struct{})
+	finished := make(chan struct{})
+	wg := &sync.WaitGroup{}
+
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		go h.work(rand.New(rand.NewSource(int64(i))), stop, wg)
+	}
+
+	go func() {
+		wg.Wait()
+		close(finished)
+	}()
+
+	//Watchdog: the run fails if no operation completes within the stall timeout
+	deadline := time.After(*duration)
+	ticker := time.NewTicker(*stall)
+	defer ticker.Stop()
+	last := int64(0)
+
+	for running := true; running; {
+		select {
+		case <-deadline:
+			close(stop)
+			deadline = nil
+		case <-finished:
+			running = false
+		case <-ticker.C:
+			done := atomic.LoadInt64(&h.done)
+			if done == last {
+				fmt.Printf("error: no operation completed in %s, goroutines:\n", *stall)
+				pprof.Lookup("goroutine").WriteTo(os.Stdout, 1)
+				dropDatabase()
+				os.Exit(1)
+			}
+			fmt.Printf("%d operations\n", done)
+			last = done
+		}
+	}
+
+	fmt.Printf("ok: %d operations by %d workers without a stall\n", atomic.LoadInt64(&h.done), *workers)
+}
+
+//dropDatabase removes the scratch database
+func dropDatabase() {
+	if _, _, db, err := mgm.DefaultConfigs(); err == nil {
+		_ = db.Drop(context.Background())
+	}
+}
+
+//seed creates the template, projects, resources and pool the workers operate on
+func (h *hammer) seed() error {
+	var err error
+
+	code, response := business.CreateTemplateBusiness(&m.TemplateRequest{Name: "phone", Fields: []m.Field{}}, h.mux)
+	if code != http.StatusCreated {
+		return fmt.Errorf("template: %v", response)
+	}
+	h.template = response.(*m.Template).ID.Hex()
+
+	for i := 0; i < 4 && err == nil; i++ {
+		if code, response = business.CreateProjectBusiness(&m.ProjectRequest{Name: fmt.Sprintf("project-%d", i)}, h.mux); code != http.StatusCreated {
+			err = fmt.Errorf("project: %v", response)
+		} else {
+			h.projects = append(h.projects, response.(*m.Project).ID.Hex())
+			h.apiKeys = append(h.apiKeys, response.(*m.Project).APIKey)
+		}
+	}
+
+	for i := 0; i < 12 && err == nil; i++ {
+		request := &m.ResourceRequest{
+			Name:       fmt.Sprintf("phone-%d", i),
+			TemplateID: h.template,
+			Projects:   []string{h.projects[i%len(h.projects)]},
+			Fields:     []m.Field{},
+			Labels:     []m.Label{{Key: "region", Value: []string{"eu", "us"}[i%2]}},
+		}
+
+		if code, response = business.CreateResourceBusiness(request, h.mux); code != http.StatusCreated {
+			err = fmt.Errorf("resource: %v", response)
+		} else {
+			h.resources = append(h.resources, response.(*m.Resource).ID.Hex())
+		}
+	}
+
+	if err == nil {
+		request := &m.PoolRequest{Name: "lab", Selector: "region", Projects: h.projects}
+
+		if code, response = business.CreatePoolBusiness(request, h.mux); code != http.StatusCreated {
+			err = fmt.Errorf("pool: %v", response)
+		} else {
+			h.pool = response.(*m.Pool).ID.Hex()
+		}
+	}
+
+	return err
+}
+
+//work runs random operations until the run is stopped
+func (h *hammer) work(random *rand.Rand, stop chan struct{}, wg *sync.WaitGroup) {
+	defer wg.Done()
+
+	operations := []func(*rand.Rand){
+		h.resourceLifecycle,
+		h.projectLifecycle,
+		h.sessionCheckout,
+		h.poolCheckout,
+		h.reservation,
+		h.migrateTemplate,
+		h.projectResources,
+		h.quarantine,
+	}
+
+	for {
+		select {
+		case <-stop:
+			return
+		default:
+			operations[random.Intn(len(operations))](random)
+			atomic.AddInt64(&h.done, 1)
+		}
+	}
+}
+
+//resourceLifecycle creates, updates and deletes a resource of a project
+func (h *hammer) resourceLifecycle(random *rand.Rand) {
+	request := &m.ResourceRequest{
+		Name:       fmt.Sprintf("tmp-%d", random.Int63()),
+		TemplateID: h.template,
+		Projects:   []string{h.projects[random.Intn(len(h.projects))]},
+		Fields:     []m.Field{},
+	}
+
+	if code, response := business.CreateResourceBusiness(request, h.mux); code == http.StatusCreated {
+		resID := response.(*m.Resource).ID.Hex()
+		update := &m.ResourceUpdateRequest{Name: request.Name, Description: "updated", Projects: request.Projects, Fields: []m.Field{}, Active: true}
+
+		business.UpdateResourceBusiness(resID, update, "", h.mux)
+		business.DeleteResourceBusiness(resID, "", h.mux)
+	}
+}
+
+//projectLifecycle creates a project, associates a resource with it and deletes it
+func (h *hammer) projectLifecycle(random *rand.Rand) {
+	if code, response := business.CreateProjectBusiness(&m.ProjectRequest{Name: fmt.Sprintf("tmp-%d", random.Int63())}, h.mux); code == http.StatusCreated {
+		projID := response.(*m.Project).ID.Hex()
+		request := &m.ResourceRequest{
+			Name:       fmt.Sprintf("tmp-%d", random.Int63()),
+			TemplateID: h.template,
+			Projects:   []string{projID},
+			Fields:     []m.Field{},
+		}
+
+		business.CreateResourceBusiness(request, h.mux)
+		business.UpdateAPIKeyBusiness(projID, "", h.mux)
+		business.DeleteProjectBusiness(projID, "", h.mux)
+	}
+}
+
+//session starts a session of a random seeded project and returns its id
+func (h *hammer) session(random *rand.Rand) string {
+	var sessID string
+	request := &m.SessionRequest{APIKey: h.apiKeys[random.Intn(len(h.apiKeys))], Metadata: m.SessionMetadata{Runner: "lockhammer"}}
+
+	if code, response := business.CreateSessionBusiness(request, 1, signingKey, h.mux); code == http.StatusOK {
+		bearer := strings.TrimPrefix(response.(map[string]string)["token"], "Bearer ")
+
+		if token, err := jwt.Parse(bearer, func(*jwt.Token) (interface{}, error) { return []byte(signingKey), nil }); err == nil {
+			sessID = token.Claims.(jwt.MapClaims)["id"].(string)
+		}
+	}
+
+	return sessID
+}
+
+//sessionCheckout checks random resources out and in within a session and closes it
+func (h *hammer) sessionCheckout(random *rand.Rand) {
+	if sessID := h.session(random); sessID != "" {
+		for i := 0; i < 3; i++ {
+			resID := h.resources[random.Intn(len(h.resources))]
+
+			if code, _ := business.SessionResCheckoutBusiness(resID, sessID, nil, h.mux); code == http.StatusOK && random.Intn(2) == 0 {
+				business.SessionResCheckinBusiness(sessID, resID, h.mux)
+			}
+		}
+
+		business.CloseSessionBusiness(sessID, m.CloseExplicit, h.mux)
+	}
+}
+
+//poolCheckout checks out members of the pool within a session and closes it
+func (h *hammer) poolCheckout(random *rand.Rand) {
+	if sessID := h.session(random); sessID != "" {
+		mode := []string{m.ModeShared, m.ModeExclusive}[random.Intn(2)]
+
+		business.PoolCheckoutBusiness(sessID, h.pool, "region=eu", mode, nil, h.mux)
+		business.PoolCheckoutBusiness(sessID, h.pool, "", mode, nil, h.mux)
+		business.CloseSessionBusiness(sessID, m.CloseExplicit, h.mux)
+	}
+}
+
+//reservation reserves a resource for a project and cancels the reservation
+func (h *hammer) reservation(random *rand.Rand) {
+	start := time.Now().Add(time.Duration(random.Intn(48)) * time.Hour)
+	request := &m.ReservationRequest{
+		ResourceID: h.resources[random.Intn(len(h.resources))],
+		Project:    h.projects[random.Intn(len(h.projects))],
+		Start:      start,
+		End:        start.Add(time.Hour),
+	}
+
+	if code, response := business.CreateReservationBusiness(request, h.mux); code == http.StatusCreated {
+		business.DeleteReservationBusiness(response.(*m.Reservation).ID.Hex(), h.mux)
+	}
+}
+
+//migrateTemplate migrates the resources of the seeded template
+func (h *hammer) migrateTemplate(random *rand.Rand) {
+	business.MigrateTemplateBusiness(h.template, &m.TemplateMigrationRequest{}, h.mux)
+}
+
+//projectResources lists the resources of a project
+func (h *hammer) projectResources(random *rand.Rand) {
+	business.ShowResourcesByPrjBusiness(h.projects[random.Intn(len(h.projects))], &m.ListRequest{}, nil, h.mux)
+}
+
+//quarantine quarantines a resource and restores it
+func (h *hammer) quarantine(random *rand.Rand) {
+	resID := h.resources[random.Intn(len(h.resources))]
+
+	business.QuarantineResourceBusiness(resID, &m.QuarantineRequest{Note: "lockhammer"}, h.mux)
+	business.RestoreResourceBusiness(resID, &m.QuarantineRequest{Note: "lockhammer"}, h.mux)
+}
@@ -0,0 +1,471 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"library/internal/app/business"
+	m "library/internal/app/models"
+	"library/internal/pkg/leaseutil"
+	"library/internal/pkg/lockutil"
+
+	"github.com/Kamva/mgm"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+/*
+	Summary:
+		Replica test: builds the library and runs several servers on this machine against a scratch database,
+		which is dropped before and after the run, and fails unless they behave as a single server:
+		tokens issued by one replica are accepted by the others, sessions checking resources out and
+		consuming their subresources through random replicas leave consistent counters behind, a single
+		replica holds the worker lease, and another one takes it over and expires sessions once it is killed
+
+	Usage:
+		go run ./scripts/replicas -mongo mongodb://localhost:27017 -replicas 3 -workers 16 -duration 20s
+
+		Run from the root of the repository, the servers read their views from it
+*/
+
+const initialSlots = 1 << 20
+
+//replica is a server process of the test
+type replica struct {
+	cmd  *exec.Cmd
+	base string //URL of the API
+	log  string //Log file
+	id   string //Replica id, read from the log
+}
+
+//harness holds the state of the test
+type harness struct {
+	replicas  []*replica
+	apiKey    string
+	resources []string
+	done      int64 //Completed session cycles
+	failed    int64 //Requests with an unexpected status
+}
+
+func main() {
+	mongoURI := flag.String("mongo", "mongodb://localhost:27017", "MongoDB connection string")
+	dbName := flag.String("db", "library_replicas", "scratch database, dropped before and after the run")
+	count := flag.Int("replicas", 3, "servers to run")
+	port := flag.Int("port", 18800, "port of the first server, the others listen on the following ports")
+	workers := flag.Int("workers", 16, "concurrent sessions")
+	resourceCount := flag.Int("resources", 4, "resources shared by the sessions")
+	duration := flag.Duration("duration", 20*time.Second, "length of the concurrent run")
+	replicated := flag.Bool("replicated", true, "take locks in the database; without, the counters are expected to drift")
+	flag.Parse()
+
+	if err := mgm.SetDefaultConfig(nil, *dbName, options.Client().ApplyURI(*mongoURI)); err != nil {
+		fmt.Println("error: invalid mongo configuration:", err)
+		os.Exit(1)
+	}
+
+	dropDatabase()
+
+	dir, err := ioutil.TempDir("", "library-replicas")
+	if err != nil {
+		fmt.Println("error: creating a working directory:", err)
+		os.Exit(1)
+	}
+
+	h := &harness{}
+
+	//Replicas are killed and the scratch database dropped whatever the outcome
+	fail := func(format string, args ...interface{}) {
+		fmt.Printf("error: "+format+"\n", args...)
+		h.stop()
+		dropDatabase()
+		os.Exit(1)
+	}
+
+	if err = h.seed(*resourceCount); err != nil {
+		fail("seeding the scratch database: %s", err)
+	}
+
+	fmt.Println("building the library")
+	binary := filepath.Join(dir, "library")
+	if out, err := exec.Command("go", "build", "-o", binary, ".").CombinedOutput(); err != nil {
+		fail("building the library: %s\n%s", err, out)
+	}
+
+	for i := 0; i < *count; i++ {
+		if err = h.start(binary, dir, i, *port+i, *mongoURI, *dbName, *replicated); err != nil {
+			fail("starting replica %d: %s", i, err)
+		}
+	}
+	fmt.Printf("%d replicas running\n", *count)
+
+	if err = h.sharedKey(); err != nil {
+		fail("signing key: %s", err)
+	}
+	fmt.Println("ok: tokens are accepted by every replica")
+
+	h.run(*workers, *duration)
+	if failed := atomic.LoadInt64(&h.failed); failed > 0 {
+		fail("%d requests failed", failed)
+	} else if err = h.consistent(); err != nil {
+		fail("after %d session cycles: %s", atomic.LoadInt64(&h.done), err)
+	}
+	fmt.Printf("ok: %d session cycles by %d sessions through %d replicas left consistent counters\n", atomic.LoadInt64(&h.done), *workers, *count)
+
+	if err = h.failover(); err != nil {
+		fail("worker: %s", err)
+	}
+
+	h.stop()
+	dropDatabase()
+	_ = os.RemoveAll(dir)
+	fmt.Println("ok")
+}
+
+//dropDatabase removes the scratch database
+func dropDatabase() {
+	if _, _, db, err := mgm.DefaultConfigs(); err == nil {
+		_ = db.Drop(context.Background())
+	}
+}
+
+//seed creates a project and its resources, each with a subresource, before the replicas start
+func (h *harness) seed(count int) error {
+	var err error
+	mux := lockutil.New()
+	fields := []m.Field{{Type: "subresource", Key: "slots", Value: float64(initialSlots)}}
+
+	code, response := business.CreateTemplateBusiness(&m.TemplateRequest{Name: "replicas", Fields: fields}, mux)
+	if code != http.StatusCreated {
+		return fmt.Errorf("template: %v", response)
+	}
+	template := response.(*m.Template).ID.Hex()
+
+	if code, response = business.CreateProjectBusiness(&m.ProjectRequest{Name: "replicas"}, mux); code != http.StatusCreated {
+		return fmt.Errorf("project: %v", response)
+	}
+	project := response.(*m.Project)
+	h.apiKey = project.APIKey
+
+	for i := 0; i < count && err == nil; i++ {
+		request := &m.ResourceRequest{
+			Name:       fmt.Sprintf("replicas-%d", i),
+			TemplateID: template,
+			Projects:   []string{project.ID.Hex()},
+			Fields:     []m.Field{{Type: "subresource", Key: "slots", Value: float64(initialSlots)}},
+		}
+
+		if code, response = business.CreateResourceBusiness(request, mux); code != http.StatusCreated {
+			err = fmt.Errorf("resource: %v", response)
+		} else {
+			h.resources = append(h.resources, response.(*m.Resource).ID.Hex())
+		}
+	}
+
+	return err
+}
+
+//start runs a server with a configuration of its own and waits until it serves requests
+func (h *harness) start(binary string, dir string, i int, port int, mongoURI string, dbName string, replicated bool) error {
+	var err error
+	r := &replica{
+		base: fmt.Sprintf("http://localhost:%d", port),
+		log:  filepath.Join(dir, fmt.Sprintf("replica-%d.log", i)),
+	}
+	conf := filepath.Join(dir, fmt.Sprintf("replica-%d.toml", i))
+	settings := fmt.Sprintf("port = %d\nrunmode = \"dev\"\nsessext = 1\ndbname = %q\nlogfile = %q\nmongouri = %q\nreplicated = %t\n", port, dbName, r.log, mongoURI, replicated)
+
+	if err = ioutil.WriteFile(conf, []byte(settings), 0600); err == nil {
+		r.cmd = exec.Command(binary)
+		r.cmd.Env = append(os.Environ(), "LIBRARY_CONF="+conf)
+		err = r.cmd.Start()
+	}
+
+	if err == nil {
+		h.replicas = append(h.replicas, r)
+		err = fmt.Errorf("not serving requests, see %s", r.log)
+
+		for deadline := time.Now().Add(30 * time.Second); time.Now().Before(deadline); time.Sleep(200 * time.Millisecond) {
+			if code, _ := r.call(http.MethodGet, "/project", "", nil, nil); code == http.StatusOK {
+				r.id = replicaID(r.log)
+				err = nil
+				break
+			}
+		}
+	}
+
+	return err
+}
+
+//replicaID reads the id a replica logged at startup
+func replicaID(logFile string) string {
+	var id string
+
+	if file, err := os.Open(logFile); err == nil {
+		scanner := bufio.NewScanner(file)
+
+		for scanner.Scan() {
+			if i := strings.Index(scanner.Text(), "starting replica "); i >= 0 {
+				id = strings.TrimSpace(scanner.Text()[i+len("starting replica "):])
+			}
+		}
+
+		file.Close()
+	}
+
+	return id
+}
+
+//stop kills the replicas still running
+func (h *harness) stop() {
+	for _, r := range h.replicas {
+		if r.cmd != nil && r.cmd.Process != nil {
+			_ = r.cmd.Process.Kill()
+			_ = r.cmd.Wait()
+			r.cmd = nil
+		}
+	}
+}
+
+//call sends a request to the API of a replica and decodes the response into out, unless out is nil
+func (r *replica) call(method string, path string, token string, body interface{}, out interface{}) (int, error) {
+	var code int
+	var err error
+	var req *http.Request
+	var resp *http.Response
+	data := []byte{}
+
+	if body != nil {
+		data, _ = json.Marshal(body)
+	}
+
+	if req, err = http.NewRequest(method, r.base+"/v1"+path, bytes.NewReader(data)); err == nil {
+		req.Header.Set("Content-Type", "application/json")
+
+		if token != "" {
+			req.Header.Set("Authorization", token)
+		}
+
+		if resp, err = http.DefaultClient.Do(req); err == nil {
+			code = resp.StatusCode
+
+			if data, err = ioutil.ReadAll(resp.Body); err == nil && out != nil {
+				err = json.Unmarshal(data, out)
+			}
+
+			resp.Body.Close()
+		}
+	}
+
+	return code, err
+}
+
+//session starts a session through a replica and returns its token
+func (h *harness) session(r *replica) (string, error) {
+	created := map[string]string{}
+
+	code, err := r.call(http.MethodPost, "/session", "", m.SessionRequest{APIKey: h.apiKey}, &created)
+	if err == nil && code != http.StatusOK {
+		err = fmt.Errorf("starting a session through %s: %d", r.base, code)
+	}
+
+	return created["token"], err
+}
+
+//sharedKey starts a session through each replica and renews and closes it through the others
+func (h *harness) sharedKey() error {
+	var err error
+
+	for i := 0; i < len(h.replicas) && err == nil; i++ {
+		var token string
+		next := h.replicas[(i+1)%len(h.replicas)]
+		renewed := map[string]string{}
+
+		if token, err = h.session(h.replicas[i]); err == nil {
+			if code, _ := next.call(http.MethodPut, "/session/authorized", token, nil, &renewed); code != http.StatusOK {
+				err = fmt.Errorf("token issued by %s rejected by %s: %d", h.replicas[i].base, next.base, code)
+			} else if code, _ = h.replicas[i].call(http.MethodDelete, "/session/authorized", renewed["token"], nil, nil); code != http.StatusOK {
+				err = fmt.Errorf("token renewed by %s rejected by %s: %d", next.base, h.replicas[i].base, code)
+			}
+		}
+	}
+
+	return err
+}
+
+//run lets the workers start sessions, check resources out, consume and release their subresources, check them in and close the sessions, each request through a random replica
+func (h *harness) run(workers int, duration time.Duration) {
+	wg := &sync.WaitGroup{}
+	deadline := time.Now().Add(duration)
+
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+
+		go func(random *rand.Rand) {
+			defer wg.Done()
+
+			for time.Now().Before(deadline) {
+				h.cycle(random)
+			}
+		}(rand.New(rand.NewSource(int64(i))))
+	}
+
+	for running := true; running; {
+		select {
+		case <-time.After(5 * time.Second):
+			fmt.Printf("%d session cycles\n", atomic.LoadInt64(&h.done))
+		case <-wait(wg):
+			running = false
+		}
+	}
+}
+
+//wait returns a channel closed once the wait group is done
+func wait(wg *sync.WaitGroup) chan struct{} {
+	done := make(chan struct{})
+
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	return done
+}
+
+//cycle runs a single session through random replicas, counting the requests which fail
+func (h *harness) cycle(random *rand.Rand) {
+	pick := func() *replica { return h.replicas[random.Intn(len(h.replicas))] }
+	resID := h.resources[random.Intn(len(h.resources))]
+	expect := func(r *replica, method string, path string, token string) {
+		if code, err := r.call(method, path, token, nil, nil); err != nil || code != http.StatusOK {
+			fmt.Printf("%s %s through %s: %d %v\n", method, path, r.base, code, err)
+			atomic.AddInt64(&h.failed, 1)
+		}
+	}
+
+	token, err := h.session(pick())
+	if err != nil {
+		fmt.Println(err)
+		atomic.AddInt64(&h.failed, 1)
+		return
+	}
+
+	expect(pick(), http.MethodPut, "/session/authorized/checkout/"+resID, token)
+
+	//Sessions are left holding some of the subresources they consume, checkins return them
+	for i := random.Intn(3) + 1; i > 0; i-- {
+		expect(pick(), http.MethodPut, "/session/authorized/checkout/"+resID+"/slots", token)
+	}
+	expect(pick(), http.MethodPut, "/session/authorized/checkin/"+resID+"/slots", token)
+
+	if random.Intn(2) == 0 {
+		expect(pick(), http.MethodPut, "/session/authorized/checkin/"+resID, token)
+	}
+
+	expect(pick(), http.MethodDelete, "/session/authorized", token)
+	atomic.AddInt64(&h.done, 1)
+}
+
+//consistent checks that every session is closed and every resource is back to its initial state
+func (h *harness) consistent() error {
+	var err error
+	open := []m.Session{}
+
+	if err = mgm.Coll(&m.Session{}).SimpleFind(&open, bson.M{}); err == nil && len(open) > 0 {
+		err = fmt.Errorf("%d sessions left open", len(open))
+	}
+
+	for i := 0; i < len(h.resources) && err == nil; i++ {
+		resource := &m.Resource{}
+
+		if err = mgm.Coll(resource).FindByID(h.resources[i], resource); err == nil {
+			if resource.CheckedOut != 0 {
+				err = fmt.Errorf("resource %s checked out %d times", resource.Name, resource.CheckedOut)
+			} else if slots := fmt.Sprint(resource.Fields[0].Value); slots != fmt.Sprint(initialSlots) {
+				err = fmt.Errorf("resource %s has %s slots instead of %d", resource.Name, slots, initialSlots)
+			}
+		}
+	}
+
+	return err
+}
+
+//failover checks that a single replica holds the worker lease, kills it and checks that another replica takes the lease over and expires sessions
+func (h *harness) failover() error {
+	var err error
+	var leader *replica
+	var token string
+	holder := leaseutil.Holder("worker")
+
+	for _, r := range h.replicas {
+		if r.id == holder {
+			leader = r
+		}
+	}
+
+	if leader == nil {
+		return fmt.Errorf("worker lease held by %q, not by a replica", holder)
+	}
+	fmt.Printf("ok: worker lease held by %s (%s)\n", leader.base, holder)
+
+	_ = leader.cmd.Process.Kill()
+	_ = leader.cmd.Wait()
+	leader.cmd = nil
+
+	//The lease runs out 10 seconds after its last renewal
+	err = fmt.Errorf("worker lease not taken over")
+	for deadline := time.Now().Add(20 * time.Second); time.Now().Before(deadline); time.Sleep(500 * time.Millisecond) {
+		if holder = leaseutil.Holder("worker"); holder != "" && holder != leader.id {
+			err = nil
+			break
+		}
+	}
+
+	if err == nil {
+		fmt.Printf("ok: worker lease taken over by %s\n", holder)
+
+		for _, r := range h.replicas {
+			if r != leader && token == "" {
+				token, err = h.session(r)
+			}
+		}
+	}
+
+	//Letting the session run out by moving its expiry to the past
+	if err == nil {
+		session := &m.Session{}
+
+		if err = mgm.Coll(session).First(bson.M{}, session); err == nil {
+			if _, err = mgm.Coll(session).UpdateOne(context.Background(), bson.M{"_id": session.ID}, bson.M{"$set": bson.M{"expires": time.Now().UTC().Add(-time.Second)}, "$inc": bson.M{"revision": 1}}); err == nil {
+				err = fmt.Errorf("session %s not expired", session.ID.Hex())
+				closed := &m.ClosedSession{}
+
+				for deadline := time.Now().Add(10 * time.Second); time.Now().Before(deadline); time.Sleep(500 * time.Millisecond) {
+					if mgm.Coll(closed).First(bson.M{"sessionid": session.ID.Hex()}, closed) == nil && closed.Reason == m.CloseExpired {
+						err = nil
+						break
+					}
+				}
+			}
+		}
+	}
+
+	if err == nil {
+		fmt.Println("ok: the new worker expires sessions")
+	}
+
+	return err
+}